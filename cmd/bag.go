@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Constants: Help Text
+
+const (
+	usageBag = "bag"
+
+	shortDescBag = "bag: work with BagIt bags stored in cloud object storage"
+
+	longDescBag = shortDescBag + `
+
+		Commands for working with BagIt bags (see RFC 8493) stored as the objects
+		under a prefix in a bucket or container.
+	`
+
+	usageBagValidate = "validate <PREFIX-URL>"
+
+	shortDescBagValidate = "validate: validate a BagIt bag stored in cloud object storage"
+
+	longDescBagValidate = shortDescBagValidate + `
+
+		Validates a BagIt bag stored as the objects under the specified prefix.
+		Checks that bagit.txt declares the BagIt version and UTF-8 tag file
+		encoding; that the payload size and file count match the Payload-Oxum in
+		bag-info.txt, if present; and that the files in the payload directory are
+		exactly those listed in each payload manifest. Then streams each payload
+		file, and each tag file listed in a tag manifest, verifying its digest
+		for every manifest algorithm from a single download.
+
+		As with the check command, files (and the manifests themselves) are
+		streamed in chunks and never stored locally, so bags of arbitrary size
+		can be validated without local disk space. Several files (by default, 4)
+		are verified at once; use --workers to adjust this.
+
+		A line is written for each file listed in the manifests, in manifest
+		order, with its status (PASS, FAIL, MISSING, or ERROR), followed by a
+		line for each extra payload file not listed in any manifest (EXTRA), and
+		by any other problems found. If the bag is not valid, cos exits with an
+		error.
+	`
+
+	exampleBagValidate = `
+		cos bag validate s3://mrt-test/bags/fk4kw5kc1z/ --endpoint http://127.0.0.1:9000/
+		cos bag validate file:///mnt/nas/bags/fk4kw5kc1z/ --workers 16
+		cos bag validate 'swift://distrib.stage.9001.__c5e/bags/fk4kw5kc1z/' -e http://cloud.sdsc.edu/auth/v1.0
+	`
+)
+
+// ------------------------------------------------------------
+// bagValidateFlags type
+
+type bagValidateFlags struct {
+	CosFlags
+
+	Workers     int
+	Concurrency int
+	Stream      bool
+}
+
+func (f bagValidateFlags) Pretty() string {
+	format := `
+		workers: %d
+		concurrency: %d
+		stream: %v
+		endpoint: '%v'
+		region: '%v'
+		log level: %v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.Workers, f.Concurrency, f.Stream, f.Endpoint, f.Region, f.LogLevel())
+}
+
+func (f bagValidateFlags) String() string {
+	return fmt.Sprintf(
+		"bagValidateFlags{ workers: %d, concurrency: %d, stream: %v, endpoint: '%v', region: '%v', log level: %v }",
+		f.Workers, f.Concurrency, f.Stream, f.Endpoint, f.Region, f.LogLevel(),
+	)
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func bagValidate(prefixURLStr string, f bagValidateFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+	logger.Tracef("prefix URL: %v\n", prefixURLStr)
+
+	target, prefix, err := f.TargetAndPrefix(prefixURLStr)
+	if err != nil {
+		return err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	logger.Tracef("target: %v\n", target)
+	logger.Tracef("prefix: %#v\n", prefix)
+
+	validation := pkg.BagValidation{
+		Target:      target,
+		Prefix:      prefix,
+		Workers:     f.Workers,
+		Concurrency: f.Concurrency,
+		Stream:      f.Stream,
+	}
+	summary, err := validation.Validate(func(result pkg.ManifestResult) {
+		status := strings.ToUpper(result.Status)
+		switch result.Status {
+		case pkg.ManifestError:
+			fmt.Printf("%-7v %v: %v\n", status, result.Entry.Path, result.Err)
+		case pkg.ManifestFail:
+			fmt.Printf("%-7v %v\n", status, result.Entry.Path)
+			logger.Detailf("%v\n", result.Err)
+		default:
+			fmt.Printf("%-7v %v\n", status, result.Entry.Path)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if summary.Version != "" {
+		logger.Detailf("BagIt version %v\n", summary.Version)
+	}
+	for _, problem := range summary.Problems {
+		fmt.Printf("%-7v %v\n", "INVALID", problem)
+	}
+	fmt.Println(summary)
+	if !summary.Valid() {
+		return fmt.Errorf("bag %v is not valid", prefixURLStr)
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := bagValidateFlags{}
+
+	validateCmd := &cobra.Command{
+		Use:     usageBagValidate,
+		Short:   shortDescBagValidate,
+		Long:    logging.Untabify(longDescBagValidate, ""),
+		Args:    cobra.ExactArgs(1),
+		Example: logging.Untabify(exampleBagValidate, "  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return bagValidate(args[0], flags)
+		},
+	}
+	cmdFlags := validateCmd.Flags()
+	flags.AddTo(cmdFlags)
+
+	cmdFlags.IntVarP(&flags.Workers, "workers", "w", pkg.DefaultManifestWorkers, "number of files to verify at once")
+	cmdFlags.IntVarP(&flags.Concurrency, "concurrency", "c", objects.DefaultDownloadConcurrency, "number of chunks of each file to download at once")
+	cmdFlags.BoolVar(&flags.Stream, "stream", false, "download each file with a single streaming request where supported")
+
+	cmd := &cobra.Command{
+		Use:   usageBag,
+		Short: shortDescBag,
+		Long:  logging.Untabify(longDescBag, ""),
+	}
+	cmd.AddCommand(validateCmd)
+
+	rootCmd.AddCommand(cmd)
+}
@@ -2,13 +2,14 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/dmolesUC3/cos/internal/objects"
 
 	"github.com/dmolesUC3/cos/pkg"
 
 	"github.com/dmolesUC3/cos/internal/logging"
-	"github.com/dmolesUC3/cos/internal/streaming"
 
 	"github.com/spf13/cobra"
 )
@@ -17,26 +18,73 @@ import (
 // Constants: Help Text
 
 const (
-	usageCheck = "check <OBJECT-URL>"
+	usageCheck = "check [--manifest FILE] <OBJECT-URL | BUCKET-URL[/PREFIX]>"
 
 	shortDescCheck = "check: verify the digest of an object"
 
 	longDescCheck = shortDescCheck + `
 
 	Verifies the digest of an object in cloud object storage, using SHA-256 (by
-	default) or MD5 (optionally). 
+	default) or any combination of MD5, SHA-1, SHA-256, SHA-512, CRC-32C, and
+	BLAKE2b-512, given as a comma-separated list (e.g. "sha256,md5"). All
+	digests are computed from a single download.
+
+	Expected digests are given as [ALGORITHM:]HEX, e.g. "md5:cadf871c...";
+	the algorithm may be omitted if only one is being computed. Use
+	--expected once for each algorithm to be verified.
 
 	The object is streamed in five-megabyte chunks, each chunk
 	being added to the digest computation and then discarded, thus
 	making it possible to verify objects of arbitary size, not
 	limited by local storage space.
 
+	Several chunks (by default, 4) are downloaded at once, ahead of the
+	digest computation; use --concurrency to adjust this. Each chunk in
+	flight holds five megabytes of memory.
+
+	With --etag, the object's S3 ETag is also recomputed from the streamed
+	content and compared with the ETag reported by the server. For objects
+	uploaded in a single part, this is the MD5 digest of the content; for
+	multipart uploads, it is the MD5 digest of the MD5 digests of the parts,
+	which depends on the part size used by the uploading client. The part size
+	may be given with --part-size; otherwise, cos tries the part size it would
+	use itself, those of common S3 clients, and the smallest whole number of
+	megabytes consistent with the object's length and number of parts.
+
+	With --checkpoint, the progress of the digest computation (the
+	intermediate state of each digest, and the number of bytes processed) is
+	saved to the specified file every 30 seconds (adjustable with
+	--checkpoint-interval), and when a download fails. If the file exists
+	when check is run again, the computation resumes from the saved offset,
+	after verifying that the object's ETag, length, and last-modified time
+	have not changed. The file is removed once the check is complete.
+
+	With --manifest, verifies every object listed in a manifest file instead
+	of a single object. The manifest may be in the format written by
+	sha256sum, md5sum, etc., or a BagIt payload manifest (manifest-sha256.txt
+	etc.); paths in the manifest are relative to the bucket URL, including
+	any prefix. The algorithm is taken from the name of a BagIt manifest, or
+	otherwise inferred from the length of the digests, unless given with
+	--algorithm. Several objects (by default, 4) are verified at once; use
+	--workers to adjust this. A line is written for each object, in manifest
+	order, with its status (PASS, FAIL, MISSING, or ERROR), followed by a
+	summary; if any object does not pass, cos exits with an error.
+
 	`
 
 	exampleCheck = ` 
 	cos check s3://www.dmoles.net/images/fa/archive.svg --endpoint https://s3.us-west-2.amazonaws.com/
 	cos check s3://www.dmoles.net/images/fa/archive.svg -e https://s3.us-west-2.amazonaws.com/ -x c99ad299fa53d5d9688909164cf25b386b33bea8d4247310d80f615be29978f5
 	cos check s3://mrt-test/inusitatum.png -e http://127.0.0.1:9000/ -a md5 -x cadf871cd4135212419f488f42c62482
+	cos check s3://mrt-test/inusitatum.png -e http://127.0.0.1:9000/ -a sha256,md5,crc32c -x md5:cadf871cd4135212419f488f42c62482
+	cos check s3://mrt-test/6GBZeroFile.txt -e http://127.0.0.1:9000/ --etag
+	cos check s3://mrt-test/2TBFile.bin -e http://127.0.0.1:9000/ -a sha256,md5 --checkpoint 2TBFile.checkpoint
+	cos check s3://mrt-test/6GBZeroFile.txt -e http://127.0.0.1:9000/ --etag --part-size 8M
+	cos check file:///mnt/nas/inusitatum.png
+	cos check --manifest sha256sums.txt s3://mrt-test/images/ -e http://127.0.0.1:9000/
+	cos check --manifest /mnt/nas/bags/fk4kw5kc1z/manifest-md5.txt s3://mrt-test/bags/fk4kw5kc1z/ -e http://127.0.0.1:9000/ --workers 16
+	`+objects.AzureAccountEnvVar+`=<account> `+objects.AzureKeyEnvVar+`=<key> cos check azure://preservation/inusitatum.png
+	`+objects.GCSCredentialsEnvVar+`=service-account.json cos check gs://preservation/inusitatum.png
 	`+objects.SwiftUserEnvVar+`=<user> `+objects.SwiftKeyEnvVar+`=<key> cos check 'swift://distrib.stage.9001.__c5e/ark:/99999/fk4kw5kc1z|1|producer/6GBZeroFile.txt' -e http://cloud.sdsc.edu/auth/v1.0
     `
 )
@@ -47,25 +95,42 @@ const (
 type checkFlags struct {
 	CosFlags
 
-	Expected  []byte
-	Algorithm string
+	Expected    []string
+	Algorithms  []string
+	Concurrency int
+	Stream      bool
+	ETag        bool
+	PartSize    string
+	Manifest    string
+	Workers     int
+
+	Checkpoint         string
+	CheckpointInterval time.Duration
 }
 
 func (f checkFlags) Pretty() string {
 	format := `
 		verbose: %v
-		expected: %x
-		algorithm: '%v'
+		expected: %v
+		algorithms: %v
+		concurrency: %d
+		stream: %v
+		etag: %v
+		part size: '%v'
+		manifest: '%v'
+		workers: %d
+		checkpoint: '%v'
+		checkpoint interval: %v
 		endpoint: '%v'
 		region: '%v'`
 	format = logging.Untabify(format, "  ")
-	return fmt.Sprintf(format, f.Verbose, f.Expected, f.Algorithm, f.Endpoint, f.Region)
+	return fmt.Sprintf(format, f.Verbose, f.Expected, f.Algorithms, f.Concurrency, f.Stream, f.ETag, f.PartSize, f.Manifest, f.Workers, f.Checkpoint, f.CheckpointInterval, f.Endpoint, f.Region)
 }
 
 func (f checkFlags) String() string {
 	return fmt.Sprintf(
-		"checkFlags{ verbose: %v, expected: %x, algorithm: '%v', endpoint: '%v', region: '%v'}",
-		f.Verbose, f.Expected, f.Algorithm, f.Endpoint, f.Region,
+		"checkFlags{ verbose: %v, expected: %v, algorithms: %v, concurrency: %d, stream: %v, etag: %v, part size: '%v', manifest: '%v', workers: %d, checkpoint: '%v', checkpoint interval: %v, endpoint: '%v', region: '%v'}",
+		f.Verbose, f.Expected, f.Algorithms, f.Concurrency, f.Stream, f.ETag, f.PartSize, f.Manifest, f.Workers, f.Checkpoint, f.CheckpointInterval, f.Endpoint, f.Region,
 	)
 }
 
@@ -75,34 +140,121 @@ func (f checkFlags) String() string {
 func check(objURLStr string, f checkFlags) error {
 	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
 	logger.Tracef("flags: %v\n", f)
+	if f.Manifest != "" {
+		return checkManifest(objURLStr, f)
+	}
 	logger.Tracef("object URL: %v\n", objURLStr)
 
-	objURL, err := streaming.ValidAbsURL(objURLStr)
+	obj, err := f.Object(objURLStr)
 	if err != nil {
 		return err
 	}
+	logger.Tracef("object: %v\n", obj)
 
-	endpointURL, err := streaming.ValidAbsURL(f.Endpoint)
+	expected, err := pkg.ParseExpectedDigests(f.Expected, f.Algorithms)
 	if err != nil {
 		return err
 	}
 
-	obj, err := objects.NewObject(objURL, endpointURL, f.Region)
+	var partSize int64
+	if f.PartSize != "" {
+		if !f.ETag {
+			return fmt.Errorf("--part-size requires --etag")
+		}
+		partSize, err = parseSize(f.PartSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	var check = pkg.Check{
+		Object:      obj,
+		Algorithms:  f.Algorithms,
+		Expected:    expected,
+		Concurrency: f.Concurrency,
+		Stream:      f.Stream,
+		ETag:        f.ETag,
+		PartSize:    partSize,
+
+		Checkpoint:         f.Checkpoint,
+		CheckpointInterval: f.CheckpointInterval,
+	}
+	result, err := check.Verify()
 	if err != nil {
 		return err
 	}
-	logger.Tracef("object: %v\n", obj)
+	if len(f.Algorithms) == 1 && !f.ETag {
+		fmt.Printf("%x\n", result.Digests[f.Algorithms[0]])
+		return nil
+	}
+	for _, algorithm := range f.Algorithms {
+		fmt.Printf("%-7v %x\n", algorithm, result.Digests[algorithm])
+	}
+	if f.ETag {
+		if result.Parts > 0 {
+			logger.Detailf("ETag matches %d parts of %d bytes\n", result.Parts, result.PartSize)
+		}
+		fmt.Printf("%-7v %v\n", "etag", result.ETag)
+	}
+	return nil
+}
 
-	var check = pkg.Check{
-		Object:    obj,
-		Expected:  f.Expected,
-		Algorithm: f.Algorithm,
+func checkManifest(prefixURLStr string, f checkFlags) error {
+	logger := logging.DefaultLogger()
+	logger.Tracef("prefix URL: %v\n", prefixURLStr)
+	if len(f.Expected) > 0 || f.ETag || f.PartSize != "" || f.Checkpoint != "" {
+		return fmt.Errorf("--manifest cannot be combined with --expected, --etag, --part-size, or --checkpoint")
+	}
+	if len(f.Algorithms) > 1 {
+		return fmt.Errorf("--manifest requires a single algorithm, got: %v", strings.Join(f.Algorithms, ", "))
+	}
+	algorithm := ""
+	if len(f.Algorithms) == 1 {
+		algorithm = f.Algorithms[0]
 	}
-	digest, err := check.VerifyDigest()
+
+	manifest, err := pkg.ReadManifestFile(f.Manifest, algorithm)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("%x\n", digest)
+	logger.Detailf("%d %v entries read from %v\n", len(manifest.Entries), manifest.Algorithm, f.Manifest)
+
+	target, prefix, err := f.TargetAndPrefix(prefixURLStr)
+	if err != nil {
+		return err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	logger.Tracef("target: %v\n", target)
+	logger.Tracef("prefix: %#v\n", prefix)
+
+	manifestCheck := pkg.ManifestCheck{
+		Target:      target,
+		Prefix:      prefix,
+		Manifest:    manifest,
+		Workers:     f.Workers,
+		Concurrency: f.Concurrency,
+		Stream:      f.Stream,
+	}
+	summary, err := manifestCheck.Run(func(result pkg.ManifestResult) {
+		switch result.Status {
+		case pkg.ManifestError:
+			fmt.Printf("%-7v %v: %v\n", strings.ToUpper(result.Status), result.Key, result.Err)
+		case pkg.ManifestFail:
+			fmt.Printf("%-7v %v\n", strings.ToUpper(result.Status), result.Key)
+			logger.Detailf("%v\n", result.Err)
+		default:
+			fmt.Printf("%-7v %v\n", strings.ToUpper(result.Status), result.Key)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println(summary)
+	if !summary.OK() {
+		return fmt.Errorf("%d of %d objects failed verification", summary.Total()-summary.Passed, summary.Total())
+	}
 	return nil
 }
 
@@ -119,14 +271,26 @@ func init() {
 		Args:          cobra.ExactArgs(1),
 		Example:       logging.Untabify(exampleCheck, "  "),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if flags.Manifest != "" && !cmd.Flags().Changed("algorithm") {
+				// infer the algorithm from the manifest
+				flags.Algorithms = nil
+			}
 			return check(args[0], flags)
 		},
 	}
 	cmdFlags := cmd.Flags()
 	flags.AddTo(cmdFlags)
 
-	cmdFlags.StringVarP(&flags.Algorithm, "algorithm", "a", "sha256", "digest algorithm (md5 or sha256)")
-	cmdFlags.BytesHexVarP(&flags.Expected, "expected", "x", nil, "expected digest value (exit with error if not matched)")
+	cmdFlags.StringSliceVarP(&flags.Algorithms, "algorithm", "a", []string{"sha256"}, "digest algorithm(s), comma-separated ("+strings.Join(objects.DigestAlgorithms, ", ")+")")
+	cmdFlags.StringArrayVarP(&flags.Expected, "expected", "x", nil, "expected digest value as [ALGORITHM:]HEX (exit with error if not matched); may be repeated")
+	cmdFlags.IntVarP(&flags.Concurrency, "concurrency", "c", objects.DefaultDownloadConcurrency, "number of chunks to download at once")
+	cmdFlags.BoolVar(&flags.Stream, "stream", false, "download with a single streaming request where supported, using ranged requests only to resume after errors")
+	cmdFlags.StringVar(&flags.Checkpoint, "checkpoint", "", "save progress to the specified file, and resume from it if present")
+	cmdFlags.DurationVar(&flags.CheckpointInterval, "checkpoint-interval", pkg.DefaultCheckpointInterval, "interval between checkpoints (with --checkpoint)")
+	cmdFlags.StringVarP(&flags.Manifest, "manifest", "m", "", "verify all objects listed in the specified manifest file, relative to the bucket URL")
+	cmdFlags.IntVarP(&flags.Workers, "workers", "w", pkg.DefaultManifestWorkers, "number of objects to verify at once (with --manifest)")
+	cmdFlags.BoolVar(&flags.ETag, "etag", false, "recompute the object's S3 ETag and verify it against the ETag reported by the server")
+	cmdFlags.StringVar(&flags.PartSize, "part-size", "", "part size for recomputing a multipart ETag, in bytes or with a unit suffix, e.g. 8M (default: detect)")
 
 	rootCmd.AddCommand(cmd)
 }
@@ -2,15 +2,12 @@ package cmd
 
 import (
 	"fmt"
-	"math"
-	"strconv"
-	"strings"
-	"unicode"
 
 	"code.cloudfoundry.org/bytefmt"
 	"github.com/spf13/cobra"
 
 	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/streaming"
 
 	"github.com/dmolesUC3/cos/pkg"
 )
@@ -34,14 +31,40 @@ const (
         binary megabytes (M, MB, MiB), binary gigabytes (G, GB, GiB), and binary 
         terabytes (T, TB, TiB). If no unit is specified, bytes are assumed.
 
-        Random bytes are generated using the Go default random number generator, with
-        a default seed of 0, for repeatability. An alternative seed can be specified
+        Random bytes are generated using AES-128 in counter mode, keyed by a seed
+        (default 1) for repeatability, fast enough that generating them does not
+        limit throughput on a fast network. An alternative seed can be specified
         with the --random-seed flag.
+
+        Other content can be specified with --content, since some services and
+        gateways compress or deduplicate data:
+
+        - random: random bytes (the default)
+        - zeros: all zero bytes
+        - pattern:<hex>: a byte pattern, given in hex, repeated (e.g. pattern:deadbeef)
+        - file:<path>: the contents of a file, repeated as needed to fill the object
+        - text: random English-like text, using the random seed
+        - counter: random bytes generated in counter mode from the random seed, so
+          that any range can be regenerated independently
+
+        With --send-checksum, the MD5 and SHA-256 digests of the object are
+        calculated before uploading, and sent with the upload so that the server
+        can reject a corrupted upload: as a Content-MD5 header with each S3
+        request (plus an x-amz-checksum-sha256 header if the object is uploaded
+        with a single request), or as an ETag header with each Swift request
+        (including large object segments). Other backends do not support this.
+
+        With any content but text, a corrupted object is
+        reported with the offset of its first corrupted byte. With these, --samples
+        verifies the object by downloading only that many ranges (of --sample-size
+        bytes), including the first and last ranges and the rest chosen at random,
+        instead of the whole object. See also verify-generated.
     `
 
 	exampleCrvd = `
         cos crvd s3://www.dmoles.net/ --endpoint https://s3.us-west-2.amazonaws.com/
         cos crvd swift://distrib.stage.9001.__c5e/ -e http://cloud.sdsc.edu/auth/v1.0
+        cos crvd file:///mnt/nas/scratch/
     `
 )
 
@@ -53,22 +76,20 @@ type crvdFlags struct {
 
 	Key  string
 	Size string
-	Seed int64
-	Keep bool
+	Seed    int64
+	Content string
+	Keep    bool
+
+	SendChecksum bool
+
+	Samples    int
+	SampleSize string
+
+	Upload UploadFlags
 }
 
 func (f crvdFlags) ContentLength() (int64, error) {
-	sizeStr := f.Size
-	sizeIsNumeric := strings.IndexFunc(sizeStr, unicode.IsLetter) == -1
-	if sizeIsNumeric {
-		return strconv.ParseInt(sizeStr, 10, 64)
-	}
-
-	bytes, err := bytefmt.ToBytes(sizeStr)
-	if err == nil && bytes > math.MaxInt64 {
-		return 0, fmt.Errorf("specified size %d bytes exceeds maximum %d", bytes, math.MaxInt64)
-	}
-	return int64(bytes), err
+	return parseSize(f.Size)
 }
 
 func (f crvdFlags) Pretty() string {
@@ -79,12 +100,16 @@ func (f crvdFlags) Pretty() string {
         key:      '%v'
 		size:      %v (%d bytes)
         seed:      %d
-        keep:      %v`
+        content:   %v
+        keep:      %v
+        checksum:  %v
+        samples:   %d (%v)
+        upload:    %v`
 	format = logging.Untabify(format, "  ")
 
 	contentLength, _ := f.ContentLength()
 
-	return fmt.Sprintf(format, f.LogLevel(), f.Region, f.Endpoint, f.Key, f.Size, contentLength, f.Seed, f.Keep)
+	return fmt.Sprintf(format, f.LogLevel(), f.Region, f.Endpoint, f.Key, f.Size, contentLength, f.Seed, f.Content, f.Keep, f.SendChecksum, f.Samples, f.SampleSize, f.Upload)
 }
 
 func crvd(bucketStr string, f crvdFlags) (err error) {
@@ -93,28 +118,68 @@ func crvd(bucketStr string, f crvdFlags) (err error) {
 	logger.Tracef("bucket URL: %v\n", bucketStr)
 
 	target, err := f.Target(bucketStr)
-	
+	if err != nil {
+		return err
+	}
 	contentLength, err := f.ContentLength()
 	if err != nil {
 		return err
 	}
+	if err = f.Upload.Configure(target, contentLength); err != nil {
+		return err
+	}
+
+	content, err := pkg.ParseContent(f.Content, f.Seed)
+	if err != nil {
+		return err
+	}
+	defer closeContent(content)
 
 	crvd := pkg.NewCrvd(target, f.Key, contentLength, f.Seed)
+	crvd.Content = content
+	crvd.SendChecksum = f.SendChecksum
+	crvd.Samples = f.Samples
+	if crvd.SampleSize, err = parseSize(f.SampleSize); err != nil {
+		return err
+	}
 
 	if f.Keep {
 		err = crvd.CreateRetrieveVerify()
 		if err == nil {
-			fmt.Printf("%v object created, retrieved, and verified; keeping %v\n", logging.FormatBytes(crvd.ContentLength), crvd.Object.Pretty())
+			fmt.Printf("%v object created%v, retrieved, and verified%v; keeping %v\n", logging.FormatBytes(crvd.ContentLength), uploadDesc(crvd), verifiedDesc(crvd), crvd.Object.Pretty())
 		}
 	} else {
 		err = crvd.CreateRetrieveVerifyDelete()
 		if err == nil {
-			fmt.Printf("%v object created, retrieved, verified, and deleted (%v)\n", logging.FormatBytes(crvd.ContentLength), crvd.Object.Pretty())
+			fmt.Printf("%v object created%v, retrieved, verified%v, and deleted (%v)\n", logging.FormatBytes(crvd.ContentLength), uploadDesc(crvd), verifiedDesc(crvd), crvd.Object.Pretty())
 		}
 	}
 	return err
 }
 
+// uploadDesc describes how the object was uploaded, if known, and whether
+// checksums were sent, e.g. " by multipart upload (3 parts of 5M) with
+// checksums"
+func uploadDesc(crvd *pkg.Crvd) string {
+	var desc string
+	if crvd.Upload != nil {
+		desc = " by " + crvd.Upload.String()
+	}
+	if crvd.SendChecksum {
+		desc += " with checksums"
+	}
+	return desc
+}
+
+// verifiedDesc describes what was verified, if only sample ranges were, e.g.
+// " 3 sample ranges (15M of 20M)"
+func verifiedDesc(crvd *pkg.Crvd) string {
+	if crvd.Verified == nil || crvd.Verified.Bytes == crvd.Verified.Length {
+		return ""
+	}
+	return " " + crvd.Verified.String()
+}
+
 func init() {
 	flags := crvdFlags{}
 	cmd := &cobra.Command{
@@ -135,7 +200,12 @@ func init() {
 	cmdFlags.StringVarP(&flags.Size, "size", "s", sizeDefault, "size object to create")
 	cmdFlags.StringVarP(&flags.Key, "key", "k", "", "key to create (defaults to cos-crvd-TIMESTAMP.bin)")
 	cmdFlags.Int64VarP(&flags.Seed, "random-seed", "", pkg.DefaultRandomSeed, "seed for random-number generator")
+	cmdFlags.StringVar(&flags.Content, "content", pkg.ContentRandom, "object content: random, zeros, pattern:<hex>, file:<path>, text, or counter")
 	cmdFlags.BoolVarP(&flags.Keep, "keep", "", false, "keep object after verification (default false)")
+	cmdFlags.BoolVar(&flags.SendChecksum, "send-checksum", false, "send checksums with the upload, for the server to verify (S3 and Swift only)")
+	cmdFlags.IntVar(&flags.Samples, "samples", 0, "number of ranges to verify, instead of the whole object (not supported for text content)")
+	cmdFlags.StringVar(&flags.SampleSize, "sample-size", bytefmt.ByteSize(uint64(streaming.DefaultRangeSize)), "size of each range verified with --samples")
+	flags.Upload.AddTo(cmdFlags)
 
 	rootCmd.AddCommand(cmd)
 }
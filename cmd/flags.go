@@ -1,6 +1,18 @@
 package cmd
 
 import (
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"code.cloudfoundry.org/bytefmt"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/spf13/pflag"
 
 	"github.com/dmolesUC3/cos/internal/streaming"
@@ -8,12 +20,21 @@ import (
 	"github.com/dmolesUC3/cos/internal/objects"
 
 	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/pkg"
 )
 
 type CosFlags struct {
 	Endpoint  string
 	Region    string
 	Verbose int
+
+	RetryAttempts int
+	RetryDelay    time.Duration
+	RetryMaxDelay time.Duration
+	RetryJitter   float64
+
+	Inject     string
+	InjectSeed int64
 }
 
 func (f *CosFlags) LogLevel() logging.LogLevel {
@@ -24,13 +45,47 @@ func (f *CosFlags) LogLevel() logging.LogLevel {
 func (f *CosFlags) AddTo(cmdFlags *pflag.FlagSet) {
 	cmdFlags.SortFlags = false
 
-	cmdFlags.StringVarP(&f.Endpoint, "endpoint", "e", "", "HTTP(S) endpoint URL (required)")
+	cmdFlags.StringVarP(&f.Endpoint, "endpoint", "e", "", "HTTP(S) endpoint URL (required except for file://, azure://, and gs:// URLs)")
 	cmdFlags.StringVarP(&f.Region, "region", "r", "", "AWS region (if not in endpoint URL; default \""+objects.DefaultAwsRegion+"\")")
 	cmdFlags.CountVarP(&f.Verbose, "verbose", "v", "verbose output (-vv for maximum verbosity)")
+	cmdFlags.IntVar(&f.RetryAttempts, "retry-attempts", objects.DefaultRetryAttempts, "maximum attempts at each request, including the first (1 to disable retries)")
+	cmdFlags.DurationVar(&f.RetryDelay, "retry-delay", objects.DefaultRetryDelay, "delay before the first retry, doubling with each further retry")
+	cmdFlags.DurationVar(&f.RetryMaxDelay, "retry-max-delay", objects.DefaultRetryMaxDelay, "maximum delay between retries")
+	cmdFlags.Float64Var(&f.RetryJitter, "retry-jitter", objects.DefaultRetryJitter, "fraction of each retry delay to randomize (0 to 1)")
+	cmdFlags.StringVar(&f.Inject, "inject", "", "inject faults for testing, e.g. 'get:5%:error,put:latency=200ms,get:1%:flipbit'")
+	cmdFlags.Int64Var(&f.InjectSeed, "inject-seed", 0, "seed for choosing injected faults (default: current time)")
+}
+
+// RetryPolicy returns the retry policy specified by the retry flags, or nil
+// if retries are disabled
+func (f *CosFlags) RetryPolicy() (*objects.RetryPolicy, error) {
+	if f.RetryAttempts <= 1 {
+		return nil, nil
+	}
+	if f.RetryJitter < 0 || f.RetryJitter > 1 {
+		return nil, fmt.Errorf("--retry-jitter must be between 0 and 1, was %v", f.RetryJitter)
+	}
+	if f.RetryDelay < 0 || f.RetryMaxDelay < 0 {
+		return nil, fmt.Errorf("retry delays must not be negative")
+	}
+	return &objects.RetryPolicy{
+		MaxAttempts: f.RetryAttempts,
+		BaseDelay:   f.RetryDelay,
+		MaxDelay:    f.RetryMaxDelay,
+		Jitter:      f.RetryJitter,
+	}, nil
+}
+
+// EndpointURL returns the endpoint URL, or nil if no endpoint was specified
+func (f *CosFlags) EndpointURL() (*url.URL, error) {
+	if f.Endpoint == "" {
+		return nil, nil
+	}
+	return streaming.ValidAbsURL(f.Endpoint)
 }
 
 func (f *CosFlags) Target(bucketStr string) (objects.Target, error) {
-	endpointURL, err := streaming.ValidAbsURL(f.Endpoint)
+	endpointURL, err := f.EndpointURL()
 	if err != nil {
 		return nil, err
 	}
@@ -40,5 +95,213 @@ func (f *CosFlags) Target(bucketStr string) (objects.Target, error) {
 		return nil, err
 	}
 
-	return objects.NewTarget(endpointURL, bucketURL, f.Region)
-}
\ No newline at end of file
+	target, err := objects.NewTarget(endpointURL, bucketURL, f.Region)
+	if err != nil {
+		return nil, err
+	}
+	return f.decorate(target)
+}
+
+// Object returns the object addressed by a URL of the form
+// <protocol>://<bucket>/<key>
+func (f *CosFlags) Object(objURLStr string) (objects.Object, error) {
+	endpointURL, err := f.EndpointURL()
+	if err != nil {
+		return nil, err
+	}
+
+	objURL, err := streaming.ValidAbsURL(objURLStr)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := objects.NewObject(objURL, endpointURL, f.Region)
+	if err != nil {
+		return nil, err
+	}
+	injector, err := f.FaultInjector()
+	if err != nil {
+		return nil, err
+	}
+	if injector != nil {
+		obj = objects.NewFaultObject(obj, injector)
+	}
+	policy, err := f.RetryPolicy()
+	if err != nil || policy == nil {
+		return obj, err
+	}
+	return objects.NewRetryingObject(obj, policy), nil
+}
+
+// FaultInjector returns the fault injector specified by the --inject flag, or
+// nil if no faults are to be injected
+func (f *CosFlags) FaultInjector() (*objects.FaultInjector, error) {
+	if f.Inject == "" {
+		return nil, nil
+	}
+	faults, err := objects.ParseFaults(f.Inject)
+	if err != nil {
+		return nil, err
+	}
+	seed := f.InjectSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	injector := objects.NewFaultInjector(faults, seed)
+	logging.DefaultLogger().Detailf("Injecting faults with seed %d: %v\n", seed, injector)
+	return injector, nil
+}
+
+// TargetAndPrefix returns the target and key prefix addressed by a URL of the
+// form <protocol>://<bucket>/<prefix>
+func (f *CosFlags) TargetAndPrefix(prefixStr string) (objects.Target, string, error) {
+	endpointURL, err := f.EndpointURL()
+	if err != nil {
+		return nil, "", err
+	}
+
+	prefixURL, err := streaming.ValidAbsURL(prefixStr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	target, prefix, err := objects.NewTargetAndPrefix(endpointURL, prefixURL, f.Region)
+	if err != nil {
+		return nil, "", err
+	}
+	target, err = f.decorate(target)
+	return target, prefix, err
+}
+
+// decorate wraps the target to inject faults according to the --inject flag,
+// if specified, and to retry object operations according to the retry flags,
+// unless retries are disabled. Retries wrap injected faults, so that injected
+// errors are retried.
+func (f *CosFlags) decorate(target objects.Target) (objects.Target, error) {
+	injector, err := f.FaultInjector()
+	if err != nil {
+		return nil, err
+	}
+	if injector != nil {
+		target = objects.NewFaultTarget(target, injector)
+	}
+	policy, err := f.RetryPolicy()
+	if err != nil || policy == nil {
+		return target, err
+	}
+	return objects.NewRetryingTarget(target, policy), nil
+}
+
+// ------------------------------------------------------------
+// UploadFlags type
+
+// UploadFlags controls how S3 objects and Swift large objects are uploaded,
+// for commands that create objects
+type UploadFlags struct {
+	Method      string
+	PartSize    string
+	Concurrency int
+
+	SwiftLargeObject      string
+	SwiftSegmentSize      string
+	SwiftSegmentContainer string
+}
+
+func (f *UploadFlags) AddTo(cmdFlags *pflag.FlagSet) {
+	cmdFlags.StringVar(&f.Method, "upload-method", objects.UploadAuto, "S3 upload method: single, multipart, or auto (multipart only if larger than one part)")
+	cmdFlags.StringVar(&f.PartSize, "part-size", "", "S3 multipart upload part size (default: chosen based on object size)")
+	cmdFlags.IntVar(&f.Concurrency, "upload-concurrency", objects.DefaultUploadConcurrency, "number of S3 multipart upload parts to upload in parallel")
+	cmdFlags.StringVar(&f.SwiftLargeObject, "swift-large-object", objects.LargeObjectDLO, "Swift large object type for objects over 2 GiB: dlo (dynamic) or slo (static)")
+	cmdFlags.StringVar(&f.SwiftSegmentSize, "swift-segment-size", bytefmt.ByteSize(uint64(streaming.DefaultRangeSize)), "Swift large object segment size")
+	cmdFlags.StringVar(&f.SwiftSegmentContainer, "swift-segment-container", "", "Swift large object segment container (default: <container>_segments)")
+}
+
+// Configure applies the upload flags to the target, if it is (or decorates)
+// an S3 or Swift target. maxSize is the size of the largest object to be
+// uploaded, which must not be too large for the S3 upload method.
+func (f *UploadFlags) Configure(target objects.Target, maxSize int64) error {
+	if err := objects.ValidateUploadMethod(f.Method); err != nil {
+		return err
+	}
+	if f.Concurrency < 1 {
+		return fmt.Errorf("--upload-concurrency must be at least 1, was %d", f.Concurrency)
+	}
+	var partSize int64
+	if f.PartSize != "" {
+		var err error
+		if partSize, err = parseSize(f.PartSize); err != nil {
+			return fmt.Errorf("invalid --part-size %#v: %v", f.PartSize, err)
+		}
+		if partSize < s3manager.MinUploadPartSize {
+			return fmt.Errorf("--part-size must be at least %v, was %v", logging.FormatBytes(s3manager.MinUploadPartSize), f.PartSize)
+		}
+	}
+	if err := objects.ValidateSwiftLargeObjectMode(f.SwiftLargeObject); err != nil {
+		return err
+	}
+	var segmentSize int64
+	if f.SwiftSegmentSize != "" {
+		var err error
+		if segmentSize, err = parseSize(f.SwiftSegmentSize); err != nil {
+			return fmt.Errorf("invalid --swift-segment-size %#v: %v", f.SwiftSegmentSize, err)
+		}
+		if segmentSize <= 0 {
+			return fmt.Errorf("--swift-segment-size must be positive, was %v", f.SwiftSegmentSize)
+		}
+	}
+	switch t := objects.BaseTarget(target).(type) {
+	case *objects.S3Target:
+		if err := objects.ValidateUploadSize(f.Method, maxSize); err != nil {
+			return fmt.Errorf("--upload-method %v: %v", f.Method, err)
+		}
+		t.UploadMethod = f.Method
+		t.PartSize = partSize
+		t.UploadConcurrency = f.Concurrency
+	case *objects.SwiftTarget:
+		t.LargeObjectMode = f.SwiftLargeObject
+		t.SegmentSize = segmentSize
+		t.SegmentContainer = f.SwiftSegmentContainer
+	}
+	return nil
+}
+
+func (f UploadFlags) Pretty() string {
+	partSize := f.PartSize
+	if partSize == "" {
+		partSize = "<auto>"
+	}
+	return fmt.Sprintf("UploadFlags{ Method: %v, PartSize: %v, Concurrency: %d, SwiftLargeObject: %v, SwiftSegmentSize: %v, SwiftSegmentContainer: %#v }",
+		f.Method, partSize, f.Concurrency, f.SwiftLargeObject, f.SwiftSegmentSize, f.SwiftSegmentContainer)
+}
+
+func (f UploadFlags) String() string {
+	return f.Pretty()
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// parseSize parses a size in bytes, given either as a plain number of bytes or
+// with a unit suffix, e.g. "5M" or "1GiB"
+func parseSize(sizeStr string) (int64, error) {
+	sizeIsNumeric := strings.IndexFunc(sizeStr, unicode.IsLetter) == -1
+	if sizeIsNumeric {
+		return strconv.ParseInt(sizeStr, 10, 64)
+	}
+
+	bytes, err := bytefmt.ToBytes(sizeStr)
+	if err == nil && bytes > math.MaxInt64 {
+		return 0, fmt.Errorf("specified size %d bytes exceeds maximum %d", bytes, math.MaxInt64)
+	}
+	return int64(bytes), err
+}
+
+// closeContent closes the content, if it holds an open file (see
+// pkg.FileContent)
+func closeContent(content pkg.Content) {
+	if closer, ok := content.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logging.DefaultLogger().Infof("error closing content %v: %v", content, err.Error())
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+const (
+	usageLs = "ls <BUCKET-URL>[/PREFIX]"
+
+	shortDescLs = "ls: list the objects in a bucket or container"
+
+	longDescLs = shortDescLs + `
+
+		Lists the keys of the objects in a bucket or container, optionally
+		restricted to those starting with the specified prefix.
+
+		By default, keys are grouped by the delimiter ("/"), as in a directory
+		listing: keys containing the delimiter after the prefix are rolled up into
+		a single common prefix, ending with the delimiter. Use --recursive to list
+		all keys under the prefix, or --delimiter to group by a different string.
+
+		Use --long to include the last-modified time (UTC), size in bytes, and ETag
+		of each object; common prefixes are shown as PRE.
+
+		Use --quoted to write each key as a quoted Go string literal (see
+		https://golang.org/pkg/strconv/), as the keys command does, so that keys
+		containing whitespace, control characters, or invalid UTF-8 display
+		unambiguously.
+	`
+
+	exampleLs = `
+		cos ls s3://www.dmoles.net/ --endpoint https://s3.us-west-2.amazonaws.com/
+		cos ls s3://www.dmoles.net/images/ --recursive --long -e https://s3.us-west-2.amazonaws.com/
+		cos ls s3://mrt-test/ --quoted -e http://127.0.0.1:9000/
+		cos ls file:///mnt/nas/scratch/ --long
+		cos ls 'swift://distrib.stage.9001.__c5e/ark:/99999/fk4kw5kc1z|' --delimiter '|' -e http://cloud.sdsc.edu/auth/v1.0
+	`
+)
+
+// ------------------------------------------------------------
+// lsFlags type
+
+type lsFlags struct {
+	CosFlags
+
+	Recursive bool
+	Delimiter string
+	Long      bool
+	Quoted    bool
+}
+
+func (f lsFlags) Pretty() string {
+	format := `
+		recursive: %v
+		delimiter: %#v
+		long: %v
+		quoted: %v
+		endpoint: '%v'
+		region: '%v'
+		log level: %v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.Recursive, f.Delimiter, f.Long, f.Quoted, f.Endpoint, f.Region, f.LogLevel())
+}
+
+func (f lsFlags) String() string {
+	return fmt.Sprintf(
+		"lsFlags{ recursive: %v, delimiter: %#v, long: %v, quoted: %v, endpoint: '%v', region: '%v', log level: %v }",
+		f.Recursive, f.Delimiter, f.Long, f.Quoted, f.Endpoint, f.Region, f.LogLevel(),
+	)
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func ls(prefixURLStr string, f lsFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+	logger.Tracef("prefix URL: %v\n", prefixURLStr)
+
+	target, prefix, err := f.TargetAndPrefix(prefixURLStr)
+	if err != nil {
+		return err
+	}
+	logger.Tracef("target: %v\n", target)
+	logger.Tracef("prefix: %#v\n", prefix)
+
+	delimiter := f.Delimiter
+	if f.Recursive {
+		delimiter = ""
+	}
+	l := pkg.Ls{
+		Target:    target,
+		Prefix:    prefix,
+		Delimiter: delimiter,
+		Long:      f.Long,
+		Quoted:    f.Quoted,
+	}
+	count, err := l.List(os.Stdout)
+	logger.Detailf("%d entries listed\n", count)
+	return err
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := lsFlags{}
+
+	cmd := &cobra.Command{
+		Use:     usageLs,
+		Short:   shortDescLs,
+		Long:    logging.Untabify(longDescLs, ""),
+		Args:    cobra.ExactArgs(1),
+		Example: logging.Untabify(exampleLs, "  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ls(args[0], flags)
+		},
+	}
+	cmdFlags := cmd.Flags()
+	flags.AddTo(cmdFlags)
+
+	cmdFlags.BoolVarP(&flags.Recursive, "recursive", "R", false, "list all keys under the prefix, without grouping by delimiter")
+	cmdFlags.StringVarP(&flags.Delimiter, "delimiter", "d", "/", "delimiter for grouping keys into common prefixes")
+	cmdFlags.BoolVarP(&flags.Long, "long", "l", false, "include last-modified time, size, and ETag")
+	cmdFlags.BoolVarP(&flags.Quoted, "quoted", "q", false, "write keys as quoted Go string literals")
+
+	rootCmd.AddCommand(cmd)
+}
@@ -22,6 +22,19 @@ const (
 
         Note that for OpenStack Swift, the API username and key must be specified
         with the ` + objects.SwiftUserEnvVar + ` and ` + objects.SwiftKeyEnvVar + ` environment variables.
+
+        For Azure Blob Storage (azure:// URLs), the account name and shared key must be
+        specified with the ` + objects.AzureAccountEnvVar + ` and ` + objects.AzureKeyEnvVar + ` environment
+        variables. The endpoint defaults to https://<account>.blob.core.windows.net; for
+        the Azurite emulator, use e.g. http://127.0.0.1:10000/devstoreaccount1.
+
+        For Google Cloud Storage (gs:// URLs), the path to a service account JSON key
+        file must be specified with the ` + objects.GCSCredentialsEnvVar + ` environment
+        variable. The endpoint defaults to ` + objects.DefaultGCSEndpoint + `; for a
+        local emulator, specify its URL with --endpoint (the key file is then optional).
+
+        Local directories (including network mounts) can be addressed with file://
+        URLs, e.g. file:///mnt/nas/scratch/; these require no endpoint or credentials.
     `
 )
 
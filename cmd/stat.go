@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+const (
+	usageStat = "stat <OBJECT-URL>"
+
+	shortDescStat = "stat: show the properties of an object"
+
+	longDescStat = shortDescStat + `
+
+		Shows the content length, ETag, content type, last-modified time, and
+		user metadata of an object, as reported by the storage service.
+
+		Objects assembled from separately uploaded parts are identified as
+		"multipart" (S3 multipart uploads), "dlo" or "slo" (OpenStack Swift
+		dynamic or static large objects), "blocks" (Azure block blobs committed
+		from staged blocks), or "composite" (Google Cloud Storage composite
+		objects), with the number of parts, if known.
+
+		Use --json to write the properties as a JSON object.
+	`
+
+	exampleStat = `
+		cos stat s3://www.dmoles.net/images/fa/archive.svg --endpoint https://s3.us-west-2.amazonaws.com/
+		cos stat s3://mrt-test/inusitatum.png --json -e http://127.0.0.1:9000/
+		cos stat file:///mnt/nas/inusitatum.png
+		cos stat 'swift://distrib.stage.9001.__c5e/ark:/99999/fk4kw5kc1z|1|producer/6GBZeroFile.txt' -e http://cloud.sdsc.edu/auth/v1.0
+	`
+)
+
+// ------------------------------------------------------------
+// statFlags type
+
+type statFlags struct {
+	CosFlags
+
+	JSON bool
+}
+
+func (f statFlags) Pretty() string {
+	format := `
+		json: %v
+		endpoint: '%v'
+		region: '%v'
+		log level: %v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.JSON, f.Endpoint, f.Region, f.LogLevel())
+}
+
+func (f statFlags) String() string {
+	return fmt.Sprintf(
+		"statFlags{ json: %v, endpoint: '%v', region: '%v', log level: %v }",
+		f.JSON, f.Endpoint, f.Region, f.LogLevel(),
+	)
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func stat(objURLStr string, f statFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+	logger.Tracef("object URL: %v\n", objURLStr)
+
+	obj, err := f.Object(objURLStr)
+	if err != nil {
+		return err
+	}
+	logger.Tracef("object: %v\n", obj)
+
+	s := pkg.Stat{Object: obj, JSON: f.JSON}
+	info, err := s.Write(os.Stdout)
+	if err == nil {
+		logger.Detailf("%v\n", info)
+	}
+	return err
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := statFlags{}
+
+	cmd := &cobra.Command{
+		Use:     usageStat,
+		Short:   shortDescStat,
+		Long:    logging.Untabify(longDescStat, ""),
+		Args:    cobra.ExactArgs(1),
+		Example: logging.Untabify(exampleStat, "  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return stat(args[0], flags)
+		},
+	}
+	cmdFlags := cmd.Flags()
+	flags.AddTo(cmdFlags)
+
+	cmdFlags.BoolVarP(&flags.JSON, "json", "j", false, "write properties as JSON")
+
+	rootCmd.AddCommand(cmd)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
 )
 
 type SuiteFlags struct {
@@ -19,10 +20,15 @@ type SuiteFlags struct {
 
 	Size bool
 	SizeMax   string
+	Content   string
 
 	Count bool
 	CountMax  uint64
 
+	LargeObjects bool
+
+	Checksum bool
+
 	Unicode bool
 	UnicodeCategories bool
 	UnicodeScripts bool
@@ -31,6 +37,8 @@ type SuiteFlags struct {
 	UnicodeInvalid bool
 
 	DryRun    bool
+
+	Upload UploadFlags
 }
 
 const (
@@ -41,8 +49,12 @@ const (
 		- maximum file size (--size)
 		- maximum number of files per key prefix (--count)
 		- Unicode key support (--unicode)
+		- Swift dynamic and static large object support (--large-objects)
+		- server verification of upload checksums (--checksum)
 
-		If none of --size, --count, etc. is specified, all test cases are run.
+		If none of --size, --count, etc. is specified, all test cases are run
+		(large object cases only for Swift containers, and checksum cases only
+		for S3 buckets and Swift containers).
 
 		The maximum size may be specified as an exact number of bytes, or using
 		human-readable quantities such as "5K" (4 KiB or 4096 bytes), "3.5M" (3.5
@@ -51,6 +63,11 @@ const (
 		GB, GiB), and binary terabytes (T, TB, TiB). If no unit is specified, bytes
 		are assumed.
 
+		File size cases create random bytes by default; other content can be
+		specified with --content, as for crvd: zeros, pattern:<hex>,
+		file:<path>, or text. Some services and gateways compress or deduplicate
+		data, so different content may give different results.
+
 		Unicode key support tests are further divided into:
 
 		- Unicode category support (--unicode-categories)
@@ -61,13 +78,32 @@ const (
 
 		If --unicode is specified, all of these are run.
 
+		Large object cases create, retrieve, verify, and delete objects of 16 MiB
+		and up (to the maximum file size) as both dynamic and static large
+		objects, regardless of --swift-large-object, and check that the cluster
+		reports the expected kind of large object. --large-objects therefore
+		requires a --size-max of at least 16 MiB.
+
+		Checksum cases upload 1 KiB and 16 MiB objects (up to the maximum file
+		size) with checksums (see crvd --send-checksum), which the server should
+		accept, and then with deliberately wrong checksums, which it should
+		reject without creating the object.
+
 		Note that there is considerable overlap between the characters in the
 		category support, script support, and properties support tests.
 
 		Note also that the --unicode-invalid test depends somewhat on the exact
 		mechanisms used to generate key strings from bytes, and results with your
 		own client code may differ.
+
+		With --dry-run, the test cases are run against an in-memory target
+		rather than the specified bucket, without making any network requests.
+		The in-memory target limits keys to 1024 bytes and objects to 64 MiB, so
+		larger file size cases are expected to fail.
 	`
+
+	// bucket name for the in-memory target used in dry runs
+	dryRunBucket = "cos-dry-run"
 )
 
 func init() {
@@ -86,10 +122,15 @@ func init() {
 
 	cmdFlags.BoolVarP(&f.Size, "size", "s", false, "test file sizes")
 	cmdFlags.StringVar(&f.SizeMax, "size-max", bytefmt.ByteSize(SizeMaxDefault), "max file size to create")
+	cmdFlags.StringVar(&f.Content, "content", pkg.ContentRandom, "file size case content: random, zeros, pattern:<hex>, file:<path>, or text")
 
 	cmdFlags.BoolVarP(&f.Count, "count", "c", false, "test file counts")
 	cmdFlags.Uint64Var(&f.CountMax, "count-max", CountMaxDefault, "max number of files to create, or -1 for no limit")
 
+	cmdFlags.BoolVarP(&f.LargeObjects, "large-objects", "l", false, "test Swift dynamic and static large objects")
+
+	cmdFlags.BoolVar(&f.Checksum, "checksum", false, "test server verification of upload checksums")
+
 	cmdFlags.BoolVarP(&f.Unicode, "unicode", "u", false, "test Unicode keys")
 	cmdFlags.BoolVar(&f.UnicodeCategories, "unicode-categories", false, "test Unicode categories")
 	cmdFlags.BoolVar(&f.UnicodeScripts, "unicode-scripts", false, "test Unicode scripts")
@@ -97,7 +138,8 @@ func init() {
 	cmdFlags.BoolVar(&f.UnicodeEmoji, "unicode-emoji", false, "test Unicode emoji")
 	cmdFlags.BoolVar(&f.UnicodeInvalid, "unicode-invalid", false, "test invalid Unicode")
 
-	cmdFlags.BoolVarP(&f.DryRun, "dry-run", "n", false, "dry run; list all tests that would be run, but don't make any requests")
+	cmdFlags.BoolVarP(&f.DryRun, "dry-run", "n", false, "dry run; run all tests against an in-memory target, without making any network requests")
+	f.Upload.AddTo(cmdFlags)
 	rootCmd.AddCommand(cmd)
 }
 
@@ -111,6 +153,17 @@ func runSuite(bucketStr string, f SuiteFlags) error {
 	if err != nil {
 		return err
 	}
+	if f.LargeObjects && sizeMax < LargeObjectSizeMin {
+		return fmt.Errorf("--large-objects requires --size-max of at least %v, was %v", logging.FormatBytes(LargeObjectSizeMin), f.SizeMax)
+	}
+
+	var content pkg.Content
+	if f.Content != pkg.ContentRandom {
+		if content, err = pkg.ParseContent(f.Content, pkg.DefaultRandomSeed); err != nil {
+			return err
+		}
+		defer closeContent(content)
+	}
 
 	var countMax uint64
 	if f.CountMax < 0 {
@@ -119,9 +172,17 @@ func runSuite(bucketStr string, f SuiteFlags) error {
 		countMax = uint64(f.CountMax)
 	}
 
-	target, err := f.Target(bucketStr)
-	if err != nil {
-		return err
+	var target objects.Target
+	if f.DryRun {
+		target = objects.NewMemoryTarget(dryRunBucket, objects.DefaultMemoryRules)
+	} else {
+		target, err = f.Target(bucketStr)
+		if err != nil {
+			return err
+		}
+		if err = f.Upload.Configure(target, sizeMax); err != nil {
+			return err
+		}
 	}
 
 	logLevel := f.LogLevel()
@@ -137,9 +198,21 @@ func runSuite(bucketStr string, f SuiteFlags) error {
 		f.UnicodeInvalid
 
 	var cases []Case
-	runAllCases := !(f.Size || f.Count || anyUnicode)
+	runAllCases := !(f.Size || f.Count || f.LargeObjects || f.Checksum || anyUnicode)
 	if runAllCases || f.Size {
-		cases = append(cases, FileSizeCases(sizeMax)...)
+		cases = append(cases, FileSizeCases(sizeMax, content)...)
+	}
+	if f.LargeObjects || (runAllCases && isSwift(target)) {
+		if !isSwift(target) {
+			return fmt.Errorf("--large-objects requires a Swift container, not %v", bucketStr)
+		}
+		cases = append(cases, SwiftLargeObjectCases(sizeMax)...)
+	}
+	if f.Checksum || (runAllCases && supportsChecksums(target)) {
+		if !supportsChecksums(target) {
+			return fmt.Errorf("--checksum requires an S3 bucket or Swift container, not %v", bucketStr)
+		}
+		cases = append(cases, ChecksumCases(sizeMax)...)
 	}
 	if runAllCases || f.Count {
 		cases = append(cases, FileCountCases(countMax)...)
@@ -167,19 +240,33 @@ func runSuite(bucketStr string, f SuiteFlags) error {
 
 	// sanity check
 	fmt.Println("Checking server connection…")
-	if !f.DryRun {
-		crvd := pkg.NewDefaultCrvd(target, "")
-		err := crvd.CreateRetrieveVerifyDelete()
-		if err != nil {
-			return fmt.Errorf("connection check failed: %v", err)
-		}
+	crvd := pkg.NewDefaultCrvd(target, "")
+	err = crvd.CreateRetrieveVerifyDelete()
+	if err != nil {
+		return fmt.Errorf("connection check failed: %v", err)
 	}
 
 	//noinspection GoPrintFunctions
 	fmt.Printf("Starting test suite (%d cases)…\n\n", len(cases))
-	suite := NewSuite(cases, target, logLevel, f.DryRun)
+	suite := NewSuite(cases, target, logLevel)
 	elapsedAll := suite.Execute()
 	fmt.Printf("\n…test complete (%v).\n", logging.FormatNanos(elapsedAll))
 
 	return nil
 }
+
+// supportsChecksums returns true if checksum cases can be run against the
+// target, i.e. if it can send checksums on upload (see objects.WithChecksums)
+func supportsChecksums(target objects.Target) bool {
+	switch objects.BaseTarget(target).(type) {
+	case *objects.S3Target, *objects.SwiftTarget, *objects.MemoryTarget:
+		return true
+	}
+	return false
+}
+
+// isSwift returns true if large object cases can be run against the target
+func isSwift(target objects.Target) bool {
+	_, ok := objects.BaseTarget(target).(*objects.SwiftTarget)
+	return ok
+}
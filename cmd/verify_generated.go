@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/bytefmt"
+	"github.com/spf13/cobra"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/internal/streaming"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+const (
+	usageVerifyGenerated = "verify-generated <OBJECT-URL>"
+
+	shortDescVerifyGenerated = "verify-generated: verify an object against generated content"
+
+	longDescVerifyGenerated = shortDescVerifyGenerated + `
+
+		Verifies that an object contains the content cos generates for the
+		specified --content and --random-seed, e.g. an object created with
+		"cos crvd --keep". If any byte does not match, reports the offset of the
+		first corrupted byte.
+
+		Only content any range of which can be regenerated independently can be
+		verified: random (the default), counter, zeros, pattern:<hex>, or
+		file:<path>.
+
+		By default, the whole object is downloaded and verified, in ranges of
+		--sample-size bytes, --concurrency at a time. With --samples, only that
+		many ranges are verified: the first and last ranges (only the first, for
+		a single sample), and the rest chosen at random. This allows a spot check of a very large object without
+		downloading all of it.
+
+		If --size is specified, the object's content length must match.
+	`
+
+	exampleVerifyGenerated = `
+		cos verify-generated s3://mrt-test/cos-crvd-1553635860.bin -e http://127.0.0.1:9000/
+		cos verify-generated s3://mrt-test/huge.bin --size 100G --samples 20 -e http://127.0.0.1:9000/
+		cos verify-generated file:///mnt/nas/scratch/zeros.bin --content zeros
+	`
+)
+
+// ------------------------------------------------------------
+// verifyGeneratedFlags type
+
+type verifyGeneratedFlags struct {
+	CosFlags
+
+	Content     string
+	Seed        int64
+	Size        string
+	Samples     int
+	SampleSize  string
+	Concurrency int
+}
+
+func (f verifyGeneratedFlags) Pretty() string {
+	format := `
+		content: %v
+		seed: %d
+		size: '%v'
+		samples: %d
+		sample size: %v
+		concurrency: %d
+		endpoint: '%v'
+		region: '%v'
+		log level: %v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.Content, f.Seed, f.Size, f.Samples, f.SampleSize, f.Concurrency, f.Endpoint, f.Region, f.LogLevel())
+}
+
+func (f verifyGeneratedFlags) String() string {
+	return fmt.Sprintf(
+		"verifyGeneratedFlags{ content: %v, seed: %d, size: '%v', samples: %d, sample size: %v, concurrency: %d, endpoint: '%v', region: '%v', log level: %v }",
+		f.Content, f.Seed, f.Size, f.Samples, f.SampleSize, f.Concurrency, f.Endpoint, f.Region, f.LogLevel(),
+	)
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func verifyGenerated(objURLStr string, f verifyGeneratedFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+	logger.Tracef("object URL: %v\n", objURLStr)
+
+	content, err := pkg.ParseContent(f.Content, f.Seed)
+	if err != nil {
+		return err
+	}
+	defer closeContent(content)
+	seekable, ok := content.(pkg.SeekableContent)
+	if !ok {
+		return fmt.Errorf("%v content cannot be regenerated by range; expected random, counter, zeros, pattern:<hex>, or file:<path>", content)
+	}
+
+	var length int64
+	if f.Size != "" {
+		if length, err = parseSize(f.Size); err != nil {
+			return err
+		}
+	}
+	sampleSize, err := parseSize(f.SampleSize)
+	if err != nil {
+		return err
+	}
+
+	obj, err := f.Object(objURLStr)
+	if err != nil {
+		return err
+	}
+	logger.Tracef("object: %v\n", obj)
+
+	v := pkg.VerifyGenerated{
+		Object:      obj,
+		Content:     seekable,
+		Length:      length,
+		Samples:     f.Samples,
+		SampleSize:  sampleSize,
+		Concurrency: f.Concurrency,
+	}
+	result, err := v.Verify()
+	if err == nil {
+		fmt.Printf("verified %v of %v against %v\n", result, obj.Pretty(), content)
+	}
+	return err
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := verifyGeneratedFlags{}
+
+	cmd := &cobra.Command{
+		Use:     usageVerifyGenerated,
+		Short:   shortDescVerifyGenerated,
+		Long:    logging.Untabify(longDescVerifyGenerated, ""),
+		Args:    cobra.ExactArgs(1),
+		Example: logging.Untabify(exampleVerifyGenerated, "  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return verifyGenerated(args[0], flags)
+		},
+	}
+	cmdFlags := cmd.Flags()
+	flags.AddTo(cmdFlags)
+
+	cmdFlags.StringVar(&flags.Content, "content", pkg.ContentRandom, "expected content: random, counter, zeros, pattern:<hex>, or file:<path>")
+	cmdFlags.Int64VarP(&flags.Seed, "random-seed", "", pkg.DefaultRandomSeed, "seed for random or counter-mode content")
+	cmdFlags.StringVarP(&flags.Size, "size", "s", "", "expected size of object (optional)")
+	cmdFlags.IntVar(&flags.Samples, "samples", 0, "number of ranges to verify (default: all)")
+	cmdFlags.StringVar(&flags.SampleSize, "sample-size", bytefmt.ByteSize(uint64(streaming.DefaultRangeSize)), "size of each range verified")
+	cmdFlags.IntVarP(&flags.Concurrency, "concurrency", "c", objects.DefaultDownloadConcurrency, "number of ranges to download at once, when verifying the whole object")
+
+	rootCmd.AddCommand(cmd)
+}
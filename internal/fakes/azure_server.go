@@ -0,0 +1,535 @@
+package fakes
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AzuriteAccount is the well-known account name of the Azurite emulator
+	AzuriteAccount = "devstoreaccount1"
+	// AzuriteKey is the well-known shared key of the Azurite emulator
+	AzuriteKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+
+	azureDefaultMaxResults = 5000
+)
+
+// ------------------------------------------------------------
+// AzureServer type
+
+// AzureServer is an in-process HTTP server implementing enough of the Azure
+// Blob service REST API to exercise AzureTarget and AzureObject: shared key
+// authentication; container creation; List Blobs; Put Blob, Put Block and Put Block List;
+// Get Blob (including ranged reads); Get Blob Properties; and Delete Blob. Like
+// the Azurite emulator, it uses path-style URLs of the form
+// http://127.0.0.1:port/<account>/<container>/<blob>.
+type AzureServer struct {
+	Account string
+	Key     string
+
+	// MaxResults caps the number of entries returned in a single page of List
+	// Blobs results (default 5000)
+	MaxResults int
+	// IgnoreOpenRanges causes GET requests for an open-ended range
+	// ("bytes=<start>-") to return the whole object, as some proxies do
+	IgnoreOpenRanges bool
+	// IgnoreRanges causes GET requests for any range to return the whole
+	// object
+	IgnoreRanges bool
+
+	server     *httptest.Server
+	mux        sync.Mutex
+	containers map[string]map[string]*azureBlob
+}
+
+// NewAzureServer starts a new AzureServer listening on a random local port,
+// accepting the Azurite emulator's well-known account and key.
+func NewAzureServer() *AzureServer {
+	s := &AzureServer{
+		Account:    AzuriteAccount,
+		Key:        AzuriteKey,
+		containers: map[string]map[string]*azureBlob{},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// ------------------------------
+// Exported methods
+
+// URL returns the account endpoint URL of the server, e.g. http://127.0.0.1:port/devstoreaccount1
+func (s *AzureServer) URL() string {
+	return s.server.URL + "/" + s.Account
+}
+
+// Close shuts down the server
+func (s *AzureServer) Close() {
+	s.server.Close()
+}
+
+// CreateContainer creates the specified container, if it does not already exist
+func (s *AzureServer) CreateContainer(container string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, ok := s.containers[container]; !ok {
+		s.containers[container] = map[string]*azureBlob{}
+	}
+}
+
+// Blob returns the committed contents of the specified blob, and whether it exists
+func (s *AzureServer) Blob(container, name string) ([]byte, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if blob, ok := s.containers[container][name]; ok {
+		return blob.data, true
+	}
+	return nil, false
+}
+
+// BlockCount returns the number of committed blocks in the specified blob, or
+// zero if it was uploaded with a single Put Blob request
+func (s *AzureServer) BlockCount(container, name string) int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if blob, ok := s.containers[container][name]; ok {
+		return len(blob.blocks)
+	}
+	return 0
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+type azureListResult struct {
+	XMLName         xml.Name          `xml:"EnumerationResults"`
+	ServiceEndpoint string            `xml:"ServiceEndpoint,attr"`
+	ContainerName   string            `xml:"ContainerName,attr"`
+	Prefix          string            `xml:",omitempty"`
+	Marker          string            `xml:",omitempty"`
+	Delimiter       string            `xml:",omitempty"`
+	Blobs           []azureListBlob   `xml:"Blobs>Blob"`
+	BlobPrefixes    []azureBlobPrefix `xml:"Blobs>BlobPrefix"`
+	NextMarker      string
+}
+
+type azureListBlob struct {
+	Name       string
+	Properties azureBlobProperties
+}
+
+type azureBlobProperties struct {
+	LastModified  string `xml:"Last-Modified"`
+	Etag          string
+	ContentLength int64 `xml:"Content-Length"`
+	BlobType      string
+}
+
+type azureBlobPrefix struct {
+	Name string
+}
+
+type azureCommittedBlock struct {
+	Name string
+	Size int
+}
+
+type azureBlob struct {
+	data         []byte
+	blocks       []azureCommittedBlock
+	header       http.Header
+	etag         string
+	lastModified time.Time
+	uncommitted  map[string][]byte
+}
+
+// ------------------------------------------------------------
+// Request handling
+
+func (s *AzureServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if !s.authorized(r) {
+		azureWriteError(w, r, http.StatusForbidden, "AuthenticationFailed")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/"+s.Account+"/")
+	container, name := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		container, name = path[:i], path[i+1:]
+	}
+	query := r.URL.Query()
+	if name == "" {
+		if r.Method == http.MethodPut && query.Get("restype") == "container" {
+			if _, exists := s.containers[container]; exists {
+				azureWriteError(w, r, http.StatusConflict, "ContainerAlreadyExists")
+				return
+			}
+			s.containers[container] = map[string]*azureBlob{}
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if r.Method == http.MethodGet && query.Get("restype") == "container" && query.Get("comp") == "list" {
+			s.listBlobs(w, r, container)
+			return
+		}
+		azureWriteError(w, r, http.StatusBadRequest, "UnsupportedHttpVerb")
+		return
+	}
+
+	blobs, ok := s.containers[container]
+	if !ok {
+		azureWriteError(w, r, http.StatusNotFound, "ContainerNotFound")
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		switch query.Get("comp") {
+		case "":
+			s.putBlob(w, r, blobs, name)
+		case "block":
+			s.putBlock(w, r, blobs, name)
+		case "blocklist":
+			s.putBlockList(w, r, blobs, name)
+		default:
+			azureWriteError(w, r, http.StatusBadRequest, "InvalidQueryParameterValue")
+		}
+	case http.MethodGet, http.MethodHead:
+		if query.Get("comp") == "blocklist" {
+			s.getBlockList(w, r, blobs, name)
+			return
+		}
+		s.getBlob(w, r, blobs, name)
+	case http.MethodDelete:
+		blob, ok := blobs[name]
+		if !ok || blob.data == nil {
+			azureWriteError(w, r, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		delete(blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		azureWriteError(w, r, http.StatusBadRequest, "UnsupportedHttpVerb")
+	}
+}
+
+func (s *AzureServer) putBlob(w http.ResponseWriter, r *http.Request, blobs map[string]*azureBlob, name string) {
+	if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+		azureWriteError(w, r, http.StatusBadRequest, "MissingRequiredHeader")
+		return
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		azureWriteError(w, r, http.StatusBadRequest, "InvalidInput")
+		return
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	blob := s.commit(blobs, name, data)
+	blob.header = azureBlobHeader(r)
+	w.Header().Set("ETag", blob.etag)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *AzureServer) putBlock(w http.ResponseWriter, r *http.Request, blobs map[string]*azureBlob, name string) {
+	blockID := r.URL.Query().Get("blockid")
+	if _, err := base64.StdEncoding.DecodeString(blockID); blockID == "" || err != nil {
+		azureWriteError(w, r, http.StatusBadRequest, "InvalidQueryParameterValue")
+		return
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		azureWriteError(w, r, http.StatusBadRequest, "InvalidInput")
+		return
+	}
+	blob, ok := blobs[name]
+	if !ok {
+		blob = &azureBlob{}
+		blobs[name] = blob
+	}
+	if blob.uncommitted == nil {
+		blob.uncommitted = map[string][]byte{}
+	}
+	for id := range blob.uncommitted {
+		if len(id) != len(blockID) {
+			azureWriteError(w, r, http.StatusBadRequest, "InvalidBlobOrBlock")
+			return
+		}
+	}
+	blob.uncommitted[blockID] = data
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *AzureServer) putBlockList(w http.ResponseWriter, r *http.Request, blobs map[string]*azureBlob, name string) {
+	var blockList struct {
+		Latest      []string `xml:"Latest"`
+		Uncommitted []string `xml:"Uncommitted"`
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = xml.Unmarshal(body, &blockList)
+	}
+	if err != nil {
+		azureWriteError(w, r, http.StatusBadRequest, "InvalidXmlDocument")
+		return
+	}
+	blob, ok := blobs[name]
+	if !ok {
+		azureWriteError(w, r, http.StatusBadRequest, "InvalidBlockList")
+		return
+	}
+	data := []byte{}
+	var blocks []azureCommittedBlock
+	for _, id := range append(blockList.Latest, blockList.Uncommitted...) {
+		block, ok := blob.uncommitted[id]
+		if !ok {
+			azureWriteError(w, r, http.StatusBadRequest, "InvalidBlockList")
+			return
+		}
+		data = append(data, block...)
+		blocks = append(blocks, azureCommittedBlock{Name: id, Size: len(block)})
+	}
+	committed := s.commit(blobs, name, data)
+	committed.header = azureBlobHeader(r)
+	committed.blocks = blocks
+	w.Header().Set("ETag", committed.etag)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *AzureServer) commit(blobs map[string]*azureBlob, name string, data []byte) *azureBlob {
+	now := time.Now().UTC()
+	blob := &azureBlob{
+		data:         data,
+		etag:         fmt.Sprintf("\"0x%X\"", now.UnixNano()),
+		lastModified: now,
+	}
+	blobs[name] = blob
+	return blob
+}
+
+func (s *AzureServer) getBlob(w http.ResponseWriter, r *http.Request, blobs map[string]*azureBlob, name string) {
+	blob, ok := blobs[name]
+	if !ok || blob.data == nil {
+		azureWriteError(w, r, http.StatusNotFound, "BlobNotFound")
+		return
+	}
+	header := w.Header()
+	for k, v := range blob.header {
+		header[k] = v
+	}
+	header.Set("ETag", blob.etag)
+	header.Set("Last-Modified", blob.lastModified.Format(http.TimeFormat))
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("x-ms-blob-type", "BlockBlob")
+	sum := md5.Sum(blob.data)
+	header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+
+	length := int64(len(blob.data))
+	start, end := int64(0), length-1
+	status := http.StatusOK
+	rangeStr := r.Header.Get("x-ms-range")
+	if rangeStr == "" {
+		rangeStr = r.Header.Get("Range")
+	}
+	if rangeStr != "" && r.Method == http.MethodGet && !(s.IgnoreRanges || s.IgnoreOpenRanges && isOpenRange(rangeStr)) {
+		var err error
+		start, end, err = parseRange(rangeStr, length)
+		if err != nil {
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", length))
+			azureWriteError(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, length))
+		status = http.StatusPartialContent
+	}
+	header.Set("Content-Length", fmt.Sprintf("%d", end+1-start))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(blob.data[start : end+1])
+	}
+}
+
+func (s *AzureServer) getBlockList(w http.ResponseWriter, r *http.Request, blobs map[string]*azureBlob, name string) {
+	blob, ok := blobs[name]
+	if !ok || blob.data == nil {
+		azureWriteError(w, r, http.StatusNotFound, "BlobNotFound")
+		return
+	}
+	azureWriteXML(w, struct {
+		XMLName         xml.Name              `xml:"BlockList"`
+		CommittedBlocks []azureCommittedBlock `xml:"CommittedBlocks>Block"`
+	}{CommittedBlocks: blob.blocks})
+}
+
+func (s *AzureServer) listBlobs(w http.ResponseWriter, r *http.Request, container string) {
+	blobs, ok := s.containers[container]
+	if !ok {
+		azureWriteError(w, r, http.StatusNotFound, "ContainerNotFound")
+		return
+	}
+	query := r.URL.Query()
+	limit := azureDefaultMaxResults
+	if s.MaxResults > 0 {
+		limit = s.MaxResults
+	}
+	if v := query.Get("maxresults"); v != "" {
+		if requested, err := strconv.Atoi(v); err == nil && requested < limit {
+			limit = requested
+		}
+	}
+
+	var names []string
+	for name, blob := range blobs {
+		if blob.data != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	entries, next := listPage(names, query.Get("prefix"), query.Get("delimiter"), query.Get("marker"), limit)
+
+	result := azureListResult{
+		ServiceEndpoint: s.URL(),
+		ContainerName:   container,
+		Prefix:          query.Get("prefix"),
+		Marker:          query.Get("marker"),
+		Delimiter:       query.Get("delimiter"),
+		NextMarker:      next,
+	}
+	for _, e := range entries {
+		if e.isPrefix {
+			result.BlobPrefixes = append(result.BlobPrefixes, azureBlobPrefix{Name: e.key})
+			continue
+		}
+		blob := blobs[e.key]
+		result.Blobs = append(result.Blobs, azureListBlob{
+			Name: e.key,
+			Properties: azureBlobProperties{
+				LastModified:  blob.lastModified.Format(http.TimeFormat),
+				Etag:          blob.etag,
+				ContentLength: int64(len(blob.data)),
+				BlobType:      "BlockBlob",
+			},
+		})
+	}
+	azureWriteXML(w, result)
+}
+
+// ------------------------------------------------------------
+// Shared key authentication
+
+func (s *AzureServer) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	prefix := "SharedKey " + s.Account + ":"
+	if !strings.HasPrefix(auth, prefix) || r.Header.Get("x-ms-version") == "" {
+		return false
+	}
+	key, err := base64.StdEncoding.DecodeString(s.Key)
+	if err != nil {
+		return false
+	}
+	contentLength := r.Header.Get("Content-Length")
+	if contentLength == "0" {
+		contentLength = ""
+	}
+	var sb strings.Builder
+	for _, v := range []string{
+		r.Method,
+		r.Header.Get("Content-Encoding"),
+		r.Header.Get("Content-Language"),
+		contentLength,
+		r.Header.Get("Content-MD5"),
+		r.Header.Get("Content-Type"),
+		r.Header.Get("Date"),
+		r.Header.Get("If-Modified-Since"),
+		r.Header.Get("If-Match"),
+		r.Header.Get("If-None-Match"),
+		r.Header.Get("If-Unmodified-Since"),
+		r.Header.Get("Range"),
+	} {
+		sb.WriteString(v + "\n")
+	}
+
+	var headerNames []string
+	for k := range r.Header {
+		if lower := strings.ToLower(k); strings.HasPrefix(lower, "x-ms-") {
+			headerNames = append(headerNames, lower)
+		}
+	}
+	sort.Strings(headerNames)
+	for _, k := range headerNames {
+		sb.WriteString(k + ":" + strings.TrimSpace(r.Header.Get(k)) + "\n")
+	}
+
+	sb.WriteString("/" + s.Account + r.URL.EscapedPath())
+	query := r.URL.Query()
+	var queryNames []string
+	for k := range query {
+		queryNames = append(queryNames, k)
+	}
+	sort.Strings(queryNames)
+	for _, k := range queryNames {
+		values := query[k]
+		sort.Strings(values)
+		sb.WriteString("\n" + strings.ToLower(k) + ":" + strings.Join(values, ","))
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(sb.String()))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(strings.TrimPrefix(auth, prefix)), []byte(expected))
+}
+
+// azureBlobHeader returns the content type (default application/octet-stream)
+// and user metadata headers of a Put Blob or Put Block List request, to be
+// returned with the blob's properties
+func azureBlobHeader(r *http.Request) http.Header {
+	header := http.Header{}
+	contentType := r.Header.Get("x-ms-blob-content-type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	for k, v := range r.Header {
+		if strings.HasPrefix(k, "X-Ms-Meta-") {
+			header[k] = v
+		}
+	}
+	return header
+}
+
+func azureWriteXML(w http.ResponseWriter, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(data)
+}
+
+func azureWriteError(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.Header().Set("x-ms-error-code", code)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "%v<Error><Code>%v</Code><Message>%v</Message></Error>", xml.Header, code, http.StatusText(status))
+}
@@ -0,0 +1,501 @@
+package fakes
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	gcsTestClientEmail = "cos-test@cos-test.iam.gserviceaccount.com"
+	gcsChunkQuantum    = 256 * 1024
+
+	gcsDefaultMaxResults = 1000
+)
+
+// ------------------------------------------------------------
+// GCSServer type
+
+// GCSServer is an in-process HTTP server implementing enough of the Google
+// Cloud Storage JSON API to exercise GCSTarget and GCSObject: an OAuth 2.0
+// token endpoint accepting JWT assertions signed with a generated service
+// account key; object listing, metadata, media download (including ranged reads) and
+// delete; and media and resumable uploads. Object names are checked against
+// the GCS naming rules.
+type GCSServer struct {
+	// RequireAuth, if true, rejects requests without a valid access token
+	RequireAuth bool
+	// MaxResults caps the number of entries returned in a single page of
+	// listing results (default 1000)
+	MaxResults int
+	// IgnoreOpenRanges causes GET requests for an open-ended range
+	// ("bytes=<start>-") to return the whole object, as some proxies do
+	IgnoreOpenRanges bool
+	// IgnoreRanges causes GET requests for any range to return the whole
+	// object
+	IgnoreRanges bool
+
+	server     *httptest.Server
+	mux        sync.Mutex
+	key        *rsa.PrivateKey
+	tokens     map[string]bool
+	buckets    map[string]map[string]*gcsObject
+	uploads    map[string]*gcsUpload
+	nextID     int
+	chunkCount map[string]int
+	// lifetime of the access tokens issued; if zero, 1 hour
+	tokenLifetime time.Duration
+}
+
+// NewGCSServer starts a new GCSServer listening on a random local port
+func NewGCSServer() *GCSServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	s := &GCSServer{
+		RequireAuth: true,
+		key:         key,
+		tokens:      map[string]bool{},
+		buckets:     map[string]map[string]*gcsObject{},
+		uploads:     map[string]*gcsUpload{},
+		chunkCount:  map[string]int{},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// ------------------------------
+// Exported methods
+
+// URL returns the endpoint URL of the server, e.g. http://127.0.0.1:port
+func (s *GCSServer) URL() string {
+	return s.server.URL
+}
+
+// Close shuts down the server
+func (s *GCSServer) Close() {
+	s.server.Close()
+}
+
+// SetTokenLifetime sets the lifetime of the access tokens issued (by
+// default, 1 hour)
+func (s *GCSServer) SetTokenLifetime(lifetime time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.tokenLifetime = lifetime
+}
+
+// TokensIssued returns the number of access tokens issued
+func (s *GCSServer) TokensIssued() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return len(s.tokens)
+}
+
+// ServiceAccountKey returns a service account JSON key file accepted by the
+// server, with a token URI pointing to the server
+func (s *GCSServer) ServiceAccountKey() []byte {
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(s.key)
+	if err != nil {
+		panic(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})
+	data, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "cos-test",
+		"private_key_id": "cos-test-key",
+		"private_key":    string(keyPEM),
+		"client_email":   gcsTestClientEmail,
+		"token_uri":      s.server.URL + "/token",
+	})
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// CreateBucket creates the specified bucket, if it does not already exist
+func (s *GCSServer) CreateBucket(bucket string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, ok := s.buckets[bucket]; !ok {
+		s.buckets[bucket] = map[string]*gcsObject{}
+	}
+}
+
+// Object returns the contents of the specified object, and whether it exists
+func (s *GCSServer) Object(bucket, name string) ([]byte, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if obj, ok := s.buckets[bucket][name]; ok {
+		return obj.data, true
+	}
+	return nil, false
+}
+
+// ChunkCount returns the number of chunks in which the specified object was
+// uploaded via a resumable upload, or zero if it was uploaded in one request
+func (s *GCSServer) ChunkCount(bucket, name string) int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.chunkCount[bucket+"/"+name]
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+type gcsObject struct {
+	data        []byte
+	contentType string
+	updated     time.Time
+}
+
+type gcsUpload struct {
+	bucket      string
+	name        string
+	contentType string
+	total       int64
+	data        []byte
+	chunks      int
+}
+
+// ------------------------------------------------------------
+// Request handling
+
+func (s *GCSServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if r.URL.Path == "/token" {
+		s.issueToken(w, r)
+		return
+	}
+	if s.RequireAuth && !s.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] {
+		gcsWriteError(w, http.StatusUnauthorized, "Invalid Credentials")
+		return
+	}
+
+	// split the escaped path, since object names may contain encoded slashes
+	segments := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			gcsWriteError(w, http.StatusBadRequest, "Invalid path")
+			return
+		}
+		segments[i] = unescaped
+	}
+
+	switch {
+	case len(segments) == 5 && segments[0] == "storage" && segments[2] == "b" && segments[4] == "o" && r.Method == http.MethodGet:
+		s.listObjects(w, r, segments[3])
+	case len(segments) == 6 && segments[0] == "storage" && segments[2] == "b" && segments[4] == "o":
+		s.serveObject(w, r, segments[3], segments[5])
+	case len(segments) == 6 && segments[0] == "upload" && segments[3] == "b" && segments[5] == "o":
+		s.upload(w, r, segments[4])
+	default:
+		gcsWriteError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (s *GCSServer) issueToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		gcsWriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+		gcsWriteError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	parts := strings.Split(r.PostForm.Get("assertion"), ".")
+	if len(parts) != 3 {
+		gcsWriteError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		gcsWriteError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(&s.key.PublicKey, crypto.SHA256, digest[:], sig) != nil {
+		gcsWriteError(w, http.StatusBadRequest, "invalid_grant: Invalid JWT Signature.")
+		return
+	}
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		gcsWriteError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	var claims struct {
+		Iss string `json:"iss"`
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+	}
+	if json.Unmarshal(claimsJSON, &claims) != nil || claims.Iss != gcsTestClientEmail ||
+		claims.Aud != s.server.URL+"/token" || claims.Exp < time.Now().Unix() {
+		gcsWriteError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	token := fmt.Sprintf("ya29.test-%d", s.newID())
+	s.tokens[token] = true
+	lifetime := s.tokenLifetime
+	if lifetime == 0 {
+		lifetime = time.Hour
+	}
+	gcsWriteJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"expires_in":   int64(lifetime / time.Second),
+		"token_type":   "Bearer",
+	})
+}
+
+func (s *GCSServer) serveObject(w http.ResponseWriter, r *http.Request, bucket, name string) {
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		gcsWriteError(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+	obj, ok := objects[name]
+	if !ok {
+		gcsWriteError(w, http.StatusNotFound, "No such object: "+bucket+"/"+name)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("alt") != "media" {
+			gcsWriteJSON(w, http.StatusOK, gcsMetadata(bucket, name, obj))
+			return
+		}
+		length := int64(len(obj.data))
+		start, end := int64(0), length-1
+		status := http.StatusOK
+		if rangeStr := r.Header.Get("Range"); rangeStr != "" && !(s.IgnoreRanges || s.IgnoreOpenRanges && isOpenRange(rangeStr)) {
+			var err error
+			start, end, err = parseRange(rangeStr, length)
+			if err != nil {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", length))
+				gcsWriteError(w, http.StatusRequestedRangeNotSatisfiable, "Request range not satisfiable")
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, length))
+			status = http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(end+1-start, 10))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(status)
+		_, _ = w.Write(obj.data[start : end+1])
+	case http.MethodDelete:
+		delete(objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		gcsWriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (s *GCSServer) listObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		gcsWriteError(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+	query := r.URL.Query()
+	limit := gcsDefaultMaxResults
+	if s.MaxResults > 0 {
+		limit = s.MaxResults
+	}
+	if v := query.Get("maxResults"); v != "" {
+		if requested, err := strconv.Atoi(v); err == nil && requested < limit {
+			limit = requested
+		}
+	}
+	marker := ""
+	if token := query.Get("pageToken"); token != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			gcsWriteError(w, http.StatusBadRequest, "Invalid page token")
+			return
+		}
+		marker = string(decoded)
+	}
+
+	var names []string
+	for name := range objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries, next := listPage(names, query.Get("prefix"), query.Get("delimiter"), marker, limit)
+
+	items := []map[string]interface{}{}
+	prefixes := []string{}
+	for _, e := range entries {
+		if e.isPrefix {
+			prefixes = append(prefixes, e.key)
+		} else {
+			items = append(items, gcsMetadata(bucket, e.key, objects[e.key]))
+		}
+	}
+	result := map[string]interface{}{"kind": "storage#objects", "items": items, "prefixes": prefixes}
+	if next != "" {
+		result["nextPageToken"] = base64.RawURLEncoding.EncodeToString([]byte(next))
+	}
+	gcsWriteJSON(w, http.StatusOK, result)
+}
+
+func (s *GCSServer) upload(w http.ResponseWriter, r *http.Request, bucket string) {
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		gcsWriteError(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+	query := r.URL.Query()
+	if uploadID := query.Get("upload_id"); uploadID != "" && r.Method == http.MethodPut {
+		s.uploadChunk(w, r, objects, uploadID)
+		return
+	}
+	if r.Method != http.MethodPost {
+		gcsWriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	name := query.Get("name")
+	if !validGCSName(name) {
+		gcsWriteError(w, http.StatusBadRequest, "The specified object name is not valid.")
+		return
+	}
+	switch query.Get("uploadType") {
+	case "media":
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			gcsWriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		obj := &gcsObject{data: data, contentType: r.Header.Get("Content-Type"), updated: time.Now().UTC()}
+		objects[name] = obj
+		delete(s.chunkCount, bucket+"/"+name)
+		gcsWriteJSON(w, http.StatusOK, gcsMetadata(bucket, name, obj))
+	case "resumable":
+		total, err := strconv.ParseInt(r.Header.Get("X-Upload-Content-Length"), 10, 64)
+		if err != nil {
+			total = -1
+		}
+		uploadID := strconv.Itoa(s.newID())
+		s.uploads[uploadID] = &gcsUpload{
+			bucket:      bucket,
+			name:        name,
+			contentType: r.Header.Get("X-Upload-Content-Type"),
+			total:       total,
+		}
+		location := fmt.Sprintf("%v/upload/storage/v1/b/%v/o?uploadType=resumable&upload_id=%v",
+			s.server.URL, url.PathEscape(bucket), uploadID)
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusOK)
+	default:
+		gcsWriteError(w, http.StatusBadRequest, "Unsupported upload type")
+	}
+}
+
+func (s *GCSServer) uploadChunk(w http.ResponseWriter, r *http.Request, objects map[string]*gcsObject, uploadID string) {
+	upload, ok := s.uploads[uploadID]
+	if !ok {
+		gcsWriteError(w, http.StatusNotFound, "No such upload")
+		return
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		gcsWriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var start, end, total int64
+	_, err = fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+	if err != nil || start != int64(len(upload.data)) || end+1-start != int64(len(data)) ||
+		(upload.total >= 0 && total != upload.total) {
+		gcsWriteError(w, http.StatusBadRequest, "Invalid Content-Range")
+		return
+	}
+	final := end+1 == total
+	if !final && len(data)%gcsChunkQuantum != 0 {
+		gcsWriteError(w, http.StatusBadRequest, "Chunk size must be a multiple of 256 KiB")
+		return
+	}
+	upload.data = append(upload.data, data...)
+	upload.chunks++
+	if !final {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(upload.data)-1))
+		w.WriteHeader(308)
+		return
+	}
+	obj := &gcsObject{data: upload.data, contentType: upload.contentType, updated: time.Now().UTC()}
+	objects[upload.name] = obj
+	s.chunkCount[upload.bucket+"/"+upload.name] = upload.chunks
+	delete(s.uploads, uploadID)
+	gcsWriteJSON(w, http.StatusOK, gcsMetadata(upload.bucket, upload.name, obj))
+}
+
+func (s *GCSServer) newID() int {
+	s.nextID++
+	return s.nextID
+}
+
+// ------------------------------------------------------------
+// Unexported utility functions
+
+// validGCSName checks the object naming rules enforced by GCS; see
+// https://cloud.google.com/storage/docs/naming#objectnames
+func validGCSName(name string) bool {
+	return name != "" && len(name) <= 1024 && utf8.ValidString(name) &&
+		!strings.ContainsAny(name, "\r\n") && name != "." && name != ".." &&
+		!strings.HasPrefix(name, ".well-known/acme-challenge/")
+}
+
+func gcsMetadata(bucket, name string, obj *gcsObject) map[string]interface{} {
+	sum := md5.Sum(obj.data)
+	metadata := map[string]interface{}{
+		"kind":    "storage#object",
+		"bucket":  bucket,
+		"name":    name,
+		"size":    strconv.Itoa(len(obj.data)),
+		"md5Hash": base64.StdEncoding.EncodeToString(sum[:]),
+		"etag":    hex.EncodeToString(sum[:8]),
+		"updated": obj.updated.Format(time.RFC3339Nano),
+	}
+	if obj.contentType != "" {
+		metadata["contentType"] = obj.contentType
+	}
+	return metadata
+}
+
+func gcsWriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+func gcsWriteError(w http.ResponseWriter, status int, message string) {
+	gcsWriteJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{"code": status, "message": message},
+	})
+}
@@ -0,0 +1,45 @@
+package fakes
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// listEntry is an object key or common prefix in a page of listing results
+type listEntry struct {
+	key      string
+	isPrefix bool
+}
+
+// listPage returns a page of at most limit entries from the specified sorted
+// keys, starting after the specified marker, filtering by prefix and rolling
+// up keys into common prefixes by delimiter. If there are more entries, it
+// also returns the marker from which to continue.
+func listPage(sortedKeys []string, prefix, delimiter, marker string, limit int) (entries []listEntry, next string) {
+	lastPrefix := ""
+	for _, k := range sortedKeys {
+		if k <= marker || !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		entry := listEntry{key: k}
+		if delimiter != "" {
+			if i := strings.Index(k[len(prefix):], delimiter); i >= 0 {
+				entry = listEntry{key: k[:len(prefix)+i+len(delimiter)], isPrefix: true}
+				if entry.key == lastPrefix {
+					continue
+				}
+				lastPrefix = entry.key
+			}
+		}
+		if len(entries) >= limit {
+			last := entries[len(entries)-1]
+			if last.isPrefix {
+				// skip past all keys under the common prefix
+				return entries, last.key + string(utf8.MaxRune)
+			}
+			return entries, last.key
+		}
+		entries = append(entries, entry)
+	}
+	return entries, ""
+}
@@ -0,0 +1,583 @@
+package fakes
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	s3DefaultMaxKeys = 1000
+	s3TimeFormat     = "2006-01-02T15:04:05.000Z"
+)
+
+// ------------------------------------------------------------
+// S3Server type
+
+// S3Server is an in-process HTTP server implementing enough of the S3 REST
+// API (with path-style addressing) to exercise S3Target and S3Object: object
+// PUT, GET (including ranged GET), HEAD, and DELETE; multipart upload; and
+// ListObjectsV2. Requests are not authenticated.
+type S3Server struct {
+	// OmitContentLength causes HEAD responses to omit the Content-Length header
+	OmitContentLength bool
+	// OmitAcceptRanges causes HEAD responses to omit the Accept-Ranges header
+	OmitAcceptRanges bool
+	// IgnoreOpenRanges causes GET requests for an open-ended range
+	// ("bytes=<start>-") to return the whole object, as some proxies do
+	IgnoreOpenRanges bool
+	// IgnoreRanges causes GET requests for any range to return the whole
+	// object
+	IgnoreRanges bool
+	// MaxKeys limits the number of keys returned in a single page of listing
+	// results (default 1000)
+	MaxKeys int
+
+	server  *httptest.Server
+	mux     sync.Mutex
+	buckets map[string]map[string]*s3Object
+	uploads map[string]*s3Upload
+	nextID  int
+}
+
+// NewS3Server starts a new S3Server listening on a random local port. Use
+// URL() as the endpoint URL.
+func NewS3Server() *S3Server {
+	s := &S3Server{
+		buckets: map[string]map[string]*s3Object{},
+		uploads: map[string]*s3Upload{},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// ------------------------------
+// Exported methods
+
+// URL returns the base URL of the server, e.g. http://127.0.0.1:port
+func (s *S3Server) URL() string {
+	return s.server.URL
+}
+
+// Close shuts down the server
+func (s *S3Server) Close() {
+	s.server.Close()
+}
+
+// CreateBucket creates the specified bucket, if it does not already exist
+func (s *S3Server) CreateBucket(bucket string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, ok := s.buckets[bucket]; !ok {
+		s.buckets[bucket] = map[string]*s3Object{}
+	}
+}
+
+// Object returns the contents of the specified object, and whether it exists
+func (s *S3Server) Object(bucket, key string) ([]byte, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if obj, ok := s.buckets[bucket][key]; ok {
+		return obj.data, true
+	}
+	return nil, false
+}
+
+// ETag returns the (quoted) ETag of the specified object, and whether it exists
+func (s *S3Server) ETag(bucket, key string) (string, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if obj, ok := s.buckets[bucket][key]; ok {
+		return obj.etag, true
+	}
+	return "", false
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+type s3Object struct {
+	data         []byte
+	etag         string
+	lastModified time.Time
+	header       http.Header
+}
+
+type s3Upload struct {
+	bucket string
+	key    string
+	parts  map[int][]byte
+	header http.Header
+}
+
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string
+	Message string
+}
+
+type s3InitiateResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Bucket   string
+	Key      string
+	UploadId string
+}
+
+type s3CompleteRequest struct {
+	Parts []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+type s3CompleteResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+type s3ListResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	KeyCount              int
+	MaxKeys               int
+	IsTruncated           bool
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	EncodingType          string `xml:",omitempty"`
+	Contents              []s3ListEntry
+	CommonPrefixes        []s3CommonPrefix
+}
+
+type s3ListEntry struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type s3CommonPrefix struct {
+	Prefix string
+}
+
+// ------------------------------------------------------------
+// Request handling
+
+func (s *S3Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		bucket, key = path[:i], path[i+1:]
+	}
+	if bucket == "" {
+		s3WriteError(w, r, http.StatusBadRequest, "InvalidBucketName", "bucket name required")
+		return
+	}
+	if key == "" {
+		s.serveBucket(w, r, bucket)
+		return
+	}
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		s3WriteError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodPut:
+		if uploadID := query.Get("uploadId"); uploadID != "" {
+			s.uploadPart(w, r, uploadID)
+		} else {
+			s.putObject(w, r, objects, key)
+		}
+	case http.MethodPost:
+		if _, ok := query["uploads"]; ok {
+			s.initiateUpload(w, r, bucket, key)
+		} else if uploadID := query.Get("uploadId"); uploadID != "" {
+			s.completeUpload(w, r, objects, uploadID)
+		} else {
+			s3WriteError(w, r, http.StatusBadRequest, "InvalidRequest", "unsupported POST")
+		}
+	case http.MethodGet, http.MethodHead:
+		s.getObject(w, r, objects, key)
+	case http.MethodDelete:
+		if uploadID := query.Get("uploadId"); uploadID != "" {
+			delete(s.uploads, uploadID)
+		} else {
+			delete(objects, key)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3WriteError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "unsupported method "+r.Method)
+	}
+}
+
+func (s *S3Server) serveBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	switch r.Method {
+	case http.MethodPut:
+		if _, ok := s.buckets[bucket]; !ok {
+			s.buckets[bucket] = map[string]*s3Object{}
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		objects, ok := s.buckets[bucket]
+		if !ok {
+			s3WriteError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+			return
+		}
+		s.listObjects(w, r, bucket, objects)
+	default:
+		s3WriteError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "unsupported method "+r.Method)
+	}
+}
+
+func (s *S3Server) putObject(w http.ResponseWriter, r *http.Request, objects map[string]*s3Object, key string) {
+	data, ok := s3ReadBody(w, r)
+	if !ok {
+		return
+	}
+	sum := md5.Sum(data)
+	obj := &s3Object{data: data, etag: fmt.Sprintf("\"%x\"", sum), lastModified: time.Now().UTC(), header: s3ObjectHeader(r)}
+	objects[key] = obj
+	w.Header().Set("ETag", obj.etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *S3Server) initiateUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	s.nextID++
+	uploadID := fmt.Sprintf("upload-%d", s.nextID)
+	s.uploads[uploadID] = &s3Upload{bucket: bucket, key: key, parts: map[int][]byte{}, header: s3ObjectHeader(r)}
+	s3WriteXML(w, http.StatusOK, s3InitiateResult{Bucket: bucket, Key: key, UploadId: uploadID})
+}
+
+func (s *S3Server) uploadPart(w http.ResponseWriter, r *http.Request, uploadID string) {
+	upload, ok := s.uploads[uploadID]
+	if !ok {
+		s3WriteError(w, r, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+		return
+	}
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 {
+		s3WriteError(w, r, http.StatusBadRequest, "InvalidArgument", "invalid part number")
+		return
+	}
+	data, ok := s3ReadBody(w, r)
+	if !ok {
+		return
+	}
+	upload.parts[partNumber] = data
+	w.Header().Set("ETag", fmt.Sprintf("\"%x\"", md5.Sum(data)))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *S3Server) completeUpload(w http.ResponseWriter, r *http.Request, objects map[string]*s3Object, uploadID string) {
+	upload, ok := s.uploads[uploadID]
+	if !ok {
+		s3WriteError(w, r, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+		return
+	}
+	var req s3CompleteRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		s3WriteError(w, r, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+	var data []byte
+	var partSums []byte
+	for _, part := range req.Parts {
+		partData, ok := upload.parts[part.PartNumber]
+		if !ok {
+			s3WriteError(w, r, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("no such part: %d", part.PartNumber))
+			return
+		}
+		sum := md5.Sum(partData)
+		if strings.Trim(part.ETag, "\"") != hex.EncodeToString(sum[:]) {
+			s3WriteError(w, r, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("ETag mismatch for part %d", part.PartNumber))
+			return
+		}
+		data = append(data, partData...)
+		partSums = append(partSums, sum[:]...)
+	}
+	etag := fmt.Sprintf("\"%x-%d\"", md5.Sum(partSums), len(req.Parts))
+	objects[upload.key] = &s3Object{data: data, etag: etag, lastModified: time.Now().UTC(), header: upload.header}
+	delete(s.uploads, uploadID)
+	s3WriteXML(w, http.StatusOK, s3CompleteResult{
+		Location: fmt.Sprintf("%v/%v/%v", s.URL(), upload.bucket, upload.key),
+		Bucket:   upload.bucket,
+		Key:      upload.key,
+		ETag:     etag,
+	})
+}
+
+func (s *S3Server) getObject(w http.ResponseWriter, r *http.Request, objects map[string]*s3Object, key string) {
+	obj, ok := objects[key]
+	if !ok {
+		s3WriteError(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	header := w.Header()
+	for k, v := range obj.header {
+		header[k] = v
+	}
+	header.Set("ETag", obj.etag)
+	header.Set("Last-Modified", obj.lastModified.Format(http.TimeFormat))
+	if !s.OmitAcceptRanges {
+		header.Set("Accept-Ranges", "bytes")
+	}
+
+	length := int64(len(obj.data))
+	start, end := int64(0), length-1
+	status := http.StatusOK
+	if rangeStr := r.Header.Get("Range"); rangeStr != "" && !(s.IgnoreRanges || s.IgnoreOpenRanges && isOpenRange(rangeStr)) {
+		var err error
+		start, end, err = parseRange(rangeStr, length)
+		if err != nil {
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", length))
+			s3WriteError(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", err.Error())
+			return
+		}
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, length))
+		status = http.StatusPartialContent
+	}
+	if r.Method == http.MethodHead {
+		if !s.OmitContentLength {
+			header.Set("Content-Length", strconv.FormatInt(length, 10))
+		}
+		w.WriteHeader(status)
+		return
+	}
+	header.Set("Content-Length", strconv.FormatInt(end+1-start, 10))
+	w.WriteHeader(status)
+	_, _ = w.Write(obj.data[start : end+1])
+}
+
+func (s *S3Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string, objects map[string]*s3Object) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	token := query.Get("continuation-token")
+	startAfter := query.Get("start-after")
+	if token != "" {
+		// continuation tokens are opaque to clients; here, they're just the
+		// base64-encoded last key returned
+		tokenKey, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			s3WriteError(w, r, http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect")
+			return
+		}
+		if string(tokenKey) > startAfter {
+			startAfter = string(tokenKey)
+		}
+	}
+	encode := func(s string) string { return s }
+	if query.Get("encoding-type") == "url" {
+		encode = url.QueryEscape
+	}
+	maxKeys := s.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = s3DefaultMaxKeys
+	}
+	if v := query.Get("max-keys"); v != "" {
+		if requested, err := strconv.Atoi(v); err == nil && requested < maxKeys {
+			maxKeys = requested
+		}
+	}
+
+	var keys []string
+	for k := range objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	result := s3ListResult{
+		Name:              bucket,
+		Prefix:            encode(prefix),
+		Delimiter:         encode(delimiter),
+		MaxKeys:           maxKeys,
+		ContinuationToken: token,
+		EncodingType:      query.Get("encoding-type"),
+	}
+	lastKey := ""
+	lastPrefix := ""
+	for _, k := range keys {
+		if k <= startAfter {
+			continue
+		}
+		commonPrefix := ""
+		if delimiter != "" {
+			if i := strings.Index(k[len(prefix):], delimiter); i >= 0 {
+				commonPrefix = k[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if commonPrefix != "" && commonPrefix == lastPrefix {
+			// already reported; skip past it
+			lastKey = k
+			continue
+		}
+		if result.KeyCount >= maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		result.KeyCount++
+		lastKey = k
+		if commonPrefix != "" {
+			lastPrefix = commonPrefix
+			result.CommonPrefixes = append(result.CommonPrefixes, s3CommonPrefix{encode(commonPrefix)})
+			continue
+		}
+		obj := objects[k]
+		result.Contents = append(result.Contents, s3ListEntry{
+			Key:          encode(k),
+			LastModified: obj.lastModified.Format(s3TimeFormat),
+			ETag:         obj.etag,
+			Size:         int64(len(obj.data)),
+			StorageClass: "STANDARD",
+		})
+	}
+	if result.IsTruncated {
+		result.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(lastKey))
+	}
+	s3WriteXML(w, http.StatusOK, result)
+}
+
+// ------------------------------------------------------------
+// Unexported utility functions
+
+// s3ObjectHeader returns the Content-Type (default application/octet-stream)
+// and user metadata headers of a PUT or multipart upload initiation request,
+// to be returned with the object
+func s3ObjectHeader(r *http.Request) http.Header {
+	header := http.Header{}
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	for k, v := range r.Header {
+		if strings.HasPrefix(k, "X-Amz-Meta-") {
+			header[k] = v
+		}
+	}
+	return header
+}
+
+func s3ReadBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s3WriteError(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return nil, false
+	}
+	if contentMD5 := r.Header.Get("Content-MD5"); contentMD5 != "" {
+		expected, err := base64.StdEncoding.DecodeString(contentMD5)
+		if err != nil {
+			s3WriteError(w, r, http.StatusBadRequest, "InvalidDigest", err.Error())
+			return nil, false
+		}
+		actual := md5.Sum(data)
+		if !bytes.Equal(expected, actual[:]) {
+			s3WriteError(w, r, http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received.")
+			return nil, false
+		}
+	}
+	if checksum := r.Header.Get("X-Amz-Checksum-Sha256"); checksum != "" {
+		expected, err := base64.StdEncoding.DecodeString(checksum)
+		if err != nil {
+			s3WriteError(w, r, http.StatusBadRequest, "InvalidRequest", err.Error())
+			return nil, false
+		}
+		actual := sha256.Sum256(data)
+		if !bytes.Equal(expected, actual[:]) {
+			s3WriteError(w, r, http.StatusBadRequest, "BadDigest", "The SHA256 you specified did not match the calculated checksum.")
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+func s3WriteXML(w http.ResponseWriter, status int, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(data)
+}
+
+func s3WriteError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	s3WriteXML(w, status, s3Error{Code: code, Message: message})
+}
+
+// isOpenRange returns true if the range is of the form "bytes=start-"
+func isOpenRange(rangeStr string) bool {
+	spec := strings.TrimPrefix(rangeStr, "bytes=")
+	return spec != rangeStr && !strings.HasPrefix(spec, "-") && strings.HasSuffix(spec, "-")
+}
+
+// parseRange parses a single HTTP byte range ("bytes=start-end", "bytes=start-",
+// or "bytes=-suffix"), clamping the end to the content length
+func parseRange(rangeStr string, length int64) (start, end int64, err error) {
+	spec := strings.TrimPrefix(rangeStr, "bytes=")
+	if spec == rangeStr || strings.Contains(spec, ",") {
+		return 0, 0, fmt.Errorf("unsupported range: %#v", rangeStr)
+	}
+	dash := strings.Index(spec, "-")
+	if dash < 0 {
+		return 0, 0, fmt.Errorf("invalid range: %#v", rangeStr)
+	}
+	startStr, endStr := spec[:dash], spec[dash+1:]
+	if startStr == "" {
+		suffix, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || suffix <= 0 {
+			return 0, 0, fmt.Errorf("invalid range: %#v", rangeStr)
+		}
+		if suffix > length {
+			suffix = length
+		}
+		return length - suffix, length - 1, nil
+	}
+	start, err = strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start >= length {
+		return 0, 0, fmt.Errorf("invalid range: %#v", rangeStr)
+	}
+	end = length - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, fmt.Errorf("invalid range: %#v", rangeStr)
+		}
+		if end >= length {
+			end = length - 1
+		}
+	}
+	return start, end, nil
+}
@@ -0,0 +1,612 @@
+package fakes
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	swiftAuthPath         = "/auth/v1.0"
+	swiftDefaultAccount   = "AUTH_test"
+	swiftDefaultLimit     = 10000
+	swiftTimeFormat       = "2006-01-02T15:04:05.000000"
+	swiftObjectMetaPrefix = "X-Object-Meta-"
+	swiftSLOHeader        = "X-Static-Large-Object"
+	swiftMaxBulkDeletes   = 10000
+	swiftMaxSLOSegments   = 1000
+)
+
+// ------------------------------------------------------------
+// SwiftServer type
+
+// SwiftServer is an in-process HTTP server implementing enough of the
+// OpenStack Swift API to exercise SwiftTarget and SwiftObject: TempAuth (v1)
+// authentication; container creation and listing; object PUT, GET (including
+// ranged GET), HEAD, and DELETE; dynamic and static large objects (DLOs and
+// SLOs); and, optionally, bulk delete.
+type SwiftServer struct {
+	User    string
+	Key     string
+	Account string
+
+	// ListingLimit caps the number of entries returned in a single container
+	// listing, regardless of the limit requested (default 10000)
+	ListingLimit int
+
+	// MaxManifestSegments caps the number of segments in a static large object
+	// manifest (default 1000)
+	MaxManifestSegments int
+
+	// BulkDelete enables the bulk delete middleware, advertised in /info
+	BulkDelete bool
+	// BulkDeleteRequests counts the bulk delete requests received
+	BulkDeleteRequests int
+	// IgnoreOpenRanges causes GET requests for an open-ended range
+	// ("bytes=<start>-") to return the whole object, as some proxies do
+	IgnoreOpenRanges bool
+	// IgnoreRanges causes GET requests for any range to return the whole
+	// object
+	IgnoreRanges bool
+	// MalformedResponses causes object requests to be answered with a
+	// malformed HTTP response, which the client sees as a network error
+	MalformedResponses bool
+	// ObjectRequests counts the object requests received
+	ObjectRequests int
+
+	server     *httptest.Server
+	mux        sync.Mutex
+	tokens     map[string]bool
+	containers map[string]map[string]*swiftObject
+}
+
+// NewSwiftServer starts a new SwiftServer listening on a random local port,
+// accepting the specified TempAuth credentials. Use AuthURL() as the endpoint URL.
+func NewSwiftServer(user, key string) *SwiftServer {
+	s := &SwiftServer{
+		User:       user,
+		Key:        key,
+		Account:    swiftDefaultAccount,
+		tokens:     map[string]bool{},
+		containers: map[string]map[string]*swiftObject{},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// ------------------------------
+// Exported methods
+
+// URL returns the base URL of the server, e.g. http://127.0.0.1:port
+func (s *SwiftServer) URL() string {
+	return s.server.URL
+}
+
+// AuthURL returns the TempAuth URL of the server, e.g. http://127.0.0.1:port/auth/v1.0
+func (s *SwiftServer) AuthURL() string {
+	return s.server.URL + swiftAuthPath
+}
+
+// Close shuts down the server
+func (s *SwiftServer) Close() {
+	s.server.Close()
+}
+
+// CreateContainer creates the specified container, if it does not already exist
+func (s *SwiftServer) CreateContainer(container string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, ok := s.containers[container]; !ok {
+		s.containers[container] = map[string]*swiftObject{}
+	}
+}
+
+// Object returns the stored contents of the specified object (for a large
+// object manifest, the manifest itself), its headers, and whether it exists
+func (s *SwiftServer) Object(container, name string) ([]byte, http.Header, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if obj, ok := s.containers[container][name]; ok {
+		return obj.data, obj.header, true
+	}
+	return nil, nil, false
+}
+
+// Names returns the sorted names of all objects in the specified container
+func (s *SwiftServer) Names(container string) []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return sortedNames(s.containers[container], "")
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+type swiftObject struct {
+	data         []byte
+	etag         string
+	lastModified time.Time
+	header       http.Header
+}
+
+// swiftSLOSegment is an entry in a static large object manifest, as uploaded
+// (path, etag, size_bytes) or as returned by ?multipart-manifest=get (name,
+// hash, bytes)
+type swiftSLOSegment struct {
+	Path      string `json:"path,omitempty"`
+	Etag      string `json:"etag,omitempty"`
+	SizeBytes int64  `json:"size_bytes,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+	Bytes     int64  `json:"bytes,omitempty"`
+}
+
+type swiftListEntry struct {
+	Name         string `json:"name,omitempty"`
+	Bytes        int64  `json:"bytes"`
+	Hash         string `json:"hash,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+	Subdir       string `json:"subdir,omitempty"`
+}
+
+// ------------------------------------------------------------
+// Request handling
+
+func (s *SwiftServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if r.URL.Path == swiftAuthPath {
+		s.authenticate(w, r)
+		return
+	}
+	if r.URL.Path == "/info" {
+		s.info(w)
+		return
+	}
+	if !s.tokens[r.Header.Get("X-Auth-Token")] {
+		swiftWriteError(w, r, http.StatusUnauthorized)
+		return
+	}
+
+	accountPrefix := "/v1/" + s.Account
+	if r.URL.Path != accountPrefix && !strings.HasPrefix(r.URL.Path, accountPrefix+"/") {
+		swiftWriteError(w, r, http.StatusNotFound)
+		return
+	}
+	path := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, accountPrefix), "/")
+	container, name := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		container, name = path[:i], path[i+1:]
+	}
+	if container == "" {
+		if _, ok := r.URL.Query()["bulk-delete"]; ok && s.BulkDelete && (r.Method == http.MethodDelete || r.Method == http.MethodPost) {
+			s.bulkDelete(w, r)
+			return
+		}
+		swiftWriteError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+	if name == "" {
+		s.serveContainer(w, r, container)
+		return
+	}
+	s.ObjectRequests++
+	if s.MalformedResponses {
+		swiftWriteMalformed(w)
+		return
+	}
+	objects, ok := s.containers[container]
+	if !ok {
+		swiftWriteError(w, r, http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		s.putObject(w, r, objects, name)
+	case http.MethodGet, http.MethodHead:
+		s.getObject(w, r, objects, name)
+	case http.MethodDelete:
+		if _, ok := objects[name]; !ok {
+			swiftWriteError(w, r, http.StatusNotFound)
+			return
+		}
+		delete(objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		swiftWriteError(w, r, http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *SwiftServer) authenticate(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Auth-User") != s.User || r.Header.Get("X-Auth-Key") != s.Key {
+		swiftWriteError(w, r, http.StatusUnauthorized)
+		return
+	}
+	tokenBytes := make([]byte, 16)
+	_, _ = rand.Read(tokenBytes)
+	token := "AUTH_tk" + hex.EncodeToString(tokenBytes)
+	s.tokens[token] = true
+	w.Header().Set("X-Auth-Token", token)
+	w.Header().Set("X-Storage-Token", token)
+	w.Header().Set("X-Storage-Url", s.URL()+"/v1/"+s.Account)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *SwiftServer) info(w http.ResponseWriter) {
+	info := map[string]interface{}{
+		"swift": map[string]interface{}{"version": "2.0.0"},
+		"slo":   map[string]interface{}{"min_segment_size": 1, "max_manifest_segments": s.maxManifestSegments()},
+	}
+	if s.BulkDelete {
+		info["bulk_delete"] = map[string]interface{}{"max_deletes_per_request": swiftMaxBulkDeletes}
+	}
+	swiftWriteJSON(w, http.StatusOK, info)
+}
+
+func (s *SwiftServer) serveContainer(w http.ResponseWriter, r *http.Request, container string) {
+	objects, exists := s.containers[container]
+	switch r.Method {
+	case http.MethodPut:
+		if exists {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		s.containers[container] = map[string]*swiftObject{}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		if !exists {
+			swiftWriteError(w, r, http.StatusNotFound)
+			return
+		}
+		s.listObjects(w, r, objects)
+	case http.MethodDelete:
+		if !exists {
+			swiftWriteError(w, r, http.StatusNotFound)
+			return
+		}
+		if len(objects) > 0 {
+			swiftWriteError(w, r, http.StatusConflict)
+			return
+		}
+		delete(s.containers, container)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		swiftWriteError(w, r, http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *SwiftServer) putObject(w http.ResponseWriter, r *http.Request, objects map[string]*swiftObject, name string) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		swiftWriteError(w, r, http.StatusBadRequest)
+		return
+	}
+	sum := md5.Sum(data)
+	etag := hex.EncodeToString(sum[:])
+	if expected := r.Header.Get("ETag"); expected != "" && strings.Trim(expected, "\"") != etag {
+		swiftWriteError(w, r, http.StatusUnprocessableEntity)
+		return
+	}
+
+	header := http.Header{}
+	if r.URL.Query().Get("multipart-manifest") == "put" {
+		if data, err = s.sloManifest(data); err != nil {
+			swiftWriteError(w, r, http.StatusBadRequest)
+			return
+		}
+		header.Set(swiftSLOHeader, "True")
+	}
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	for k, v := range r.Header {
+		if k == "X-Object-Manifest" || strings.HasPrefix(k, swiftObjectMetaPrefix) {
+			header[k] = v
+		}
+	}
+	objects[name] = &swiftObject{data: data, etag: etag, lastModified: time.Now().UTC(), header: header}
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *SwiftServer) getObject(w http.ResponseWriter, r *http.Request, objects map[string]*swiftObject, name string) {
+	obj, ok := objects[name]
+	if !ok {
+		swiftWriteError(w, r, http.StatusNotFound)
+		return
+	}
+	data, etag := obj.data, obj.etag
+	if manifest := obj.header.Get("X-Object-Manifest"); manifest != "" {
+		data, etag = s.dloContents(manifest)
+	} else if obj.header.Get(swiftSLOHeader) != "" && r.URL.Query().Get("multipart-manifest") != "get" {
+		data, etag = s.sloContents(obj.data)
+	}
+
+	header := w.Header()
+	for k, v := range obj.header {
+		header[k] = v
+	}
+	header.Set("ETag", etag)
+	header.Set("Last-Modified", obj.lastModified.Format(http.TimeFormat))
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("X-Timestamp", fmt.Sprintf("%d.00000", obj.lastModified.Unix()))
+
+	length := int64(len(data))
+	start, end := int64(0), length-1
+	status := http.StatusOK
+	if rangeStr := r.Header.Get("Range"); rangeStr != "" && !(s.IgnoreRanges || s.IgnoreOpenRanges && isOpenRange(rangeStr)) {
+		var err error
+		start, end, err = parseRange(rangeStr, length)
+		if err != nil {
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", length))
+			swiftWriteError(w, r, http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, length))
+		status = http.StatusPartialContent
+	}
+	header.Set("Content-Length", strconv.FormatInt(end+1-start, 10))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(data[start : end+1])
+	}
+}
+
+func (s *SwiftServer) listObjects(w http.ResponseWriter, r *http.Request, objects map[string]*swiftObject) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	marker := query.Get("marker")
+	endMarker := query.Get("end_marker")
+	limit := swiftDefaultLimit
+	if s.ListingLimit > 0 {
+		limit = s.ListingLimit
+	}
+	if v := query.Get("limit"); v != "" {
+		if requested, err := strconv.Atoi(v); err == nil && requested < limit {
+			limit = requested
+		}
+	}
+
+	var entries []swiftListEntry
+	lastSubdir := ""
+	for _, name := range sortedNames(objects, prefix) {
+		if name <= marker || (endMarker != "" && name >= endMarker) {
+			continue
+		}
+		if len(entries) >= limit {
+			break
+		}
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				subdir := name[:len(prefix)+i+len(delimiter)]
+				if subdir != lastSubdir {
+					lastSubdir = subdir
+					entries = append(entries, swiftListEntry{Subdir: subdir})
+				}
+				continue
+			}
+		}
+		obj := objects[name]
+		entries = append(entries, swiftListEntry{
+			Name:         name,
+			Bytes:        int64(len(obj.data)),
+			Hash:         obj.etag,
+			LastModified: obj.lastModified.Format(swiftTimeFormat),
+			ContentType:  obj.header.Get("Content-Type"),
+		})
+	}
+
+	w.Header().Set("X-Container-Object-Count", strconv.Itoa(len(objects)))
+	if query.Get("format") != "json" && !strings.Contains(r.Header.Get("Accept"), "json") {
+		var sb strings.Builder
+		for _, e := range entries {
+			if e.Subdir != "" {
+				sb.WriteString(e.Subdir + "\n")
+			} else {
+				sb.WriteString(e.Name + "\n")
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if len(entries) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(sb.String()))
+		}
+		return
+	}
+	if entries == nil {
+		entries = []swiftListEntry{}
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	swiftWriteJSON(w, http.StatusOK, entries)
+}
+
+// dloContents returns the concatenated contents of the segments of a dynamic
+// large object, along with the combined ETag (the MD5 of the concatenated
+// segment ETags, quoted, as returned by Swift)
+func (s *SwiftServer) dloContents(manifest string) ([]byte, string) {
+	segContainer, prefix := manifest, ""
+	if i := strings.Index(manifest, "/"); i >= 0 {
+		segContainer, prefix = manifest[:i], manifest[i+1:]
+	}
+	segments := s.containers[segContainer]
+	var data []byte
+	var etags strings.Builder
+	for _, name := range sortedNames(segments, prefix) {
+		seg := segments[name]
+		data = append(data, seg.data...)
+		etags.WriteString(seg.etag)
+	}
+	return data, fmt.Sprintf("\"%x\"", md5.Sum([]byte(etags.String())))
+}
+
+// sloManifest validates an uploaded static large object manifest against the
+// stored segments, returning the manifest as stored (in the format returned
+// by ?multipart-manifest=get)
+func (s *SwiftServer) sloManifest(data []byte) ([]byte, error) {
+	var uploaded []swiftSLOSegment
+	if err := json.Unmarshal(data, &uploaded); err != nil {
+		return nil, err
+	}
+	if len(uploaded) > s.maxManifestSegments() {
+		return nil, fmt.Errorf("too many segments: %d > %d", len(uploaded), s.maxManifestSegments())
+	}
+	stored := make([]swiftSLOSegment, len(uploaded))
+	for i, seg := range uploaded {
+		path := strings.TrimPrefix(seg.Path, "/")
+		segContainer, name := splitSwiftPath(path)
+		obj, ok := s.containers[segContainer][name]
+		if !ok {
+			return nil, fmt.Errorf("segment %v not found", path)
+		}
+		if seg.Etag != "" && seg.Etag != obj.etag {
+			return nil, fmt.Errorf("segment %v: expected etag %v, was %v", path, seg.Etag, obj.etag)
+		}
+		if seg.SizeBytes != 0 && seg.SizeBytes != int64(len(obj.data)) {
+			return nil, fmt.Errorf("segment %v: expected %d bytes, was %d", path, seg.SizeBytes, len(obj.data))
+		}
+		stored[i] = swiftSLOSegment{Name: "/" + path, Hash: obj.etag, Bytes: int64(len(obj.data))}
+	}
+	return json.Marshal(stored)
+}
+
+func (s *SwiftServer) maxManifestSegments() int {
+	if s.MaxManifestSegments > 0 {
+		return s.MaxManifestSegments
+	}
+	return swiftMaxSLOSegments
+}
+
+// sloContents returns the concatenated contents of the segments of a static
+// large object, along with the combined ETag (the MD5 of the concatenated
+// segment ETags, quoted, as returned by Swift). Missing segments are skipped.
+func (s *SwiftServer) sloContents(manifest []byte) ([]byte, string) {
+	var segments []swiftSLOSegment
+	_ = json.Unmarshal(manifest, &segments)
+	var data []byte
+	var etags strings.Builder
+	for _, seg := range segments {
+		segContainer, name := splitSwiftPath(strings.TrimPrefix(seg.Name, "/"))
+		if obj, ok := s.containers[segContainer][name]; ok {
+			data = append(data, obj.data...)
+		}
+		etags.WriteString(seg.Hash)
+	}
+	return data, fmt.Sprintf("\"%x\"", md5.Sum([]byte(etags.String())))
+}
+
+// bulkDelete deletes the objects listed, one URL-encoded /container/object
+// path per line, in the request body
+func (s *SwiftServer) bulkDelete(w http.ResponseWriter, r *http.Request) {
+	s.BulkDeleteRequests++
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		swiftWriteError(w, r, http.StatusBadRequest)
+		return
+	}
+	var deleted, notFound int
+	failures := [][]string{}
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		path, err := url.PathUnescape(line)
+		if err != nil {
+			failures = append(failures, []string{line, "400 Bad Request"})
+			continue
+		}
+		container, name := splitSwiftPath(strings.TrimPrefix(path, "/"))
+		if _, ok := s.containers[container][name]; !ok {
+			notFound++
+			continue
+		}
+		delete(s.containers[container], name)
+		deleted++
+	}
+	status := "200 OK"
+	if len(failures) > 0 {
+		status = "400 Bad Request"
+	}
+	swiftWriteJSON(w, http.StatusOK, map[string]interface{}{
+		"Number Deleted":   deleted,
+		"Number Not Found": notFound,
+		"Response Status":  status,
+		"Response Body":    "",
+		"Errors":           failures,
+	})
+}
+
+// ------------------------------------------------------------
+// Unexported utility functions
+
+func splitSwiftPath(path string) (container, name string) {
+	if i := strings.Index(path, "/"); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+func sortedNames(objects map[string]*swiftObject, prefix string) []string {
+	var names []string
+	for name := range objects {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func swiftWriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+func swiftWriteError(w http.ResponseWriter, r *http.Request, status int) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+func swiftWriteMalformed(w http.ResponseWriter) {
+	conn, buf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	_, _ = buf.WriteString("HTTP/1.1 malformed\r\n\r\n")
+	_ = buf.Flush()
+}
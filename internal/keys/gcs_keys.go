@@ -0,0 +1,56 @@
+package keys
+
+import "strings"
+
+var allGCSKeys []string
+
+// GCSKeys returns keys probing the Google Cloud Storage object naming rules
+// (https://cloud.google.com/storage/docs/naming#objectnames): names must be
+// 1-1024 bytes of valid UTF-8, must not contain carriage returns or line feeds,
+// must not be "." or "..", and must not start with ".well-known/acme-challenge/".
+// Also included are characters GCS recommends avoiding, and near misses for
+// each rule that should be accepted.
+func GCSKeys() []string {
+	if len(allGCSKeys) == 0 {
+		allGCSKeys = []string{
+			// carriage return and line feed
+			"carriage\rreturn",
+			"line\nfeed",
+			"crlf\r\npair",
+			"trailing-line-feed\n",
+			"\rleading-carriage-return",
+
+			// "." and ".."
+			".",
+			"..",
+			"./dot-path",
+			"../double-dot-path",
+			"...",
+
+			// ACME challenge paths
+			".well-known/acme-challenge/token",
+			".well-known/acme-challenge/",
+			".well-known/acme-challenge",
+			".well-known/other",
+			"nested/.well-known/acme-challenge/token",
+
+			// length limits
+			strings.Repeat("x", 1024),
+			strings.Repeat("x", 1025),
+			strings.Repeat("é", 512),
+			strings.Repeat("é", 512) + "x",
+
+			// characters GCS recommends avoiding
+			"hash#sign",
+			"left[bracket",
+			"right]bracket",
+			"aster*isk",
+			"question?mark",
+			"delete\u007fcontrol",
+			"c1\u0080control",
+			"c1\u009fcontrol",
+			"tab\tcharacter",
+		}
+	}
+	return allGCSKeys
+}
@@ -110,6 +110,13 @@ func init() {
 		MiscKeys(),
 	)
 	addKeyList(misc)
+
+	gcs := NewKeyList(
+		"gcs",
+		"Google Cloud Storage object naming rules, incl. CR/LF, dot paths & ACME challenges",
+		GCSKeys(),
+	)
+	addKeyList(gcs)
 }
 
 func filterKeys(keys []string, re string) []string {
@@ -61,8 +61,6 @@ func (r *ProgressReporter) monitorProgress(logger Logger, interval time.Duration
 			if currentBytes >= expectedBytes {
 				return
 			}
-		default:
-			// wait for next tick
 		}
 	}
 }
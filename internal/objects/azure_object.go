@@ -0,0 +1,246 @@
+package objects
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/streaming"
+)
+
+// ------------------------------------------------------------
+// AzureObject type
+
+type AzureObject struct {
+	Endpoint *AzureTarget
+	Name     string
+}
+
+// ------------------------------
+// Object implementation
+
+func (obj *AzureObject) Pretty() string {
+	return fmt.Sprintf("azure://%v/%v", obj.Endpoint.Container, obj.Name)
+}
+
+func (obj *AzureObject) String() string {
+	return obj.Pretty()
+}
+
+func (obj *AzureObject) GetEndpoint() Target {
+	return obj.Endpoint
+}
+
+func (obj *AzureObject) ContentLength() (length int64, err error) {
+	resp, err := obj.Endpoint.do(http.MethodHead, obj.url(nil), nil, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	lengthStr := resp.Header.Get("Content-Length")
+	if lengthStr == "" {
+		return 0, fmt.Errorf("no Content-Length in properties for %v", obj)
+	}
+	return strconv.ParseInt(lengthStr, 10, 64)
+}
+
+// Stat returns the blob's properties. Block blobs committed from staged blocks
+// are identified by listing their committed blocks.
+func (obj *AzureObject) Stat() (info *ObjectInfo, err error) {
+	resp, err := obj.Endpoint.do(http.MethodHead, obj.url(nil), nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	header := resp.Header
+	info = &ObjectInfo{
+		URL:         obj.Pretty(),
+		ETag:        trimETag(header.Get("ETag")),
+		ContentType: header.Get("Content-Type"),
+		Metadata:    metadataFromHeaders(header, "X-Ms-Meta-"),
+	}
+	if info.ContentLength, err = strconv.ParseInt(header.Get("Content-Length"), 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid Content-Length in properties for %v: %v", obj, err)
+	}
+	if lastModified := header.Get("Last-Modified"); lastModified != "" {
+		if info.LastModified, err = http.ParseTime(lastModified); err != nil {
+			return nil, err
+		}
+	}
+	if header.Get("x-ms-blob-type") == "BlockBlob" {
+		blocks, err := obj.committedBlocks()
+		if err != nil {
+			return nil, err
+		}
+		if blocks > 0 {
+			info.LargeObject = LargeObjectBlocks
+			info.Parts = blocks
+		}
+	}
+	return info, nil
+}
+
+func (obj *AzureObject) DownloadRange(startInclusive, endInclusive int64, buffer []byte) (n int64, err error) {
+	header := http.Header{}
+	header.Set("x-ms-range", fmt.Sprintf("bytes=%d-%d", startInclusive, endInclusive))
+	resp, err := obj.Endpoint.do(http.MethodGet, obj.url(nil), header, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	if err = checkRangeResponse(obj, resp, startInclusive); err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	err = streaming.ReadExactly(resp.Body, buffer)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(buffer)), nil
+}
+
+// Stream returns the body of a single Get Blob request for the blob's content
+// from the specified offset to the end
+func (obj *AzureObject) Stream(startInclusive int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	header.Set("x-ms-range", fmt.Sprintf("bytes=%d-", startInclusive))
+	resp, err := obj.Endpoint.do(http.MethodGet, obj.url(nil), header, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkRangeResponse(obj, resp, startInclusive); err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Create uploads the blob as a single Put Blob request if its length is no
+// more than the target block size, or otherwise as a series of staged blocks
+// committed with Put Block List. Sending checksums (see WithChecksums) is
+// not supported.
+func (obj *AzureObject) Create(body io.Reader, length int64, options ...CreateOption) (err error) {
+	if NewCreateOptions(options...).SendChecksum {
+		return ErrChecksumNotSupported
+	}
+	logger := logging.DefaultLogger()
+	blockSize := obj.Endpoint.BlockSizeFor(length)
+	if length <= blockSize {
+		header := http.Header{}
+		header.Set("x-ms-blob-type", "BlockBlob")
+		resp, err := obj.Endpoint.do(http.MethodPut, obj.url(nil), header, body, length)
+		if err != nil {
+			logger.Tracef("Error uploading %v: %v\n", obj, err)
+			return err
+		}
+		_ = resp.Body.Close()
+		logger.Tracef("Wrote %d bytes to %v\n", length, obj)
+		return nil
+	}
+
+	logger.Tracef(
+		"Object size %d is greater than block size %d; uploading staged blocks\n",
+		length, blockSize,
+	)
+	var blockIDs []string
+	buffer := make([]byte, blockSize)
+	for written := int64(0); written < length; {
+		size := blockSize
+		if remaining := length - written; remaining < size {
+			size = remaining
+		}
+		block := buffer[:size]
+		err = streaming.ReadExactly(body, block)
+		if err != nil {
+			logger.Tracef("Error reading block %d of %v: %v\n", len(blockIDs), obj, err)
+			return err
+		}
+		blockID := azureBlockID(len(blockIDs))
+		query := url.Values{"comp": {"block"}, "blockid": {blockID}}
+		resp, err := obj.Endpoint.do(http.MethodPut, obj.url(query), nil, bytes.NewReader(block), size)
+		if err != nil {
+			logger.Tracef("Error staging block %d of %v: %v\n", len(blockIDs), obj, err)
+			return err
+		}
+		_ = resp.Body.Close()
+		blockIDs = append(blockIDs, blockID)
+		written += size
+	}
+
+	blockList, err := xml.Marshal(azureBlockList{Latest: blockIDs})
+	if err != nil {
+		return err
+	}
+	blockList = append([]byte(xml.Header), blockList...)
+	query := url.Values{"comp": {"blocklist"}}
+	resp, err := obj.Endpoint.do(http.MethodPut, obj.url(query), nil, bytes.NewReader(blockList), int64(len(blockList)))
+	if err != nil {
+		logger.Tracef("Error committing block list for %v: %v\n", obj, err)
+		return err
+	}
+	_ = resp.Body.Close()
+	logger.Tracef("Wrote %d bytes to %v in %d blocks\n", length, obj, len(blockIDs))
+	return nil
+}
+
+func (obj *AzureObject) Delete() (err error) {
+	logger := logging.DefaultLogger()
+	logger.Tracef("Deleting %v\n", obj)
+	resp, err := obj.Endpoint.do(http.MethodDelete, obj.url(nil), nil, nil, 0)
+	if err != nil {
+		logger.Tracef("Deleting %v failed: %v", obj, err)
+		return err
+	}
+	_ = resp.Body.Close()
+	logger.Tracef("Deleted %v\n", obj)
+	return nil
+}
+
+// ------------------------------
+// Unexported types and functions
+
+type azureBlockList struct {
+	XMLName xml.Name `xml:"BlockList"`
+	Latest  []string `xml:"Latest"`
+}
+
+// committedBlocks returns the number of committed blocks in a block blob,
+// which is zero for blobs uploaded with a single Put Blob request
+func (obj *AzureObject) committedBlocks() (int, error) {
+	query := url.Values{"comp": {"blocklist"}, "blocklisttype": {"committed"}}
+	resp, err := obj.Endpoint.do(http.MethodGet, obj.url(query), nil, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	var result struct {
+		CommittedBlocks []struct {
+			Name string `xml:"Name"`
+		} `xml:"CommittedBlocks>Block"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return 0, err
+	}
+	return len(result.CommittedBlocks), nil
+}
+
+func (obj *AzureObject) url(query url.Values) *url.URL {
+	return obj.Endpoint.blobURL(obj.Name, query)
+}
+
+// azureBlockID returns a block ID for the specified block index; Azure
+// requires all block IDs in a blob to be base64-encoded and of equal length.
+func azureBlockID(index int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", index)))
+}
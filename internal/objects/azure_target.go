@@ -0,0 +1,352 @@
+package objects
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmolesUC3/cos/internal/streaming"
+)
+
+const (
+	AzureAccountEnvVar = "AZURE_STORAGE_ACCOUNT"
+	AzureKeyEnvVar     = "AZURE_STORAGE_KEY"
+
+	azureAPIVersion = "2019-02-02"
+	azureMaxBlocks  = 50000
+)
+
+// ------------------------------------------------------------
+// AzureTarget type
+
+// AzureTarget is an Azure Blob Storage container, accessed via the Blob
+// service REST API with shared key authentication
+type AzureTarget struct {
+	Account   string
+	Endpoint  *url.URL
+	Container string
+
+	// BlockSize is the size above which blobs are uploaded as staged blocks,
+	// and the size of each block; if zero, the default of 5 MiB is used
+	BlockSize int64
+
+	key    []byte
+	client *http.Client
+}
+
+// ------------------------------
+// Factory method
+
+// NewAzureTarget creates a new AzureTarget for the specified container, using
+// the account name and shared key from the AZURE_STORAGE_ACCOUNT and
+// AZURE_STORAGE_KEY environment variables. If endpointURL is nil, the default
+// endpoint for the account, https://<account>.blob.core.windows.net, is used.
+// For path-style endpoints such as the Azurite emulator, the endpoint URL
+// should include the account name, e.g. http://127.0.0.1:10000/devstoreaccount1
+func NewAzureTarget(endpointURL *url.URL, container string) (*AzureTarget, error) {
+	account := os.Getenv(AzureAccountEnvVar)
+	if account == "" {
+		return nil, errors.New("missing environment variable $" + AzureAccountEnvVar)
+	}
+	keyStr := os.Getenv(AzureKeyEnvVar)
+	if keyStr == "" {
+		return nil, errors.New("missing environment variable $" + AzureKeyEnvVar)
+	}
+	key, err := base64.StdEncoding.DecodeString(keyStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $%v (expected base64-encoded shared key): %v", AzureKeyEnvVar, err)
+	}
+	if endpointURL == nil {
+		endpointURL, err = url.Parse(fmt.Sprintf("https://%v.blob.core.windows.net", account))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &AzureTarget{Account: account, Endpoint: endpointURL, Container: container, key: key, client: &http.Client{}}, nil
+}
+
+// ------------------------------
+// Target implementation
+
+func (t *AzureTarget) Object(key string) Object {
+	return &AzureObject{Endpoint: t, Name: key}
+}
+
+// List lists blobs with the List Blobs operation, following NextMarker
+func (t *AzureTarget) List(prefix, delimiter string, fn ListFunc) error {
+	marker := ""
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		resp, err := t.do(http.MethodGet, t.containerURL(query), nil, nil, 0)
+		if err != nil {
+			return err
+		}
+		var result azureListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		var objects []ObjectSummary
+		for _, b := range result.Blobs {
+			lastModified, _ := time.Parse(http.TimeFormat, b.Properties.LastModified)
+			objects = append(objects, ObjectSummary{
+				Key:          b.Name,
+				Size:         b.Properties.ContentLength,
+				ETag:         trimETag(b.Properties.Etag),
+				LastModified: lastModified,
+			})
+		}
+		var prefixes []string
+		for _, p := range result.BlobPrefixes {
+			prefixes = append(prefixes, p.Name)
+		}
+		for _, summary := range mergeListing(objects, prefixes) {
+			if err := fn(summary); err != nil {
+				return listResult(err)
+			}
+		}
+
+		if result.NextMarker == "" {
+			return nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+func (t *AzureTarget) Pretty() string {
+	var keyStr string
+	if len(t.key) == 0 {
+		keyStr = "<not set>"
+	} else {
+		keyStr = "<hidden>"
+	}
+
+	var endpointStr string
+	if t.Endpoint == nil {
+		endpointStr = "<nil>"
+	} else {
+		endpointStr = t.Endpoint.String()
+	}
+
+	return fmt.Sprintf("AzureTarget { Account: %#v, Key: %v, Endpoint: %#v, Container: %#v }",
+		t.Account, keyStr, endpointStr, t.Container)
+}
+
+func (t *AzureTarget) String() string {
+	return t.Pretty()
+}
+
+// ------------------------------
+// Miscellaneous methods
+
+// BlockSizeFor returns the block size to use for a blob of the specified
+// length, increasing the configured block size if necessary to stay within
+// Azure's limit of 50,000 blocks per blob
+func (t *AzureTarget) BlockSizeFor(length int64) int64 {
+	blockSize := t.BlockSize
+	if blockSize <= 0 {
+		blockSize = streaming.DefaultRangeSize
+	}
+	if minSize := (length + azureMaxBlocks - 1) / azureMaxBlocks; blockSize < minSize {
+		blockSize = minSize
+	}
+	return blockSize
+}
+
+func (t *AzureTarget) blobURL(name string, query url.Values) *url.URL {
+	return t.resourceURL("/"+t.Container+"/"+name, query)
+}
+
+func (t *AzureTarget) containerURL(query url.Values) *url.URL {
+	return t.resourceURL("/"+t.Container, query)
+}
+
+func (t *AzureTarget) resourceURL(path string, query url.Values) *url.URL {
+	u := *t.Endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawPath = ""
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+// do signs and sends a request, returning an *AzureError if the response
+// status is not 2xx. The caller is responsible for closing the response body.
+func (t *AzureTarget) do(method string, u *url.URL, header http.Header, body io.Reader, length int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.ContentLength = length
+	if length == 0 {
+		req.Body = nil
+	}
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	req.Header.Set("Authorization", "SharedKey "+t.Account+":"+t.signature(req))
+
+	// the client is never set here, since requests may be made concurrently
+	// (e.g. by Downloader); a target not created with NewAzureTarget uses
+	// the default client
+	client := t.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		return nil, newAzureError(resp)
+	}
+	return resp, nil
+}
+
+// signature computes the shared key signature for the request, as described in
+// https://docs.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+func (t *AzureTarget) signature(req *http.Request) string {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+	h := req.Header
+	lines := []string{
+		req.Method,
+		h.Get("Content-Encoding"),
+		h.Get("Content-Language"),
+		contentLength,
+		h.Get("Content-MD5"),
+		h.Get("Content-Type"),
+		"", // Date (x-ms-date is used instead)
+		h.Get("If-Modified-Since"),
+		h.Get("If-Match"),
+		h.Get("If-None-Match"),
+		h.Get("If-Unmodified-Since"),
+		h.Get("Range"),
+	}
+	stringToSign := strings.Join(lines, "\n") + "\n" + canonicalizedAzureHeaders(h) + t.canonicalizedResource(req.URL)
+
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (t *AzureTarget) canonicalizedResource(u *url.URL) string {
+	var sb strings.Builder
+	sb.WriteString("/" + t.Account + u.EscapedPath())
+	query := u.Query()
+	var names []string
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		sb.WriteString("\n" + strings.ToLower(name) + ":" + strings.Join(values, ","))
+	}
+	return sb.String()
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+type azureListResult struct {
+	Blobs []struct {
+		Name       string
+		Properties struct {
+			LastModified  string `xml:"Last-Modified"`
+			Etag          string
+			ContentLength int64 `xml:"Content-Length"`
+		}
+	} `xml:"Blobs>Blob"`
+	BlobPrefixes []struct {
+		Name string
+	} `xml:"Blobs>BlobPrefix"`
+	NextMarker string
+}
+
+// ------------------------------------------------------------
+// AzureError type
+
+// AzureError represents an error response from the Azure Blob service
+type AzureError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *AzureError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("azure: %d %v", e.StatusCode, e.Code)
+	}
+	return fmt.Sprintf("azure: %d %v: %v", e.StatusCode, e.Code, e.Message)
+}
+
+func newAzureError(resp *http.Response) *AzureError {
+	azureErr := &AzureError{StatusCode: resp.StatusCode, Code: resp.Header.Get("x-ms-error-code")}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err == nil && len(body) > 0 {
+		var parsed struct {
+			Code    string
+			Message string
+		}
+		if xml.Unmarshal(body, &parsed) == nil {
+			if azureErr.Code == "" {
+				azureErr.Code = parsed.Code
+			}
+			azureErr.Message = strings.TrimSpace(strings.SplitN(parsed.Message, "\n", 2)[0])
+		}
+	}
+	if azureErr.Code == "" {
+		azureErr.Code = http.StatusText(resp.StatusCode)
+	}
+	return azureErr
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+func canonicalizedAzureHeaders(h http.Header) string {
+	var names []string
+	for name := range h {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-ms-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(name + ":" + strings.TrimSpace(h.Get(name)) + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,101 @@
+package objects
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+// ErrChecksumNotSupported is returned by Create when checksums are requested
+// (see WithChecksums) from a backend that cannot send them
+var ErrChecksumNotSupported = errors.New("sending checksums on upload not supported")
+
+// ------------------------------------------------------------
+// CreateOptions type
+
+// CreateOptions are the options for Object.Create
+type CreateOptions struct {
+	// SendChecksum causes the object to send checksums of the body along with
+	// it (Content-MD5 for each S3 request, plus x-amz-checksum-sha256 for a
+	// single PutObject request; ETag for each Swift PUT), so that the server
+	// rejects a body corrupted in transit
+	SendChecksum bool
+	// MD5 is the MD5 digest of the whole body, if known; if nil, it is
+	// calculated from the body where needed
+	MD5 []byte
+	// SHA256 is the SHA-256 digest of the whole body, if known; if nil, it
+	// is calculated from the body where needed
+	SHA256 []byte
+	// WrongChecksum causes a deliberately incorrect checksum to be sent, to
+	// confirm that the server rejects it
+	WrongChecksum bool
+}
+
+// CreateOption sets an option for Object.Create
+type CreateOption func(opts *CreateOptions)
+
+// NewCreateOptions returns the CreateOptions resulting from the specified
+// options
+func NewCreateOptions(options ...CreateOption) *CreateOptions {
+	opts := &CreateOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	return opts
+}
+
+// WithChecksums causes Create to send checksums of the body. The MD5 and
+// SHA-256 digests of the whole body may be provided if known, e.g. if they
+// were calculated from the source of the data, so that corruption between
+// the source and the upload is detected as well; either may be nil.
+func WithChecksums(md5Digest, sha256Digest []byte) CreateOption {
+	return func(opts *CreateOptions) {
+		opts.SendChecksum = true
+		opts.MD5 = md5Digest
+		opts.SHA256 = sha256Digest
+	}
+}
+
+// WithWrongChecksums causes Create to send deliberately incorrect checksums
+// of the body, which the server should reject
+func WithWrongChecksums() CreateOption {
+	return func(opts *CreateOptions) {
+		opts.SendChecksum = true
+		opts.WrongChecksum = true
+	}
+}
+
+// ------------------------------
+// Unexported methods
+
+// sent returns the digest to send in place of the specified digest: the
+// digest itself, or, if WrongChecksum is set, a copy with one bit flipped
+func (opts *CreateOptions) sent(digest []byte) []byte {
+	if !opts.WrongChecksum || len(digest) == 0 {
+		return digest
+	}
+	wrong := append([]byte(nil), digest...)
+	wrong[0] ^= 1
+	return wrong
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// seekableDigests calculates the MD5 and SHA-256 digests of the remainder of
+// the specified body, then seeks back to where it started
+func seekableDigests(body io.ReadSeeker) (md5Digest, sha256Digest []byte, err error) {
+	start, err := body.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, nil, err
+	}
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	if _, err = io.Copy(io.MultiWriter(md5Hash, sha256Hash), body); err != nil {
+		return nil, nil, err
+	}
+	if _, err = body.Seek(start, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	return md5Hash.Sum(nil), sha256Hash.Sum(nil), nil
+}
@@ -0,0 +1,61 @@
+package objects
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// DigestAlgorithms lists the digest algorithms supported by NewHash
+var DigestAlgorithms = []string{"md5", "sha1", "sha256", "sha512", "crc32c", "blake2b"}
+
+// ------------------------------------------------------------
+// Exported functions
+
+// NewHash returns a new hash.Hash for the specified algorithm: md5, sha1,
+// sha256, sha512, crc32c (CRC-32 with the Castagnoli polynomial, as used by
+// Google Cloud Storage), or blake2b (BLAKE2b-512).
+func NewHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "crc32c":
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	case "blake2b":
+		return blake2b.New512(nil)
+	}
+	return nil, fmt.Errorf("unsupported digest algorithm: '%v' (expected one of: %v)", algorithm, strings.Join(DigestAlgorithms, ", "))
+}
+
+// NewHashes returns a new hash.Hash for each of the specified algorithms,
+// returning an error if any algorithm is unsupported or repeated
+func NewHashes(algorithms []string) (map[string]hash.Hash, error) {
+	if len(algorithms) == 0 {
+		return nil, fmt.Errorf("no digest algorithm specified")
+	}
+	hashes := map[string]hash.Hash{}
+	for _, algorithm := range algorithms {
+		if _, ok := hashes[algorithm]; ok {
+			return nil, fmt.Errorf("digest algorithm '%v' specified more than once", algorithm)
+		}
+		h, err := NewHash(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		hashes[algorithm] = h
+	}
+	return hashes, nil
+}
@@ -0,0 +1,304 @@
+package objects
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/streaming"
+)
+
+const (
+	// DefaultDownloadConcurrency is the default number of ranges a Downloader
+	// fetches at once
+	DefaultDownloadConcurrency = 4
+)
+
+// ------------------------------------------------------------
+// Downloader type
+
+// Downloader downloads objects as a series of ranged requests. Up to
+// Concurrency ranges are fetched at once, ahead of the writer, and written in
+// order. Each range in flight or awaiting its turn to be written holds one
+// buffer of RangeSize bytes, and no more than Concurrency buffers are
+// allocated, so memory use is bounded by RangeSize * Concurrency regardless of
+// the size of the object. Buffers are drawn from, and returned to, a shared
+// pool (see streaming.SharedBufferPool), so that they are reused across
+// downloads.
+//
+// If Stream is true, and the object supports it (see Streamer), the object is
+// instead downloaded with a single request, streamed through one reusable
+// buffer. Ranged requests are then used only to resume the download if the
+// stream fails partway through.
+type Downloader struct {
+	RangeSize   int64
+	Concurrency int
+	Stream      bool
+}
+
+// NewDownloader returns a new Downloader with the specified range size and
+// concurrency, or the defaults (streaming.DefaultRangeSize and
+// DefaultDownloadConcurrency) if these are zero or negative.
+func NewDownloader(rangeSize int64, concurrency int) *Downloader {
+	if rangeSize <= 0 {
+		rangeSize = streaming.DefaultRangeSize
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultDownloadConcurrency
+	}
+	return &Downloader{RangeSize: rangeSize, Concurrency: concurrency}
+}
+
+// ------------------------------
+// Exported methods
+
+// Download downloads the object, writing the downloaded bytes to the specified
+// io.Writer in order. If any range cannot be downloaded or written, Download
+// stops fetching further ranges and returns the first error encountered.
+func (d *Downloader) Download(obj Object, out io.Writer) (n int64, err error) {
+	return d.DownloadFrom(obj, 0, out)
+}
+
+// DownloadFrom downloads the object starting at the specified offset, e.g. to
+// resume an interrupted download, writing the downloaded bytes to the
+// specified io.Writer in order. The number of bytes returned is the number
+// written, not counting those before the offset.
+func (d *Downloader) DownloadFrom(obj Object, offset int64, out io.Writer) (n int64, err error) {
+	// this will 404 if the object doesn't exist
+	contentLength, err := obj.ContentLength()
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 || offset > contentLength {
+		return 0, fmt.Errorf("offset %d out of range for content length %d of %v", offset, contentLength, obj)
+	}
+	logger := logging.DefaultLogger()
+
+	outWithProgress := logging.NewProgressWriter(out, contentLength-offset)
+	outWithProgress.LogTo(logger, time.Second)
+
+	n, err = d.download(obj, offset, contentLength, outWithProgress)
+	logger.Detailf("%v from %v\n", logging.FormatBytes(n), obj)
+	return n, err
+}
+
+// CalcDigest calculates the digest of the object using the specified algorithm
+// (see NewHash).
+func (d *Downloader) CalcDigest(obj Object, algorithm string) ([]byte, error) {
+	digests, err := d.CalcDigests(obj, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return digests[algorithm], nil
+}
+
+// CalcDigests calculates the digests of the object using each of the specified
+// algorithms (see NewHash), from a single download.
+func (d *Downloader) CalcDigests(obj Object, algorithms ...string) (map[string][]byte, error) {
+	hashes, err := NewHashes(algorithms)
+	if err != nil {
+		return nil, err
+	}
+	var writers []io.Writer
+	for _, algorithm := range algorithms {
+		writers = append(writers, hashes[algorithm])
+	}
+	_, err = d.Download(obj, io.MultiWriter(writers...))
+	if err != nil {
+		return nil, err
+	}
+	digests := map[string][]byte{}
+	for algorithm, h := range hashes {
+		digests[algorithm] = h.Sum(nil)
+	}
+	return digests, nil
+}
+
+func (d *Downloader) Pretty() string {
+	return fmt.Sprintf("Downloader{ RangeSize: %d, Concurrency: %d, Stream: %v }", d.RangeSize, d.Concurrency, d.Stream)
+}
+
+func (d *Downloader) String() string {
+	return d.Pretty()
+}
+
+// ------------------------------
+// Unexported methods
+
+func (d *Downloader) download(obj Object, offset int64, contentLength int64, out io.Writer) (n int64, err error) {
+	if d.Stream && offset < contentLength {
+		if streamer, ok := obj.(Streamer); ok {
+			return d.stream(obj, streamer, offset, contentLength, out)
+		}
+		logging.DefaultLogger().Tracef("%v does not support streaming; using ranged requests\n", obj)
+	}
+	return d.downloadRanges(obj, offset, contentLength, out)
+}
+
+// stream downloads the object with a single request, falling back to ranged
+// requests for the remainder if the stream cannot be opened or ends early
+func (d *Downloader) stream(obj Object, streamer Streamer, offset int64, contentLength int64, out io.Writer) (n int64, err error) {
+	logger := logging.DefaultLogger()
+	in, err := streamer.Stream(offset)
+	if err == ErrStreamNotSupported {
+		logger.Tracef("%v does not support streaming; using ranged requests\n", obj)
+		return d.downloadRanges(obj, offset, contentLength, out)
+	}
+	if err != nil {
+		logger.Detailf("Unable to stream %v from byte %d; using ranged requests: %v\n", obj, offset, err)
+		return d.downloadRanges(obj, offset, contentLength, out)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	pool := streaming.SharedBufferPool(d.RangeSize)
+	buffer := pool.Get()
+	defer pool.Put(buffer)
+
+	remaining := contentLength - offset
+	for remaining > 0 {
+		chunk := buffer
+		if int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		bytesRead, readErr := in.Read(chunk)
+		if bytesRead > 0 {
+			// write errors are not recoverable, so return them immediately
+			if err = streaming.WriteExactly(out, chunk[:bytesRead]); err != nil {
+				return n, err
+			}
+			n += int64(bytesRead)
+			remaining -= int64(bytesRead)
+		}
+		if readErr == io.EOF && remaining > 0 {
+			readErr = io.ErrUnexpectedEOF
+		}
+		if readErr != nil && readErr != io.EOF {
+			resumeAt := offset + n
+			logger.Detailf("Stream of %v interrupted at byte %d of %d; resuming with ranged requests: %v\n", obj, resumeAt, contentLength, readErr)
+			resumed, err := d.downloadRanges(obj, resumeAt, contentLength, out)
+			return n + resumed, err
+		}
+	}
+	return n, nil
+}
+
+// downloadRanges downloads the object as a series of ranged requests
+func (d *Downloader) downloadRanges(obj Object, offset int64, contentLength int64, out io.Writer) (n int64, err error) {
+	rangeSize := d.RangeSize
+	rangeCount := int((contentLength - offset + rangeSize - 1) / rangeSize)
+	if rangeCount == 0 {
+		return 0, nil
+	}
+	concurrency := d.Concurrency
+	if concurrency > rangeCount {
+		concurrency = rangeCount
+	}
+
+	// buffers are handed out in range order, so the next range to be written
+	// always holds a buffer, and the reorder buffer can never deadlock
+	pool := streaming.SharedBufferPool(rangeSize)
+	buffers := make(chan []byte, concurrency)
+	for i := 0; i < concurrency; i++ {
+		buffers <- pool.Get()
+	}
+	jobs := make(chan downloadRange)
+	results := make(chan downloadRange)
+	stop := make(chan struct{})
+
+	// at most concurrency ranges are in flight or pending at once, all with
+	// indices in [next, next + concurrency), so each has its own slot
+	pending := make([]downloadRange, concurrency)
+	defer func() {
+		close(stop)
+		// return the buffers not held by a range still in flight
+		for _, r := range pending {
+			if r.buffer != nil {
+				pool.Put(r.buffer[:cap(r.buffer)])
+			}
+		}
+		for {
+			select {
+			case buffer := <-buffers:
+				pool.Put(buffer)
+			default:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer close(jobs)
+		for index := 0; index < rangeCount; index++ {
+			var buffer []byte
+			select {
+			case buffer = <-buffers:
+			case <-stop:
+				return
+			}
+			start := offset + int64(index)*rangeSize
+			end := start + rangeSize - 1
+			if end >= contentLength {
+				end = contentLength - 1
+			}
+			select {
+			case jobs <- downloadRange{index: index, start: start, end: end, buffer: buffer[:end+1-start]}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			for r := range jobs {
+				bytesRead, err := obj.DownloadRange(r.start, r.end, r.buffer)
+				if err == nil && bytesRead != int64(len(r.buffer)) {
+					err = fmt.Errorf("expected to read %d bytes, got %d", len(r.buffer), bytesRead)
+				}
+				r.err = err
+				select {
+				case results <- r:
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	for next := 0; next < rangeCount; {
+		r := <-results
+		if r.err != nil {
+			return n, fmt.Errorf("error downloading bytes %d-%d of %v: %v", r.start, r.end, obj, r.err)
+		}
+		pending[r.index%concurrency] = r
+		for {
+			slot := next % concurrency
+			r := pending[slot]
+			if r.buffer == nil || r.index != next {
+				break
+			}
+			pending[slot] = downloadRange{}
+			err = streaming.WriteExactly(out, r.buffer)
+			if err != nil {
+				buffers <- r.buffer[:cap(r.buffer)]
+				return n, err
+			}
+			n += int64(len(r.buffer))
+			buffers <- r.buffer[:cap(r.buffer)]
+			next++
+		}
+	}
+	return n, nil
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+type downloadRange struct {
+	index      int
+	start, end int64
+	buffer     []byte
+	err        error
+}
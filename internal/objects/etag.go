@@ -0,0 +1,245 @@
+package objects
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"regexp"
+	"strings"
+
+	"code.cloudfoundry.org/bytefmt"
+)
+
+// commonPartSizes are the default part sizes of commonly used S3 clients,
+// tried when detecting the part size of a multipart upload: the AWS SDKs (5
+// MiB), the AWS CLI (8 MiB), s3cmd (15 MiB), and assorted powers of two.
+var commonPartSizes = []int64{
+	5 * bytefmt.MEGABYTE,
+	8 * bytefmt.MEGABYTE,
+	15 * bytefmt.MEGABYTE,
+	16 * bytefmt.MEGABYTE,
+	32 * bytefmt.MEGABYTE,
+	64 * bytefmt.MEGABYTE,
+	128 * bytefmt.MEGABYTE,
+	256 * bytefmt.MEGABYTE,
+	512 * bytefmt.MEGABYTE,
+	bytefmt.GIGABYTE,
+}
+
+var md5ETagRegexp = regexp.MustCompile("^[0-9a-f]{32}(-[0-9]+)?$")
+
+// ------------------------------------------------------------
+// S3ETag type
+
+// S3ETag computes the ETag S3 assigns to an object uploaded in parts of the
+// specified size: for a single part, the hex-encoded MD5 digest of the
+// content; for multiple parts, the hex-encoded MD5 digest of the concatenated
+// binary MD5 digests of the parts, followed by "-" and the number of parts.
+type S3ETag struct {
+	PartSize int64
+
+	part        hash.Hash
+	partWritten int64
+	partSums    []byte
+}
+
+// NewS3ETag returns a new S3ETag for the specified part size
+func NewS3ETag(partSize int64) *S3ETag {
+	return &S3ETag{PartSize: partSize, part: md5.New()}
+}
+
+// Write adds the specified bytes to the ETag computation. It never returns an error.
+func (e *S3ETag) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		remaining := e.PartSize - e.partWritten
+		chunk := p
+		if int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		_, _ = e.part.Write(chunk)
+		e.partWritten += int64(len(chunk))
+		n += len(chunk)
+		p = p[len(chunk):]
+		if e.partWritten == e.PartSize {
+			e.partSums = e.part.Sum(e.partSums)
+			e.part.Reset()
+			e.partWritten = 0
+		}
+	}
+	return n, nil
+}
+
+// Parts returns the number of parts written so far, including any partial part
+func (e *S3ETag) Parts() int {
+	parts := len(e.partSums) / md5.Size
+	if e.partWritten > 0 {
+		parts++
+	}
+	return parts
+}
+
+// ETag returns the (unquoted) ETag of a single-part upload of the bytes written
+// so far, if they fit in a single part, or otherwise of a multipart upload
+func (e *S3ETag) ETag() string {
+	switch {
+	case len(e.partSums) == 0:
+		return hex.EncodeToString(e.part.Sum(nil))
+	case len(e.partSums) == md5.Size && e.partWritten == 0:
+		return hex.EncodeToString(e.partSums)
+	}
+	return e.MultipartETag()
+}
+
+// MultipartETag returns the (unquoted) ETag of a multipart upload of the bytes
+// written so far, even if they fit in a single part
+func (e *S3ETag) MultipartETag() string {
+	partSums := e.partSums
+	if e.partWritten > 0 || len(partSums) == 0 {
+		partSums = e.part.Sum(append([]byte{}, partSums...))
+	}
+	sum := md5.Sum(partSums)
+	return fmt.Sprintf("%x-%d", sum, len(partSums)/md5.Size)
+}
+
+// ------------------------------------------------------------
+// ETagVerifier type
+
+// ETagVerifier recomputes an S3 ETag from the streamed content of an object,
+// to verify the object's integrity without a stored digest. For a multipart
+// ETag, if no part size is specified, the ETag is recomputed in a single pass
+// for each part size consistent with the object's length and number of parts,
+// from among the part size used by cos itself and those of common clients.
+type ETagVerifier struct {
+	// Expected is the (unquoted) ETag to verify
+	Expected string
+	// Parts is the number of parts in a multipart ETag, or 0 for a single-part ETag
+	Parts int
+
+	candidates []*S3ETag
+}
+
+// NewETagVerifier returns a new ETagVerifier for the specified ETag and
+// content length, trying the specified part size or, if partSize is zero,
+// detecting the part size. It returns an error if the ETag is not an
+// MD5-based S3 ETag, or if the specified part size is inconsistent with the
+// number of parts.
+func NewETagVerifier(etag string, contentLength int64, partSize int64) (*ETagVerifier, error) {
+	expected := strings.Trim(etag, "\"")
+	if !md5ETagRegexp.MatchString(expected) {
+		return nil, fmt.Errorf("ETag %#v is not an MD5-based S3 ETag", etag)
+	}
+	v := &ETagVerifier{Expected: expected, Parts: multipartETagParts(expected)}
+	if v.Parts == 0 {
+		v.candidates = []*S3ETag{NewS3ETag(contentLength + 1)}
+		return v, nil
+	}
+	if partSize > 0 {
+		if !consistentPartSize(contentLength, partSize, v.Parts) {
+			return nil, fmt.Errorf(
+				"part size %d is inconsistent with %d parts for content length %d",
+				partSize, v.Parts, contentLength,
+			)
+		}
+		v.candidates = []*S3ETag{NewS3ETag(partSize)}
+		return v, nil
+	}
+	for _, size := range candidatePartSizes(contentLength, v.Parts) {
+		v.candidates = append(v.candidates, NewS3ETag(size))
+	}
+	if len(v.candidates) == 0 {
+		return nil, fmt.Errorf(
+			"unable to detect part size for %d parts with content length %d; try specifying the part size",
+			v.Parts, contentLength,
+		)
+	}
+	return v, nil
+}
+
+// Write adds the specified bytes to the ETag computation for each candidate
+// part size. It never returns an error.
+func (v *ETagVerifier) Write(p []byte) (n int, err error) {
+	for _, candidate := range v.candidates {
+		_, _ = candidate.Write(p)
+	}
+	return len(p), nil
+}
+
+// PartSizes returns the part sizes tried
+func (v *ETagVerifier) PartSizes() []int64 {
+	var sizes []int64
+	for _, candidate := range v.candidates {
+		sizes = append(sizes, candidate.PartSize)
+	}
+	return sizes
+}
+
+// Verify compares the recomputed ETag(s) with the expected ETag, returning the
+// matching ETag and part size (0 for a single-part ETag), or, if none match,
+// the ETag recomputed for the first part size tried, and an error.
+func (v *ETagVerifier) Verify() (actual string, partSize int64, err error) {
+	for _, candidate := range v.candidates {
+		actual = v.etag(candidate)
+		if actual == v.Expected {
+			if v.Parts == 0 {
+				return actual, 0, nil
+			}
+			return actual, candidate.PartSize, nil
+		}
+	}
+	first := v.candidates[0]
+	actual = v.etag(first)
+	if v.Parts == 0 {
+		return actual, 0, fmt.Errorf("ETag mismatch:\nexpected: %v\nactual: %v", v.Expected, actual)
+	}
+	var sizes []string
+	for _, size := range v.PartSizes() {
+		sizes = append(sizes, fmt.Sprintf("%d", size))
+	}
+	return actual, first.PartSize, fmt.Errorf(
+		"ETag mismatch:\nexpected: %v\nactual: %v (part size %d; tried part sizes: %v)",
+		v.Expected, actual, first.PartSize, strings.Join(sizes, ", "),
+	)
+}
+
+func (v *ETagVerifier) etag(candidate *S3ETag) string {
+	if v.Parts == 0 {
+		return candidate.ETag()
+	}
+	return candidate.MultipartETag()
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// consistentPartSize returns true if an object of the specified length
+// uploaded in parts of the specified size would have the specified number of parts
+func consistentPartSize(contentLength, partSize int64, parts int) bool {
+	if contentLength == 0 {
+		return parts == 1
+	}
+	return numberOfParts(contentLength, partSize) == int64(parts)
+}
+
+// candidatePartSizes returns the plausible part sizes for an object of the
+// specified length uploaded in the specified number of parts, starting with
+// the part size cos itself would use
+func candidatePartSizes(contentLength int64, parts int) []int64 {
+	sizes := []int64{partSize(contentLength)}
+	sizes = append(sizes, commonPartSizes...)
+	// the smallest whole number of MiB that yields the right number of parts,
+	// as chosen by clients that divide the object evenly
+	perPart := (contentLength + int64(parts) - 1) / int64(parts)
+	mib := int64(bytefmt.MEGABYTE)
+	sizes = append(sizes, ((perPart+mib-1)/mib)*mib)
+
+	seen := map[int64]bool{}
+	var candidates []int64
+	for _, size := range sizes {
+		if !seen[size] && consistentPartSize(contentLength, size, parts) {
+			candidates = append(candidates, size)
+		}
+		seen[size] = true
+	}
+	return candidates
+}
@@ -0,0 +1,503 @@
+package objects
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+// Operations into which faults can be injected
+const (
+	// FaultGet is a ranged download (DownloadRange)
+	FaultGet = "get"
+	// FaultPut is an upload (Create)
+	FaultPut = "put"
+	// FaultHead is a metadata request (ContentLength or Stat)
+	FaultHead = "head"
+	// FaultDelete is a delete (Delete)
+	FaultDelete = "delete"
+	// FaultList is a listing (List)
+	FaultList = "list"
+	// FaultAny matches any operation
+	FaultAny = "*"
+)
+
+// Kinds of fault
+const (
+	// FaultError fails the operation with an InjectedError, without performing it
+	FaultError = "error"
+	// FaultLatency delays the operation
+	FaultLatency = "latency"
+	// FaultTruncate returns fewer bytes than requested from a download, or
+	// ends an upload body early
+	FaultTruncate = "truncate"
+	// FaultFlipBit flips a random bit in the downloaded or uploaded data
+	FaultFlipBit = "flipbit"
+)
+
+const (
+	// DefaultFaultStatus is the HTTP status reported by an injected error
+	// fault, if not otherwise specified
+	DefaultFaultStatus = http.StatusServiceUnavailable
+)
+
+var faultOps = []string{FaultGet, FaultPut, FaultHead, FaultDelete, FaultList, FaultAny}
+
+// ------------------------------------------------------------
+// Fault type
+
+// Fault describes a fault to inject into an operation, with a probability
+type Fault struct {
+	Op          string
+	Probability float64
+	Kind        string
+
+	// Latency is the delay for a latency fault
+	Latency time.Duration
+	// StatusCode is the HTTP status reported by an error fault
+	StatusCode int
+}
+
+// ParseFaults parses a comma-separated list of fault specifications, each of
+// the form OP[:PROBABILITY]:FAULT, where OP is get, put, head, delete, list,
+// or * (any operation); PROBABILITY is a percentage (e.g. 5%) or a fraction
+// (e.g. 0.05), defaulting to 100%; and FAULT is one of error[=STATUS],
+// latency=DURATION, truncate, or flipbit. For example:
+//
+//	get:5%:error,put:latency=200ms,get:1%:flipbit
+func ParseFaults(spec string) ([]Fault, error) {
+	var faults []Fault
+	for _, ruleStr := range strings.Split(spec, ",") {
+		ruleStr = strings.TrimSpace(ruleStr)
+		if ruleStr == "" {
+			continue
+		}
+		fault, err := parseFault(ruleStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fault %#v: %v", ruleStr, err)
+		}
+		faults = append(faults, fault)
+	}
+	if len(faults) == 0 {
+		return nil, fmt.Errorf("no faults specified in %#v", spec)
+	}
+	return faults, nil
+}
+
+// Matches returns true if the fault applies to the specified operation
+func (f Fault) Matches(op string) bool {
+	if f.Op != FaultAny && f.Op != op {
+		return false
+	}
+	switch f.Kind {
+	case FaultTruncate, FaultFlipBit:
+		return op == FaultGet || op == FaultPut
+	}
+	return true
+}
+
+// String returns the fault in the format accepted by ParseFaults
+func (f Fault) String() string {
+	kind := f.Kind
+	switch f.Kind {
+	case FaultLatency:
+		kind = fmt.Sprintf("%v=%v", f.Kind, f.Latency)
+	case FaultError:
+		kind = fmt.Sprintf("%v=%d", f.Kind, f.StatusCode)
+	}
+	return fmt.Sprintf("%v:%v%%:%v", f.Op, strconv.FormatFloat(f.Probability*100, 'f', -1, 64), kind)
+}
+
+// ------------------------------------------------------------
+// InjectedError type
+
+// InjectedError is the error returned by an injected error fault
+type InjectedError struct {
+	Op         string
+	StatusCode int
+}
+
+func (e *InjectedError) Error() string {
+	return fmt.Sprintf("injected fault: %v failed with status %d (%v)", e.Op, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// ------------------------------------------------------------
+// FaultInjector type
+
+// FaultInjector decides, for each operation, which faults to inject, and
+// counts the faults injected
+type FaultInjector struct {
+	Faults []Fault
+
+	mutex    sync.Mutex
+	random   *rand.Rand
+	injected map[string]int
+}
+
+// NewFaultInjector returns a new FaultInjector for the specified faults,
+// choosing faults pseudorandomly from the specified seed
+func NewFaultInjector(faults []Fault, seed int64) *FaultInjector {
+	return &FaultInjector{
+		Faults:   faults,
+		random:   rand.New(rand.NewSource(seed)),
+		injected: map[string]int{},
+	}
+}
+
+// Injected returns the number of faults injected so far, by fault
+// specification (see Fault.String)
+func (fi *FaultInjector) Injected() map[string]int {
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	injected := map[string]int{}
+	for k, v := range fi.injected {
+		injected[k] = v
+	}
+	return injected
+}
+
+func (fi *FaultInjector) String() string {
+	specs := make([]string, len(fi.Faults))
+	for i, f := range fi.Faults {
+		specs[i] = f.String()
+	}
+	return fmt.Sprintf("FaultInjector{ %v }", strings.Join(specs, ", "))
+}
+
+// ------------------------------
+// Unexported methods
+
+// choose returns the faults to inject into the specified operation
+func (fi *FaultInjector) choose(op string, description interface{}) []Fault {
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	var chosen []Fault
+	for _, f := range fi.Faults {
+		if !f.Matches(op) || fi.random.Float64() >= f.Probability {
+			continue
+		}
+		fi.injected[f.String()]++
+		logging.DefaultLogger().Detailf("Injecting %v into %v %v\n", f, op, description)
+		chosen = append(chosen, f)
+	}
+	return chosen
+}
+
+// before injects latency and error faults, returning the injected error, if
+// any, and the faults remaining to be applied to the operation's data
+func (fi *FaultInjector) before(op string, description interface{}) ([]Fault, error) {
+	var remaining []Fault
+	var err error
+	for _, f := range fi.choose(op, description) {
+		switch f.Kind {
+		case FaultLatency:
+			time.Sleep(f.Latency)
+		case FaultError:
+			if err == nil {
+				err = &InjectedError{Op: op, StatusCode: f.StatusCode}
+			}
+		default:
+			remaining = append(remaining, f)
+		}
+	}
+	return remaining, err
+}
+
+func (fi *FaultInjector) intn(n int64) int64 {
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	return fi.random.Int63n(n)
+}
+
+// ------------------------------------------------------------
+// FaultTarget type
+
+// FaultTarget decorates a Target, injecting faults into its listings and
+// the operations of its objects, for testing cos itself
+type FaultTarget struct {
+	Target
+	Injector *FaultInjector
+}
+
+// NewFaultTarget returns a new FaultTarget wrapping the specified target
+func NewFaultTarget(target Target, injector *FaultInjector) *FaultTarget {
+	return &FaultTarget{Target: target, Injector: injector}
+}
+
+// Object returns a FaultObject wrapping the specified object in the
+// underlying target
+func (t *FaultTarget) Object(key string) Object {
+	return &FaultObject{Object: t.Target.Object(key), Injector: t.Injector, target: t}
+}
+
+// List lists the underlying target, unless an error fault is injected
+func (t *FaultTarget) List(prefix, delimiter string, fn ListFunc) error {
+	_, err := t.Injector.before(FaultList, t.Target)
+	if err != nil {
+		return err
+	}
+	return t.Target.List(prefix, delimiter, fn)
+}
+
+func (t *FaultTarget) String() string {
+	return fmt.Sprintf("%v (%v)", t.Target, t.Injector)
+}
+
+// ------------------------------------------------------------
+// FaultObject type
+
+// FaultObject decorates an Object, injecting faults into its operations
+type FaultObject struct {
+	Object
+	Injector *FaultInjector
+
+	target Target
+}
+
+// NewFaultObject returns a new FaultObject wrapping the specified object
+func NewFaultObject(obj Object, injector *FaultInjector) *FaultObject {
+	return &FaultObject{Object: obj, Injector: injector}
+}
+
+// GetEndpoint returns the FaultTarget containing this object, if any, or
+// otherwise the underlying object's target
+func (obj *FaultObject) GetEndpoint() Target {
+	if obj.target != nil {
+		return obj.target
+	}
+	return obj.Object.GetEndpoint()
+}
+
+func (obj *FaultObject) ContentLength() (int64, error) {
+	if _, err := obj.Injector.before(FaultHead, obj.Object); err != nil {
+		return 0, err
+	}
+	return obj.Object.ContentLength()
+}
+
+func (obj *FaultObject) Stat() (*ObjectInfo, error) {
+	if _, err := obj.Injector.before(FaultHead, obj.Object); err != nil {
+		return nil, err
+	}
+	return obj.Object.Stat()
+}
+
+func (obj *FaultObject) DownloadRange(startInclusive, endInclusive int64, buffer []byte) (int64, error) {
+	faults, err := obj.Injector.before(FaultGet, obj.Object)
+	if err != nil {
+		return 0, err
+	}
+	n, err := obj.Object.DownloadRange(startInclusive, endInclusive, buffer)
+	if err != nil || n <= 0 {
+		return n, err
+	}
+	for _, f := range faults {
+		switch f.Kind {
+		case FaultTruncate:
+			n = obj.Injector.intn(n)
+		case FaultFlipBit:
+			if n > 0 {
+				bit := obj.Injector.intn(n * 8)
+				buffer[bit/8] ^= 1 << uint(bit%8)
+			}
+		}
+	}
+	return n, nil
+}
+
+// Stream opens a stream from the underlying object, injecting get faults:
+// truncate ends the stream early, and flipbit flips a bit in the first data
+// read.
+func (obj *FaultObject) Stream(startInclusive int64) (io.ReadCloser, error) {
+	s, ok := obj.Object.(Streamer)
+	if !ok {
+		return nil, ErrStreamNotSupported
+	}
+	faults, err := obj.Injector.before(FaultGet, obj.Object)
+	if err != nil {
+		return nil, err
+	}
+	in, err := s.Stream(startInclusive)
+	if err != nil || len(faults) == 0 {
+		return in, err
+	}
+	return &faultReader{ReadCloser: in, faults: faults, injector: obj.Injector}, nil
+}
+
+func (obj *FaultObject) Create(body io.Reader, length int64, options ...CreateOption) error {
+	faults, err := obj.Injector.before(FaultPut, obj.Object)
+	if err != nil {
+		return err
+	}
+	for _, f := range faults {
+		if length <= 0 {
+			break
+		}
+		switch f.Kind {
+		case FaultTruncate:
+			body = io.LimitReader(body, obj.Injector.intn(length))
+		case FaultFlipBit:
+			body = &bitFlipReader{in: body, bit: obj.Injector.intn(length * 8)}
+		}
+	}
+	return obj.Object.Create(body, length, options...)
+}
+
+func (obj *FaultObject) Delete() error {
+	if _, err := obj.Injector.before(FaultDelete, obj.Object); err != nil {
+		return err
+	}
+	return obj.Object.Delete()
+}
+
+func (obj *FaultObject) LastUpload() *UploadInfo {
+	return LastUpload(obj.Object)
+}
+
+func (obj *FaultObject) String() string {
+	return fmt.Sprintf("%v", obj.Object)
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+// faultReader applies truncate and flipbit faults to the first read from a
+// stream; after a truncated read, the stream fails with io.ErrUnexpectedEOF
+type faultReader struct {
+	io.ReadCloser
+	faults    []Fault
+	injector  *FaultInjector
+	truncated bool
+}
+
+func (r *faultReader) Read(p []byte) (n int, err error) {
+	if r.truncated {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n, err = r.ReadCloser.Read(p)
+	if n <= 0 || len(r.faults) == 0 {
+		return n, err
+	}
+	faults := r.faults
+	r.faults = nil
+	for _, f := range faults {
+		switch f.Kind {
+		case FaultTruncate:
+			n = int(r.injector.intn(int64(n)))
+			r.truncated = true
+		case FaultFlipBit:
+			if n > 0 {
+				bit := r.injector.intn(int64(n) * 8)
+				p[bit/8] ^= 1 << uint(bit%8)
+			}
+		}
+	}
+	if r.truncated {
+		return n, nil
+	}
+	return n, err
+}
+
+// bitFlipReader flips the specified bit in the data read through it
+type bitFlipReader struct {
+	in     io.Reader
+	bit    int64
+	offset int64
+}
+
+func (r *bitFlipReader) Read(p []byte) (n int, err error) {
+	n, err = r.in.Read(p)
+	index := r.bit/8 - r.offset
+	if index >= 0 && index < int64(n) {
+		p[index] ^= 1 << uint(r.bit%8)
+	}
+	r.offset += int64(n)
+	return n, err
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+func parseFault(ruleStr string) (Fault, error) {
+	parts := strings.Split(ruleStr, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Fault{}, fmt.Errorf("expected OP[:PROBABILITY]:FAULT")
+	}
+	fault := Fault{Op: strings.ToLower(parts[0]), Probability: 1}
+	if !contains(faultOps, fault.Op) {
+		return Fault{}, fmt.Errorf("unknown operation %#v (expected one of %v)", parts[0], strings.Join(faultOps, ", "))
+	}
+	if len(parts) == 3 {
+		probability, err := parseProbability(parts[1])
+		if err != nil {
+			return Fault{}, err
+		}
+		fault.Probability = probability
+	}
+
+	kindStr := parts[len(parts)-1]
+	kind, value := kindStr, ""
+	if i := strings.Index(kindStr, "="); i >= 0 {
+		kind, value = kindStr[:i], kindStr[i+1:]
+	}
+	fault.Kind = strings.ToLower(kind)
+	switch fault.Kind {
+	case FaultError:
+		fault.StatusCode = DefaultFaultStatus
+		if value != "" {
+			status, err := strconv.Atoi(value)
+			if err != nil || status < 100 || status > 599 {
+				return Fault{}, fmt.Errorf("invalid HTTP status %#v", value)
+			}
+			fault.StatusCode = status
+		}
+		return fault, nil
+	case FaultLatency:
+		latency, err := time.ParseDuration(value)
+		if err != nil {
+			return Fault{}, fmt.Errorf("invalid latency %#v: %v", value, err)
+		}
+		fault.Latency = latency
+		return fault, nil
+	case FaultTruncate, FaultFlipBit:
+		if value != "" {
+			return Fault{}, fmt.Errorf("%v takes no value", fault.Kind)
+		}
+		if fault.Op != FaultAny && fault.Op != FaultGet && fault.Op != FaultPut {
+			return Fault{}, fmt.Errorf("%v applies only to get and put", fault.Kind)
+		}
+		return fault, nil
+	}
+	return Fault{}, fmt.Errorf("unknown fault %#v (expected error, latency, truncate, or flipbit)", kind)
+}
+
+func parseProbability(probabilityStr string) (float64, error) {
+	percent := strings.HasSuffix(probabilityStr, "%")
+	probability, err := strconv.ParseFloat(strings.TrimSuffix(probabilityStr, "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid probability %#v", probabilityStr)
+	}
+	if percent {
+		probability /= 100
+	}
+	if probability < 0 || probability > 1 {
+		return 0, fmt.Errorf("probability %#v is not between 0 and 100%%", probabilityStr)
+	}
+	return probability, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package objects
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/streaming"
+)
+
+// ------------------------------------------------------------
+// FileObject type
+
+type FileObject struct {
+	Endpoint *FileTarget
+	Key      string
+}
+
+// ------------------------------
+// Object implementation
+
+func (obj *FileObject) Pretty() string {
+	return fmt.Sprintf("file://%v/%v", filepath.ToSlash(obj.Endpoint.Dir), obj.Key)
+}
+
+func (obj *FileObject) String() string {
+	return obj.Pretty()
+}
+
+func (obj *FileObject) GetEndpoint() Target {
+	return obj.Endpoint
+}
+
+func (obj *FileObject) ContentLength() (length int64, err error) {
+	path, err := obj.Endpoint.Path(obj.Key)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if info.IsDir() {
+		return 0, fmt.Errorf("%v is a directory", path)
+	}
+	return info.Size(), nil
+}
+
+// Stat returns the file's size and modification time, and a content type
+// guessed from its extension, if any
+func (obj *FileObject) Stat() (info *ObjectInfo, err error) {
+	path, err := obj.Endpoint.Path(obj.Key)
+	if err != nil {
+		return nil, err
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fileInfo.IsDir() {
+		return nil, fmt.Errorf("%v is a directory", path)
+	}
+	return &ObjectInfo{
+		URL:           obj.Pretty(),
+		ContentLength: fileInfo.Size(),
+		ContentType:   mime.TypeByExtension(filepath.Ext(path)),
+		LastModified:  fileInfo.ModTime(),
+	}, nil
+}
+
+func (obj *FileObject) DownloadRange(startInclusive, endInclusive int64, buffer []byte) (n int64, err error) {
+	path, err := obj.Endpoint.Path(obj.Key)
+	if err != nil {
+		return 0, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logging.DefaultLogger().Tracef("error closing %v: %v\n", path, err)
+		}
+	}()
+	err = streaming.ReadExactly(io.NewSectionReader(file, startInclusive, int64(len(buffer))), buffer)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(buffer)), nil
+}
+
+// Stream opens the file, positioned at the specified offset
+func (obj *FileObject) Stream(startInclusive int64) (io.ReadCloser, error) {
+	path, err := obj.Endpoint.Path(obj.Key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = file.Seek(startInclusive, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func (obj *FileObject) Create(body io.Reader, length int64, options ...CreateOption) (err error) {
+	if NewCreateOptions(options...).SendChecksum {
+		return ErrChecksumNotSupported
+	}
+	path, err := obj.Endpoint.Path(obj.Key)
+	if err != nil {
+		return err
+	}
+	logger := logging.DefaultLogger()
+	logger.Detailf("Writing %d bytes to %v\n", length, obj)
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := out.Close()
+		if err2 != nil {
+			logger.Tracef("Error closing %v: %v\n", path, err2)
+			if err == nil {
+				err = err2
+			}
+		}
+	}()
+
+	buffer := make([]byte, streaming.DefaultRangeSize)
+	written, err := io.CopyBuffer(out, body, buffer)
+	if err != nil {
+		logger.Tracef("Error writing to %v: %v\n", path, err)
+		return err
+	}
+	if written != length {
+		return fmt.Errorf("expected to write %d bytes, got %d", length, written)
+	}
+	logger.Tracef("Wrote %d bytes to %v\n", written, obj)
+	return nil
+}
+
+func (obj *FileObject) Delete() (err error) {
+	path, err := obj.Endpoint.Path(obj.Key)
+	if err != nil {
+		return err
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%v is a directory", path)
+	}
+	logger := logging.DefaultLogger()
+	logger.Tracef("Deleting %v\n", obj)
+	err = os.Remove(path)
+	if err != nil {
+		logger.Tracef("Deleting %v failed: %v", obj, err)
+		return err
+	}
+	logger.Tracef("Deleted %v\n", obj)
+	obj.removeEmptyParents(path)
+	return nil
+}
+
+// ------------------------------
+// Unexported methods
+
+// removeEmptyParents removes any directories left empty by deleting the file at
+// the specified path, stopping at the target directory, to mimic the flat key
+// space of a cloud storage bucket
+func (obj *FileObject) removeEmptyParents(path string) {
+	root := obj.Endpoint.Dir
+	for dir := filepath.Dir(path); dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+		// os.Remove fails on non-empty directories, which is what we want
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package objects
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ------------------------------------------------------------
+// FileTarget type
+
+// FileTarget represents a directory on the local filesystem (including
+// network mounts), treated as a bucket
+type FileTarget struct {
+	Dir string
+}
+
+// ------------------------------
+// Factory method
+
+func NewFileTarget(dir string) (*FileTarget, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(absDir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%v is not a directory", absDir)
+	}
+	return &FileTarget{Dir: absDir}, nil
+}
+
+// ------------------------------
+// Target implementation
+
+func (e *FileTarget) Object(key string) Object {
+	return &FileObject{Endpoint: e, Key: key}
+}
+
+// List walks the target directory, treating the slash-separated relative path
+// of each file as its key. Only the subdirectory named by the portion of the
+// prefix up to its last slash is walked.
+func (e *FileTarget) List(prefix, delimiter string, fn ListFunc) error {
+	root := e.Dir
+	if dir := prefixOf(prefix); dir != "" {
+		root = filepath.Join(e.Dir, filepath.FromSlash(dir))
+	}
+	var summaries []ObjectSummary
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(e.Dir, path)
+		if err != nil {
+			return err
+		}
+		summaries = append(summaries, ObjectSummary{
+			Key:          filepath.ToSlash(rel),
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return listSorted(summaries, prefix, delimiter, fn)
+}
+
+func (e *FileTarget) Pretty() string {
+	return fmt.Sprintf("FileTarget{ Dir: %#v }", e.Dir)
+}
+
+func (e *FileTarget) String() string {
+	return e.Pretty()
+}
+
+// ------------------------------
+// Miscellaneous methods
+
+// Path returns the filesystem path for the specified key, returning an error
+// if the path would fall outside the target directory. The key is passed to
+// the filesystem as-is, so that (e.g.) a key containing "a/../b" fails if
+// directory "a" does not exist, rather than silently being cleaned to "b".
+func (e *FileTarget) Path(key string) (string, error) {
+	path := e.Dir + string(os.PathSeparator) + key
+	rel, err := filepath.Rel(e.Dir, filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("key %#v does not resolve to a file in %v", key, e.Dir)
+	}
+	return path, nil
+}
+
+// ------------------------------------------------------------
+// Unexported utility functions
+
+// filePath extracts a filesystem path from a file:// URL, treating any host
+// component as the first element of a relative path
+func filePath(fileURL *url.URL) string {
+	if fileURL.Host == "" {
+		return fileURL.Path
+	}
+	return fileURL.Host + fileURL.Path
+}
@@ -0,0 +1,317 @@
+package objects
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/streaming"
+)
+
+const (
+	gcsMaxNameBytes     = 1024
+	gcsAcmeChallenge    = ".well-known/acme-challenge/"
+	gcsResumeIncomplete = 308
+)
+
+// ------------------------------------------------------------
+// GCSObject type
+
+type GCSObject struct {
+	Endpoint *GCSTarget
+	Name     string
+}
+
+// ------------------------------
+// Object implementation
+
+func (obj *GCSObject) Pretty() string {
+	return fmt.Sprintf("gs://%v/%v", obj.Endpoint.Bucket, obj.Name)
+}
+
+func (obj *GCSObject) String() string {
+	return obj.Pretty()
+}
+
+func (obj *GCSObject) GetEndpoint() Target {
+	return obj.Endpoint
+}
+
+func (obj *GCSObject) ContentLength() (length int64, err error) {
+	metadata, err := obj.metadata()
+	if err != nil {
+		return 0, err
+	}
+	if metadata.Size == "" {
+		return 0, fmt.Errorf("no size in metadata for %v", obj)
+	}
+	return strconv.ParseInt(metadata.Size, 10, 64)
+}
+
+// Stat returns the object's properties. Composite objects are identified by
+// their component count.
+func (obj *GCSObject) Stat() (info *ObjectInfo, err error) {
+	metadata, err := obj.metadata()
+	if err != nil {
+		return nil, err
+	}
+	info = &ObjectInfo{
+		URL:         obj.Pretty(),
+		ETag:        trimETag(metadata.ETag),
+		ContentType: metadata.ContentType,
+		Metadata:    metadata.Metadata,
+	}
+	if info.ContentLength, err = strconv.ParseInt(metadata.Size, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid size in metadata for %v: %v", obj, err)
+	}
+	if metadata.Updated != "" {
+		if info.LastModified, err = time.Parse(time.RFC3339Nano, metadata.Updated); err != nil {
+			return nil, err
+		}
+	}
+	if metadata.ComponentCount > 0 {
+		info.LargeObject = LargeObjectComposite
+		info.Parts = metadata.ComponentCount
+	}
+	return info, nil
+}
+
+func (obj *GCSObject) DownloadRange(startInclusive, endInclusive int64, buffer []byte) (n int64, err error) {
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", startInclusive, endInclusive))
+	urlStr := obj.Endpoint.objectURL(obj.Name, url.Values{"alt": {"media"}})
+	resp, err := obj.Endpoint.do(http.MethodGet, urlStr, header, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	if err = checkRangeResponse(obj, resp, startInclusive); err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	err = streaming.ReadExactly(resp.Body, buffer)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(buffer)), nil
+}
+
+// Stream returns the body of a single media download request for the
+// object's content from the specified offset to the end
+func (obj *GCSObject) Stream(startInclusive int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-", startInclusive))
+	urlStr := obj.Endpoint.objectURL(obj.Name, url.Values{"alt": {"media"}})
+	resp, err := obj.Endpoint.do(http.MethodGet, urlStr, header, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkRangeResponse(obj, resp, startInclusive); err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Create uploads the object with a single media upload if its length is no
+// more than the target chunk size, or otherwise with a resumable upload. If
+// the upload fails and the object name violates one of the GCS object naming
+// rules, the rule is included in the returned error. Sending checksums (see
+// WithChecksums) is not supported.
+func (obj *GCSObject) Create(body io.Reader, length int64, options ...CreateOption) (err error) {
+	if NewCreateOptions(options...).SendChecksum {
+		return ErrChecksumNotSupported
+	}
+	logger := logging.DefaultLogger()
+	if length <= obj.Endpoint.ChunkSize() {
+		err = obj.createSimple(body, length)
+	} else {
+		err = obj.createResumable(body, length)
+	}
+	if err != nil {
+		if nameErr := ValidateGCSObjectName(obj.Name); nameErr != nil {
+			err = fmt.Errorf("%v (%v)", err, nameErr)
+		}
+		logger.Tracef("Error uploading %v: %v\n", obj, err)
+		return err
+	}
+	logger.Tracef("Wrote %d bytes to %v\n", length, obj)
+	return nil
+}
+
+func (obj *GCSObject) Delete() (err error) {
+	logger := logging.DefaultLogger()
+	logger.Tracef("Deleting %v\n", obj)
+	resp, err := obj.Endpoint.do(http.MethodDelete, obj.Endpoint.objectURL(obj.Name, nil), nil, nil, 0)
+	if err != nil {
+		logger.Tracef("Deleting %v failed: %v", obj, err)
+		return err
+	}
+	_ = resp.Body.Close()
+	logger.Tracef("Deleted %v\n", obj)
+	return nil
+}
+
+// ------------------------------------------------------------
+// Object naming rules
+
+// ValidateGCSObjectName returns an error describing the first Google Cloud
+// Storage object naming rule violated by the specified name, or nil if the
+// name violates none of them. See https://cloud.google.com/storage/docs/naming#objectnames
+func ValidateGCSObjectName(name string) error {
+	if name == "" {
+		return fmt.Errorf("GCS object names must not be empty")
+	}
+	if len(name) > gcsMaxNameBytes {
+		return fmt.Errorf("GCS object name (%d bytes) exceeds maximum of %d bytes", len(name), gcsMaxNameBytes)
+	}
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("GCS object names must be valid UTF-8")
+	}
+	if strings.ContainsAny(name, "\r\n") {
+		return fmt.Errorf("GCS object names must not contain carriage return or line feed characters")
+	}
+	if name == "." || name == ".." {
+		return fmt.Errorf("GCS object names must not be %#v", name)
+	}
+	if strings.HasPrefix(name, gcsAcmeChallenge) {
+		return fmt.Errorf("GCS object names must not start with %#v", gcsAcmeChallenge)
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// Unexported methods
+
+func (obj *GCSObject) metadata() (*gcsObjectMetadata, error) {
+	resp, err := obj.Endpoint.do(http.MethodGet, obj.Endpoint.objectURL(obj.Name, nil), nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	var metadata gcsObjectMetadata
+	err = json.NewDecoder(resp.Body).Decode(&metadata)
+	if err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+func (obj *GCSObject) createSimple(body io.Reader, length int64) error {
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	query := url.Values{"uploadType": {"media"}, "name": {obj.Name}}
+	resp, err := obj.Endpoint.do(http.MethodPost, obj.Endpoint.uploadURL(query), header, body, length)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (obj *GCSObject) createResumable(body io.Reader, length int64) error {
+	logger := logging.DefaultLogger()
+	chunkSize := obj.Endpoint.ChunkSize()
+	logger.Tracef(
+		"Object size %d is greater than chunk size %d; using resumable upload\n",
+		length, chunkSize,
+	)
+
+	header := http.Header{}
+	header.Set("X-Upload-Content-Type", "application/octet-stream")
+	header.Set("X-Upload-Content-Length", strconv.FormatInt(length, 10))
+	query := url.Values{"uploadType": {"resumable"}, "name": {obj.Name}}
+	resp, err := obj.Endpoint.do(http.MethodPost, obj.Endpoint.uploadURL(query), header, nil, 0)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	sessionURL := resp.Header.Get("Location")
+	if sessionURL == "" {
+		return fmt.Errorf("no resumable upload session URL returned for %v", obj)
+	}
+
+	buffer := make([]byte, chunkSize)
+	chunks := 0
+	for offset := int64(0); offset < length; {
+		size := chunkSize
+		if remaining := length - offset; remaining < size {
+			size = remaining
+		}
+		chunk := buffer[:size]
+		err = streaming.ReadExactly(body, chunk)
+		if err != nil {
+			return err
+		}
+		persisted, err := obj.putChunk(sessionURL, chunk, offset, length)
+		if err != nil {
+			return err
+		}
+		chunks++
+		offset += size
+		if persisted != offset {
+			return fmt.Errorf(
+				"resumable upload of %v: expected %d bytes persisted after chunk %d, got %d",
+				obj, offset, chunks, persisted,
+			)
+		}
+	}
+	logger.Tracef("Uploaded %v in %d chunks\n", obj, chunks)
+	return nil
+}
+
+// putChunk uploads a chunk of a resumable upload, resending any part of the
+// chunk the server reports as not persisted, and returns the total number of
+// bytes persisted
+func (obj *GCSObject) putChunk(sessionURL string, chunk []byte, offset, total int64) (persisted int64, err error) {
+	end := offset + int64(len(chunk))
+	for start := offset; start < end; {
+		header := http.Header{}
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, total))
+		data := chunk[start-offset:]
+		resp, err := obj.Endpoint.do(http.MethodPut, sessionURL, header, bytes.NewReader(data), int64(len(data)), gcsResumeIncomplete)
+		if err != nil {
+			return start, err
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != gcsResumeIncomplete {
+			// upload complete
+			return end, nil
+		}
+		next, err := gcsPersistedBytes(resp.Header.Get("Range"))
+		if err != nil {
+			return start, err
+		}
+		if next <= start {
+			return next, fmt.Errorf("resumable upload of %v made no progress at offset %d", obj, start)
+		}
+		start = next
+	}
+	return end, nil
+}
+
+// gcsPersistedBytes parses the Range header of a 308 Resume Incomplete
+// response, e.g. "bytes=0-262143", returning the number of bytes persisted
+func gcsPersistedBytes(rangeStr string) (int64, error) {
+	if rangeStr == "" {
+		return 0, nil
+	}
+	i := strings.LastIndex(rangeStr, "-")
+	if i < 0 {
+		return 0, fmt.Errorf("invalid resumable upload range: %#v", rangeStr)
+	}
+	last, err := strconv.ParseInt(rangeStr[i+1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid resumable upload range: %#v", rangeStr)
+	}
+	return last + 1, nil
+}
@@ -0,0 +1,422 @@
+package objects
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmolesUC3/cos/internal/streaming"
+)
+
+const (
+	GCSCredentialsEnvVar = "GOOGLE_APPLICATION_CREDENTIALS"
+
+	DefaultGCSEndpoint = "https://storage.googleapis.com"
+
+	gcsScope           = "https://www.googleapis.com/auth/devstorage.read_write"
+	gcsDefaultTokenURI = "https://oauth2.googleapis.com/token"
+	gcsChunkQuantum    = 256 * 1024
+)
+
+// ------------------------------------------------------------
+// GCSTarget type
+
+// GCSTarget is a Google Cloud Storage bucket, accessed via the JSON API with
+// OAuth 2.0 access tokens obtained for a service account
+type GCSTarget struct {
+	Endpoint *url.URL
+	Bucket   string
+
+	// UploadChunkSize is the size above which objects are uploaded with
+	// resumable uploads, and the size of each chunk; if zero, the default of
+	// 5 MiB is used. It is rounded up to a multiple of 256 KiB, as GCS requires.
+	UploadChunkSize int64
+
+	credentials *gcsCredentials
+
+	// the client and token are shared by concurrent requests (e.g. from
+	// Downloader)
+	clientOnce  sync.Once
+	client      *http.Client
+	tokenMutex  sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// ------------------------------
+// Factory method
+
+// NewGCSTarget creates a new GCSTarget for the specified bucket, authenticating
+// with the service account JSON key file named by the
+// GOOGLE_APPLICATION_CREDENTIALS environment variable. If endpointURL is nil,
+// the default endpoint, https://storage.googleapis.com, is used. If an
+// alternate endpoint is specified (e.g. a local emulator) and no key file is
+// provided, requests are made without authentication.
+func NewGCSTarget(endpointURL *url.URL, bucket string) (*GCSTarget, error) {
+	var credentials *gcsCredentials
+	keyFile := os.Getenv(GCSCredentialsEnvVar)
+	if keyFile != "" {
+		var err error
+		credentials, err = loadGCSCredentials(keyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if endpointURL == nil {
+		if credentials == nil {
+			return nil, errors.New("missing environment variable $" + GCSCredentialsEnvVar)
+		}
+		var err error
+		endpointURL, err = url.Parse(DefaultGCSEndpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &GCSTarget{Endpoint: endpointURL, Bucket: bucket, credentials: credentials}, nil
+}
+
+// ------------------------------
+// Target implementation
+
+func (t *GCSTarget) Object(key string) Object {
+	return &GCSObject{Endpoint: t, Name: key}
+}
+
+// List lists objects with the JSON API objects.list method, following
+// nextPageToken
+func (t *GCSTarget) List(prefix, delimiter string, fn ListFunc) error {
+	pageToken := ""
+	for {
+		query := url.Values{}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		urlStr := t.apiURL("/storage/v1/b/"+url.PathEscape(t.Bucket)+"/o", query)
+		resp, err := t.do(http.MethodGet, urlStr, nil, nil, 0)
+		if err != nil {
+			return err
+		}
+		var result gcsListResult
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		var objects []ObjectSummary
+		for _, item := range result.Items {
+			size, err := strconv.ParseInt(item.Size, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid size %#v for gs://%v/%v", item.Size, t.Bucket, item.Name)
+			}
+			updated, _ := time.Parse(time.RFC3339Nano, item.Updated)
+			objects = append(objects, ObjectSummary{Key: item.Name, Size: size, ETag: trimETag(item.ETag), LastModified: updated})
+		}
+		for _, summary := range mergeListing(objects, result.Prefixes) {
+			if err := fn(summary); err != nil {
+				return listResult(err)
+			}
+		}
+
+		if result.NextPageToken == "" {
+			return nil
+		}
+		pageToken = result.NextPageToken
+	}
+}
+
+func (t *GCSTarget) Pretty() string {
+	var accountStr string
+	if t.credentials == nil {
+		accountStr = "<not set>"
+	} else {
+		accountStr = fmt.Sprintf("%#v", t.credentials.ClientEmail)
+	}
+
+	var endpointStr string
+	if t.Endpoint == nil {
+		endpointStr = "<nil>"
+	} else {
+		endpointStr = t.Endpoint.String()
+	}
+
+	return fmt.Sprintf("GCSTarget { ServiceAccount: %v, Endpoint: %#v, Bucket: %#v }",
+		accountStr, endpointStr, t.Bucket)
+}
+
+func (t *GCSTarget) String() string {
+	return t.Pretty()
+}
+
+// ------------------------------
+// Miscellaneous methods
+
+// ChunkSize returns the resumable upload chunk size, rounded up to a multiple
+// of 256 KiB
+func (t *GCSTarget) ChunkSize() int64 {
+	chunkSize := t.UploadChunkSize
+	if chunkSize <= 0 {
+		chunkSize = streaming.DefaultRangeSize
+	}
+	return ((chunkSize + gcsChunkQuantum - 1) / gcsChunkQuantum) * gcsChunkQuantum
+}
+
+func (t *GCSTarget) objectURL(name string, query url.Values) string {
+	return t.apiURL("/storage/v1/b/"+url.PathEscape(t.Bucket)+"/o/"+url.PathEscape(name), query)
+}
+
+func (t *GCSTarget) uploadURL(query url.Values) string {
+	return t.apiURL("/upload/storage/v1/b/"+url.PathEscape(t.Bucket)+"/o", query)
+}
+
+func (t *GCSTarget) apiURL(escapedPath string, query url.Values) string {
+	urlStr := strings.TrimSuffix(t.Endpoint.String(), "/") + escapedPath
+	if len(query) > 0 {
+		urlStr += "?" + query.Encode()
+	}
+	return urlStr
+}
+
+// do sends an authenticated request, returning a *GCSError if the response
+// status is not 2xx or one of the additional accepted statuses. The caller is
+// responsible for closing the response body.
+func (t *GCSTarget) do(method, urlStr string, header http.Header, body io.Reader, length int64, accept ...int) (*http.Response, error) {
+	req, err := http.NewRequest(method, urlStr, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.ContentLength = length
+	if length == 0 {
+		req.Body = nil
+	}
+	if t.credentials != nil {
+		token, err := t.accessToken()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := t.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return resp, nil
+	}
+	for _, status := range accept {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	return nil, newGCSError(resp)
+}
+
+func (t *GCSTarget) httpClient() *http.Client {
+	t.clientOnce.Do(func() {
+		// resumable upload responses use 308 without a Location header, which
+		// must not be treated as a redirect
+		t.client = &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	})
+	return t.client
+}
+
+// accessToken returns a cached OAuth 2.0 access token, requesting a new one
+// with a signed JWT assertion if there is none or it is about to expire.
+// Concurrent callers wait for a single request for a new token.
+func (t *GCSTarget) accessToken() (string, error) {
+	t.tokenMutex.Lock()
+	defer t.tokenMutex.Unlock()
+	if t.token != "" && time.Now().Add(time.Minute).Before(t.tokenExpiry) {
+		return t.token, nil
+	}
+	assertion, err := t.credentials.assertion(time.Now())
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	resp, err := t.httpClient().PostForm(t.credentials.TokenURI, form)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("gcs: error obtaining access token for %v: %v: %v",
+			t.credentials.ClientEmail, resp.Status, strings.TrimSpace(string(body)))
+	}
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&tokenResp)
+	if err != nil {
+		return "", err
+	}
+	if tokenResp.AccessToken == "" {
+		return "", fmt.Errorf("gcs: no access token returned for %v", t.credentials.ClientEmail)
+	}
+	t.token = tokenResp.AccessToken
+	t.tokenExpiry = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	return t.token, nil
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+type gcsObjectMetadata struct {
+	Name           string            `json:"name"`
+	Size           string            `json:"size"`
+	ETag           string            `json:"etag"`
+	Updated        string            `json:"updated"`
+	ContentType    string            `json:"contentType"`
+	Metadata       map[string]string `json:"metadata"`
+	ComponentCount int               `json:"componentCount"`
+}
+
+type gcsListResult struct {
+	Items         []gcsObjectMetadata `json:"items"`
+	Prefixes      []string            `json:"prefixes"`
+	NextPageToken string              `json:"nextPageToken"`
+}
+
+// ------------------------------------------------------------
+// GCSError type
+
+// GCSError represents an error response from the Google Cloud Storage JSON API
+type GCSError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *GCSError) Error() string {
+	return fmt.Sprintf("gcs: %d %v", e.StatusCode, e.Message)
+}
+
+func newGCSError(resp *http.Response) *GCSError {
+	gcsErr := &GCSError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err == nil && len(body) > 0 {
+		var parsed struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(body, &parsed) == nil && parsed.Error.Message != "" {
+			gcsErr.Message = parsed.Error.Message
+		}
+	}
+	return gcsErr
+}
+
+// ------------------------------------------------------------
+// Service account credentials
+
+type gcsCredentials struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+func loadGCSCredentials(keyFile string) (*gcsCredentials, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	var c gcsCredentials
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account key file %v: %v", keyFile, err)
+	}
+	if c.Type != "service_account" {
+		return nil, fmt.Errorf("invalid service account key file %v: expected type \"service_account\", got %#v", keyFile, c.Type)
+	}
+	if c.TokenURI == "" {
+		c.TokenURI = gcsDefaultTokenURI
+	}
+	block, _ := pem.Decode([]byte(c.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("invalid service account key file %v: no PEM private key found", keyFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account key file %v: %v", keyFile, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid service account key file %v: expected RSA private key", keyFile)
+	}
+	c.key = key
+	return &c, nil
+}
+
+// assertion returns a signed JWT for the OAuth 2.0 JWT bearer grant, as
+// described in https://developers.google.com/identity/protocols/OAuth2ServiceAccount
+func (c *gcsCredentials) assertion(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": c.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   c.ClientEmail,
+		"scope": gcsScope,
+		"aud":   c.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, c.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + enc.EncodeToString(sig), nil
+}
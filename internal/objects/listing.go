@@ -0,0 +1,112 @@
+package objects
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ------------------------------------------------------------
+// ObjectSummary type
+
+// ObjectSummary describes an object, or a common prefix, returned by Target.List()
+type ObjectSummary struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+
+	// IsPrefix indicates a common prefix (e.g. a "directory") standing in for
+	// all keys that share it up to the delimiter, rather than a single object
+	IsPrefix bool
+}
+
+// ------------------------------
+// ListFunc type
+
+// ListFunc is called by Target.List() for each object or common prefix, in
+// key order. If it returns an error, the listing stops and List() returns
+// that error, except for StopListing, which stops the listing without error.
+type ListFunc func(summary ObjectSummary) error
+
+// StopListing can be returned by a ListFunc to stop a listing early without error
+var StopListing = errors.New("stop listing")
+
+// ------------------------------------------------------------
+// Exported functions
+
+// ListAllObjects lists all objects and common prefixes in the target under the
+// specified prefix, returning them as a slice
+func ListAllObjects(target Target, prefix, delimiter string) ([]ObjectSummary, error) {
+	var summaries []ObjectSummary
+	err := target.List(prefix, delimiter, func(summary ObjectSummary) error {
+		summaries = append(summaries, summary)
+		return nil
+	})
+	return summaries, err
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// listSorted implements a listing for targets that can enumerate all their
+// objects locally, filtering by prefix and rolling up keys into common
+// prefixes by delimiter
+func listSorted(summaries []ObjectSummary, prefix, delimiter string, fn ListFunc) error {
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Key < summaries[j].Key
+	})
+	lastPrefix := ""
+	for _, summary := range summaries {
+		if !strings.HasPrefix(summary.Key, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(summary.Key[len(prefix):], delimiter); i >= 0 {
+				commonPrefix := summary.Key[:len(prefix)+i+len(delimiter)]
+				if commonPrefix == lastPrefix {
+					continue
+				}
+				lastPrefix = commonPrefix
+				summary = ObjectSummary{Key: commonPrefix, IsPrefix: true}
+			}
+		}
+		if err := fn(summary); err != nil {
+			return listResult(err)
+		}
+	}
+	return nil
+}
+
+// mergeListing merges the objects and common prefixes from a single page of a
+// listing (each already sorted by key) into key order
+func mergeListing(objects []ObjectSummary, prefixes []string) []ObjectSummary {
+	merged := make([]ObjectSummary, 0, len(objects)+len(prefixes))
+	i, j := 0, 0
+	for i < len(objects) || j < len(prefixes) {
+		if j >= len(prefixes) || (i < len(objects) && objects[i].Key < prefixes[j]) {
+			merged = append(merged, objects[i])
+			i++
+		} else {
+			merged = append(merged, ObjectSummary{Key: prefixes[j], IsPrefix: true})
+			j++
+		}
+	}
+	return merged
+}
+
+// listResult returns the error that should be returned from List() given the
+// error that stopped the listing, if any
+func listResult(err error) error {
+	if err == StopListing {
+		return nil
+	}
+	return err
+}
+
+// trimETag removes the quotes from an ETag, so that Stat and List report the
+// same ETag for an object
+func trimETag(etag string) string {
+	return strings.Trim(etag, "\"")
+}
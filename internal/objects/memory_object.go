@@ -0,0 +1,170 @@
+package objects
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+// ------------------------------------------------------------
+// MemoryObject type
+
+type MemoryObject struct {
+	Endpoint *MemoryTarget
+	Key      string
+}
+
+// ------------------------------
+// Object implementation
+
+func (obj *MemoryObject) Pretty() string {
+	return fmt.Sprintf("mem://%v/%v", obj.Endpoint.Bucket, obj.Key)
+}
+
+func (obj *MemoryObject) String() string {
+	return obj.Pretty()
+}
+
+func (obj *MemoryObject) GetEndpoint() Target {
+	return obj.Endpoint
+}
+
+func (obj *MemoryObject) ContentLength() (length int64, err error) {
+	data, err := obj.data()
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+// Stat returns the object's size and modification time; the ETag is the
+// hex-encoded MD5 digest of its contents, as in List()
+func (obj *MemoryObject) Stat() (info *ObjectInfo, err error) {
+	entry, ok := obj.Endpoint.store.entry(obj.Key)
+	if !ok {
+		return nil, obj.notFound()
+	}
+	sum := md5.Sum(entry.data)
+	return &ObjectInfo{
+		URL:           obj.Pretty(),
+		ContentLength: int64(len(entry.data)),
+		ETag:          hex.EncodeToString(sum[:]),
+		LastModified:  entry.modified,
+	}, nil
+}
+
+func (obj *MemoryObject) DownloadRange(startInclusive, endInclusive int64, buffer []byte) (n int64, err error) {
+	data, err := obj.data()
+	if err != nil {
+		return 0, err
+	}
+	length := int64(len(data))
+	if startInclusive < 0 || startInclusive > endInclusive || endInclusive >= length {
+		return 0, fmt.Errorf("invalid range %d-%d for %v (%d bytes)", startInclusive, endInclusive, obj, length)
+	}
+	copied := copy(buffer, data[startInclusive:endInclusive+1])
+	if copied != len(buffer) {
+		return 0, fmt.Errorf("expected to read %d bytes, got %d", len(buffer), copied)
+	}
+	return int64(copied), nil
+}
+
+// Stream returns a reader for the object's content from the specified offset
+// to the end
+func (obj *MemoryObject) Stream(startInclusive int64) (io.ReadCloser, error) {
+	data, err := obj.data()
+	if err != nil {
+		return nil, err
+	}
+	if startInclusive < 0 || startInclusive > int64(len(data)) {
+		return nil, fmt.Errorf("invalid offset %d for %v (%d bytes)", startInclusive, obj, len(data))
+	}
+	return ioutil.NopCloser(bytes.NewReader(data[startInclusive:])), nil
+}
+
+// Create stores the body in memory. If checksums are sent (see
+// WithChecksums), they are verified against the body, as a server would.
+func (obj *MemoryObject) Create(body io.Reader, length int64, options ...CreateOption) (err error) {
+	rules := obj.Endpoint.Rules
+	if err = rules.ValidateKey(obj.Key); err != nil {
+		return err
+	}
+	if err = rules.ValidateSize(length); err != nil {
+		return err
+	}
+	data := make([]byte, length)
+	_, err = io.ReadFull(body, data)
+	if err != nil {
+		return err
+	}
+	if err = obj.verifyChecksums(data, NewCreateOptions(options...)); err != nil {
+		return err
+	}
+	err = obj.Endpoint.store.put(obj.Key, data, rules.MaxObjectsPerPrefix)
+	if err == nil {
+		logging.DefaultLogger().Tracef("Wrote %d bytes to %v\n", length, obj)
+	}
+	return err
+}
+
+func (obj *MemoryObject) Delete() (err error) {
+	if !obj.Endpoint.store.remove(obj.Key) {
+		return obj.notFound()
+	}
+	logging.DefaultLogger().Tracef("Deleted %v\n", obj)
+	return nil
+}
+
+// ------------------------------
+// Unexported methods
+
+func (obj *MemoryObject) data() ([]byte, error) {
+	data, ok := obj.Endpoint.store.get(obj.Key)
+	if !ok {
+		return nil, obj.notFound()
+	}
+	return data, nil
+}
+
+// verifyChecksums returns an error if the checksums to be sent for the
+// specified data do not match it
+func (obj *MemoryObject) verifyChecksums(data []byte, opts *CreateOptions) error {
+	if !opts.SendChecksum {
+		return nil
+	}
+	md5Digest, sha256Digest := opts.MD5, opts.SHA256
+	if md5Digest == nil {
+		sum := md5.Sum(data)
+		md5Digest = sum[:]
+	}
+	if actual := md5.Sum(data); !bytes.Equal(opts.sent(md5Digest), actual[:]) {
+		return fmt.Errorf("MD5 checksum mismatch for %v: expected %x, got %x", obj, opts.sent(md5Digest), actual)
+	}
+	if sha256Digest != nil {
+		if actual := sha256.Sum256(data); !bytes.Equal(opts.sent(sha256Digest), actual[:]) {
+			return fmt.Errorf("SHA-256 checksum mismatch for %v: expected %x, got %x", obj, opts.sent(sha256Digest), actual)
+		}
+	}
+	return nil
+}
+
+func (obj *MemoryObject) notFound() error {
+	return &memoryNotFoundError{url: obj.Pretty()}
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+type memoryNotFoundError struct {
+	url string
+}
+
+func (e *memoryNotFoundError) Error() string {
+	return fmt.Sprintf("no such object: %v", e.url)
+}
@@ -0,0 +1,262 @@
+package objects
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/bytefmt"
+)
+
+const (
+	// DefaultMemoryMaxObjectSize is the maximum object size enforced by
+	// DefaultMemoryRules, to keep in-memory test runs from exhausting memory
+	DefaultMemoryMaxObjectSize = int64(64 * bytefmt.MEGABYTE)
+)
+
+// DefaultMemoryRules approximates the limitations of a typical cloud storage
+// service, within the constraints of available memory.
+var DefaultMemoryRules = MemoryRules{
+	MaxKeyBytes:   1024,
+	MaxObjectSize: DefaultMemoryMaxObjectSize,
+}
+
+// ------------------------------------------------------------
+// MemoryRules type
+
+// MemoryRules represents the restrictions enforced by a MemoryTarget, simulating
+// the limitations of a real storage service. Zero values indicate no restriction.
+type MemoryRules struct {
+	MaxKeyBytes         int
+	ForbiddenRunes      string
+	MaxObjectSize       int64
+	MaxObjectsPerPrefix int
+}
+
+// MemoryRulesFromQuery parses memory rules from URL query parameters, e.g.
+// mem://bucket?max-key-bytes=1024&forbidden-runes=%5C&max-object-size=5M&max-objects-per-prefix=1000
+func MemoryRulesFromQuery(query url.Values) (rules MemoryRules, err error) {
+	if v := query.Get("max-key-bytes"); v != "" {
+		if rules.MaxKeyBytes, err = strconv.Atoi(v); err != nil {
+			return rules, fmt.Errorf("invalid max-key-bytes %#v: %v", v, err)
+		}
+	}
+	rules.ForbiddenRunes = query.Get("forbidden-runes")
+	if v := query.Get("max-object-size"); v != "" {
+		size, err := parseMemorySize(v)
+		if err != nil {
+			return rules, fmt.Errorf("invalid max-object-size %#v: %v", v, err)
+		}
+		rules.MaxObjectSize = size
+	}
+	if v := query.Get("max-objects-per-prefix"); v != "" {
+		if rules.MaxObjectsPerPrefix, err = strconv.Atoi(v); err != nil {
+			return rules, fmt.Errorf("invalid max-objects-per-prefix %#v: %v", v, err)
+		}
+	}
+	return rules, nil
+}
+
+// ValidateKey returns an error if the specified key violates these rules
+func (r MemoryRules) ValidateKey(key string) error {
+	if r.MaxKeyBytes > 0 && len(key) > r.MaxKeyBytes {
+		return fmt.Errorf("key %#v (%d bytes) exceeds maximum of %d bytes", key, len(key), r.MaxKeyBytes)
+	}
+	if i := strings.IndexAny(key, r.ForbiddenRunes); i >= 0 {
+		return fmt.Errorf("key %#v contains forbidden character %#v", key, string([]rune(key[i:])[0]))
+	}
+	return nil
+}
+
+// ValidateSize returns an error if the specified object size violates these rules
+func (r MemoryRules) ValidateSize(length int64) error {
+	if r.MaxObjectSize > 0 && length > r.MaxObjectSize {
+		return fmt.Errorf("object size %d exceeds maximum of %d bytes", length, r.MaxObjectSize)
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// MemoryTarget type
+
+// MemoryTarget is an in-process Target, for testing and dry runs. Targets with
+// the same bucket name share the same objects.
+type MemoryTarget struct {
+	Bucket string
+	Rules  MemoryRules
+
+	store *memoryStore
+}
+
+// ------------------------------
+// Factory methods
+
+func NewMemoryTarget(bucket string, rules MemoryRules) *MemoryTarget {
+	return &MemoryTarget{Bucket: bucket, Rules: rules, store: memoryStoreFor(bucket)}
+}
+
+func NewMemoryTargetFromURL(bucketURL *url.URL) (*MemoryTarget, error) {
+	rules, err := MemoryRulesFromQuery(bucketURL.Query())
+	if err != nil {
+		return nil, err
+	}
+	return NewMemoryTarget(bucketURL.Host, rules), nil
+}
+
+// ------------------------------
+// Target implementation
+
+func (e *MemoryTarget) Object(key string) Object {
+	return &MemoryObject{Endpoint: e, Key: key}
+}
+
+// List lists the objects currently stored in this target's bucket. The ETag
+// of each object is the hex-encoded MD5 digest of its contents.
+func (e *MemoryTarget) List(prefix, delimiter string, fn ListFunc) error {
+	return listSorted(e.store.summaries(), prefix, delimiter, fn)
+}
+
+func (e *MemoryTarget) Pretty() string {
+	return fmt.Sprintf("MemoryTarget{ Bucket: %#v, Rules: %+v }", e.Bucket, e.Rules)
+}
+
+func (e *MemoryTarget) String() string {
+	return e.Pretty()
+}
+
+// ------------------------------
+// Miscellaneous methods
+
+// Keys returns the keys of all objects currently stored in this target's bucket
+func (e *MemoryTarget) Keys() []string {
+	return e.store.keys()
+}
+
+// Clear deletes all objects in this target's bucket
+func (e *MemoryTarget) Clear() {
+	e.store.clear()
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+type memoryStore struct {
+	mux     sync.RWMutex
+	objects map[string]*memoryEntry
+}
+
+type memoryEntry struct {
+	data     []byte
+	modified time.Time
+}
+
+var memoryStores = map[string]*memoryStore{}
+var memoryStoresMux sync.Mutex
+
+func memoryStoreFor(bucket string) *memoryStore {
+	memoryStoresMux.Lock()
+	defer memoryStoresMux.Unlock()
+	store, ok := memoryStores[bucket]
+	if !ok {
+		store = &memoryStore{objects: map[string]*memoryEntry{}}
+		memoryStores[bucket] = store
+	}
+	return store
+}
+
+func (s *memoryStore) get(key string) ([]byte, bool) {
+	entry, ok := s.entry(key)
+	if !ok {
+		return nil, false
+	}
+	return entry.data, true
+}
+
+func (s *memoryStore) entry(key string) (*memoryEntry, bool) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	entry, ok := s.objects[key]
+	return entry, ok
+}
+
+func (s *memoryStore) put(key string, data []byte, maxPerPrefix int) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, exists := s.objects[key]; !exists && maxPerPrefix > 0 {
+		prefix := prefixOf(key)
+		count := 0
+		for k := range s.objects {
+			if prefixOf(k) == prefix {
+				count++
+			}
+		}
+		if count >= maxPerPrefix {
+			return fmt.Errorf("prefix %#v already contains maximum of %d objects", prefix, maxPerPrefix)
+		}
+	}
+	s.objects[key] = &memoryEntry{data: data, modified: time.Now()}
+	return nil
+}
+
+func (s *memoryStore) remove(key string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	_, ok := s.objects[key]
+	delete(s.objects, key)
+	return ok
+}
+
+func (s *memoryStore) keys() []string {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	var keys []string
+	for k := range s.objects {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (s *memoryStore) summaries() []ObjectSummary {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	var summaries []ObjectSummary
+	for k, entry := range s.objects {
+		sum := md5.Sum(entry.data)
+		summaries = append(summaries, ObjectSummary{
+			Key:          k,
+			Size:         int64(len(entry.data)),
+			ETag:         hex.EncodeToString(sum[:]),
+			LastModified: entry.modified,
+		})
+	}
+	return summaries
+}
+
+func (s *memoryStore) clear() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.objects = map[string]*memoryEntry{}
+}
+
+// ------------------------------------------------------------
+// Unexported utility functions
+
+func prefixOf(key string) string {
+	if i := strings.LastIndex(key, "/"); i >= 0 {
+		return key[:i+1]
+	}
+	return ""
+}
+
+func parseMemorySize(sizeStr string) (int64, error) {
+	if size, err := strconv.ParseInt(sizeStr, 10, 64); err == nil {
+		return size, nil
+	}
+	size, err := bytefmt.ToBytes(sizeStr)
+	return int64(size), err
+}
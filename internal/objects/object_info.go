@@ -0,0 +1,135 @@
+package objects
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// LargeObjectMultipart indicates an S3 object created by multipart upload
+	LargeObjectMultipart = "multipart"
+	// LargeObjectDLO indicates an OpenStack Swift dynamic large object
+	LargeObjectDLO = "dlo"
+	// LargeObjectSLO indicates an OpenStack Swift static large object
+	LargeObjectSLO = "slo"
+	// LargeObjectBlocks indicates an Azure block blob committed from staged blocks
+	LargeObjectBlocks = "blocks"
+	// LargeObjectComposite indicates a Google Cloud Storage composite object
+	LargeObjectComposite = "composite"
+
+	infoTimeFormat = time.RFC3339
+)
+
+// ------------------------------------------------------------
+// ObjectInfo type
+
+// ObjectInfo describes an object's properties, as reported by the storage
+// service. Fields the service does not report are left at their zero values.
+type ObjectInfo struct {
+	URL           string            `json:"url"`
+	ContentLength int64             `json:"contentLength"`
+	ETag          string            `json:"etag,omitempty"` // without quotes
+	ContentType   string            `json:"contentType,omitempty"`
+	LastModified  time.Time         `json:"lastModified"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+
+	// LargeObject indicates how the object was assembled from separately
+	// uploaded parts (one of LargeObjectMultipart, LargeObjectDLO,
+	// LargeObjectSLO, LargeObjectBlocks or LargeObjectComposite), or is empty
+	// if it was uploaded in a single request
+	LargeObject string `json:"largeObject,omitempty"`
+	// Parts is the number of parts, segments, blocks, or components making up
+	// a large object, or 0 if not known
+	Parts int `json:"parts,omitempty"`
+	// Manifest is the <container>/<prefix> of the segments of a Swift dynamic
+	// large object
+	Manifest string `json:"manifest,omitempty"`
+}
+
+// ------------------------------
+// Pretty-printing
+
+// Pretty returns the object info as "Name: value" lines, suitable for display
+func (info *ObjectInfo) Pretty() string {
+	var sb strings.Builder
+	line := func(name string, value interface{}) {
+		sb.WriteString(fmt.Sprintf("%-16v%v\n", name+":", value))
+	}
+	line("URL", info.URL)
+	line("Content-Length", info.ContentLength)
+	if info.ETag != "" {
+		line("ETag", info.ETag)
+	}
+	if info.ContentType != "" {
+		line("Content-Type", info.ContentType)
+	}
+	if !info.LastModified.IsZero() {
+		line("Last-Modified", info.LastModified.UTC().Format(infoTimeFormat))
+	}
+	if info.LargeObject != "" {
+		largeObject := info.LargeObject
+		if info.Parts > 0 {
+			largeObject = fmt.Sprintf("%v (%d parts)", largeObject, info.Parts)
+		}
+		line("Large-Object", largeObject)
+	}
+	if info.Manifest != "" {
+		line("Manifest", info.Manifest)
+	}
+	if len(info.Metadata) > 0 {
+		sb.WriteString("Metadata:\n")
+		var keys []string
+		for k := range info.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sb.WriteString(fmt.Sprintf("  %v: %v\n", k, info.Metadata[k]))
+		}
+	}
+	return sb.String()
+}
+
+func (info *ObjectInfo) String() string {
+	return fmt.Sprintf(
+		"ObjectInfo{ URL: %v, ContentLength: %d, ETag: %v, ContentType: %v, LastModified: %v, LargeObject: %v, Parts: %d }",
+		info.URL, info.ContentLength, info.ETag, info.ContentType, info.LastModified, info.LargeObject, info.Parts,
+	)
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// multipartETagParts returns the number of parts encoded in an S3 multipart
+// upload ETag of the form "<md5 of part md5s>-<parts>", or 0 if the ETag is
+// not a multipart ETag
+func multipartETagParts(etag string) int {
+	etag = strings.Trim(etag, "\"")
+	i := strings.LastIndex(etag, "-")
+	if i < 0 {
+		return 0
+	}
+	parts, err := strconv.Atoi(etag[i+1:])
+	if err != nil || parts < 1 {
+		return 0
+	}
+	return parts
+}
+
+// metadataFromHeaders extracts user metadata from HTTP headers with the
+// specified (canonical) prefix, e.g. "X-Amz-Meta-", lowercasing the names
+func metadataFromHeaders(header map[string][]string, prefix string) map[string]string {
+	metadata := map[string]string{}
+	for k, v := range header {
+		if strings.HasPrefix(k, prefix) && len(v) > 0 {
+			metadata[strings.ToLower(strings.TrimPrefix(k, prefix))] = v[0]
+		}
+	}
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
@@ -1,16 +1,17 @@
 package objects
 
 import (
-	"crypto/md5"
-	"crypto/sha256"
+	"errors"
 	"fmt"
-	"hash"
 	"io"
+	"net/http"
 	"net/url"
-	"time"
+	"os"
+	"path/filepath"
+	"strings"
 
-	"github.com/dmolesUC3/cos/internal/logging"
-	"github.com/dmolesUC3/cos/internal/streaming"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/ncw/swift"
 )
 
 // ------------------------------------------------------------
@@ -19,8 +20,11 @@ import (
 type Object interface {
 	GetEndpoint() Target
 
-	Create(body io.Reader, length int64) (err error)
+	// Create uploads the specified body, of the specified length, as the
+	// content of the object (see CreateOption)
+	Create(body io.Reader, length int64, options ...CreateOption) (err error)
 	ContentLength() (length int64, err error)
+	Stat() (info *ObjectInfo, err error)
 	DownloadRange(startInclusive, endInclusive int64, buffer []byte) (n int64, err error)
 	Delete() (err error)
 
@@ -32,8 +36,20 @@ type Object interface {
 
 func NewObject(objURL, endpointURL *url.URL, regionStr string) (Object, error) {
 	protocol := objURL.Scheme
+	if protocol == protocolFile {
+		dir, key := filepath.Split(filePath(objURL))
+		target, err := NewFileTarget(dir)
+		if err != nil {
+			return nil, err
+		}
+		return target.Object(key), nil
+	}
+
 	bucket := objURL.Host
 	key := objURL.Path
+	if protocol == protocolMemory || protocol == protocolAzure || protocol == protocolGCS {
+		key = strings.TrimPrefix(key, "/")
+	}
 
 	bucketUrlStr := fmt.Sprintf("%v://%v", protocol, bucket)
 	bucketURL, err := url.Parse(bucketUrlStr)
@@ -49,61 +65,101 @@ func NewObject(objURL, endpointURL *url.URL, regionStr string) (Object, error) {
 }
 
 // ------------------------------------------------------------
-// Utility functions
+// Streamer type
+
+// Streamer is implemented by objects that can be downloaded with a single
+// request, streaming the object's content from the specified offset to the
+// end. The caller must close the returned io.ReadCloser. If the offset is
+// not 0 and the response does not start at it, as when a proxy ignores the
+// Range header, Stream returns an error, and the caller can fall back to
+// ranged requests.
+type Streamer interface {
+	Stream(startInclusive int64) (io.ReadCloser, error)
+}
 
-// Download downloads the object in chunks of the specified rangeSize, writing
-// the downloaded bytes to the specified io.Writer.
-func Download(obj Object, rangeSize int64, out io.Writer) (n int64, err error) {
-	// this will 404 if the object doesn't exist
-	contentLength, err := obj.ContentLength()
-	if err != nil {
-		return 0, err
+// ErrStreamNotSupported is returned by decorators implementing Streamer when
+// the object they decorate does not
+var ErrStreamNotSupported = errors.New("streaming not supported")
+
+// checkRange returns an error unless the Content-Range of a response to a
+// request for the object's content starting at startInclusive shows that the
+// response starts there. A server or proxy that ignores the Range header
+// returns the whole object instead, with no Content-Range; when
+// startInclusive is 0, that response still starts at the right byte.
+func checkRange(obj Object, contentRange string, startInclusive int64) error {
+	if startInclusive == 0 {
+		return nil
 	}
-	logger := logging.DefaultLogger()
-
-	outWithProgress := logging.NewProgressWriter(out, contentLength)
-	outWithProgress.LogTo(logger, time.Second)
-
-	expectedBytes := outWithProgress.ExpectedBytes()
-
-	for ; n < expectedBytes; {
-		start, end, size := streaming.NextRange(n, rangeSize, expectedBytes)
-		buffer := make([]byte, size)
-		bytesRead, err := obj.DownloadRange(start, end, buffer)
-		if err != nil {
-			break
-		}
-		err = streaming.WriteExactly(outWithProgress, buffer)
-		if err != nil {
-			break
-		}
-		n += bytesRead
+	if !strings.HasPrefix(contentRange, fmt.Sprintf("bytes %d-", startInclusive)) {
+		return fmt.Errorf("range starting at byte %d of %v not honored (Content-Range: %#v)", startInclusive, obj, contentRange)
 	}
-	logger.Detailf("%v from %v\n", logging.FormatBytes(n), obj)
-	return n, err
+	return nil
 }
 
-// CalcDigest calculates the digest of the object using the specified algorithm
-// (md5 or sha256), using ranged downloads of the specified size.
-func CalcDigest(obj Object, downloadRangeSize int64, algorithm string) ([] byte, error) {
-	h, err := newHash(algorithm)
-	if err != nil {
-		return nil, err
+// checkRangeResponse returns an error unless the response to a request for
+// the object's content starting at startInclusive is a 206 Partial Content
+// response starting there (see checkRange), closing the response body if not
+func checkRangeResponse(obj Object, resp *http.Response, startInclusive int64) error {
+	if startInclusive == 0 {
+		return nil
+	}
+	err := checkRange(obj, resp.Header.Get("Content-Range"), startInclusive)
+	if err == nil && resp.StatusCode != http.StatusPartialContent {
+		err = fmt.Errorf("range starting at byte %d of %v not honored (status %d)", startInclusive, obj, resp.StatusCode)
 	}
-	_, err = Download(obj, downloadRangeSize, h)
 	if err != nil {
-		return nil, err
+		_ = resp.Body.Close()
 	}
-	digest := h.Sum(nil)
-	return digest, nil
+	return err
+}
+
+// ------------------------------------------------------------
+// Utility functions
+
+// Download downloads the object in chunks of the specified rangeSize, writing
+// the downloaded bytes to the specified io.Writer. Up to
+// DefaultDownloadConcurrency chunks are downloaded at once; see Downloader.
+func Download(obj Object, rangeSize int64, out io.Writer) (n int64, err error) {
+	return NewDownloader(rangeSize, DefaultDownloadConcurrency).Download(obj, out)
+}
+
+// CalcDigest calculates the digest of the object using the specified algorithm
+// (see NewHash), using ranged downloads of the specified size.
+func CalcDigest(obj Object, downloadRangeSize int64, algorithm string) ([]byte, error) {
+	return NewDownloader(downloadRangeSize, DefaultDownloadConcurrency).CalcDigest(obj, algorithm)
 }
 
-// newHash returns a new hash of the specified algorithm ("sha256" or "md5")
-func newHash(algorithm string) (hash.Hash, error) {
-	if algorithm == "sha256" {
-		return sha256.New(), nil
-	} else if algorithm == "md5" {
-		return md5.New(), nil
+// CalcDigests calculates the digests of the object using each of the specified
+// algorithms (see NewHash) from a single download, using ranged downloads of
+// the specified size.
+func CalcDigests(obj Object, downloadRangeSize int64, algorithms ...string) (map[string][]byte, error) {
+	return NewDownloader(downloadRangeSize, DefaultDownloadConcurrency).CalcDigests(obj, algorithms...)
+}
+
+// IsNotFound returns true if the specified error, or any error it wraps,
+// indicates that the object does not exist
+func IsNotFound(err error) bool {
+	for err != nil {
+		if os.IsNotExist(err) {
+			return true
+		}
+		switch e := err.(type) {
+		case *memoryNotFoundError:
+			return true
+		case awserr.RequestFailure:
+			return e.StatusCode() == http.StatusNotFound
+		case awserr.Error:
+			return e.Code() == "NotFound" || e.Code() == "NoSuchKey"
+		case *swift.Error:
+			return e.StatusCode == http.StatusNotFound
+		case *AzureError:
+			return e.StatusCode == http.StatusNotFound
+		case *GCSError:
+			return e.StatusCode == http.StatusNotFound
+		case *InjectedError:
+			return e.StatusCode == http.StatusNotFound
+		}
+		err = errors.Unwrap(err)
 	}
-	return nil, fmt.Errorf("unsupported digest algorithm: '%v'\n", algorithm)
+	return false
 }
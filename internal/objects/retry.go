@@ -0,0 +1,359 @@
+package objects
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/ncw/swift"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+const (
+	// DefaultRetryAttempts is the default maximum number of attempts at each
+	// operation, including the first
+	DefaultRetryAttempts = 3
+	// DefaultRetryDelay is the default delay before the first retry
+	DefaultRetryDelay = 500 * time.Millisecond
+	// DefaultRetryMaxDelay is the default maximum delay between retries
+	DefaultRetryMaxDelay = 30 * time.Second
+	// DefaultRetryJitter is the default fraction of each delay that is randomized
+	DefaultRetryJitter = 0.5
+)
+
+// retryableS3Codes are the S3 error codes indicating throttling or timeouts
+var retryableS3Codes = map[string]bool{
+	"SlowDown":            true,
+	"RequestTimeout":      true,
+	"Throttling":          true,
+	"ThrottlingException": true,
+}
+
+// ------------------------------------------------------------
+// RetryPolicy type
+
+// RetryPolicy determines how many times, and how long to wait before, an
+// operation that fails with a retryable error is retried. Delays increase
+// exponentially from BaseDelay, doubling after each attempt, up to MaxDelay;
+// a fraction (Jitter) of each delay is randomized, so that concurrent
+// operations that fail together are not all retried at once.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first; 1
+	// or less means no retries
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Jitter is the fraction of each delay, from 0 to 1, that is randomized
+	Jitter float64
+
+	// Retryable determines whether an error is retryable; if nil, IsRetryable
+	// is used
+	Retryable func(err error) bool
+}
+
+// NewRetryPolicy returns a new RetryPolicy with the defaults
+// (DefaultRetryAttempts, DefaultRetryDelay, DefaultRetryMaxDelay, and
+// DefaultRetryJitter)
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: DefaultRetryAttempts,
+		BaseDelay:   DefaultRetryDelay,
+		MaxDelay:    DefaultRetryMaxDelay,
+		Jitter:      DefaultRetryJitter,
+	}
+}
+
+// ------------------------------
+// Exported methods
+
+// Delay returns the delay before the specified retry (starting with 1 for
+// the first retry), including jitter
+func (p *RetryPolicy) Delay(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	jitter := p.Jitter
+	if jitter <= 0 {
+		return delay
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	randomized := time.Duration(jitter * float64(delay))
+	return delay - randomized + time.Duration(rand.Int63n(int64(randomized)+1))
+}
+
+// Do calls fn until it succeeds, returns an error that is not retryable, or
+// the maximum number of attempts is reached, returning the last error.
+// Retries are logged at Detail level, with a description of the operation
+// from describe, which is called only if the operation is retried.
+func (p *RetryPolicy) Do(describe func() string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !p.retryable(err) {
+			return err
+		}
+		delay := p.Delay(attempt)
+		logging.DefaultLogger().Detailf(
+			"%v failed (attempt %d of %d); retrying in %v: %v\n",
+			describe(), attempt, p.MaxAttempts, delay, err,
+		)
+		time.Sleep(delay)
+	}
+}
+
+func (p *RetryPolicy) Pretty() string {
+	return fmt.Sprintf(
+		"RetryPolicy{ MaxAttempts: %d, BaseDelay: %v, MaxDelay: %v, Jitter: %v }",
+		p.MaxAttempts, p.BaseDelay, p.MaxDelay, p.Jitter,
+	)
+}
+
+func (p *RetryPolicy) String() string {
+	return p.Pretty()
+}
+
+// ------------------------------
+// Unexported methods
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// ------------------------------------------------------------
+// RetryingTarget type
+
+// RetryingTarget decorates a Target, retrying the operations of its objects
+// according to a RetryPolicy (see RetryingObject). Listings are not retried,
+// as the listing function may already have been called for some objects.
+type RetryingTarget struct {
+	Target
+	Policy *RetryPolicy
+}
+
+// NewRetryingTarget returns a new RetryingTarget wrapping the specified
+// target. If the underlying target is a SwiftTarget, the Swift client's own
+// retries are reduced to the one it needs to re-authenticate, so that the
+// policy alone limits the attempts.
+func NewRetryingTarget(target Target, policy *RetryPolicy) *RetryingTarget {
+	disableSwiftClientRetries(target)
+	return &RetryingTarget{Target: target, Policy: policy}
+}
+
+// Object returns a RetryingObject wrapping the specified object in the
+// underlying target
+func (t *RetryingTarget) Object(key string) Object {
+	return &RetryingObject{Object: t.Target.Object(key), Policy: t.Policy, target: t}
+}
+
+func (t *RetryingTarget) String() string {
+	return fmt.Sprintf("%v (%v)", t.Target, t.Policy)
+}
+
+// ------------------------------------------------------------
+// RetryingObject type
+
+// RetryingObject decorates an Object, retrying DownloadRange, Create, Delete,
+// ContentLength, Stat, and opening a Stream when they fail with a retryable
+// error. Create is retried only if the body is an io.Seeker, so that it can
+// be rewound.
+type RetryingObject struct {
+	Object
+	Policy *RetryPolicy
+
+	target Target
+}
+
+// NewRetryingObject returns a new RetryingObject wrapping the specified
+// object. As with NewRetryingTarget, if the object's underlying target is a
+// SwiftTarget, the Swift client's own retries are reduced.
+func NewRetryingObject(obj Object, policy *RetryPolicy) *RetryingObject {
+	disableSwiftClientRetries(obj.GetEndpoint())
+	return &RetryingObject{Object: obj, Policy: policy}
+}
+
+// GetEndpoint returns the RetryingTarget containing this object, if any, or
+// otherwise the underlying object's target
+func (obj *RetryingObject) GetEndpoint() Target {
+	if obj.target != nil {
+		return obj.target
+	}
+	return obj.Object.GetEndpoint()
+}
+
+func (obj *RetryingObject) Create(body io.Reader, length int64, options ...CreateOption) error {
+	seeker, ok := body.(io.Seeker)
+	if !ok {
+		logging.DefaultLogger().Detailf("Create of %v cannot be retried: body cannot be rewound\n", obj.Object)
+		return obj.Object.Create(body, length, options...)
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		logging.DefaultLogger().Detailf("Create of %v cannot be retried: %v\n", obj.Object, err)
+		return obj.Object.Create(body, length, options...)
+	}
+	attempt := 0
+	return obj.Policy.Do(obj.describe("Create"), func() error {
+		attempt++
+		if attempt > 1 {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		return obj.Object.Create(body, length, options...)
+	})
+}
+
+func (obj *RetryingObject) ContentLength() (length int64, err error) {
+	err = obj.Policy.Do(obj.describe("ContentLength"), func() error {
+		length, err = obj.Object.ContentLength()
+		return err
+	})
+	return length, err
+}
+
+func (obj *RetryingObject) Stat() (info *ObjectInfo, err error) {
+	err = obj.Policy.Do(obj.describe("Stat"), func() error {
+		info, err = obj.Object.Stat()
+		return err
+	})
+	return info, err
+}
+
+// DownloadRange downloads the specified range, retrying if the download
+// fails with a retryable error or returns fewer bytes than requested
+func (obj *RetryingObject) DownloadRange(startInclusive, endInclusive int64, buffer []byte) (n int64, err error) {
+	describe := func() string {
+		return fmt.Sprintf("DownloadRange %d-%d of %v", startInclusive, endInclusive, obj.Object)
+	}
+	err = obj.Policy.Do(describe, func() error {
+		n, err = obj.Object.DownloadRange(startInclusive, endInclusive, buffer)
+		if err == nil && n != int64(len(buffer)) {
+			err = &ShortReadError{Expected: int64(len(buffer)), Actual: n}
+		}
+		return err
+	})
+	return n, err
+}
+
+// Stream opens a stream from the specified offset, retrying if the stream
+// cannot be opened. Errors partway through the stream are not retried here;
+// the caller can resume with DownloadRange (see Downloader).
+func (obj *RetryingObject) Stream(startInclusive int64) (in io.ReadCloser, err error) {
+	s, ok := obj.Object.(Streamer)
+	if !ok {
+		return nil, ErrStreamNotSupported
+	}
+	describe := func() string {
+		return fmt.Sprintf("Stream from %d of %v", startInclusive, obj.Object)
+	}
+	err = obj.Policy.Do(describe, func() error {
+		in, err = s.Stream(startInclusive)
+		return err
+	})
+	return in, err
+}
+
+func (obj *RetryingObject) Delete() error {
+	return obj.Policy.Do(obj.describe("Delete"), obj.Object.Delete)
+}
+
+func (obj *RetryingObject) LastUpload() *UploadInfo {
+	return LastUpload(obj.Object)
+}
+
+func (obj *RetryingObject) String() string {
+	return fmt.Sprintf("%v", obj.Object)
+}
+
+func (obj *RetryingObject) describe(op string) func() string {
+	return func() string {
+		return fmt.Sprintf("%v %v", op, obj.Object)
+	}
+}
+
+// ------------------------------------------------------------
+// ShortReadError type
+
+// ShortReadError indicates that fewer bytes were read than expected
+type ShortReadError struct {
+	Expected int64
+	Actual   int64
+}
+
+func (e *ShortReadError) Error() string {
+	return fmt.Sprintf("expected to read %d bytes, got %d", e.Expected, e.Actual)
+}
+
+// ------------------------------------------------------------
+// Exported functions
+
+// IsRetryable returns true if the error indicates a condition that may be
+// temporary: a timeout; an HTTP 408 (Request Timeout), 429 (Too Many
+// Requests), or 5xx (server error) status from any backend; S3 SlowDown or
+// other throttling; or a short read.
+func IsRetryable(err error) bool {
+	for err != nil {
+		if err == io.ErrUnexpectedEOF || err == context.DeadlineExceeded {
+			return true
+		}
+		switch e := err.(type) {
+		case *ShortReadError:
+			return true
+		case net.Error:
+			if e.Timeout() {
+				return true
+			}
+		case awserr.RequestFailure:
+			if retryableStatus(e.StatusCode()) || retryableS3Codes[e.Code()] {
+				return true
+			}
+		case awserr.Error:
+			if retryableS3Codes[e.Code()] {
+				return true
+			}
+			// e.g. "RequestError: send request failed", wrapping a net.Error
+			err = e.OrigErr()
+			continue
+		case *swift.Error:
+			return retryableStatus(e.StatusCode)
+		case *AzureError:
+			return retryableStatus(e.StatusCode)
+		case *GCSError:
+			return retryableStatus(e.StatusCode)
+		case *InjectedError:
+			return retryableStatus(e.StatusCode)
+		}
+		err = errors.Unwrap(err)
+	}
+	return false
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// disableSwiftClientRetries reduces the Swift client's retries, if the
+// underlying target is a SwiftTarget, so that a RetryPolicy limits the attempts
+func disableSwiftClientRetries(target Target) {
+	if swiftTarget, ok := BaseTarget(target).(*SwiftTarget); ok && swiftTarget != nil {
+		swiftTarget.disableClientRetries()
+	}
+}
+
+func retryableStatus(status int) bool {
+	return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
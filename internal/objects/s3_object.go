@@ -1,16 +1,22 @@
 package objects
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"math"
+	"strings"
+	"sync/atomic"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 
 	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/streaming"
 )
 
 // ------------------------------------------------------------
@@ -19,6 +25,8 @@ import (
 type S3Object struct {
 	Endpoint *S3Target
 	Key      string
+
+	lastUpload *UploadInfo
 }
 
 // ------------------------------
@@ -67,6 +75,37 @@ func (obj *S3Object) ContentLength() (length int64, err error) {
 	return *lengthP, nil
 }
 
+// Stat returns the object's properties. Objects created by multipart upload
+// are identified by their ETags, which end in "-<number of parts>".
+func (obj *S3Object) Stat() (info *ObjectInfo, err error) {
+	h, err := obj.Head()
+	if err != nil {
+		return nil, err
+	}
+	info = &ObjectInfo{
+		URL:          obj.Pretty(),
+		ETag:         trimETag(aws.StringValue(h.ETag)),
+		ContentType:  aws.StringValue(h.ContentType),
+		LastModified: aws.TimeValue(h.LastModified),
+	}
+	if h.ContentLength != nil {
+		info.ContentLength = *h.ContentLength
+	} else if info.ContentLength, err = obj.ContentLength(); err != nil {
+		return nil, err
+	}
+	if len(h.Metadata) > 0 {
+		info.Metadata = map[string]string{}
+		for k, v := range h.Metadata {
+			info.Metadata[strings.ToLower(k)] = aws.StringValue(v)
+		}
+	}
+	if parts := multipartETagParts(info.ETag); parts > 0 {
+		info.LargeObject = LargeObjectMultipart
+		info.Parts = parts
+	}
+	return info, nil
+}
+
 // SupportsRanges returns true if the object supports ranged downloads,
 // false otherwise
 func (obj *S3Object) SupportsRanges() bool {
@@ -87,44 +126,79 @@ func (obj *S3Object) SupportsRanges() bool {
 	return false
 }
 
+// DownloadRange downloads the specified range with a single GetObject
+// request, reading the response directly into the buffer
 func (obj *S3Object) DownloadRange(startInclusive, endInclusive int64, buffer []byte) (n int64, err error) {
-	if !obj.SupportsRanges() {
-		logging.DefaultLogger().Tracef("object %v may not support ranged downloads; trying anyway\n", obj)
+	body, err := obj.get(startInclusive, fmt.Sprintf("bytes=%d-%d", startInclusive, endInclusive))
+	if err != nil {
+		return 0, err
 	}
-
-	awsSession, err := obj.Endpoint.Session()
+	defer func() {
+		_ = body.Close()
+	}()
+	err = streaming.ReadExactly(body, buffer)
 	if err != nil {
 		return 0, err
 	}
+	return int64(len(buffer)), nil
+}
 
-	out := aws.NewWriteAtBuffer(buffer)
-	rangeStr := fmt.Sprintf("bytes=%d-%d", startInclusive, endInclusive)
-	downloader := s3manager.NewDownloader(awsSession)
-	return downloader.Download(out, &s3.GetObjectInput{
-		Bucket: &obj.Endpoint.Bucket,
-		Key:    &obj.Key,
-		Range:  &rangeStr,
-	})
+// Stream returns the body of a single GetObject request for the object's
+// content from the specified offset to the end
+func (obj *S3Object) Stream(startInclusive int64) (io.ReadCloser, error) {
+	return obj.get(startInclusive, fmt.Sprintf("bytes=%d-", startInclusive))
 }
 
-func (obj *S3Object) Create(body io.Reader, length int64) (err error) {
+// Create uploads the object according to the target's UploadMethod, with a
+// single PutObject request or by multipart upload, recording the method and
+// number of parts used (see LastUpload). If checksums are sent (see
+// WithChecksums), each PutObject and UploadPart request includes a
+// Content-MD5 header, and a PutObject request also includes an
+// x-amz-checksum-sha256 header; the latter cannot be sent with multipart
+// uploads, as this version of the SDK cannot include part checksums when
+// completing the upload.
+func (obj *S3Object) Create(body io.Reader, length int64, options ...CreateOption) (err error) {
 	awsSession, err := obj.Endpoint.Session()
 	if err != nil {
 		return err
 	}
-	logging.DefaultLogger().Detailf("Uploading %d bytes to %v\n", length, obj)
+	method := obj.Endpoint.uploadMethod()
+	if err = ValidateUploadMethod(method); err != nil {
+		return err
+	}
+	if err = ValidateUploadSize(method, length); err != nil {
+		return err
+	}
+	ptSize := obj.Endpoint.partSize(length)
+	if method != UploadSingle && numberOfParts(length, ptSize) > s3manager.MaxUploadParts {
+		return fmt.Errorf(
+			"part size %v is too small for %v: %d parts needed, maximum is %d",
+			logging.FormatBytes(ptSize), logging.FormatBytes(length), numberOfParts(length, ptSize), s3manager.MaxUploadParts,
+		)
+	}
+	logger := logging.DefaultLogger()
+	logger.Detailf("Uploading %d bytes to %v (upload method: %v, part size: %v)\n", length, obj, method, logging.FormatBytes(ptSize))
 
-	uploader := s3manager.NewUploader(awsSession)
-	uploader.PartSize = partSize(length)
-	logging.DefaultLogger().Detailf("Set part size to %v\n", logging.FormatBytes(uploader.PartSize))
+	var requestOptions []request.Option
+	opts := NewCreateOptions(options...)
+	if opts.SendChecksum {
+		requestOptions = append(requestOptions, s3Checksums(opts, length <= ptSize))
+	}
 
-	result, err := uploader.Upload(&s3manager.UploadInput{
-		Bucket: &obj.Endpoint.Bucket,
-		Key:    &obj.Key,
-		Body:   body,
-	})
+	obj.lastUpload = nil
+	var upload *UploadInfo
+	switch {
+	case method == UploadSingle:
+		upload, err = obj.putObject(awsSession, body, length, opts, requestOptions...)
+	case method == UploadMultipart && length <= ptSize:
+		// s3manager would upload this with a single request
+		upload, err = obj.uploadOnePart(awsSession, body, length, opts, requestOptions...)
+	default:
+		upload, err = obj.upload(awsSession, body, ptSize, requestOptions...)
+	}
 	if err == nil {
-		logging.DefaultLogger().Detailf("Uploaded %d bytes to %v\n", length, result.Location)
+		obj.lastUpload = upload
+		logger.Detailf("Uploaded %d bytes to %v by %v\n", length, obj, upload)
 	}
 	return err
 }
@@ -149,6 +223,12 @@ func (obj *S3Object) Delete() (err error) {
 	return err
 }
 
+// LastUpload returns how the object was most recently uploaded with Create,
+// or nil if it has not been
+func (obj *S3Object) LastUpload() *UploadInfo {
+	return obj.lastUpload
+}
+
 // ------------------------------
 // Miscellaneous methods
 
@@ -162,6 +242,9 @@ func (obj *S3Object) Head() (h *s3.HeadObjectOutput, err error) {
 		Bucket: &obj.Endpoint.Bucket,
 		Key:    &obj.Key,
 	})
+	if err != nil {
+		return nil, err
+	}
 	if h != nil {
 		return h, nil
 	} else {
@@ -179,6 +262,9 @@ func (obj *S3Object) Get() (h *s3.GetObjectOutput, err error) {
 		Bucket: &obj.Endpoint.Bucket,
 		Key:    &obj.Key,
 	})
+	if err != nil {
+		return nil, err
+	}
 	if h != nil {
 		return h, nil
 	} else {
@@ -186,9 +272,189 @@ func (obj *S3Object) Get() (h *s3.GetObjectOutput, err error) {
 	}
 }
 
+// get returns the body of a GetObject request for the specified range,
+// starting at startInclusive, or an error if the response does not start
+// there (see checkRange)
+func (obj *S3Object) get(startInclusive int64, rangeStr string) (io.ReadCloser, error) {
+	s3Svc, err := obj.Endpoint.S3()
+	if err != nil {
+		return nil, err
+	}
+	out, err := s3Svc.GetObject(&s3.GetObjectInput{
+		Bucket: &obj.Endpoint.Bucket,
+		Key:    &obj.Key,
+		Range:  &rangeStr,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = checkRange(obj, aws.StringValue(out.ContentRange), startInclusive); err != nil {
+		_ = out.Body.Close()
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// putObject uploads the object with a single PutObject request. A body that
+// is not an io.ReadSeeker is streamed with an unsigned payload, as the SDK
+// would otherwise need to read it to sign the request, and is not retried by
+// the SDK. Checksums (see CreateOptions) are sent before the body, so they
+// must either be provided or calculated from a seekable body, which is read
+// once to calculate them and again to upload it.
+func (obj *S3Object) putObject(awsSession *session.Session, body io.Reader, length int64, opts *CreateOptions, requestOptions ...request.Option) (*UploadInfo, error) {
+	seeker, ok := body.(io.ReadSeeker)
+	if !ok {
+		if opts.SendChecksum && (opts.MD5 == nil || opts.SHA256 == nil) {
+			return nil, fmt.Errorf("unable to send checksums for %v: digests not provided, and body is not seekable", obj)
+		}
+		seeker = aws.ReadSeekCloser(io.LimitReader(body, length))
+		requestOptions = append(requestOptions, unsignedPayload)
+	}
+	_, err := s3.New(awsSession).PutObjectWithContext(aws.BackgroundContext(), &s3.PutObjectInput{
+		Bucket:        &obj.Endpoint.Bucket,
+		Key:           &obj.Key,
+		Body:          seeker,
+		ContentLength: aws.Int64(length),
+	}, requestOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return &UploadInfo{Method: UploadSingle, Parts: 1}, nil
+}
+
+// uploadOnePart uploads the object by multipart upload, as a single part,
+// which is streamed like the body of a single PutObject request (see
+// putObject). The part is the whole body, so its MD5 digest, if checksums are
+// sent, is likewise either provided or calculated from a seekable body.
+func (obj *S3Object) uploadOnePart(awsSession *session.Session, body io.Reader, length int64, opts *CreateOptions, requestOptions ...request.Option) (*UploadInfo, error) {
+	seeker, ok := body.(io.ReadSeeker)
+	if !ok {
+		if opts.SendChecksum && opts.MD5 == nil {
+			return nil, fmt.Errorf("unable to send checksum for %v: MD5 digest not provided, and body is not seekable", obj)
+		}
+		seeker = aws.ReadSeekCloser(io.LimitReader(body, length))
+		requestOptions = append(requestOptions, unsignedPayload)
+	}
+	svc := s3.New(awsSession)
+	created, err := svc.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket: &obj.Endpoint.Bucket,
+		Key:    &obj.Key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	part, err := svc.UploadPartWithContext(aws.BackgroundContext(), &s3.UploadPartInput{
+		Bucket:        &obj.Endpoint.Bucket,
+		Key:           &obj.Key,
+		UploadId:      created.UploadId,
+		PartNumber:    aws.Int64(1),
+		Body:          seeker,
+		ContentLength: aws.Int64(length),
+	}, requestOptions...)
+	if err == nil {
+		_, err = svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+			Bucket:   &obj.Endpoint.Bucket,
+			Key:      &obj.Key,
+			UploadId: created.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{
+				Parts: []*s3.CompletedPart{{ETag: part.ETag, PartNumber: aws.Int64(1)}},
+			},
+		})
+	}
+	if err != nil {
+		_, abortErr := svc.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   &obj.Endpoint.Bucket,
+			Key:      &obj.Key,
+			UploadId: created.UploadId,
+		})
+		if abortErr != nil {
+			logging.DefaultLogger().Tracef("Error aborting upload %v: %v\n", aws.StringValue(created.UploadId), abortErr)
+		}
+		return nil, err
+	}
+	return &UploadInfo{Method: UploadMultipart, Parts: 1, PartSize: length}, nil
+}
+
+// upload uploads the object with s3manager, which uses a single PutObject
+// request if the body fits in one part, and multipart upload otherwise
+func (obj *S3Object) upload(awsSession *session.Session, body io.Reader, ptSize int64, requestOptions ...request.Option) (*UploadInfo, error) {
+	var parts int64
+	countParts := func(r *request.Request) {
+		r.Handlers.Complete.PushBack(func(r *request.Request) {
+			if r.Operation.Name == "UploadPart" && r.Error == nil {
+				atomic.AddInt64(&parts, 1)
+			}
+		})
+	}
+	uploader := s3manager.NewUploader(awsSession, func(u *s3manager.Uploader) {
+		u.PartSize = ptSize
+		if obj.Endpoint.UploadConcurrency > 0 {
+			u.Concurrency = obj.Endpoint.UploadConcurrency
+		}
+	}, s3manager.WithUploaderRequestOptions(append(requestOptions, countParts)...))
+	result, err := uploader.Upload(&s3manager.UploadInput{
+		Bucket: &obj.Endpoint.Bucket,
+		Key:    &obj.Key,
+		Body:   body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.UploadID == "" {
+		return &UploadInfo{Method: UploadSingle, Parts: 1}, nil
+	}
+	return &UploadInfo{Method: UploadMultipart, Parts: int(atomic.LoadInt64(&parts)), PartSize: uploader.PartSize}, nil
+}
+
 // ------------------------------------------------------------
 // Unexported utility functions
 
+// unsignedPayload is a request option that marks the request body as
+// unsigned, so that the SDK need not read the body to sign the request
+func unsignedPayload(r *request.Request) {
+	r.HTTPRequest.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+}
+
+// s3Checksums returns a request option setting the Content-MD5 header of
+// PutObject and UploadPart requests, and the x-amz-checksum-sha256 header of
+// PutObject requests, replacing the Content-MD5 header the SDK would otherwise
+// calculate. A PutObject request uploads the whole body, as does an
+// UploadPart request if the body fits in one part (onePart), so its digests
+// are taken from opts if known; otherwise, they are calculated from the
+// request body, which must then be seekable.
+func s3Checksums(opts *CreateOptions, onePart bool) request.Option {
+	return func(r *request.Request) {
+		r.Handlers.Build.PushBack(func(r *request.Request) {
+			op := r.Operation.Name
+			if r.Error != nil || (op != "PutObject" && op != "UploadPart") {
+				return
+			}
+			var md5Digest, sha256Digest []byte
+			if op == "PutObject" || onePart {
+				md5Digest, sha256Digest = opts.MD5, opts.SHA256
+			}
+			if md5Digest == nil || (op == "PutObject" && sha256Digest == nil) {
+				bodyMD5, bodySHA256, err := seekableDigests(r.Body)
+				if err != nil {
+					r.Error = fmt.Errorf("unable to calculate checksums for %v: %v", op, err)
+					return
+				}
+				if md5Digest == nil {
+					md5Digest = bodyMD5
+				}
+				if sha256Digest == nil {
+					sha256Digest = bodySHA256
+				}
+			}
+			header := r.HTTPRequest.Header
+			header.Set("Content-MD5", base64.StdEncoding.EncodeToString(opts.sent(md5Digest)))
+			if op == "PutObject" {
+				header.Set("X-Amz-Checksum-Sha256", base64.StdEncoding.EncodeToString(opts.sent(sha256Digest)))
+			}
+		})
+	}
+}
+
 func numberOfParts(length, partSize int64) int64 {
 	return 1 + ((length - 1) / partSize)
 }
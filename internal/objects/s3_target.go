@@ -3,11 +3,18 @@ package objects
 import (
 	"fmt"
 	"net/url"
+	"sync"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
+// DefaultUploadConcurrency is the default number of multipart upload parts
+// uploaded in parallel
+const DefaultUploadConcurrency = s3manager.DefaultUploadConcurrency
+
 // ------------------------------------------------------------
 // S3Target type
 
@@ -16,6 +23,18 @@ type S3Target struct {
 	Endpoint string
 	Bucket   string
 
+	// UploadMethod is UploadAuto (the default), UploadSingle, or UploadMultipart
+	UploadMethod string
+	// PartSize is the multipart upload part size; if zero, it is chosen based
+	// on the size of the object
+	PartSize int64
+	// UploadConcurrency is the number of parts uploaded in parallel; if zero,
+	// DefaultUploadConcurrency is used
+	UploadConcurrency int
+
+	// the session and client are created on first use, which may be from
+	// concurrent requests (e.g. from ManifestCheck workers)
+	mutex      sync.Mutex
 	awsSession *session.Session
 	s3Svc      *s3.S3
 }
@@ -35,6 +54,57 @@ func (e *S3Target) Object(key string) Object {
 	return &S3Object{Endpoint: e, Key: key}
 }
 
+// List lists objects with ListObjectsV2, following continuation tokens
+func (e *S3Target) List(prefix, delimiter string, fn ListFunc) error {
+	svc, err := e.S3()
+	if err != nil {
+		return err
+	}
+	// request URL-encoded keys, since keys may contain characters that can't
+	// be represented in XML 1.0
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(e.Bucket), EncodingType: aws.String(s3.EncodingTypeUrl)}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+	if delimiter != "" {
+		input.Delimiter = aws.String(delimiter)
+	}
+	var fnErr error
+	err = svc.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		var objects []ObjectSummary
+		for _, o := range page.Contents {
+			var key string
+			if key, fnErr = url.QueryUnescape(aws.StringValue(o.Key)); fnErr != nil {
+				return false
+			}
+			objects = append(objects, ObjectSummary{
+				Key:          key,
+				Size:         aws.Int64Value(o.Size),
+				ETag:         trimETag(aws.StringValue(o.ETag)),
+				LastModified: aws.TimeValue(o.LastModified),
+			})
+		}
+		var prefixes []string
+		for _, p := range page.CommonPrefixes {
+			var commonPrefix string
+			if commonPrefix, fnErr = url.QueryUnescape(aws.StringValue(p.Prefix)); fnErr != nil {
+				return false
+			}
+			prefixes = append(prefixes, commonPrefix)
+		}
+		for _, summary := range mergeListing(objects, prefixes) {
+			if fnErr = fn(summary); fnErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err == nil {
+		err = fnErr
+	}
+	return listResult(err)
+}
+
 func (e *S3Target) Pretty() string {
 	return fmt.Sprintf("S3Target{ Region: %#v, Endpoint: %#v, Bucket: %#v }", e.Region, e.Endpoint, e.Bucket)
 }
@@ -47,6 +117,27 @@ func (e *S3Target) String() string {
 // Miscellaneous methods
 
 func (e *S3Target) Session() (*session.Session, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.session()
+}
+
+func (e *S3Target) S3() (*s3.S3, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.s3Svc == nil {
+		awsSession, err := e.session()
+		if err != nil {
+			return nil, err
+		}
+		e.s3Svc = s3.New(awsSession)
+	}
+	return e.s3Svc, nil
+}
+
+// session returns the session, creating it if necessary; the caller must
+// hold the mutex
+func (e *S3Target) session() (*session.Session, error) {
 	if e.awsSession == nil {
 		awsSession, err := ValidS3Session(&e.Endpoint, &e.Region)
 		if err != nil {
@@ -57,13 +148,16 @@ func (e *S3Target) Session() (*session.Session, error) {
 	return e.awsSession, nil
 }
 
-func (e *S3Target) S3() (*s3.S3, error) {
-	if e.s3Svc == nil {
-		awsSession, err := e.Session()
-		if err != nil {
-			return nil, err
-		}
-		e.s3Svc = s3.New(awsSession)
+func (e *S3Target) uploadMethod() string {
+	if e.UploadMethod == "" {
+		return UploadAuto
 	}
-	return e.s3Svc, nil
+	return e.UploadMethod
+}
+
+func (e *S3Target) partSize(length int64) int64 {
+	if e.PartSize > 0 {
+		return e.PartSize
+	}
+	return partSize(length)
 }
@@ -111,7 +111,7 @@ func InitS3Session(endpointP *string, regionStrP *string) (*session.Session, err
 // DisallowIAMFallback uses reflection to check whether we're falling back to IAM credentials
 // See https://github.com/aws/aws-sdk-go/issues/2392
 func DisallowIAMFallback(awsSession *session.Session) (*session.Session, error) {
-	providerVal := reflect.ValueOf(*awsSession.Config.Credentials).FieldByName("provider").Elem()
+	providerVal := reflect.ValueOf(awsSession.Config.Credentials).Elem().FieldByName("provider").Elem()
 	if providerVal.Type() == reflect.TypeOf((*credentials.ChainProvider)(nil)) {
 		chainProvider := (*credentials.ChainProvider)(unsafe.Pointer(providerVal.Pointer()))
 		providers := chainProvider.Providers
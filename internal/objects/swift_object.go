@@ -1,8 +1,14 @@
 package objects
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
+	"time"
 
 	"code.cloudfoundry.org/bytefmt"
 	"github.com/ncw/swift"
@@ -48,17 +54,54 @@ func (obj *SwiftObject) ContentLength() (length int64, err error) {
 	return info.Bytes, nil
 }
 
-func (obj *SwiftObject) DownloadRange(startInclusive, endInclusive int64, buffer []byte) (n int64, err error) {
+// Stat returns the object's properties. For dynamic and static large objects,
+// the number of segments is determined by listing the segments or reading the
+// manifest, respectively; if this fails, the number of parts is left unknown.
+func (obj *SwiftObject) Stat() (info *ObjectInfo, err error) {
 	cnx, err := obj.Endpoint.Connection()
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	swiftInfo, headers, err := cnx.Object(obj.Container, obj.Name)
+	if err != nil {
+		return nil, err
+	}
+	info = &ObjectInfo{
+		URL:           obj.Pretty(),
+		ContentLength: swiftInfo.Bytes,
+		ETag:          trimETag(swiftInfo.Hash),
+		ContentType:   swiftInfo.ContentType,
+		LastModified:  swiftInfo.LastModified,
+	}
+	if metadata := headers.ObjectMetadata(); len(metadata) > 0 {
+		info.Metadata = metadata
+	}
+	switch swiftInfo.ObjectType {
+	case swift.DynamicLargeObjectType:
+		info.LargeObject = LargeObjectDLO
+		info.Manifest = headers["X-Object-Manifest"]
+	case swift.StaticLargeObjectType:
+		info.LargeObject = LargeObjectSLO
+	default:
+		return info, nil
+	}
+	_, segments, err := cnx.LargeObjectGetSegments(obj.Container, obj.Name)
+	if err != nil {
+		logging.DefaultLogger().Tracef("Error getting segments of %v: %v\n", obj, err)
+		return info, nil
 	}
-	rangeStr := fmt.Sprintf("bytes=%d-%d", startInclusive, endInclusive)
-	headers := map[string]string{"Range": rangeStr}
-	file, _, err := cnx.ObjectOpen(obj.Container, obj.Name, false, headers)
+	info.Parts = len(segments)
+	return info, nil
+}
+
+func (obj *SwiftObject) DownloadRange(startInclusive, endInclusive int64, buffer []byte) (n int64, err error) {
+	file, err := obj.open(startInclusive, fmt.Sprintf("bytes=%d-%d", startInclusive, endInclusive))
 	if err != nil {
 		return 0, err
 	}
+	defer func() {
+		_ = file.Close()
+	}()
 	err = streaming.ReadExactly(file, buffer)
 	if err != nil {
 		return 0, err
@@ -66,27 +109,53 @@ func (obj *SwiftObject) DownloadRange(startInclusive, endInclusive int64, buffer
 	return int64(len(buffer)), nil
 }
 
-func (obj *SwiftObject) Create(body io.Reader, length int64) (err error) {
+// Stream opens the object with a single GET request for its content from the
+// specified offset to the end
+func (obj *SwiftObject) Stream(startInclusive int64) (io.ReadCloser, error) {
+	return obj.open(startInclusive, fmt.Sprintf("bytes=%d-", startInclusive))
+}
+
+// Create uploads the object with a single PUT request if its length is no
+// more than the target's LargeObjectThreshold, or otherwise as a large object
+// (see LargeObjectMode). If checksums are sent (see WithChecksums), each PUT
+// request includes an ETag header with the MD5 digest of its body, which the
+// server verifies; for a single PUT, the digest must either be provided or
+// calculated from a seekable body, as it is sent before the body.
+func (obj *SwiftObject) Create(body io.Reader, length int64, options ...CreateOption) (err error) {
 	cnx, err := obj.Endpoint.Connection()
 	if err != nil {
 		return err
 	}
 
 	logger := logging.DefaultLogger()
+	opts := NewCreateOptions(options...)
 	var out io.WriteCloser
-	if length <= dloSizeThreshold { // 2 GiB
-		out, err = cnx.ObjectCreate(obj.Container, obj.Name, false, "", "", nil)
+	bufferSize := streaming.DefaultRangeSize
+	threshold := obj.Endpoint.largeObjectThreshold()
+	if length <= threshold { // 2 GiB by default
+		var etag string
+		if opts.SendChecksum {
+			if etag, err = obj.etag(body, opts); err != nil {
+				return err
+			}
+		}
+		out, err = cnx.ObjectCreate(obj.Container, obj.Name, false, etag, "", nil)
+	} else if opts.SendChecksum {
+		logger.Tracef(
+			"Object size %d is greater than single-object maximum %d; creating %v large object with segment checksums\n",
+			length, threshold, obj.Endpoint.largeObjectMode(),
+		)
+		return obj.createLargeObjectWithChecksums(cnx, body, length, opts)
 	} else {
 		logger.Tracef(
-			"Object size %d is greater than single-object maximum %d; creating dynamic large object\n",
-			length, dloSizeThreshold,
+			"Object size %d is greater than single-object maximum %d; creating %v large object\n",
+			length, threshold, obj.Endpoint.largeObjectMode(),
 		)
-		dloOpts := swift.LargeObjectOpts{
-			Container:  obj.Container,
-			ObjectName: obj.Name,
-			ChunkSize:  streaming.DefaultRangeSize, // 5 MiB
+		out, err = obj.createLargeObject(cnx, length)
+		// writes larger than the segment size are split into uneven segments
+		if segmentSize := obj.Endpoint.segmentSize(); segmentSize < bufferSize {
+			bufferSize = segmentSize
 		}
-		out, err = cnx.DynamicLargeObjectCreateFile(&dloOpts)
 	}
 	if err != nil {
 		logger.Tracef("Error opening upload stream: %v\n", err)
@@ -94,13 +163,16 @@ func (obj *SwiftObject) Create(body io.Reader, length int64) (err error) {
 	}
 
 	defer func() {
-		err := out.Close()
-		if err != nil {
-			logger.Tracef("Error closing upload stream: %v\n", err)
+		closeErr := out.Close()
+		if closeErr != nil {
+			logger.Tracef("Error closing upload stream: %v\n", closeErr)
+			if err == nil {
+				err = closeErr
+			}
 		}
 	}()
 
-	buffer := make([]byte, streaming.DefaultRangeSize)
+	buffer := make([]byte, bufferSize)
 	written, err := io.CopyBuffer(out, body, buffer)
 	if err != nil {
 		logger.Tracef("Error writing to upload stream: %v\n", err)
@@ -109,22 +181,352 @@ func (obj *SwiftObject) Create(body io.Reader, length int64) (err error) {
 	return err
 }
 
+// Delete deletes the object. If the object is a dynamic or static large
+// object, its segments are deleted as well (see DeleteWithSegments).
 func (obj *SwiftObject) Delete() (err error) {
+	_, err = obj.DeleteWithSegments()
+	return err
+}
+
+// ------------------------------
+// Exported methods
+
+// DeleteWithSegments deletes the object and, if it is a dynamic or static
+// large object, its segments, returning a description of what was removed.
+// Segments are deleted before the manifest, so that if deletion fails
+// partway, the manifest is left in place and the deletion can be retried.
+// If the cluster supports bulk delete, segments are deleted in bulk;
+// otherwise, they are deleted one at a time.
+func (obj *SwiftObject) DeleteWithSegments() (deletion *SwiftDeletion, err error) {
 	cnx, err := obj.Endpoint.Connection()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// TODO: detect DynamicLargeObjects
-	err = cnx.ObjectDelete(obj.Container, obj.Name)
 	logger := logging.DefaultLogger()
 	logger.Tracef("Deleting %v\n", obj)
-	if err == nil {
-		logger.Tracef("Deleted %v\n", obj)
-	} else {
-		logger.Tracef("Deleting %v failed: %v", obj, err)
+	swiftInfo, _, err := cnx.Object(obj.Container, obj.Name)
+	if err != nil {
+		logger.Tracef("Deleting %v failed: %v\n", obj, err)
+		return nil, err
+	}
+
+	deletion = &SwiftDeletion{Object: obj.Pretty()}
+	switch swiftInfo.ObjectType {
+	case swift.DynamicLargeObjectType:
+		deletion.LargeObject = LargeObjectDLO
+	case swift.StaticLargeObjectType:
+		deletion.LargeObject = LargeObjectSLO
+	}
+	if deletion.LargeObject != "" {
+		segmentContainer, segments, err := cnx.LargeObjectGetSegments(obj.Container, obj.Name)
+		if err != nil {
+			logger.Tracef("Error getting segments of %v: %v\n", obj, err)
+			return nil, fmt.Errorf("unable to get segments of %v: %v", obj, err)
+		}
+		deletion.SegmentContainer = segmentContainer
+		names := make([]string, len(segments))
+		for i, segment := range segments {
+			names[i] = segment.Name
+		}
+		if err = obj.deleteSegments(cnx, deletion, names); err != nil {
+			logger.Tracef("Deleting segments of %v failed: %v\n", obj, err)
+			return deletion, err
+		}
+	}
+
+	err = cnx.ObjectDelete(obj.Container, obj.Name)
+	if err != nil {
+		logger.Tracef("Deleting %v failed: %v\n", obj, err)
+		return deletion, err
+	}
+	logger.Detailf("Deleted %v\n", deletion)
+	return deletion, nil
+}
+
+// ------------------------------
+// Unexported methods
+
+// open opens the object with a GET request for the specified range, starting
+// at startInclusive, or returns an error if the response does not start there
+// (see checkRange)
+func (obj *SwiftObject) open(startInclusive int64, rangeStr string) (*swift.ObjectOpenFile, error) {
+	cnx, err := obj.Endpoint.Connection()
+	if err != nil {
+		return nil, err
+	}
+	file, headers, err := cnx.ObjectOpen(obj.Container, obj.Name, false, map[string]string{"Range": rangeStr})
+	if err != nil {
+		return nil, err
+	}
+	if err = checkRange(obj, headers["Content-Range"], startInclusive); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// createLargeObject opens a dynamic or static large object for writing,
+// according to the target's LargeObjectMode
+func (obj *SwiftObject) createLargeObject(cnx *swift.Connection, length int64) (io.WriteCloser, error) {
+	e := obj.Endpoint
+	opts := swift.LargeObjectOpts{
+		Container:        obj.Container,
+		ObjectName:       obj.Name,
+		ChunkSize:        e.segmentSize(), // 5 MiB by default
+		SegmentContainer: e.SegmentContainer,
+	}
+	mode := e.largeObjectMode()
+	switch mode {
+	case LargeObjectDLO:
+		return cnx.DynamicLargeObjectCreate(&opts)
+	case LargeObjectSLO:
+		info, err := e.swiftInfo()
+		if err != nil {
+			return nil, err
+		}
+		if !info.SupportsSLO() {
+			return nil, swift.SLONotSupported
+		}
+		opts.ChunkSize = obj.sloSegmentSize(length, opts.ChunkSize)
+		return cnx.StaticLargeObjectCreate(&opts)
+	}
+	return nil, ValidateSwiftLargeObjectMode(mode)
+}
+
+// sloSegmentSize returns the specified segment size, increased if necessary
+// to upload an object of the specified length within the cluster's maximum
+// number of static large object segments
+func (obj *SwiftObject) sloSegmentSize(length, segmentSize int64) int64 {
+	maxSegments := obj.Endpoint.maxManifestSegments()
+	if maxSegments <= 0 {
+		return segmentSize
+	}
+	if minSize := (length + maxSegments - 1) / maxSegments; minSize > segmentSize {
+		logging.DefaultLogger().Detailf(
+			"Increasing segment size from %d to %d bytes to stay within maximum of %d segments\n",
+			segmentSize, minSize, maxSegments,
+		)
+		return minSize
+	}
+	return segmentSize
+}
+
+// etag returns the ETag header to send with a single PUT of the specified
+// body: the hex-encoded MD5 digest from opts, if known, or otherwise
+// calculated from the body, which must be seekable
+func (obj *SwiftObject) etag(body io.Reader, opts *CreateOptions) (string, error) {
+	md5Digest := opts.MD5
+	if md5Digest == nil {
+		seeker, ok := body.(io.ReadSeeker)
+		if !ok {
+			return "", fmt.Errorf("unable to send checksum for %v: MD5 digest not provided, and body is not seekable", obj)
+		}
+		var err error
+		if md5Digest, _, err = seekableDigests(seeker); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(opts.sent(md5Digest)), nil
+}
+
+// createLargeObjectWithChecksums uploads the body as a large object of the
+// target's LargeObjectMode, sending each segment with an ETag header. The
+// swift library does not send ETags with segments, so the segments and the
+// manifest are uploaded here, with segment names following the convention of
+// the OpenStack command-line client: <object>/<timestamp>/<size>/<segment
+// size>/<index>. As when the swift library creates a large object, any
+// existing object is deleted first; if the upload fails, any segments already
+// uploaded are deleted.
+func (obj *SwiftObject) createLargeObjectWithChecksums(cnx *swift.Connection, body io.Reader, length int64, opts *CreateOptions) (err error) {
+	e := obj.Endpoint
+	mode := e.largeObjectMode()
+	if err = ValidateSwiftLargeObjectMode(mode); err != nil {
+		return err
+	}
+	segmentSize := e.segmentSize()
+	if mode == LargeObjectSLO {
+		info, err := e.swiftInfo()
+		if err != nil {
+			return err
+		}
+		if !info.SupportsSLO() {
+			return swift.SLONotSupported
+		}
+		segmentSize = obj.sloSegmentSize(length, segmentSize)
 	}
+	segmentContainer := e.SegmentContainer
+	if segmentContainer == "" {
+		segmentContainer = obj.Container + "_segments"
+	}
+	if err = cnx.ContainerCreate(segmentContainer, nil); err != nil {
+		return err
+	}
+	if _, _, err = cnx.Object(obj.Container, obj.Name); err == nil {
+		if _, err = obj.DeleteWithSegments(); err != nil {
+			return err
+		}
+	} else if err != swift.ObjectNotFound {
+		return err
+	}
+
+	logger := logging.DefaultLogger()
+	prefix := fmt.Sprintf("%v/%d/%d/%d/", obj.Name, time.Now().UnixNano(), length, segmentSize)
+	var names []string
+	var segments []sloSegment
+	defer func() {
+		if err == nil || len(names) == 0 {
+			return
+		}
+		if delErr := obj.deleteSegments(cnx, &SwiftDeletion{Object: obj.Pretty(), SegmentContainer: segmentContainer}, names); delErr != nil {
+			logger.Tracef("Error deleting segments of failed upload: %v\n", delErr)
+		}
+	}()
+
+	buffer := make([]byte, segmentSize)
+	var written int64
+	for written < length {
+		n, err := io.ReadFull(body, buffer)
+		if n == 0 || (err != nil && err != io.ErrUnexpectedEOF) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("error reading body after %d of %d bytes: %v", written, length, err)
+		}
+		data := buffer[:n]
+		sum := md5.Sum(data)
+		name := fmt.Sprintf("%v%08d", prefix, len(names))
+		if _, err = cnx.ObjectPut(segmentContainer, name, bytes.NewReader(data), false, hex.EncodeToString(opts.sent(sum[:])), "", nil); err != nil {
+			return fmt.Errorf("error uploading segment %v of %v: %v", name, obj, err)
+		}
+		names = append(names, name)
+		segments = append(segments, sloSegment{Path: segmentContainer + "/" + name, Etag: hex.EncodeToString(sum[:]), SizeBytes: int64(n)})
+		written += int64(n)
+	}
+	logger.Tracef("Wrote %d bytes to %v in %d segments\n", written, obj, len(segments))
+
+	if mode == LargeObjectDLO {
+		headers := swift.Headers{"X-Object-Manifest": segmentContainer + "/" + prefix}
+		_, err = cnx.ObjectPut(obj.Container, obj.Name, bytes.NewReader(nil), false, "", "", headers)
+		return err
+	}
+	manifest, err := json.Marshal(segments)
+	if err != nil {
+		return err
+	}
+	_, _, err = cnx.Call(cnx.StorageUrl, swift.RequestOpts{
+		Container:  obj.Container,
+		ObjectName: obj.Name,
+		Operation:  "PUT",
+		Parameters: url.Values{"multipart-manifest": {"put"}},
+		Body:       bytes.NewReader(manifest),
+		NoResponse: true,
+	})
 	return err
+}
+
+// deleteSegments deletes the specified segments from deletion.SegmentContainer,
+// in bulk if possible, recording the results in deletion
+func (obj *SwiftObject) deleteSegments(cnx *swift.Connection, deletion *SwiftDeletion, names []string) error {
+	container := deletion.SegmentContainer
+	logger := logging.DefaultLogger()
+	if maxBulkDeletes := obj.Endpoint.maxBulkDeletes(); maxBulkDeletes > 0 {
+		for len(names) > 0 {
+			batch := names
+			if len(batch) > maxBulkDeletes {
+				batch = names[:maxBulkDeletes]
+			}
+			result, err := cnx.BulkDelete(container, batch)
+			if err == swift.Forbidden && !deletion.BulkDelete {
+				logger.Detailf("Bulk delete not permitted; deleting segments of %v individually\n", obj)
+				break
+			}
+			deletion.BulkDelete = true
+			deletion.Segments += int(result.NumberDeleted)
+			deletion.NotFound += int(result.NumberNotFound)
+			if len(result.Errors) > 0 {
+				return fmt.Errorf("unable to delete %d segments of %v from %v: %v", len(result.Errors), obj, container, bulkDeleteError(result.Errors))
+			}
+			if err != nil {
+				return fmt.Errorf("error deleting segments of %v from %v: %v", obj, container, err)
+			}
+			names = names[len(batch):]
+		}
+	}
+	for _, name := range names {
+		err := cnx.ObjectDelete(container, name)
+		if err == swift.ObjectNotFound {
+			deletion.NotFound++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error deleting segment %v of %v from %v: %v", name, obj, container, err)
+		}
+		deletion.Segments++
+	}
+	return nil
+}
 
+// ------------------------------------------------------------
+// SwiftDeletion type
+
+// SwiftDeletion describes what was removed by SwiftObject.DeleteWithSegments
+type SwiftDeletion struct {
+	// Object is the URL of the deleted object
+	Object string
+	// LargeObject is LargeObjectDLO or LargeObjectSLO if the object was a
+	// large object, or empty otherwise
+	LargeObject      string
+	SegmentContainer string
+	// Segments is the number of segments deleted
+	Segments int
+	// NotFound is the number of segments that had already been deleted
+	NotFound int
+	// BulkDelete is true if segments were deleted with bulk delete requests
+	BulkDelete bool
+}
+
+func (d *SwiftDeletion) Pretty() string {
+	if d.LargeObject == "" {
+		return d.Object
+	}
+	method := "individually"
+	if d.BulkDelete {
+		method = "in bulk"
+	}
+	desc := fmt.Sprintf("%v (%v) and %d segments from %v, %v", d.Object, d.LargeObject, d.Segments, d.SegmentContainer, method)
+	if d.NotFound > 0 {
+		desc += fmt.Sprintf(" (%d already deleted)", d.NotFound)
+	}
+	return desc
+}
+
+func (d *SwiftDeletion) String() string {
+	return d.Pretty()
 }
 
+// ------------------------------------------------------------
+// Unexported types
+
+// sloSegment is a segment in a static large object manifest, in the format
+// expected by a multipart-manifest=put request
+type sloSegment struct {
+	Path      string `json:"path"`
+	Etag      string `json:"etag"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// bulkDeleteError returns the error for the first (by name) of the objects
+// that could not be deleted
+func bulkDeleteError(errs map[string]error) error {
+	var first string
+	for name := range errs {
+		if first == "" || name < first {
+			first = name
+		}
+	}
+	return fmt.Errorf("%v: %v", first, errs[first])
+}
@@ -5,14 +5,25 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/ncw/swift"
+
+	"github.com/dmolesUC3/cos/internal/streaming"
 )
 
 const (
 	SwiftUserEnvVar = "ST_USER"
 	SwiftKeyEnvVar  = "ST_KEY"
 	defaultRetries  = 3
+	// minRetries is the fewest retries the Swift client can be configured
+	// with: it treats 0 as the default, and uses its retries to
+	// re-authenticate when the auth token expires
+	minRetries = 1
+
+	// defaultMaxBulkDeletes is the Swift default for max_deletes_per_request
+	defaultMaxBulkDeletes = 10000
 )
 
 // ------------------------------------------------------------
@@ -23,7 +34,27 @@ type SwiftTarget struct {
 	APIKey    string
 	AuthURL   *url.URL
 	Container string
+
+	// LargeObjectThreshold is the size above which objects are uploaded as
+	// large objects; if zero, the default of 2 GiB is used
+	LargeObjectThreshold int64
+	// LargeObjectMode is the kind of large object uploaded: LargeObjectDLO
+	// (dynamic, the default) or LargeObjectSLO (static)
+	LargeObjectMode string
+	// SegmentSize is the size of large object segments; if zero, the default
+	// of 5 MiB is used. For static large objects, the segment size is increased
+	// if necessary to stay within the cluster's maximum number of segments.
+	SegmentSize int64
+	// SegmentContainer is the container for large object segments; if empty,
+	// the default of <container>_segments is used
+	SegmentContainer string
+
+	// the connection and cluster info are created on first use, which may
+	// be from concurrent requests (e.g. from ManifestCheck workers)
+	mutex     sync.Mutex
 	cnx       *swift.Connection
+	info      swift.SwiftInfo
+	noRetries bool
 }
 
 // ------------------------------
@@ -48,6 +79,53 @@ func (e *SwiftTarget) Object(key string) Object {
 	return &SwiftObject{e, e.Container, key}
 }
 
+// List lists objects with container GET requests, following markers until
+// an empty page is returned
+func (e *SwiftTarget) List(prefix, delimiter string, fn ListFunc) error {
+	cnx, err := e.Connection()
+	if err != nil {
+		return err
+	}
+	opts := &swift.ObjectsOpts{Prefix: prefix}
+	if delimiter != "" {
+		runes := []rune(delimiter)
+		if len(runes) != 1 {
+			return fmt.Errorf("swift listings support only single-character delimiters; got %#v", delimiter)
+		}
+		opts.Delimiter = runes[0]
+	}
+	lastKey := ""
+	for {
+		objects, err := cnx.Objects(e.Container, opts)
+		if err != nil {
+			return err
+		}
+		if len(objects) == 0 {
+			return nil
+		}
+		for _, o := range objects {
+			if o.Name <= lastKey {
+				continue
+			}
+			lastKey = o.Name
+			summary := ObjectSummary{Key: o.Name, IsPrefix: o.PseudoDirectory}
+			if !o.PseudoDirectory {
+				summary.Size = o.Bytes
+				summary.ETag = trimETag(o.Hash)
+				summary.LastModified = o.LastModified
+			}
+			if err := fn(summary); err != nil {
+				return listResult(err)
+			}
+		}
+		opts.Marker = lastKey
+		if objects[len(objects)-1].PseudoDirectory {
+			// skip past all keys under the pseudo-directory
+			opts.Marker += string(utf8.MaxRune)
+		}
+	}
+}
+
 func (e *SwiftTarget) Pretty() string {
 	var apiKeyStr string
 	if e.APIKey == "" {
@@ -63,8 +141,8 @@ func (e *SwiftTarget) Pretty() string {
 		authURLStr = e.AuthURL.String()
 	}
 
-	return fmt.Sprintf("SwiftTarget { Username: %#v, APIKey: %v, AuthURL: %#v, Container: %#v }",
-		e.UserName, apiKeyStr, authURLStr, e.Container)
+	return fmt.Sprintf("SwiftTarget { Username: %#v, APIKey: %v, AuthURL: %#v, Container: %#v, LargeObjectMode: %#v }",
+		e.UserName, apiKeyStr, authURLStr, e.Container, e.largeObjectMode())
 }
 
 func (e *SwiftTarget) String() string {
@@ -74,7 +152,36 @@ func (e *SwiftTarget) String() string {
 // ------------------------------
 // Miscellaneous methods
 
+func (e *SwiftTarget) largeObjectThreshold() int64 {
+	if e.LargeObjectThreshold > 0 {
+		return e.LargeObjectThreshold
+	}
+	return dloSizeThreshold
+}
+
+func (e *SwiftTarget) largeObjectMode() string {
+	if e.LargeObjectMode == "" {
+		return LargeObjectDLO
+	}
+	return e.LargeObjectMode
+}
+
+func (e *SwiftTarget) segmentSize() int64 {
+	if e.SegmentSize > 0 {
+		return e.SegmentSize
+	}
+	return streaming.DefaultRangeSize
+}
+
 func (e *SwiftTarget) Connection() (*swift.Connection, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.connection()
+}
+
+// connection returns the connection, creating it if necessary; the caller
+// must hold the mutex
+func (e *SwiftTarget) connection() (*swift.Connection, error) {
 	if e.cnx == nil {
 		authUrl := e.AuthURL
 		if authUrl == nil {
@@ -87,6 +194,135 @@ func (e *SwiftTarget) Connection() (*swift.Connection, error) {
 			AuthUrl:  authUrlStr,
 			Retries:  defaultRetries,
 		}
+		if e.noRetries {
+			e.cnx.Retries = minRetries
+		}
 	}
 	return e.cnx, nil
 }
+
+// disableClientRetries reduces the connection's retries to minRetries, for
+// use when operations are retried by a RetryingTarget instead
+func (e *SwiftTarget) disableClientRetries() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.noRetries = true
+	if e.cnx != nil {
+		e.cnx.Retries = minRetries
+	}
+}
+
+// swiftInfo returns the cluster capabilities reported by /info, caching the
+// result. Concurrent callers wait for a single request.
+func (e *SwiftTarget) swiftInfo() (swift.SwiftInfo, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.info == nil {
+		cnx, err := e.connection()
+		if err != nil {
+			return nil, err
+		}
+		if !cnx.Authenticated() {
+			// QueryInfo needs the storage URL returned by authentication
+			if err = cnx.Authenticate(); err != nil {
+				return nil, err
+			}
+		}
+		info, err := cnx.QueryInfo()
+		if err != nil {
+			return nil, err
+		}
+		e.info = info
+	}
+	return e.info, nil
+}
+
+// maxBulkDeletes returns the maximum number of objects per bulk delete
+// request, or 0 if the cluster does not support bulk delete
+func (e *SwiftTarget) maxBulkDeletes() int {
+	info, err := e.swiftInfo()
+	if err != nil || !info.SupportsBulkDelete() {
+		return 0
+	}
+	if bulkDelete, ok := info["bulk_delete"].(map[string]interface{}); ok {
+		if max, ok := bulkDelete["max_deletes_per_request"].(float64); ok && max > 0 {
+			return int(max)
+		}
+	}
+	return defaultMaxBulkDeletes
+}
+
+// maxManifestSegments returns the maximum number of segments in a static
+// large object manifest, or 0 if unknown
+func (e *SwiftTarget) maxManifestSegments() int64 {
+	info, err := e.swiftInfo()
+	if err != nil {
+		return 0
+	}
+	if slo, ok := info["slo"].(map[string]interface{}); ok {
+		if max, ok := slo["max_manifest_segments"].(float64); ok && max > 0 {
+			return int64(max)
+		}
+	}
+	return 0
+}
+
+// withLargeObjects returns a copy of the target, sharing its connection, that
+// uploads every object larger than one byte as a large object of the
+// specified kind
+func (e *SwiftTarget) withLargeObjects(mode string) *SwiftTarget {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return &SwiftTarget{
+		UserName:             e.UserName,
+		APIKey:               e.APIKey,
+		AuthURL:              e.AuthURL,
+		Container:            e.Container,
+		LargeObjectThreshold: 1,
+		LargeObjectMode:      mode,
+		SegmentSize:          e.SegmentSize,
+		SegmentContainer:     e.SegmentContainer,
+		cnx:                  e.cnx,
+		info:                 e.info,
+		noRetries:            e.noRetries,
+	}
+}
+
+// ------------------------------------------------------------
+// Exported functions
+
+// ValidateSwiftLargeObjectMode returns an error if the specified mode is not
+// LargeObjectDLO or LargeObjectSLO
+func ValidateSwiftLargeObjectMode(mode string) error {
+	if mode != LargeObjectDLO && mode != LargeObjectSLO {
+		return fmt.Errorf("unknown Swift large object mode %#v; expected %#v or %#v", mode, LargeObjectDLO, LargeObjectSLO)
+	}
+	return nil
+}
+
+// WithSwiftLargeObjects returns a copy of the specified Swift target, which
+// may be decorated with a RetryingTarget or FaultTarget, that uploads every
+// object larger than one byte as a large object of the specified kind
+// (LargeObjectDLO or LargeObjectSLO)
+func WithSwiftLargeObjects(target Target, mode string) (Target, error) {
+	if err := ValidateSwiftLargeObjectMode(mode); err != nil {
+		return nil, err
+	}
+	switch t := target.(type) {
+	case *SwiftTarget:
+		return t.withLargeObjects(mode), nil
+	case *RetryingTarget:
+		inner, err := WithSwiftLargeObjects(t.Target, mode)
+		if err != nil {
+			return nil, err
+		}
+		return NewRetryingTarget(inner, t.Policy), nil
+	case *FaultTarget:
+		inner, err := WithSwiftLargeObjects(t.Target, mode)
+		if err != nil {
+			return nil, err
+		}
+		return NewFaultTarget(inner, t.Injector), nil
+	}
+	return nil, fmt.Errorf("not a Swift target: %v", target)
+}
@@ -3,16 +3,30 @@ package objects
 import (
 	"fmt"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 const (
-	protocolSwift = "swift"
-	protocolS3    = "s3"
+	protocolSwift  = "swift"
+	protocolS3     = "s3"
+	protocolFile   = "file"
+	protocolMemory = "mem"
+	protocolAzure  = "azure"
+	protocolGCS    = "gs"
 )
 
 // Target encapsulates a service URL and a bucket or container
 type Target interface {
 	Object(key string) Object
+
+	// List calls fn for each object in the target whose key starts with the
+	// specified prefix, in key order, following continuation tokens or markers
+	// as needed. If delimiter is not empty, keys containing the delimiter after
+	// the prefix are rolled up into a single common prefix summary.
+	List(prefix, delimiter string, fn ListFunc) error
+
 	Pretty() string
 }
 
@@ -20,6 +34,21 @@ func NewTarget(endpointURL *url.URL, bucketURL *url.URL, region string) (Target,
 	protocol := bucketURL.Scheme
 	bucket := bucketURL.Host
 
+	if protocol == protocolFile {
+		return NewFileTarget(filePath(bucketURL))
+	}
+	if protocol == protocolMemory {
+		return NewMemoryTargetFromURL(bucketURL)
+	}
+	if protocol == protocolAzure {
+		return NewAzureTarget(endpointURL, bucket)
+	}
+	if protocol == protocolGCS {
+		return NewGCSTarget(endpointURL, bucket)
+	}
+	if endpointURL == nil {
+		return nil, fmt.Errorf("endpoint URL is required for protocol %#v", protocol)
+	}
 	if protocol == protocolSwift {
 		return NewSwiftEndpoint(endpointURL, bucket)
 	} else if protocol == protocolS3 {
@@ -27,3 +56,46 @@ func NewTarget(endpointURL *url.URL, bucketURL *url.URL, region string) (Target,
 	}
 	return nil, fmt.Errorf("unsupported protocol: %#v", protocol)
 }
+
+// NewTargetAndPrefix returns the target and key prefix addressed by a URL of
+// the form <protocol>://<bucket>/<prefix>. For file:// URLs, the target is the
+// directory named by the URL if it exists or the URL ends with a slash;
+// otherwise the target is the parent directory and the prefix is the last
+// path element.
+func NewTargetAndPrefix(endpointURL, prefixURL *url.URL, region string) (Target, string, error) {
+	if prefixURL.Scheme == protocolFile {
+		path := filePath(prefixURL)
+		dir, prefix := path, ""
+		if !strings.HasSuffix(path, "/") {
+			if info, err := os.Stat(path); err != nil || !info.IsDir() {
+				dir, prefix = filepath.Split(path)
+			}
+		}
+		target, err := NewFileTarget(dir)
+		return target, prefix, err
+	}
+
+	bucketURL := *prefixURL
+	bucketURL.Path = ""
+	bucketURL.RawPath = ""
+	target, err := NewTarget(endpointURL, &bucketURL, region)
+	if err != nil {
+		return nil, "", err
+	}
+	return target, strings.TrimPrefix(prefixURL.Path, "/"), nil
+}
+
+// BaseTarget returns the target underlying any RetryingTarget or FaultTarget
+// decorators
+func BaseTarget(target Target) Target {
+	for {
+		switch t := target.(type) {
+		case *RetryingTarget:
+			target = t.Target
+		case *FaultTarget:
+			target = t.Target
+		default:
+			return target
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package objects
+
+import (
+	"fmt"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+const (
+	// UploadAuto uploads objects with a single request if they fit in one
+	// part, and by multipart upload otherwise
+	UploadAuto = "auto"
+	// UploadSingle uploads objects with a single request, regardless of size
+	UploadSingle = "single"
+	// UploadMultipart uploads objects by multipart upload, regardless of size
+	UploadMultipart = "multipart"
+
+	// MaxSingleUploadSize is the largest object S3 accepts in a single
+	// PutObject request (5 GiB)
+	MaxSingleUploadSize = 5 * 1024 * 1024 * 1024
+)
+
+// ------------------------------------------------------------
+// UploadInfo type
+
+// UploadInfo describes how an object was uploaded
+type UploadInfo struct {
+	// Method is UploadSingle or UploadMultipart
+	Method string
+	// Parts is the number of parts uploaded, or 1 for a single request
+	Parts int
+	// PartSize is the size of each part except the last, for multipart uploads
+	PartSize int64
+}
+
+func (u *UploadInfo) Pretty() string {
+	if u.Method == UploadSingle {
+		return "single request"
+	}
+	return fmt.Sprintf("%v upload (%d parts of %v)", u.Method, u.Parts, logging.FormatBytes(u.PartSize))
+}
+
+func (u *UploadInfo) String() string {
+	return u.Pretty()
+}
+
+// ------------------------------------------------------------
+// UploadReporter type
+
+// UploadReporter is implemented by objects that can report how they were
+// most recently uploaded with Create
+type UploadReporter interface {
+	LastUpload() *UploadInfo
+}
+
+// ------------------------------------------------------------
+// Exported functions
+
+// LastUpload returns how the specified object was most recently uploaded, or
+// nil if the object has not been uploaded or does not report uploads
+func LastUpload(obj Object) *UploadInfo {
+	if r, ok := obj.(UploadReporter); ok {
+		return r.LastUpload()
+	}
+	return nil
+}
+
+// ValidateUploadSize returns an error if objects of the specified size cannot
+// be uploaded with the specified method, i.e. if the method is UploadSingle
+// and the size is greater than MaxSingleUploadSize
+func ValidateUploadSize(method string, size int64) error {
+	if method == UploadSingle && size > MaxSingleUploadSize {
+		return fmt.Errorf(
+			"%v is too large for a single upload request (maximum %v); use multipart upload",
+			logging.FormatBytes(size), logging.FormatBytes(MaxSingleUploadSize),
+		)
+	}
+	return nil
+}
+
+// ValidateUploadMethod returns an error if the specified method is not
+// UploadAuto, UploadSingle, or UploadMultipart
+func ValidateUploadMethod(method string) error {
+	switch method {
+	case UploadAuto, UploadSingle, UploadMultipart:
+		return nil
+	}
+	return fmt.Errorf("unknown upload method %#v; expected %#v, %#v, or %#v", method, UploadAuto, UploadSingle, UploadMultipart)
+}
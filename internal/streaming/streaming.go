@@ -5,12 +5,79 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"sync"
 
 	"code.cloudfoundry.org/bytefmt"
 )
 
 const DefaultRangeSize = int64(5 * bytefmt.MEGABYTE)
 
+// DefaultPooledBuffers is the default maximum number of free buffers each
+// BufferPool retains
+const DefaultPooledBuffers = 16
+
+// ------------------------------------------------------------
+// BufferPool type
+
+// BufferPool is a free list of buffers of a fixed size, so that buffers can
+// be reused across ranges and downloads rather than allocated for each. Up to
+// a fixed number of free buffers are retained; any more are left to the
+// garbage collector.
+type BufferPool struct {
+	Size int64
+
+	free chan []byte
+}
+
+// NewBufferPool returns a new BufferPool for buffers of the specified size,
+// retaining up to the specified number of free buffers
+func NewBufferPool(size int64, maxFree int) *BufferPool {
+	return &BufferPool{Size: size, free: make(chan []byte, maxFree)}
+}
+
+var sharedBufferPools = map[int64]*BufferPool{}
+var sharedBufferPoolsMutex sync.Mutex
+
+// SharedBufferPool returns a BufferPool for buffers of the specified size,
+// shared by all callers in the process, retaining up to DefaultPooledBuffers
+// free buffers
+func SharedBufferPool(size int64) *BufferPool {
+	sharedBufferPoolsMutex.Lock()
+	defer sharedBufferPoolsMutex.Unlock()
+	pool, ok := sharedBufferPools[size]
+	if !ok {
+		pool = NewBufferPool(size, DefaultPooledBuffers)
+		sharedBufferPools[size] = pool
+	}
+	return pool
+}
+
+// Get returns a free buffer from the pool, if any, or otherwise a newly
+// allocated one, of length Size
+func (p *BufferPool) Get() []byte {
+	select {
+	case buffer := <-p.free:
+		return buffer
+	default:
+		return make([]byte, p.Size)
+	}
+}
+
+// Put returns a buffer to the pool. Buffers with capacity other than Size are
+// ignored. The caller must not use the buffer afterward.
+func (p *BufferPool) Put(buffer []byte) {
+	if int64(cap(buffer)) != p.Size {
+		return
+	}
+	select {
+	case p.free <- buffer[:p.Size]:
+	default:
+	}
+}
+
+// ------------------------------------------------------------
+// Functions
+
 func NextRange(currentTotal int64, maxRangeSize int64, contentLength int64) (start, end int64, size int) {
 	start = currentTotal
 	end = currentTotal + maxRangeSize
@@ -23,7 +23,9 @@ const (
 
 type Case interface {
 	Name() string
-	RunWithSpinner(index int, target objects.Target, dryRun bool) (detail string)
+	// Run executes the case against the specified target, without a spinner
+	Run(target objects.Target) (ok bool, detail string)
+	RunWithSpinner(index int, target objects.Target) (detail string)
 }
 
 // ------------------------------------------------------------
@@ -44,11 +46,15 @@ func (c *caseImpl) Name() string {
 	return c.name
 }
 
-func (c *caseImpl) RunWithSpinner(index int, target objects.Target, dryRun bool) string {
+func (c *caseImpl) Run(target objects.Target) (ok bool, detail string) {
+	return c.exec(target)
+}
+
+func (c *caseImpl) RunWithSpinner(index int, target objects.Target) string {
 	sp := newSpinner(c.title(index))
 	sp.Start()
 
-	elapsed, ok, detail := c.maybeExec(target, dryRun)
+	elapsed, ok, detail := c.timedExec(target)
 	if time.Duration(elapsed) < minTaskTime {
 		time.Sleep(minTaskTime - time.Duration(elapsed))
 	}
@@ -72,17 +78,8 @@ func (c *caseImpl) title(index int) string {
 	return fmt.Sprintf("%d. %v", index+1, c.Name())
 }
 
-func (c *caseImpl) maybeExec(target objects.Target, dryRun bool) (elapsed int64, ok bool, detail string) {
+func (c *caseImpl) timedExec(target objects.Target) (elapsed int64, ok bool, detail string) {
 	start := time.Now().UnixNano()
-	if dryRun {
-		execOrig := c.exec
-		defer func() {
-			c.exec = execOrig
-		}()
-		c.exec = func(target objects.Target) (ok bool, detail string) {
-			return true, ""
-		}
-	}
 	ok, detail = c.exec(target)
 	elapsed = time.Now().UnixNano() - start
 	return
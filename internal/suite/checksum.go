@@ -0,0 +1,74 @@
+package suite
+
+import (
+	"fmt"
+
+	"github.com/dmolesUC3/cos/internal/objects"
+
+	. "code.cloudfoundry.org/bytefmt"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	. "github.com/dmolesUC3/cos/pkg"
+)
+
+// checksumSizes are the object sizes for checksum cases: one small enough to
+// upload with a single request, and one large enough for a multipart upload
+// with the default S3 part size (5 MiB)
+var checksumSizes = []int64{KILOBYTE, 16 * MEGABYTE}
+
+// ChecksumCases returns cases that upload objects of each checksum size up to
+// sizeMax, first with correct checksums, which the server should accept, and
+// then with deliberately wrong checksums, which it should reject
+func ChecksumCases(sizeMax int64) []Case {
+	var tasks []Case
+	for _, size := range checksumSizes {
+		if size <= sizeMax {
+			tasks = append(tasks, ChecksumCase(size), WrongChecksumCase(size))
+		}
+	}
+	return tasks
+}
+
+// ChecksumCase returns a case that creates, retrieves, verifies, and deletes
+// a file of the specified size, sending checksums with the upload
+func ChecksumCase(size int64) Case {
+	title := fmt.Sprintf("create/retrieve/verify/delete %v file with checksums", logging.FormatBytes(size))
+	execution := func(target objects.Target) (ok bool, detail string) {
+		crvd := NewCrvd(target, "", size, DefaultRandomSeed)
+		crvd.SendChecksum = true
+		err := crvd.CreateRetrieveVerifyDelete()
+		if err == nil {
+			return true, uploadDetail(crvd)
+		} else {
+			return false, err.Error()
+		}
+	}
+	return newCase(title, execution)
+}
+
+// WrongChecksumCase returns a case that uploads a file of the specified size
+// with deliberately wrong checksums, and succeeds only if the server rejects
+// the upload without creating the object
+func WrongChecksumCase(size int64) Case {
+	title := fmt.Sprintf("reject %v file with wrong checksums", logging.FormatBytes(size))
+	execution := func(target objects.Target) (ok bool, detail string) {
+		crvd := NewCrvd(target, "", size, DefaultRandomSeed)
+		obj := crvd.Object
+		err := obj.Create(crvd.NewBody(), size, objects.WithWrongChecksums())
+		if err == objects.ErrChecksumNotSupported {
+			return false, err.Error()
+		}
+		if _, lengthErr := obj.ContentLength(); lengthErr == nil {
+			_ = obj.Delete()
+			if err == nil {
+				return false, fmt.Sprintf("server accepted upload of %v with wrong checksums", obj)
+			}
+			return false, fmt.Sprintf("upload of %v with wrong checksums failed (%v), but object was created", obj, err)
+		}
+		if err == nil {
+			return false, fmt.Sprintf("upload of %v with wrong checksums reported success, but object was not created", obj)
+		}
+		return true, fmt.Sprintf("rejected: %v", err)
+	}
+	return newCase(title, execution)
+}
@@ -19,30 +19,28 @@ const (
 	SizeMaxDefault = 256 * GIGABYTE
 )
 
-func FileSizeCases(sizeMax int64) []Case {
-	tasks := []Case{FileSizeCase(0)}
-	for _, unit := range []int64{BYTE, KILOBYTE, MEGABYTE, GIGABYTE, TERABYTE} {
-		if unit > sizeMax {
-			break
-		}
-		for _, multiplier := range []int64{1, 16, 256} {
-			size := multiplier * unit
-			if size > sizeMax {
-				break
-			}
-			tasks = append(tasks, FileSizeCase(size))
-		}
+// FileSizeCases returns create/retrieve/verify/delete cases for files of
+// increasing sizes, up to sizeMax, with the specified content (if nil,
+// random bytes with the default seed)
+func FileSizeCases(sizeMax int64, content Content) []Case {
+	tasks := []Case{FileSizeCase(0, content)}
+	for _, size := range fileSizes(sizeMax) {
+		tasks = append(tasks, FileSizeCase(size, content))
 	}
 	return tasks
 }
 
-func FileSizeCase(size int64) Case {
+func FileSizeCase(size int64, content Content) Case {
 	title := fmt.Sprintf("create/retrieve/verify/delete %v file", logging.FormatBytes(size))
+	if content != nil {
+		title = fmt.Sprintf("%v (%v)", title, content)
+	}
 	execution := func(target objects.Target) (ok bool, detail string) {
 		crvd := NewCrvd(target, "", size, DefaultRandomSeed)
+		crvd.Content = content
 		err := crvd.CreateRetrieveVerifyDelete()
 		if err == nil {
-			return true, ""
+			return true, uploadDetail(crvd)
 		} else {
 			return false, err.Error()
 		}
@@ -61,4 +59,30 @@ func ParseSizeMax(sizeStr string) (int64, error) {
 		return 0, fmt.Errorf("specified size %d bytes exceeds maximum %d", bytes, math.MaxInt64)
 	}
 	return int64(bytes), err
-}
\ No newline at end of file
+}
+
+// fileSizes returns 1, 16, and 256 of each unit from bytes to terabytes, up to sizeMax
+func fileSizes(sizeMax int64) []int64 {
+	var sizes []int64
+	for _, unit := range []int64{BYTE, KILOBYTE, MEGABYTE, GIGABYTE, TERABYTE} {
+		if unit > sizeMax {
+			break
+		}
+		for _, multiplier := range []int64{1, 16, 256} {
+			size := multiplier * unit
+			if size > sizeMax {
+				break
+			}
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes
+}
+
+// uploadDetail describes how the object was uploaded, if known
+func uploadDetail(crvd *Crvd) string {
+	if crvd.Upload == nil {
+		return ""
+	}
+	return fmt.Sprintf("uploaded by %v", crvd.Upload)
+}
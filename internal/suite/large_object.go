@@ -0,0 +1,77 @@
+package suite
+
+import (
+	"fmt"
+
+	"github.com/dmolesUC3/cos/internal/objects"
+
+	. "code.cloudfoundry.org/bytefmt"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	. "github.com/dmolesUC3/cos/pkg"
+)
+
+const (
+	// LargeObjectSizeMin is the size of the smallest large object case, which
+	// spans several segments of the default size (5 MiB)
+	LargeObjectSizeMin = 16 * MEGABYTE
+)
+
+var largeObjectNames = map[string]string{
+	objects.LargeObjectDLO: "dynamic large object",
+	objects.LargeObjectSLO: "static large object",
+}
+
+// SwiftLargeObjectCases returns create/retrieve/verify/delete cases for Swift
+// dynamic and static large objects of increasing sizes, up to sizeMax
+func SwiftLargeObjectCases(sizeMax int64) []Case {
+	var tasks []Case
+	for _, mode := range []string{objects.LargeObjectDLO, objects.LargeObjectSLO} {
+		for _, size := range fileSizes(sizeMax) {
+			if size >= LargeObjectSizeMin {
+				tasks = append(tasks, SwiftLargeObjectCase(mode, size))
+			}
+		}
+	}
+	return tasks
+}
+
+// SwiftLargeObjectCase returns a case that creates, retrieves, and verifies a
+// Swift large object of the specified kind (LargeObjectDLO or LargeObjectSLO)
+// and size, checks that the cluster reports it as that kind of large object,
+// and deletes it along with its segments
+func SwiftLargeObjectCase(mode string, size int64) Case {
+	title := fmt.Sprintf("create/retrieve/verify/delete %v Swift %v", logging.FormatBytes(size), largeObjectNames[mode])
+	execution := func(target objects.Target) (ok bool, detail string) {
+		largeObjectTarget, err := objects.WithSwiftLargeObjects(target, mode)
+		if err != nil {
+			return false, err.Error()
+		}
+		crvd := NewCrvd(largeObjectTarget, "", size, DefaultRandomSeed)
+		err = crvd.CreateRetrieveVerify()
+		if err == nil {
+			err = verifyLargeObject(crvd.Object, mode)
+		}
+		err2 := crvd.Object.Delete()
+		if err == nil {
+			err = err2
+		}
+		if err == nil {
+			return true, ""
+		} else {
+			return false, err.Error()
+		}
+	}
+	return newCase(title, execution)
+}
+
+func verifyLargeObject(obj objects.Object, mode string) error {
+	info, err := obj.Stat()
+	if err != nil {
+		return err
+	}
+	if info.LargeObject != mode {
+		return fmt.Errorf("expected %v to be stored as %v, but was %#v", obj, largeObjectNames[mode], info.LargeObject)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package test
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+
+	"code.cloudfoundry.org/bytefmt"
+	. "gopkg.in/check.v1"
+
+	"github.com/dmolesUC3/cos/internal/fakes"
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+const azureTestContainer = "azure-test-container"
+
+type AzureObjectSuite struct {
+	server   *fakes.AzureServer
+	target   *AzureTarget
+	envSaved map[string]string
+}
+
+var _ = Suite(&AzureObjectSuite{})
+
+func (s *AzureObjectSuite) SetUpSuite(c *C) {
+	s.envSaved = map[string]string{}
+	for k, v := range map[string]string{
+		AzureAccountEnvVar: fakes.AzuriteAccount,
+		AzureKeyEnvVar:     fakes.AzuriteKey,
+	} {
+		s.envSaved[k] = os.Getenv(k)
+		c.Assert(os.Setenv(k, v), IsNil)
+	}
+}
+
+func (s *AzureObjectSuite) TearDownSuite(c *C) {
+	for k, v := range s.envSaved {
+		_ = os.Setenv(k, v)
+	}
+}
+
+func (s *AzureObjectSuite) SetUpTest(c *C) {
+	s.server = fakes.NewAzureServer()
+	s.server.CreateContainer(azureTestContainer)
+	endpointURL, err := url.Parse(s.server.URL())
+	c.Assert(err, IsNil)
+	s.target, err = NewAzureTarget(endpointURL, azureTestContainer)
+	c.Assert(err, IsNil)
+}
+
+func (s *AzureObjectSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *AzureObjectSuite) TestCreateDownloadDelete(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model (1).txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+
+	stored, ok := s.server.Blob(azureTestContainer, "nested/path/model (1).txt")
+	c.Assert(ok, Equals, true)
+	c.Assert(stored, DeepEquals, data)
+
+	length, err := obj.ContentLength()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, int64(len(data)))
+
+	buffer := make([]byte, 5)
+	n, err := obj.DownloadRange(9, 13, buffer)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(5))
+	c.Assert(string(buffer), Equals, "very ")
+
+	var out bytes.Buffer
+	n, err = Download(obj, 7, &out)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(len(data)))
+	c.Assert(out.Bytes(), DeepEquals, data)
+
+	c.Assert(obj.Delete(), IsNil)
+	_, ok = s.server.Blob(azureTestContainer, "nested/path/model (1).txt")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *AzureObjectSuite) TestStream(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+	assertStreams(c, obj, data)
+}
+
+func (s *AzureObjectSuite) TestStreamIgnoredRange(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+	s.server.IgnoreOpenRanges = true
+	assertStreamChecksRange(c, obj, data)
+}
+
+func (s *AzureObjectSuite) TestDownloadRangeIgnoredRange(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+	s.server.IgnoreRanges = true
+	assertDownloadRangeChecksRange(c, obj, data)
+}
+
+func (s *AzureObjectSuite) TestNewObject(c *C) {
+	data := []byte("data")
+	c.Assert(s.target.Object("key.bin").Create(bytes.NewReader(data), int64(len(data))), IsNil)
+
+	objURL, err := url.Parse("azure://" + azureTestContainer + "/key.bin")
+	c.Assert(err, IsNil)
+	endpointURL, err := url.Parse(s.server.URL())
+	c.Assert(err, IsNil)
+	obj, err := NewObject(objURL, endpointURL, "")
+	c.Assert(err, IsNil)
+	length, err := obj.ContentLength()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, int64(len(data)))
+}
+
+func (s *AzureObjectSuite) TestDefaultEndpoint(c *C) {
+	target, err := NewAzureTarget(nil, azureTestContainer)
+	c.Assert(err, IsNil)
+	c.Assert(target.Endpoint.String(), Equals, "https://"+fakes.AzuriteAccount+".blob.core.windows.net")
+}
+
+func (s *AzureObjectSuite) TestSingleBlobCrvd(c *C) {
+	crvd := pkg.NewCrvd(s.target, "single.bin", 1024, pkg.DefaultRandomSeed)
+	c.Assert(crvd.CreateRetrieveVerify(), IsNil)
+
+	info, err := s.target.Object("single.bin").Stat()
+	c.Assert(err, IsNil)
+	c.Assert(info.URL, Equals, "azure://"+azureTestContainer+"/single.bin")
+	c.Assert(info.ContentLength, Equals, int64(1024))
+	c.Assert(info.ETag, Not(Equals), "")
+	c.Assert(info.ContentType, Equals, "application/octet-stream")
+	c.Assert(info.LastModified.IsZero(), Equals, false)
+	c.Assert(info.LargeObject, Equals, "")
+}
+
+func (s *AzureObjectSuite) TestStagedBlocks(c *C) {
+	s.target.BlockSize = int64(bytefmt.MEGABYTE)
+	size := int64(3*bytefmt.MEGABYTE + 17)
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	obj := s.target.Object("staged.bin")
+	c.Assert(obj.Create(bytes.NewReader(data), size), IsNil)
+
+	stored, ok := s.server.Blob(azureTestContainer, "staged.bin")
+	c.Assert(ok, Equals, true)
+	c.Assert(bytes.Equal(stored, data), Equals, true)
+	c.Assert(s.server.BlockCount(azureTestContainer, "staged.bin"), Equals, 4)
+
+	info, err := obj.Stat()
+	c.Assert(err, IsNil)
+	c.Assert(info.ContentLength, Equals, size)
+	c.Assert(info.LargeObject, Equals, LargeObjectBlocks)
+	c.Assert(info.Parts, Equals, 4)
+}
+
+func (s *AzureObjectSuite) TestBlockSizeFor(c *C) {
+	target := &AzureTarget{}
+	c.Assert(target.BlockSizeFor(1024), Equals, int64(5*bytefmt.MEGABYTE))
+
+	length := int64(500 * bytefmt.GIGABYTE)
+	blockSize := target.BlockSizeFor(length)
+	c.Assert(blockSize*50000 >= length, Equals, true)
+	c.Assert((blockSize-1)*50000 < length, Equals, true)
+}
+
+func (s *AzureObjectSuite) TestList(c *C) {
+	s.server.MaxResults = 2
+	checkListing(c, s.target, true)
+}
+
+func (s *AzureObjectSuite) TestBadKey(c *C) {
+	c.Assert(os.Setenv(AzureKeyEnvVar, "bm90IHRoZSBrZXk="), IsNil)
+	defer func() {
+		_ = os.Setenv(AzureKeyEnvVar, fakes.AzuriteKey)
+	}()
+	endpointURL, err := url.Parse(s.server.URL())
+	c.Assert(err, IsNil)
+	target, err := NewAzureTarget(endpointURL, azureTestContainer)
+	c.Assert(err, IsNil)
+	_, err = target.Object("anything").ContentLength()
+	c.Assert(err, NotNil)
+	azureErr, ok := err.(*AzureError)
+	c.Assert(ok, Equals, true)
+	c.Assert(azureErr.Code, Equals, "AuthenticationFailed")
+}
+
+func (s *AzureObjectSuite) TestMissingBlob(c *C) {
+	_, err := s.target.Object("missing").ContentLength()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*AzureError).StatusCode, Equals, 404)
+
+	err = s.target.Object("missing").Delete()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*AzureError).Code, Equals, "BlobNotFound")
+}
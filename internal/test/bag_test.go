@@ -0,0 +1,157 @@
+package test
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+const bagPrefix = "bags/fk4kw5kc1z/"
+
+var bagPayload = map[string]string{
+	"data/hello.txt":       "hello\n",
+	"data/nested/world.md": "# world\n",
+	"data/line%break.txt":  "percent-encoded\n",
+}
+
+type BagSuite struct {
+	bucketCount int
+	target      Target
+}
+
+var _ = Suite(&BagSuite{})
+
+func (s *BagSuite) SetUpTest(c *C) {
+	s.bucketCount++
+	s.target = NewMemoryTarget(fmt.Sprintf("bag-suite-%d", s.bucketCount), DefaultMemoryRules)
+
+	var octets int
+	var sha256Manifest, md5Manifest strings.Builder
+	for _, path := range []string{"data/hello.txt", "data/nested/world.md", "data/line%break.txt"} {
+		data := bagPayload[path]
+		s.put(c, path, data)
+		octets += len(data)
+		encoded := strings.Replace(path, "%", "%25", -1)
+		sha256Manifest.WriteString(fmt.Sprintf("%x  %v\n", sha256.Sum256([]byte(data)), encoded))
+		md5Manifest.WriteString(fmt.Sprintf("%x %v\n", md5.Sum([]byte(data)), encoded))
+	}
+	tagFiles := map[string]string{
+		"bagit.txt":           "BagIt-Version: 1.0\nTag-File-Character-Encoding: UTF-8\n",
+		"bag-info.txt":        fmt.Sprintf("Source-Organization: UC3\nExternal-Description: a bag\n  for testing\nPayload-Oxum: %d.%d\n", octets, len(bagPayload)),
+		"manifest-sha256.txt": sha256Manifest.String(),
+		"manifest-md5.txt":    md5Manifest.String(),
+	}
+	var tagManifest strings.Builder
+	for _, path := range []string{"bagit.txt", "bag-info.txt", "manifest-sha256.txt", "manifest-md5.txt"} {
+		s.put(c, path, tagFiles[path])
+		tagManifest.WriteString(fmt.Sprintf("%x %v\n", sha256.Sum256([]byte(tagFiles[path])), path))
+	}
+	s.put(c, "tagmanifest-sha256.txt", tagManifest.String())
+}
+
+func (s *BagSuite) put(c *C, path string, data string) {
+	c.Assert(s.target.Object(bagPrefix+path).Create(strings.NewReader(data), int64(len(data))), IsNil)
+}
+
+func (s *BagSuite) validate(c *C) (*pkg.BagSummary, map[string]string) {
+	statuses := map[string]string{}
+	validation := pkg.BagValidation{Target: s.target, Prefix: bagPrefix, Workers: 2}
+	summary, err := validation.Validate(func(result pkg.ManifestResult) {
+		c.Check(result.Key, Equals, bagPrefix+result.Entry.Path)
+		statuses[result.Entry.Path] = result.Status
+	})
+	c.Assert(err, IsNil)
+	return summary, statuses
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *BagSuite) TestValid(c *C) {
+	summary, statuses := s.validate(c)
+	c.Assert(summary.Problems, IsNil)
+	c.Assert(summary.Extra, IsNil)
+	c.Assert(summary.Valid(), Equals, true)
+	c.Assert(summary.Version, Equals, "1.0")
+	c.Assert(summary.Files, Equals, pkg.ManifestSummary{Passed: 7})
+	for path := range bagPayload {
+		c.Check(statuses[path], Equals, pkg.ManifestPass, Commentf(path))
+	}
+	c.Assert(statuses["manifest-md5.txt"], Equals, pkg.ManifestPass)
+}
+
+func (s *BagSuite) TestCorruptedPayload(c *C) {
+	s.put(c, "data/hello.txt", "HELLO\n")
+	summary, statuses := s.validate(c)
+	c.Assert(summary.Valid(), Equals, false)
+	c.Assert(summary.Problems, IsNil)
+	c.Assert(statuses["data/hello.txt"], Equals, pkg.ManifestFail)
+	c.Assert(summary.Files.Failed, Equals, 1)
+}
+
+func (s *BagSuite) TestMissingPayload(c *C) {
+	c.Assert(s.target.Object(bagPrefix+"data/nested/world.md").Delete(), IsNil)
+	summary, statuses := s.validate(c)
+	c.Assert(summary.Valid(), Equals, false)
+	c.Assert(statuses["data/nested/world.md"], Equals, pkg.ManifestMissing)
+	c.Assert(summary.Problems, HasLen, 1)
+	c.Assert(summary.Problems[0], Matches, "Payload-Oxum mismatch: expected 30.3, actual 22.2")
+}
+
+func (s *BagSuite) TestExtraPayload(c *C) {
+	s.put(c, "data/extra.txt", "")
+	summary, statuses := s.validate(c)
+	c.Assert(summary.Valid(), Equals, false)
+	c.Assert(summary.Extra, DeepEquals, []string{"data/extra.txt"})
+	c.Assert(statuses["data/extra.txt"], Equals, pkg.BagExtra)
+	c.Assert(summary.Files.OK(), Equals, true)
+	c.Assert(summary.Problems, HasLen, 1)
+	c.Assert(summary.Problems[0], Matches, "Payload-Oxum mismatch: .*actual 30.4")
+}
+
+func (s *BagSuite) TestNotInEveryManifest(c *C) {
+	s.put(c, "manifest-md5.txt", fmt.Sprintf("%x data/hello.txt\n", md5.Sum([]byte("hello\n"))))
+	summary, _ := s.validate(c)
+	c.Assert(summary.Valid(), Equals, false)
+	c.Assert(summary.Problems, DeepEquals, []string{
+		"data/line%break.txt is not listed in manifest-md5.txt",
+		"data/nested/world.md is not listed in manifest-md5.txt",
+	})
+	// the tag manifest no longer matches
+	c.Assert(summary.Files.Failed, Equals, 1)
+}
+
+func (s *BagSuite) TestInvalidDeclaration(c *C) {
+	s.put(c, "bagit.txt", "BagIt-Version: 1.0\nTag-File-Character-Encoding: ISO-8859-1\n")
+	summary, _ := s.validate(c)
+	c.Assert(summary.Valid(), Equals, false)
+	c.Assert(summary.Problems, DeepEquals, []string{"unsupported Tag-File-Character-Encoding: \"ISO-8859-1\""})
+
+	c.Assert(s.target.Object(bagPrefix+"bagit.txt").Delete(), IsNil)
+	summary, statuses := s.validate(c)
+	c.Assert(summary.Problems, DeepEquals, []string{"bagit.txt not found"})
+	c.Assert(statuses["bagit.txt"], Equals, pkg.ManifestMissing)
+}
+
+func (s *BagSuite) TestNoPayloadManifest(c *C) {
+	c.Assert(s.target.Object(bagPrefix+"manifest-md5.txt").Delete(), IsNil)
+	c.Assert(s.target.Object(bagPrefix+"manifest-sha256.txt").Delete(), IsNil)
+	summary, _ := s.validate(c)
+	c.Assert(summary.Valid(), Equals, false)
+	c.Assert(summary.Problems, DeepEquals, []string{"no payload manifest found"})
+	c.Assert(summary.Extra, HasLen, len(bagPayload))
+}
+
+func (s *BagSuite) TestNoBag(c *C) {
+	_, err := pkg.BagValidation{Target: s.target, Prefix: "no-such-bag/"}.Validate(func(result pkg.ManifestResult) {})
+	c.Assert(err, ErrorMatches, "no objects found under \"no-such-bag/\"")
+}
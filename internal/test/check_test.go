@@ -0,0 +1,105 @@
+package test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+// known digests of "hello\n"
+var helloDigests = map[string]string{
+	"md5":     "b1946ac92492d2347c6235b4d2611184",
+	"sha1":    "f572d396fae9206628714fb2ce00f72e94f2258f",
+	"sha256":  "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03",
+	"sha512":  "e7c22b994c59d9cf2b48e549b1e24666636045930d3da7c1acb299d1c3b7f931f94aae41edda2c2b207a36e10f8bcb8d45223e54878f5b316e7ce3b6bc019629",
+	"crc32c":  "353dd8be",
+	"blake2b": "f60ce482e5cc1229f39d71313171a8d9f4ca3a87d066bf4b205effb528192a75f14f3271e2c1a90e1de53f275b4d4793eef2f5e31ea90d2ce29d2e481c36435f",
+}
+
+type CheckSuite struct {
+	bucketCount int
+	obj         Object
+}
+
+var _ = Suite(&CheckSuite{})
+
+func (s *CheckSuite) SetUpTest(c *C) {
+	s.bucketCount++
+	target := NewMemoryTarget(fmt.Sprintf("check-suite-%d", s.bucketCount), DefaultMemoryRules)
+	s.obj = target.Object("hello.txt")
+	data := []byte("hello\n")
+	c.Assert(s.obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *CheckSuite) TestAllAlgorithms(c *C) {
+	digests, err := CalcDigests(s.obj, 2, DigestAlgorithms...)
+	c.Assert(err, IsNil)
+	c.Assert(digests, HasLen, len(DigestAlgorithms))
+	for _, algorithm := range DigestAlgorithms {
+		c.Check(hex.EncodeToString(digests[algorithm]), Equals, helloDigests[algorithm], Commentf(algorithm))
+	}
+}
+
+func (s *CheckSuite) TestUnsupportedAlgorithm(c *C) {
+	_, err := CalcDigests(s.obj, 2, "sha256", "sha3")
+	c.Assert(err, ErrorMatches, "unsupported digest algorithm: 'sha3'.*")
+	_, err = CalcDigests(s.obj, 2, "md5", "md5")
+	c.Assert(err, ErrorMatches, ".*more than once")
+}
+
+func (s *CheckSuite) TestVerifyDigests(c *C) {
+	algorithms := []string{"sha256", "md5", "crc32c"}
+	expected, err := pkg.ParseExpectedDigests([]string{"md5:" + helloDigests["md5"], "crc32c:" + helloDigests["crc32c"]}, algorithms)
+	c.Assert(err, IsNil)
+	check := pkg.Check{Object: s.obj, Algorithms: algorithms, Expected: expected}
+	digests, err := check.VerifyDigests()
+	c.Assert(err, IsNil)
+	c.Assert(hex.EncodeToString(digests["sha256"]), Equals, helloDigests["sha256"])
+
+	check.Expected["sha256"] = make([]byte, 32)
+	check.Expected["md5"] = make([]byte, 16)
+	_, err = check.VerifyDigests()
+	c.Assert(err, ErrorMatches, "(?s)sha256 digest mismatch:.*md5 digest mismatch:.*")
+}
+
+func (s *CheckSuite) TestVerifyDigest(c *C) {
+	check := pkg.Check{Object: s.obj, Algorithms: []string{"md5"}}
+	digest, err := check.VerifyDigest()
+	c.Assert(err, IsNil)
+	c.Assert(hex.EncodeToString(digest), Equals, helloDigests["md5"])
+
+	check.Expected = map[string][]byte{"md5": make([]byte, 16)}
+	digest, err = check.VerifyDigest()
+	c.Assert(err, ErrorMatches, "(?s)md5 digest mismatch:.*")
+	c.Assert(hex.EncodeToString(digest), Equals, helloDigests["md5"])
+
+	check.Algorithms = []string{"md5", "sha256"}
+	_, err = check.VerifyDigest()
+	c.Assert(err, ErrorMatches, "VerifyDigest requires exactly one algorithm, got 2")
+}
+
+func (s *CheckSuite) TestParseExpectedDigests(c *C) {
+	expected, err := pkg.ParseExpectedDigests([]string{helloDigests["md5"]}, []string{"md5"})
+	c.Assert(err, IsNil)
+	c.Assert(hex.EncodeToString(expected["md5"]), Equals, helloDigests["md5"])
+
+	_, err = pkg.ParseExpectedDigests([]string{helloDigests["md5"]}, []string{"md5", "sha256"})
+	c.Assert(err, ErrorMatches, ".*must be prefixed.*")
+	_, err = pkg.ParseExpectedDigests([]string{"sha1:" + helloDigests["sha1"]}, []string{"md5", "sha256"})
+	c.Assert(err, ErrorMatches, ".*not among the algorithms.*")
+	_, err = pkg.ParseExpectedDigests([]string{"md5:abc", "md5:def"}, []string{"md5"})
+	c.Assert(err, ErrorMatches, ".*invalid expected md5 digest.*")
+	_, err = pkg.ParseExpectedDigests([]string{"md5:ab", "md5:cd"}, []string{"md5"})
+	c.Assert(err, ErrorMatches, ".*more than once")
+}
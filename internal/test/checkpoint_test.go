@@ -0,0 +1,139 @@
+package test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/bytefmt"
+	. "gopkg.in/check.v1"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/internal/streaming"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+type CheckpointSuite struct {
+	bucketCount int
+	data        []byte
+	obj         Object
+	path        string
+}
+
+var _ = Suite(&CheckpointSuite{})
+
+func (s *CheckpointSuite) SetUpTest(c *C) {
+	s.bucketCount++
+	target := NewMemoryTarget(fmt.Sprintf("checkpoint-suite-%d", s.bucketCount), DefaultMemoryRules)
+	s.data = randomBytes(12 * bytefmt.MEGABYTE)
+	s.obj = target.Object("large.bin")
+	c.Assert(s.obj.Create(bytes.NewReader(s.data), int64(len(s.data))), IsNil)
+	s.path = filepath.Join(c.MkDir(), "large.checkpoint")
+}
+
+// interrupt runs a check that fails at the third range, leaving a checkpoint
+func (s *CheckpointSuite) interrupt(c *C, algorithms ...string) {
+	failAt := int64(2 * streaming.DefaultRangeSize)
+	check := pkg.Check{
+		Object:      &slowObject{Object: s.obj, failAt: failAt},
+		Algorithms:  algorithms,
+		Concurrency: 1,
+		Checkpoint:  s.path,
+	}
+	_, err := check.Verify()
+	c.Assert(err, ErrorMatches, fmt.Sprintf(".*injected failure \\(checkpoint saved to .* at byte %d of %d\\)", failAt, len(s.data)))
+
+	cp, err := pkg.LoadCheckpoint(s.path)
+	c.Assert(err, IsNil)
+	c.Assert(cp, NotNil)
+	c.Assert(cp.Offset, Equals, failAt)
+	c.Assert(cp.ContentLength, Equals, int64(len(s.data)))
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *CheckpointSuite) TestResume(c *C) {
+	s.interrupt(c, "sha256", "md5")
+
+	check := pkg.Check{Object: s.obj, Algorithms: []string{"sha256", "md5"}, Checkpoint: s.path}
+	result, err := check.Verify()
+	c.Assert(err, IsNil)
+	sha256Sum := sha256.Sum256(s.data)
+	md5Sum := md5.Sum(s.data)
+	c.Assert(result.Digests["sha256"], DeepEquals, sha256Sum[:])
+	c.Assert(result.Digests["md5"], DeepEquals, md5Sum[:])
+
+	_, err = os.Stat(s.path)
+	c.Assert(os.IsNotExist(err), Equals, true, Commentf("checkpoint not removed: %v", err))
+}
+
+func (s *CheckpointSuite) TestNoCheckpoint(c *C) {
+	check := pkg.Check{Object: s.obj, Algorithms: DigestAlgorithms, Checkpoint: s.path, CheckpointInterval: 1}
+	result, err := check.Verify()
+	c.Assert(err, IsNil)
+	sha256Sum := sha256.Sum256(s.data)
+	c.Assert(result.Digests["sha256"], DeepEquals, sha256Sum[:])
+	_, err = os.Stat(s.path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *CheckpointSuite) TestObjectChanged(c *C) {
+	s.interrupt(c, "sha256")
+	s.data[0] ^= 0x01
+	c.Assert(s.obj.Create(bytes.NewReader(s.data), int64(len(s.data))), IsNil)
+
+	_, err := pkg.Check{Object: s.obj, Algorithms: []string{"sha256"}, Checkpoint: s.path}.Verify()
+	c.Assert(err, ErrorMatches, "unable to resume from checkpoint .*: .* has changed since checkpoint .*")
+}
+
+func (s *CheckpointSuite) TestAlgorithmsChanged(c *C) {
+	s.interrupt(c, "sha256")
+	_, err := pkg.Check{Object: s.obj, Algorithms: []string{"sha256", "md5"}, Checkpoint: s.path}.Verify()
+	c.Assert(err, ErrorMatches, "unable to resume from checkpoint .*: checkpoint is for algorithms sha256, not md5, sha256")
+}
+
+func (s *CheckpointSuite) TestETagNotSupported(c *C) {
+	_, err := pkg.Check{Object: s.obj, Algorithms: []string{"sha256"}, ETag: true, Checkpoint: s.path}.Verify()
+	c.Assert(err, ErrorMatches, "ETag verification does not support checkpoints")
+}
+
+func (s *CheckpointSuite) TestSaveAndRestore(c *C) {
+	info, err := s.obj.Stat()
+	c.Assert(err, IsNil)
+	hashes, err := NewHashes(DigestAlgorithms)
+	c.Assert(err, IsNil)
+	half := len(s.data) / 2
+	for _, h := range hashes {
+		_, _ = h.Write(s.data[:half])
+	}
+	cp, err := pkg.NewCheckpoint(info, int64(half), hashes)
+	c.Assert(err, IsNil)
+	c.Assert(cp.Save(s.path), IsNil)
+
+	loaded, err := pkg.LoadCheckpoint(s.path)
+	c.Assert(err, IsNil)
+	c.Assert(loaded.Offset, Equals, int64(half))
+	restored, err := NewHashes(DigestAlgorithms)
+	c.Assert(err, IsNil)
+	c.Assert(loaded.Restore(info, restored), IsNil)
+	for algorithm, h := range restored {
+		_, _ = h.Write(s.data[half:])
+		expected, err := NewHash(algorithm)
+		c.Assert(err, IsNil)
+		_, _ = expected.Write(s.data)
+		c.Check(h.Sum(nil), DeepEquals, expected.Sum(nil), Commentf(algorithm))
+	}
+}
+
+func (s *CheckpointSuite) TestLoadMissing(c *C) {
+	cp, err := pkg.LoadCheckpoint(filepath.Join(c.MkDir(), "no-such-file"))
+	c.Assert(err, IsNil)
+	c.Assert(cp, IsNil)
+}
@@ -0,0 +1,229 @@
+package test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"unicode"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+type ContentSuite struct {
+	dir string
+}
+
+var _ = Suite(&ContentSuite{})
+
+func (s *ContentSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+}
+
+func (s *ContentSuite) body(c *C, content pkg.Content, length int64) []byte {
+	data, err := ioutil.ReadAll(content.NewBody(length))
+	c.Assert(err, IsNil, Commentf("%v", content))
+	c.Assert(data, HasLen, int(length), Commentf("%v", content))
+	return data
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *ContentSuite) TestParseContent(c *C) {
+	path := filepath.Join(s.dir, "sample.txt")
+	c.Assert(ioutil.WriteFile(path, []byte("sample"), 0644), IsNil)
+
+	expected := map[string]pkg.Content{
+		"random":           &pkg.RandomContent{Seed: 17},
+		"zeros":            &pkg.ZerosContent{},
+		"pattern:DEADbeef": &pkg.PatternContent{Pattern: []byte{0xde, 0xad, 0xbe, 0xef}},
+		"file:" + path:     &pkg.FileContent{Path: path},
+		"text":             &pkg.TextContent{Seed: 17},
+	}
+	for spec, content := range expected {
+		parsed, err := pkg.ParseContent(spec, 17)
+		c.Assert(err, IsNil, Commentf(spec))
+		c.Assert(parsed, DeepEquals, content, Commentf(spec))
+	}
+	c.Assert((&pkg.PatternContent{Pattern: []byte{0xde, 0xad}}).String(), Equals, "pattern:dead")
+	c.Assert((&pkg.RandomContent{Seed: 1}).String(), Equals, "random (seed 1)")
+}
+
+func (s *ContentSuite) TestParseContentInvalid(c *C) {
+	empty := filepath.Join(s.dir, "empty.txt")
+	c.Assert(ioutil.WriteFile(empty, nil, 0644), IsNil)
+
+	invalid := map[string]string{
+		"":                   ".*expected \"random\", \"zeros\", .*",
+		"ones":               ".*expected \"random\", \"zeros\", .*",
+		"zeros:16":           ".*zeros takes no value",
+		"pattern:":           ".*pattern is empty",
+		"pattern:xyz":        ".*pattern is not valid hex.*",
+		"file:":              ".*no file specified",
+		"file:" + s.dir:      ".*is not a non-empty regular file",
+		"file:" + empty:      ".*is not a non-empty regular file",
+		"file:/no/such/file": ".*no such file or directory",
+	}
+	for spec, msg := range invalid {
+		_, err := pkg.ParseContent(spec, 1)
+		c.Check(err, ErrorMatches, msg, Commentf(spec))
+	}
+}
+
+func (s *ContentSuite) TestRandomMatchesDefault(c *C) {
+	crvd := pkg.NewCrvd(NewMemoryTarget("content-suite", DefaultMemoryRules), "", 1000, 42)
+	expected, err := ioutil.ReadAll(crvd.NewBody())
+	c.Assert(err, IsNil)
+	c.Assert(s.body(c, &pkg.RandomContent{Seed: 42}, 1000), DeepEquals, expected)
+}
+
+func (s *ContentSuite) TestRandom(c *C) {
+	data := s.body(c, &pkg.RandomContent{Seed: 1}, 100000)
+	c.Assert(s.body(c, &pkg.RandomContent{Seed: 1}, 100000), DeepEquals, data)
+	c.Assert(s.body(c, &pkg.RandomContent{Seed: 2}, 100000), Not(DeepEquals), data)
+
+	// the first block is the AES-128 encryption of counter 0, keyed by the
+	// first 16 bytes of the SHA-256 digest of the big-endian seed
+	key := sha256.Sum256([]byte{0, 0, 0, 0, 0, 0, 0, 1})
+	block, err := aes.NewCipher(key[:16])
+	c.Assert(err, IsNil)
+	expected := make([]byte, aes.BlockSize)
+	block.Encrypt(expected, make([]byte, aes.BlockSize))
+	c.Assert(data[:aes.BlockSize], DeepEquals, expected)
+}
+
+func (s *ContentSuite) TestZerosAndPattern(c *C) {
+	c.Assert(s.body(c, &pkg.ZerosContent{}, 100000), DeepEquals, make([]byte, 100000))
+
+	data := s.body(c, &pkg.PatternContent{Pattern: []byte("abc")}, 10)
+	c.Assert(string(data), Equals, "abcabcabca")
+	c.Assert(s.body(c, &pkg.PatternContent{Pattern: []byte("abc")}, 100003), DeepEquals, bytes.Repeat([]byte("abc"), 33335)[:100003])
+}
+
+func (s *ContentSuite) TestFileRepeated(c *C) {
+	path := filepath.Join(s.dir, "sample.txt")
+	c.Assert(ioutil.WriteFile(path, []byte("sample\n"), 0644), IsNil)
+	content := &pkg.FileContent{Path: path}
+	c.Assert(string(s.body(c, content, 4)), Equals, "samp")
+	c.Assert(string(s.body(c, content, 7)), Equals, "sample\n")
+	c.Assert(string(s.body(c, content, 17)), Equals, "sample\nsample\nsam")
+	c.Assert(content.Close(), IsNil)
+
+	_, err := ioutil.ReadAll((&pkg.FileContent{Path: filepath.Join(s.dir, "missing")}).NewBody(10))
+	c.Assert(err, ErrorMatches, ".*no such file or directory")
+}
+
+func (s *ContentSuite) TestFileKeptOpen(c *C) {
+	path := filepath.Join(s.dir, "sample.txt")
+	c.Assert(ioutil.WriteFile(path, []byte("sample\n"), 0644), IsNil)
+	content := &pkg.FileContent{Path: path}
+	c.Assert(string(s.body(c, content, 10)), Equals, "sample\nsam")
+
+	// replacing the file does not affect the open content
+	replacement := filepath.Join(s.dir, "replacement.txt")
+	c.Assert(ioutil.WriteFile(replacement, []byte("other\n"), 0644), IsNil)
+	c.Assert(os.Rename(replacement, path), IsNil)
+	c.Assert(string(s.body(c, content, 10)), Equals, "sample\nsam")
+
+	// once closed, the file is reopened
+	c.Assert(content.Close(), IsNil)
+	c.Assert(string(s.body(c, content, 10)), Equals, "other\nothe")
+	c.Assert(content.Close(), IsNil)
+	c.Assert(content.Close(), IsNil)
+}
+
+func (s *ContentSuite) TestText(c *C) {
+	content := &pkg.TextContent{Seed: 1}
+	data := s.body(c, content, 10000)
+	c.Assert(s.body(c, content, 10000), DeepEquals, data)
+	c.Assert(s.body(c, &pkg.TextContent{Seed: 2}, 10000), Not(DeepEquals), data)
+	c.Assert(unicode.IsUpper(rune(data[0])), Equals, true)
+	for _, b := range data {
+		c.Assert(b == '\n' || b == ' ' || b == '.' || unicode.IsLetter(rune(b)), Equals, true, Commentf("%q", b))
+	}
+}
+
+func (s *ContentSuite) TestCrvd(c *C) {
+	path := filepath.Join(s.dir, "sample.txt")
+	c.Assert(ioutil.WriteFile(path, []byte("sample"), 0644), IsNil)
+	target := NewMemoryTarget("content-suite-crvd", DefaultMemoryRules)
+	for _, spec := range []string{"random", "zeros", "pattern:0102", "file:" + path, "text"} {
+		content, err := pkg.ParseContent(spec, 1)
+		c.Assert(err, IsNil)
+		crvd := pkg.NewCrvd(target, "content.bin", 12345, 1)
+		crvd.Content = content
+		crvd.SendChecksum = true
+		c.Assert(crvd.CreateRetrieveVerifyDelete(), IsNil, Commentf(spec))
+	}
+}
+
+// ------------------------------------------------------------
+// Benchmarks
+//
+// Run with: go test ./internal/test -check.b -check.f ContentSuite.Benchmark
+
+// benchmarkSize is the number of bytes generated per benchmark iteration
+const benchmarkSize = 1 << 20
+
+func (s *ContentSuite) benchmark(c *C, content pkg.Content) {
+	c.SetBytes(benchmarkSize)
+	for i := 0; i < c.N; i++ {
+		if _, err := io.Copy(ioutil.Discard, content.NewBody(benchmarkSize)); err != nil {
+			c.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMathRand measures the Go default random number generator, formerly
+// used for random content, for comparison
+func (s *ContentSuite) BenchmarkMathRand(c *C) {
+	c.SetBytes(benchmarkSize)
+	for i := 0; i < c.N; i++ {
+		body := io.LimitReader(rand.New(rand.NewSource(1)), benchmarkSize)
+		if _, err := io.Copy(ioutil.Discard, body); err != nil {
+			c.Fatal(err)
+		}
+	}
+}
+
+func (s *ContentSuite) BenchmarkRandom(c *C) {
+	s.benchmark(c, &pkg.RandomContent{Seed: 1})
+}
+
+func (s *ContentSuite) BenchmarkCounter(c *C) {
+	s.benchmark(c, &pkg.CounterContent{Seed: 1})
+}
+
+func (s *ContentSuite) BenchmarkZeros(c *C) {
+	s.benchmark(c, &pkg.ZerosContent{})
+}
+
+func (s *ContentSuite) BenchmarkPattern(c *C) {
+	s.benchmark(c, &pkg.PatternContent{Pattern: []byte{0xde, 0xad, 0xbe, 0xef}})
+}
+
+func (s *ContentSuite) BenchmarkText(c *C) {
+	s.benchmark(c, &pkg.TextContent{Seed: 1})
+}
+
+func (s *ContentSuite) BenchmarkRandomReadAt(c *C) {
+	content := &pkg.RandomContent{Seed: 1}
+	p := make([]byte, benchmarkSize)
+	c.SetBytes(benchmarkSize)
+	for i := 0; i < c.N; i++ {
+		if _, err := content.ReadAt(p, int64(i)*benchmarkSize+7); err != nil {
+			c.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/internal/streaming"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+type DownloaderSuite struct {
+	bucketCount int
+	data        []byte
+	obj         Object
+}
+
+var _ = Suite(&DownloaderSuite{})
+
+func (s *DownloaderSuite) SetUpTest(c *C) {
+	s.bucketCount++
+	target := NewMemoryTarget(fmt.Sprintf("downloader-suite-%d", s.bucketCount), DefaultMemoryRules)
+	s.data = make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(s.data)
+	s.obj = target.Object("data.bin")
+	c.Assert(s.obj.Create(bytes.NewReader(s.data), int64(len(s.data))), IsNil)
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *DownloaderSuite) TestRangeSizes(c *C) {
+	for _, rangeSize := range []int64{1, 7, 100, 999, 1000, 1001} {
+		for _, concurrency := range []int{1, 3, 16} {
+			var out bytes.Buffer
+			n, err := NewDownloader(rangeSize, concurrency).Download(s.obj, &out)
+			comment := Commentf("range size %d, concurrency %d", rangeSize, concurrency)
+			c.Assert(err, IsNil, comment)
+			c.Assert(n, Equals, int64(len(s.data)), comment)
+			c.Assert(out.Bytes(), DeepEquals, s.data, comment)
+		}
+	}
+}
+
+func (s *DownloaderSuite) TestReordering(c *C) {
+	obj := &slowObject{Object: s.obj}
+	digest, err := NewDownloader(50, 4).CalcDigest(obj, "sha256")
+	c.Assert(err, IsNil)
+	expected := sha256.Sum256(s.data)
+	c.Assert(digest, DeepEquals, expected[:])
+	c.Assert(obj.maxInFlight > 1, Equals, true, Commentf("max in flight: %d", obj.maxInFlight))
+	c.Assert(obj.maxInFlight <= 4, Equals, true, Commentf("max in flight: %d", obj.maxInFlight))
+}
+
+func (s *DownloaderSuite) TestError(c *C) {
+	obj := &slowObject{Object: s.obj, failAt: 500}
+	var out bytes.Buffer
+	n, err := NewDownloader(100, 4).Download(obj, &out)
+	c.Assert(err, ErrorMatches, "error downloading bytes 500-599 .*: injected failure")
+	// later ranges finish first, so the failure may be seen before all of the
+	// preceding ranges are written, but nothing after it should be
+	c.Assert(n <= 500, Equals, true, Commentf("wrote %d bytes", n))
+	c.Assert(out.Bytes(), DeepEquals, s.data[:n])
+}
+
+func (s *DownloaderSuite) TestDownloadFrom(c *C) {
+	for _, offset := range []int64{0, 1, 99, 100, 101, 999, 1000} {
+		var out bytes.Buffer
+		n, err := NewDownloader(100, 3).DownloadFrom(s.obj, offset, &out)
+		comment := Commentf("offset: %d", offset)
+		c.Assert(err, IsNil, comment)
+		c.Assert(n, Equals, int64(len(s.data))-offset, comment)
+		c.Assert(bytes.Equal(out.Bytes(), s.data[offset:]), Equals, true, comment)
+	}
+	_, err := NewDownloader(100, 3).DownloadFrom(s.obj, 1001, &bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "offset 1001 out of range .*")
+}
+
+func (s *DownloaderSuite) TestEmptyObject(c *C) {
+	obj := s.obj.GetEndpoint().Object("empty.bin")
+	c.Assert(obj.Create(bytes.NewReader(nil), 0), IsNil)
+	var out bytes.Buffer
+	n, err := NewDownloader(100, 4).Download(obj, &out)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(0))
+}
+
+func (s *DownloaderSuite) TestDefaults(c *C) {
+	d := NewDownloader(0, 0)
+	c.Assert(d.RangeSize > 0, Equals, true)
+	c.Assert(d.Concurrency, Equals, DefaultDownloadConcurrency)
+}
+
+func (s *DownloaderSuite) TestStream(c *C) {
+	obj := &streamingObject{Object: s.obj}
+	d := NewDownloader(100, 4)
+	d.Stream = true
+	for _, offset := range []int64{0, 1, 999} {
+		var out bytes.Buffer
+		n, err := d.DownloadFrom(obj, offset, &out)
+		comment := Commentf("offset: %d", offset)
+		c.Assert(err, IsNil, comment)
+		c.Assert(n, Equals, int64(len(s.data))-offset, comment)
+		c.Assert(bytes.Equal(out.Bytes(), s.data[offset:]), Equals, true, comment)
+	}
+	c.Assert(obj.streams, Equals, 3)
+	c.Assert(obj.ranges, Equals, 0)
+}
+
+func (s *DownloaderSuite) TestStreamResumes(c *C) {
+	obj := &streamingObject{Object: s.obj, failAt: 250}
+	d := NewDownloader(100, 4)
+	d.Stream = true
+	var out bytes.Buffer
+	n, err := d.Download(obj, &out)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(len(s.data)))
+	c.Assert(out.Bytes(), DeepEquals, s.data)
+	c.Assert(obj.streams, Equals, 1)
+	// bytes 250-999, in ranges of 100
+	c.Assert(obj.ranges, Equals, 8)
+}
+
+func (s *DownloaderSuite) TestStreamNotSupported(c *C) {
+	obj := &slowObject{Object: s.obj}
+	d := NewDownloader(100, 4)
+	d.Stream = true
+	var out bytes.Buffer
+	_, err := d.Download(NewRetryingObject(obj, NewRetryPolicy()), &out)
+	c.Assert(err, IsNil)
+	c.Assert(out.Bytes(), DeepEquals, s.data)
+	c.Assert(obj.maxInFlight > 0, Equals, true)
+}
+
+func (s *DownloaderSuite) TestBufferPool(c *C) {
+	pool := streaming.NewBufferPool(100, 2)
+	b1, b2, b3 := pool.Get(), pool.Get(), pool.Get()
+	c.Assert(b1, HasLen, 100)
+	pool.Put(b1[:10])
+	pool.Put(b2)
+	pool.Put(b3)
+	pool.Put(make([]byte, 50))
+
+	// only two buffers retained, and returned at full length
+	r1, r2, r3 := pool.Get(), pool.Get(), pool.Get()
+	c.Assert(&r1[0], Equals, &b1[0])
+	c.Assert(r1, HasLen, 100)
+	c.Assert(&r2[0], Equals, &b2[0])
+	c.Assert(&r3[0] != &b3[0], Equals, true)
+
+	c.Assert(streaming.SharedBufferPool(100), Equals, streaming.SharedBufferPool(100))
+}
+
+// ------------------------------------------------------------
+// Helper functions
+
+// assertStreams asserts that the object supports streaming, and that its
+// streamed content from each of several offsets, and the content downloaded by
+// a streaming Downloader, is the specified data
+func assertStreams(c *C, obj Object, data []byte) {
+	streamer, ok := obj.(Streamer)
+	c.Assert(ok, Equals, true, Commentf("%v does not support streaming", obj))
+	for _, offset := range []int{0, 1, len(data) / 2, len(data) - 1} {
+		in, err := streamer.Stream(int64(offset))
+		c.Assert(err, IsNil)
+		streamed, err := ioutil.ReadAll(in)
+		c.Assert(err, IsNil)
+		c.Assert(in.Close(), IsNil)
+		c.Assert(bytes.Equal(streamed, data[offset:]), Equals, true, Commentf("offset %d: got %d bytes", offset, len(streamed)))
+	}
+	d := NewDownloader(7, 2)
+	d.Stream = true
+	var out bytes.Buffer
+	n, err := d.Download(obj, &out)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(len(data)))
+	c.Assert(out.Bytes(), DeepEquals, data)
+}
+
+// assertStreamChecksRange asserts that the object, whose server ignores
+// open-ended ranges, refuses to stream from an offset other than 0, and that
+// a streaming Downloader falls back to ranged requests
+func assertStreamChecksRange(c *C, obj Object, data []byte) {
+	streamer := obj.(Streamer)
+	in, err := streamer.Stream(0)
+	c.Assert(err, IsNil)
+	streamed, err := ioutil.ReadAll(in)
+	c.Assert(err, IsNil)
+	c.Assert(in.Close(), IsNil)
+	c.Assert(streamed, DeepEquals, data)
+
+	_, err = streamer.Stream(1)
+	c.Assert(err, ErrorMatches, "range starting at byte 1 of .* not honored.*")
+
+	d := NewDownloader(7, 2)
+	d.Stream = true
+	offset := int64(len(data) / 2)
+	var out bytes.Buffer
+	n, err := d.DownloadFrom(obj, offset, &out)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(len(data))-offset)
+	c.Assert(out.Bytes(), DeepEquals, data[offset:])
+}
+
+// assertDownloadRangeChecksRange asserts that the object, whose server
+// ignores all ranges, refuses to download a range starting at an offset
+// other than 0, rather than returning bytes from the start of the object
+func assertDownloadRangeChecksRange(c *C, obj Object, data []byte) {
+	buffer := make([]byte, 10)
+	n, err := obj.DownloadRange(0, 9, buffer)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(10))
+	c.Assert(buffer, DeepEquals, data[:10])
+
+	_, err = obj.DownloadRange(10, 19, buffer)
+	c.Assert(err, ErrorMatches, "range starting at byte 10 of .* not honored.*")
+
+	_, err = NewDownloader(7, 2).Download(obj, ioutil.Discard)
+	c.Assert(err, ErrorMatches, "error downloading bytes 7-13 of .*: range starting at byte 7 of .* not honored.*")
+}
+
+// ------------------------------------------------------------
+// Helper types
+
+// streamingObject counts streams and ranged downloads, optionally failing
+// each stream at a given offset
+type streamingObject struct {
+	Object
+	failAt int64
+
+	mux     sync.Mutex
+	streams int
+	ranges  int
+}
+
+func (obj *streamingObject) Stream(startInclusive int64) (io.ReadCloser, error) {
+	obj.mux.Lock()
+	obj.streams++
+	obj.mux.Unlock()
+	in, err := obj.Object.(Streamer).Stream(startInclusive)
+	if err != nil || obj.failAt <= startInclusive {
+		return in, err
+	}
+	failing := io.MultiReader(io.LimitReader(in, obj.failAt-startInclusive), &errorReader{errors.New("connection reset")})
+	return ioutil.NopCloser(failing), nil
+}
+
+func (obj *streamingObject) DownloadRange(startInclusive, endInclusive int64, buffer []byte) (int64, error) {
+	obj.mux.Lock()
+	obj.ranges++
+	obj.mux.Unlock()
+	return obj.Object.DownloadRange(startInclusive, endInclusive, buffer)
+}
+
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// slowObject delays each ranged download, earlier ranges longest, so that
+// ranges complete out of order; optionally failing at a given offset
+type slowObject struct {
+	Object
+	failAt int64
+
+	mux         sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (obj *slowObject) String() string {
+	return obj.Pretty()
+}
+
+func (obj *slowObject) DownloadRange(startInclusive, endInclusive int64, buffer []byte) (int64, error) {
+	obj.mux.Lock()
+	obj.inFlight++
+	if obj.inFlight > obj.maxInFlight {
+		obj.maxInFlight = obj.inFlight
+	}
+	obj.mux.Unlock()
+	defer func() {
+		obj.mux.Lock()
+		obj.inFlight--
+		obj.mux.Unlock()
+	}()
+
+	time.Sleep(time.Duration(1000-startInclusive) * 10 * time.Microsecond)
+	if obj.failAt > 0 && startInclusive == obj.failAt {
+		return 0, errors.New("injected failure")
+	}
+	return obj.Object.DownloadRange(startInclusive, endInclusive, buffer)
+}
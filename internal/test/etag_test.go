@@ -0,0 +1,174 @@
+package test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"code.cloudfoundry.org/bytefmt"
+	. "gopkg.in/check.v1"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+type ETagSuite struct {
+}
+
+var _ = Suite(&ETagSuite{})
+
+// multipartETag computes a multipart ETag the long way, for comparison
+func multipartETag(data []byte, partSize int) string {
+	var partSums []byte
+	for start := 0; start < len(data); start += partSize {
+		end := start + partSize
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := md5.Sum(data[start:end])
+		partSums = append(partSums, sum[:]...)
+	}
+	return fmt.Sprintf("%x-%d", md5.Sum(partSums), len(partSums)/md5.Size)
+}
+
+func randomBytes(size int) []byte {
+	data := make([]byte, size)
+	random := rand.New(rand.NewSource(pkg.DefaultRandomSeed))
+	_, _ = random.Read(data)
+	return data
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *ETagSuite) TestSinglePart(c *C) {
+	data := []byte("hello\n")
+	etag := NewS3ETag(5 * bytefmt.MEGABYTE)
+	_, err := etag.Write(data)
+	c.Assert(err, IsNil)
+	c.Assert(etag.Parts(), Equals, 1)
+	c.Assert(etag.ETag(), Equals, helloDigests["md5"])
+	c.Assert(etag.MultipartETag(), Equals, multipartETag(data, 5*bytefmt.MEGABYTE))
+}
+
+func (s *ETagSuite) TestMultipart(c *C) {
+	data := randomBytes(1000)
+	for _, writeSize := range []int{1, 7, 100, 1000} {
+		etag := NewS3ETag(300)
+		for start := 0; start < len(data); start += writeSize {
+			end := start + writeSize
+			if end > len(data) {
+				end = len(data)
+			}
+			_, err := etag.Write(data[start:end])
+			c.Assert(err, IsNil)
+		}
+		c.Check(etag.Parts(), Equals, 4, Commentf("write size %d", writeSize))
+		c.Check(etag.ETag(), Equals, multipartETag(data, 300), Commentf("write size %d", writeSize))
+	}
+}
+
+func (s *ETagSuite) TestExactParts(c *C) {
+	data := randomBytes(900)
+	etag := NewS3ETag(300)
+	_, err := etag.Write(data)
+	c.Assert(err, IsNil)
+	c.Assert(etag.Parts(), Equals, 3)
+	c.Assert(etag.ETag(), Equals, multipartETag(data, 300))
+	c.Assert(strings.HasSuffix(etag.ETag(), "-3"), Equals, true)
+}
+
+func (s *ETagSuite) TestVerifySinglePart(c *C) {
+	data := []byte("hello\n")
+	verifier, err := NewETagVerifier("\""+helloDigests["md5"]+"\"", int64(len(data)), 0)
+	c.Assert(err, IsNil)
+	_, err = verifier.Write(data)
+	c.Assert(err, IsNil)
+	actual, partSize, err := verifier.Verify()
+	c.Assert(err, IsNil)
+	c.Assert(actual, Equals, helloDigests["md5"])
+	c.Assert(partSize, Equals, int64(0))
+}
+
+func (s *ETagSuite) TestVerifyOnePartMultipart(c *C) {
+	data := []byte("hello\n")
+	expected := multipartETag(data, 5*bytefmt.MEGABYTE)
+	c.Assert(strings.HasSuffix(expected, "-1"), Equals, true)
+	verifier, err := NewETagVerifier(expected, int64(len(data)), 0)
+	c.Assert(err, IsNil)
+	_, _ = verifier.Write(data)
+	actual, _, err := verifier.Verify()
+	c.Assert(err, IsNil)
+	c.Assert(actual, Equals, expected)
+}
+
+func (s *ETagSuite) TestDetectPartSize(c *C) {
+	data := randomBytes(20 * bytefmt.MEGABYTE)
+	for _, partSize := range []int{5 * bytefmt.MEGABYTE, 8 * bytefmt.MEGABYTE, 7 * bytefmt.MEGABYTE} {
+		expected := multipartETag(data, partSize)
+		verifier, err := NewETagVerifier(expected, int64(len(data)), 0)
+		c.Assert(err, IsNil)
+		_, _ = verifier.Write(data)
+		actual, detected, err := verifier.Verify()
+		c.Assert(err, IsNil, Commentf("part size %d", partSize))
+		c.Check(actual, Equals, expected)
+		c.Check(detected, Equals, int64(partSize))
+	}
+}
+
+func (s *ETagSuite) TestExplicitPartSize(c *C) {
+	data := randomBytes(1000)
+	expected := multipartETag(data, 300)
+	verifier, err := NewETagVerifier(expected, int64(len(data)), 300)
+	c.Assert(err, IsNil)
+	c.Assert(verifier.PartSizes(), DeepEquals, []int64{300})
+	_, _ = verifier.Write(data)
+	_, partSize, err := verifier.Verify()
+	c.Assert(err, IsNil)
+	c.Assert(partSize, Equals, int64(300))
+
+	_, err = NewETagVerifier(expected, int64(len(data)), 500)
+	c.Assert(err, ErrorMatches, "part size 500 is inconsistent with 4 parts.*")
+}
+
+func (s *ETagSuite) TestMismatch(c *C) {
+	data := []byte("hello\n")
+	verifier, err := NewETagVerifier("00000000000000000000000000000000", int64(len(data)), 0)
+	c.Assert(err, IsNil)
+	_, _ = verifier.Write(data)
+	actual, _, err := verifier.Verify()
+	c.Assert(err, ErrorMatches, "(?s)ETag mismatch:.*")
+	c.Assert(actual, Equals, helloDigests["md5"])
+
+	data = randomBytes(1000)
+	verifier, err = NewETagVerifier(multipartETag(data, 300), int64(len(data)), 300)
+	c.Assert(err, IsNil)
+	data[500] ^= 0x01
+	_, _ = verifier.Write(data)
+	_, _, err = verifier.Verify()
+	c.Assert(err, ErrorMatches, "(?s)ETag mismatch:.*part size 300.*")
+}
+
+func (s *ETagSuite) TestNotMD5(c *C) {
+	_, err := NewETagVerifier("\"0x8D6E5AB2F3C4A1B\"", 6, 0)
+	c.Assert(err, ErrorMatches, ".*not an MD5-based S3 ETag")
+}
+
+func (s *ETagSuite) TestCheck(c *C) {
+	target := NewMemoryTarget("etag-suite", DefaultMemoryRules)
+	obj := target.Object("hello.txt")
+	data := []byte("hello\n")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+
+	check := pkg.Check{Object: obj, Algorithms: []string{"sha256"}, ETag: true}
+	result, err := check.Verify()
+	c.Assert(err, IsNil)
+	c.Assert(result.ETag, Equals, helloDigests["md5"])
+	c.Assert(result.Parts, Equals, 0)
+	c.Assert(fmt.Sprintf("%x", result.Digests["sha256"]), Equals, helloDigests["sha256"])
+}
@@ -0,0 +1,181 @@
+package test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+type FaultsSuite struct {
+	bucketCount int
+	data        []byte
+	target      Target
+}
+
+var _ = Suite(&FaultsSuite{})
+
+func (s *FaultsSuite) SetUpTest(c *C) {
+	s.bucketCount++
+	s.target = NewMemoryTarget(fmt.Sprintf("faults-suite-%d", s.bucketCount), DefaultMemoryRules)
+	s.data = randomBytes(1000)
+	c.Assert(s.target.Object("data.bin").Create(bytes.NewReader(s.data), int64(len(s.data))), IsNil)
+}
+
+func (s *FaultsSuite) faultTarget(c *C, spec string) (*FaultTarget, *FaultInjector) {
+	faults, err := ParseFaults(spec)
+	c.Assert(err, IsNil)
+	injector := NewFaultInjector(faults, 1)
+	return NewFaultTarget(s.target, injector), injector
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *FaultsSuite) TestParseFaults(c *C) {
+	faults, err := ParseFaults("get:5%:error, put:latency=200ms,get:0.01:flipbit,*:error=404,get:truncate")
+	c.Assert(err, IsNil)
+	c.Assert(faults, DeepEquals, []Fault{
+		{Op: FaultGet, Probability: 0.05, Kind: FaultError, StatusCode: http.StatusServiceUnavailable},
+		{Op: FaultPut, Probability: 1, Kind: FaultLatency, Latency: 200 * time.Millisecond},
+		{Op: FaultGet, Probability: 0.01, Kind: FaultFlipBit},
+		{Op: FaultAny, Probability: 1, Kind: FaultError, StatusCode: http.StatusNotFound},
+		{Op: FaultGet, Probability: 1, Kind: FaultTruncate},
+	})
+	for _, f := range faults {
+		reparsed, err := ParseFaults(f.String())
+		c.Assert(err, IsNil, Commentf(f.String()))
+		c.Assert(reparsed, DeepEquals, []Fault{f})
+	}
+}
+
+func (s *FaultsSuite) TestParseFaultsInvalid(c *C) {
+	invalid := map[string]string{
+		"":                   "no faults specified.*",
+		"get":                ".*expected OP\\[:PROBABILITY\\]:FAULT",
+		"post:error":         ".*unknown operation \"post\".*",
+		"get:150%:error":     ".*not between 0 and 100%",
+		"get:often:error":    ".*invalid probability \"often\"",
+		"get:explode":        ".*unknown fault \"explode\".*",
+		"get:error=teapot":   ".*invalid HTTP status \"teapot\"",
+		"put:latency":        ".*invalid latency \"\".*",
+		"delete:flipbit":     ".*flipbit applies only to get and put",
+		"get:truncate=half":  ".*truncate takes no value",
+		"get:1%:error:extra": ".*expected OP\\[:PROBABILITY\\]:FAULT",
+	}
+	for spec, msg := range invalid {
+		_, err := ParseFaults(spec)
+		c.Check(err, ErrorMatches, msg, Commentf(spec))
+	}
+}
+
+func (s *FaultsSuite) TestFlipBitDetected(c *C) {
+	target, injector := s.faultTarget(c, "get:flipbit")
+	expected := sha256.Sum256(s.data)
+	check := pkg.Check{
+		Object:      target.Object("data.bin"),
+		Algorithms:  []string{"sha256"},
+		Expected:    map[string][]byte{"sha256": expected[:]},
+		Concurrency: 1,
+	}
+	_, err := check.VerifyDigests()
+	c.Assert(err, ErrorMatches, "(?s)sha256 digest mismatch:.*")
+	c.Assert(injector.Injected()["get:100%:flipbit"] > 0, Equals, true)
+}
+
+func (s *FaultsSuite) TestStreamFaults(c *C) {
+	expected := sha256.Sum256(s.data)
+	for _, spec := range []string{"get:flipbit", "get:truncate"} {
+		target, injector := s.faultTarget(c, spec)
+		check := pkg.Check{
+			Object:     target.Object("data.bin"),
+			Algorithms: []string{"sha256"},
+			Expected:   map[string][]byte{"sha256": expected[:]},
+			Stream:     true,
+		}
+		_, err := check.VerifyDigests()
+		c.Assert(err, NotNil, Commentf(spec))
+		c.Assert(injector.Injected()["get:100%:"+spec[4:]] > 0, Equals, true, Commentf(spec))
+	}
+}
+
+func (s *FaultsSuite) TestCrvdDetectsCorruptUpload(c *C) {
+	target, _ := s.faultTarget(c, "put:flipbit")
+	crvd := pkg.NewCrvd(target, "crvd.bin", 12345, pkg.DefaultRandomSeed)
+	err := crvd.CreateRetrieveVerifyDelete()
+	c.Assert(err, ErrorMatches, "(?s)sha256 digest mismatch:.*")
+	_, err = s.target.Object("crvd.bin").ContentLength()
+	c.Assert(err, NotNil, Commentf("object not deleted"))
+}
+
+func (s *FaultsSuite) TestCrvdChecksumRejectsCorruptUpload(c *C) {
+	target, _ := s.faultTarget(c, "put:flipbit")
+	crvd := pkg.NewCrvd(target, "crvd.bin", 12345, pkg.DefaultRandomSeed)
+	crvd.SendChecksum = true
+	err := crvd.CreateRetrieveVerify()
+	c.Assert(err, ErrorMatches, "MD5 checksum mismatch for mem://.*/crvd.bin: .*")
+	_, err = s.target.Object("crvd.bin").ContentLength()
+	c.Assert(err, NotNil, Commentf("corrupt object created"))
+}
+
+func (s *FaultsSuite) TestCrvdDetectsTruncatedUpload(c *C) {
+	target, _ := s.faultTarget(c, "put:truncate")
+	crvd := pkg.NewCrvd(target, "crvd.bin", 12345, pkg.DefaultRandomSeed)
+	c.Assert(crvd.CreateRetrieveVerify(), NotNil)
+}
+
+func (s *FaultsSuite) TestTruncatedRead(c *C) {
+	target, _ := s.faultTarget(c, "get:truncate")
+	var out bytes.Buffer
+	_, err := NewDownloader(100, 1).Download(target.Object("data.bin"), &out)
+	c.Assert(err, ErrorMatches, "error downloading bytes 0-99 .*: expected to read 100 bytes, got .*")
+}
+
+func (s *FaultsSuite) TestErrorsRetried(c *C) {
+	target, injector := s.faultTarget(c, "delete:error,list:error=404")
+	retrying := NewRetryingTarget(target, &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	err := retrying.Object("data.bin").Delete()
+	c.Assert(err, ErrorMatches, "injected fault: delete failed with status 503 \\(Service Unavailable\\)")
+	c.Assert(injector.Injected()["delete:100%:error=503"], Equals, 3)
+
+	_, err = ListAllObjects(retrying, "", "")
+	c.Assert(err, ErrorMatches, "injected fault: list failed with status 404 \\(Not Found\\)")
+	c.Assert(IsRetryable(err), Equals, false)
+
+	// the object was never actually deleted
+	length, err := s.target.Object("data.bin").ContentLength()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, int64(len(s.data)))
+}
+
+func (s *FaultsSuite) TestLatency(c *C) {
+	target, _ := s.faultTarget(c, "head:latency=20ms")
+	start := time.Now()
+	_, err := target.Object("data.bin").Stat()
+	c.Assert(err, IsNil)
+	c.Assert(time.Since(start) >= 20*time.Millisecond, Equals, true)
+}
+
+func (s *FaultsSuite) TestProbability(c *C) {
+	target, injector := s.faultTarget(c, "get:25%:error,get:0%:flipbit")
+	buffer := make([]byte, 100)
+	var failures int
+	for i := 0; i < 1000; i++ {
+		if _, err := target.Object("data.bin").DownloadRange(0, 99, buffer); err != nil {
+			failures++
+		} else {
+			c.Assert(buffer, DeepEquals, s.data[:100])
+		}
+	}
+	c.Assert(injector.Injected(), DeepEquals, map[string]int{"get:25%:error=503": failures})
+	c.Assert(failures > 200 && failures < 300, Equals, true, Commentf("failures: %d", failures))
+}
@@ -0,0 +1,135 @@
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+type FileTargetSuite struct {
+	dir    string
+	target *FileTarget
+}
+
+var _ = Suite(&FileTargetSuite{})
+
+func (s *FileTargetSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+	target, err := NewFileTarget(s.dir)
+	c.Assert(err, IsNil)
+	s.target = target
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *FileTargetSuite) TestNewTarget(c *C) {
+	bucketURL, err := url.Parse("file://" + s.dir)
+	c.Assert(err, IsNil)
+	target, err := NewTarget(nil, bucketURL, "")
+	c.Assert(err, IsNil)
+	c.Assert(target.(*FileTarget).Dir, Equals, s.dir)
+}
+
+func (s *FileTargetSuite) TestNewTargetNotADirectory(c *C) {
+	path := filepath.Join(s.dir, "file.txt")
+	c.Assert(ioutil.WriteFile(path, []byte("text"), 0644), IsNil)
+	_, err := NewFileTarget(path)
+	c.Assert(err, ErrorMatches, ".*is not a directory")
+}
+
+func (s *FileTargetSuite) TestChecksumNotSupported(c *C) {
+	data := []byte("text")
+	err := s.target.Object("file.txt").Create(bytes.NewReader(data), int64(len(data)), WithChecksums(nil, nil))
+	c.Assert(err, Equals, ErrChecksumNotSupported)
+}
+
+func (s *FileTargetSuite) TestNewObject(c *C) {
+	path := filepath.Join(s.dir, "file.txt")
+	c.Assert(ioutil.WriteFile(path, []byte("text"), 0644), IsNil)
+	objURL, err := url.Parse("file://" + path)
+	c.Assert(err, IsNil)
+	obj, err := NewObject(objURL, nil, "")
+	c.Assert(err, IsNil)
+	length, err := obj.ContentLength()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, int64(4))
+}
+
+func (s *FileTargetSuite) TestCreateDownloadDelete(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+
+	length, err := obj.ContentLength()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, int64(len(data)))
+
+	buffer := make([]byte, 5)
+	n, err := obj.DownloadRange(9, 13, buffer)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(5))
+	c.Assert(string(buffer), Equals, "very ")
+
+	var out bytes.Buffer
+	n, err = Download(obj, 7, &out)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(len(data)))
+	c.Assert(out.Bytes(), DeepEquals, data)
+
+	c.Assert(obj.Delete(), IsNil)
+	_, err = os.Stat(filepath.Join(s.dir, "nested"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+	_, err = os.Stat(s.dir)
+	c.Assert(err, IsNil)
+}
+
+func (s *FileTargetSuite) TestCrvd(c *C) {
+	crvd := pkg.NewCrvd(s.target, "crvd.bin", 12345, pkg.DefaultRandomSeed)
+	c.Assert(crvd.CreateRetrieveVerifyDelete(), IsNil)
+}
+
+func (s *FileTargetSuite) TestStat(c *C) {
+	path := filepath.Join(s.dir, "file.txt")
+	c.Assert(ioutil.WriteFile(path, []byte("text"), 0644), IsNil)
+	modTime := time.Date(2019, time.March, 14, 15, 9, 26, 0, time.UTC)
+	c.Assert(os.Chtimes(path, modTime, modTime), IsNil)
+
+	info, err := s.target.Object("file.txt").Stat()
+	c.Assert(err, IsNil)
+	c.Assert(info.ContentLength, Equals, int64(4))
+	c.Assert(info.ContentType, Matches, "text/plain.*")
+	c.Assert(info.LastModified.Equal(modTime), Equals, true)
+	c.Assert(info.ETag, Equals, "")
+
+	_, err = s.target.Object("missing.txt").Stat()
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *FileTargetSuite) TestPathOutsideDir(c *C) {
+	for _, key := range []string{"..", "../escape", "a/../../escape", "", "."} {
+		_, err := s.target.Path(key)
+		c.Check(err, NotNil, Commentf("expected error for key %#v", key))
+	}
+}
+
+func (s *FileTargetSuite) TestMissingIntermediateDirectory(c *C) {
+	obj := s.target.Object("missing/../file.txt")
+	err := obj.Create(bytes.NewReader([]byte("text")), 4)
+	c.Assert(err, NotNil)
+}
+
+func (s *FileTargetSuite) TestList(c *C) {
+	checkListing(c, s.target, false)
+}
@@ -0,0 +1,248 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/dmolesUC3/cos/internal/fakes"
+	"github.com/dmolesUC3/cos/internal/keys"
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+const gcsTestBucket = "gcs-test-bucket"
+
+type GCSObjectSuite struct {
+	server   *fakes.GCSServer
+	target   *GCSTarget
+	envSaved string
+}
+
+var _ = Suite(&GCSObjectSuite{})
+
+func (s *GCSObjectSuite) SetUpSuite(c *C) {
+	s.envSaved = os.Getenv(GCSCredentialsEnvVar)
+}
+
+func (s *GCSObjectSuite) TearDownSuite(c *C) {
+	_ = os.Setenv(GCSCredentialsEnvVar, s.envSaved)
+}
+
+func (s *GCSObjectSuite) SetUpTest(c *C) {
+	s.server = fakes.NewGCSServer()
+	s.server.CreateBucket(gcsTestBucket)
+
+	keyFile := filepath.Join(c.MkDir(), "service-account.json")
+	c.Assert(ioutil.WriteFile(keyFile, s.server.ServiceAccountKey(), 0600), IsNil)
+	c.Assert(os.Setenv(GCSCredentialsEnvVar, keyFile), IsNil)
+
+	s.target = s.newTarget(c)
+}
+
+func (s *GCSObjectSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *GCSObjectSuite) newTarget(c *C) *GCSTarget {
+	endpointURL, err := url.Parse(s.server.URL())
+	c.Assert(err, IsNil)
+	target, err := NewGCSTarget(endpointURL, gcsTestBucket)
+	c.Assert(err, IsNil)
+	return target
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *GCSObjectSuite) TestCreateDownloadDelete(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model (1).txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+
+	stored, ok := s.server.Object(gcsTestBucket, "nested/path/model (1).txt")
+	c.Assert(ok, Equals, true)
+	c.Assert(stored, DeepEquals, data)
+
+	length, err := obj.ContentLength()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, int64(len(data)))
+
+	buffer := make([]byte, 5)
+	n, err := obj.DownloadRange(9, 13, buffer)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(5))
+	c.Assert(string(buffer), Equals, "very ")
+
+	var out bytes.Buffer
+	n, err = Download(obj, 7, &out)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(len(data)))
+	c.Assert(out.Bytes(), DeepEquals, data)
+
+	c.Assert(obj.Delete(), IsNil)
+	_, ok = s.server.Object(gcsTestBucket, "nested/path/model (1).txt")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *GCSObjectSuite) TestStream(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+	assertStreams(c, obj, data)
+}
+
+func (s *GCSObjectSuite) TestStreamIgnoredRange(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+	s.server.IgnoreOpenRanges = true
+	assertStreamChecksRange(c, obj, data)
+}
+
+func (s *GCSObjectSuite) TestDownloadRangeIgnoredRange(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+	s.server.IgnoreRanges = true
+	assertDownloadRangeChecksRange(c, obj, data)
+}
+
+func (s *GCSObjectSuite) TestNewObject(c *C) {
+	data := []byte("data")
+	c.Assert(s.target.Object("key.bin").Create(bytes.NewReader(data), int64(len(data))), IsNil)
+
+	objURL, err := url.Parse("gs://" + gcsTestBucket + "/key.bin")
+	c.Assert(err, IsNil)
+	endpointURL, err := url.Parse(s.server.URL())
+	c.Assert(err, IsNil)
+	obj, err := NewObject(objURL, endpointURL, "")
+	c.Assert(err, IsNil)
+	length, err := obj.ContentLength()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, int64(len(data)))
+}
+
+func (s *GCSObjectSuite) TestCrvd(c *C) {
+	crvd := pkg.NewCrvd(s.target, "crvd.bin", 1024, pkg.DefaultRandomSeed)
+	c.Assert(crvd.CreateRetrieveVerify(), IsNil)
+	c.Assert(s.server.ChunkCount(gcsTestBucket, "crvd.bin"), Equals, 0)
+
+	info, err := s.target.Object("crvd.bin").Stat()
+	c.Assert(err, IsNil)
+	c.Assert(info.URL, Equals, "gs://"+gcsTestBucket+"/crvd.bin")
+	c.Assert(info.ContentLength, Equals, int64(1024))
+	c.Assert(info.ETag, Not(Equals), "")
+	c.Assert(info.ContentType, Equals, "application/octet-stream")
+	c.Assert(info.LastModified.IsZero(), Equals, false)
+	c.Assert(info.LargeObject, Equals, "")
+}
+
+func (s *GCSObjectSuite) TestResumableUpload(c *C) {
+	s.target.UploadChunkSize = 256 * 1024
+	size := int64(4*256*1024 + 17)
+	crvd := pkg.NewCrvd(s.target, "resumable.bin", size, pkg.DefaultRandomSeed)
+	c.Assert(crvd.CreateRetrieveVerify(), IsNil)
+	c.Assert(s.server.ChunkCount(gcsTestBucket, "resumable.bin"), Equals, 5)
+}
+
+func (s *GCSObjectSuite) TestChunkSize(c *C) {
+	target := &GCSTarget{}
+	c.Assert(target.ChunkSize(), Equals, int64(5*1024*1024))
+	target.UploadChunkSize = 1000
+	c.Assert(target.ChunkSize(), Equals, int64(256*1024))
+}
+
+func (s *GCSObjectSuite) TestNameRules(c *C) {
+	for _, name := range []string{"carriage\rreturn", "line\nfeed", ".well-known/acme-challenge/token", ".."} {
+		c.Assert(ValidateGCSObjectName(name), NotNil, Commentf("expected %#v to be invalid", name))
+		err := s.target.Object(name).Create(bytes.NewReader([]byte("data")), 4)
+		c.Assert(err, NotNil, Commentf("expected %#v to be rejected", name))
+		c.Assert(err.Error(), Matches, ".*GCS object name.*")
+	}
+	c.Assert(ValidateGCSObjectName(".well-known/other"), IsNil)
+}
+
+func (s *GCSObjectSuite) TestGCSKeyList(c *C) {
+	keyList, err := keys.KeyListForName("gcs")
+	c.Assert(err, IsNil)
+	k := pkg.NewKeys(s.target, keyList)
+	failures, err := k.CheckAll(nil, nil, false)
+	c.Assert(err, IsNil)
+
+	var failed []string
+	for _, f := range failures {
+		failed = append(failed, f.Key)
+	}
+	var expected []string
+	for _, key := range keyList.Keys() {
+		if ValidateGCSObjectName(key) != nil {
+			expected = append(expected, key)
+		}
+	}
+	c.Assert(failed, DeepEquals, expected)
+}
+
+func (s *GCSObjectSuite) TestEmulatorWithoutCredentials(c *C) {
+	c.Assert(os.Unsetenv(GCSCredentialsEnvVar), IsNil)
+	s.server.RequireAuth = false
+	target := s.newTarget(c)
+	crvd := pkg.NewCrvd(target, "anonymous.bin", 128, pkg.DefaultRandomSeed)
+	c.Assert(crvd.CreateRetrieveVerify(), IsNil)
+
+	_, err := NewGCSTarget(nil, gcsTestBucket)
+	c.Assert(err, ErrorMatches, ".*"+GCSCredentialsEnvVar+".*")
+}
+
+func (s *GCSObjectSuite) TestList(c *C) {
+	s.server.MaxResults = 2
+	checkListing(c, s.target, true)
+}
+
+func (s *GCSObjectSuite) TestMissingObject(c *C) {
+	_, err := s.target.Object("missing").ContentLength()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*GCSError).StatusCode, Equals, 404)
+}
+
+// TestConcurrentDownloadsWithExpiringToken is intended to be run with -race
+func (s *GCSObjectSuite) TestConcurrentDownloadsWithExpiringToken(c *C) {
+	// tokens expire within a minute, so each request refreshes the token
+	s.server.SetTokenLifetime(time.Minute)
+
+	const rangeSize, ranges = 4096, 16
+	data := randomBytes(rangeSize * ranges)
+	obj := s.target.Object("concurrent.bin")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, ranges)
+	for i := 0; i < ranges; i++ {
+		wg.Add(1)
+		go func(start int64) {
+			defer wg.Done()
+			buffer := make([]byte, rangeSize)
+			n, err := obj.DownloadRange(start, start+rangeSize-1, buffer)
+			if err == nil && !bytes.Equal(buffer[:n], data[start:start+rangeSize]) {
+				err = fmt.Errorf("wrong content for range starting at %d", start)
+			}
+			errs <- err
+		}(int64(i * rangeSize))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		c.Check(err, IsNil)
+	}
+	c.Assert(s.server.TokensIssued() > ranges, Equals, true)
+}
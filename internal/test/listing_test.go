@@ -0,0 +1,98 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+)
+
+// ------------------------------------------------------------
+// Shared listing checks
+
+var listingTestKeys = []string{
+	"dir/sub/d.txt",
+	"a.txt",
+	"dir/c.txt",
+	"dir-e.txt",
+	"dir/b.txt",
+}
+
+type listed struct {
+	Key      string
+	IsPrefix bool
+}
+
+// checkListing creates objects for listingTestKeys in the target and checks
+// listings with and without prefixes and delimiters. Targets backed by fake
+// servers should be configured with a small page size so that continuation
+// tokens or markers are exercised.
+func checkListing(c *C, target Target, expectETags bool) {
+	for _, key := range listingTestKeys {
+		data := []byte(key)
+		c.Assert(target.Object(key).Create(bytes.NewReader(data), int64(len(data))), IsNil)
+	}
+
+	summaries, err := ListAllObjects(target, "", "")
+	c.Assert(err, IsNil)
+	c.Assert(toListed(summaries), DeepEquals, []listed{
+		{"a.txt", false}, {"dir-e.txt", false}, {"dir/b.txt", false}, {"dir/c.txt", false}, {"dir/sub/d.txt", false},
+	})
+	for _, s := range summaries {
+		c.Check(s.Size, Equals, int64(len(s.Key)), Commentf(s.Key))
+		c.Check(s.LastModified.IsZero(), Equals, false, Commentf(s.Key))
+		c.Check(s.ETag != "", Equals, expectETags, Commentf(s.Key))
+		info, err := target.Object(s.Key).Stat()
+		c.Assert(err, IsNil, Commentf(s.Key))
+		c.Check(info.ETag, Equals, s.ETag, Commentf("%v: Stat and List ETags differ", s.Key))
+	}
+
+	summaries, err = ListAllObjects(target, "", "/")
+	c.Assert(err, IsNil)
+	c.Assert(toListed(summaries), DeepEquals, []listed{
+		{"a.txt", false}, {"dir-e.txt", false}, {"dir/", true},
+	})
+
+	summaries, err = ListAllObjects(target, "dir/", "/")
+	c.Assert(err, IsNil)
+	c.Assert(toListed(summaries), DeepEquals, []listed{
+		{"dir/b.txt", false}, {"dir/c.txt", false}, {"dir/sub/", true},
+	})
+
+	summaries, err = ListAllObjects(target, "dir/", "")
+	c.Assert(err, IsNil)
+	c.Assert(toListed(summaries), DeepEquals, []listed{
+		{"dir/b.txt", false}, {"dir/c.txt", false}, {"dir/sub/d.txt", false},
+	})
+
+	summaries, err = ListAllObjects(target, "no-such-prefix/", "/")
+	c.Assert(err, IsNil)
+	c.Assert(summaries, HasLen, 0)
+
+	var keys []string
+	err = target.List("", "", func(s ObjectSummary) error {
+		keys = append(keys, s.Key)
+		if len(keys) == 3 {
+			return StopListing
+		}
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(keys, DeepEquals, []string{"a.txt", "dir-e.txt", "dir/b.txt"})
+
+	expectedErr := errors.New("expected error")
+	err = target.List("", "", func(s ObjectSummary) error {
+		return expectedErr
+	})
+	c.Assert(err, Equals, expectedErr)
+}
+
+func toListed(summaries []ObjectSummary) []listed {
+	result := []listed{}
+	for _, s := range summaries {
+		result = append(result, listed{s.Key, s.IsPrefix})
+	}
+	return result
+}
@@ -0,0 +1,113 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+type LsSuite struct {
+	bucketCount int
+	target      *MemoryTarget
+}
+
+var _ = Suite(&LsSuite{})
+
+func (s *LsSuite) SetUpTest(c *C) {
+	s.bucketCount++
+	s.target = NewMemoryTarget(fmt.Sprintf("ls-suite-%d", s.bucketCount), DefaultMemoryRules)
+	for _, key := range []string{"a.txt", "dir/b.txt", "dir/sub/c.txt", "odd\nkey\x01"} {
+		data := []byte(key)
+		c.Assert(s.target.Object(key).Create(bytes.NewReader(data), int64(len(data))), IsNil)
+	}
+}
+
+func (s *LsSuite) list(c *C, l pkg.Ls) []string {
+	l.Target = s.target
+	var out bytes.Buffer
+	count, err := l.List(&out)
+	c.Assert(err, IsNil)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if l.Quoted {
+		c.Assert(lines, HasLen, count)
+	}
+	return lines
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *LsSuite) TestDelimited(c *C) {
+	lines := s.list(c, pkg.Ls{Delimiter: "/", Quoted: true})
+	c.Assert(lines, DeepEquals, []string{`"a.txt"`, `"dir/"`, `"odd\nkey\x01"`})
+}
+
+func (s *LsSuite) TestRecursiveWithPrefix(c *C) {
+	lines := s.list(c, pkg.Ls{Prefix: "dir/"})
+	c.Assert(lines, DeepEquals, []string{"dir/b.txt", "dir/sub/c.txt"})
+}
+
+func (s *LsSuite) TestLong(c *C) {
+	lines := s.list(c, pkg.Ls{Prefix: "dir/", Delimiter: "/", Long: true, Quoted: true})
+	c.Assert(lines, HasLen, 2)
+
+	fields := strings.Fields(lines[0])
+	c.Assert(fields, HasLen, 5)
+	_, err := time.Parse("2006-01-02 15:04:05", fields[0]+" "+fields[1])
+	c.Assert(err, IsNil)
+	c.Assert(fields[2], Equals, "9")
+	c.Assert(fields[3], Matches, "[0-9a-f]{32}") // in-memory ETags are MD5 hex digests
+	c.Assert(fields[4], Equals, `"dir/b.txt"`)
+
+	c.Assert(strings.Fields(lines[1]), DeepEquals, []string{"PRE", `"dir/sub/"`})
+}
+
+func (s *LsSuite) TestFormatKey(c *C) {
+	c.Assert(pkg.FormatKey("tab\there", false), Equals, `"tab\there"`)
+	c.Assert(pkg.FormatKey("tab\there", true), Equals, "tab\there")
+}
+
+func (s *LsSuite) TestTargetAndPrefix(c *C) {
+	prefixURL, err := url.Parse("mem://" + s.target.Bucket + "/dir/sub/")
+	c.Assert(err, IsNil)
+	target, prefix, err := NewTargetAndPrefix(nil, prefixURL, "")
+	c.Assert(err, IsNil)
+	c.Assert(target.(*MemoryTarget).Bucket, Equals, s.target.Bucket)
+	c.Assert(prefix, Equals, "dir/sub/")
+}
+
+func (s *LsSuite) TestFileTargetAndPrefix(c *C) {
+	dir := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "prefix-1.txt"), []byte("1"), 0644), IsNil)
+
+	for _, tc := range []struct {
+		urlStr    string
+		targetDir string
+		prefix    string
+	}{
+		{"file://" + dir, dir, ""},
+		{"file://" + dir + "/", dir + "/", ""},
+		{"file://" + dir + "/prefix-", dir + "/", "prefix-"},
+	} {
+		prefixURL, err := url.Parse(tc.urlStr)
+		c.Assert(err, IsNil)
+		target, prefix, err := NewTargetAndPrefix(nil, prefixURL, "")
+		c.Assert(err, IsNil)
+		expectedDir, err := filepath.Abs(tc.targetDir)
+		c.Assert(err, IsNil)
+		c.Assert(target.(*FileTarget).Dir, Equals, expectedDir)
+		c.Assert(prefix, Equals, tc.prefix)
+	}
+}
@@ -0,0 +1,241 @@
+package test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+type ManifestSuite struct {
+	bucketCount int
+	target      Target
+}
+
+var _ = Suite(&ManifestSuite{})
+
+func (s *ManifestSuite) SetUpTest(c *C) {
+	s.bucketCount++
+	s.target = NewMemoryTarget(fmt.Sprintf("manifest-suite-%d", s.bucketCount), DefaultMemoryRules)
+}
+
+func (s *ManifestSuite) put(c *C, key string, data string) {
+	c.Assert(s.target.Object(key).Create(strings.NewReader(data), int64(len(data))), IsNil)
+}
+
+func sha256Line(data string, path string) string {
+	return fmt.Sprintf("%x  %v\n", sha256.Sum256([]byte(data)), path)
+}
+
+// assertConcurrentManifestCheck uploads objects to the specified target and
+// checks them with a multi-worker ManifestCheck against a fresh target for
+// the same bucket, whose lazily created clients are then first used
+// concurrently (run with -race to detect unsynchronized initialization)
+func assertConcurrentManifestCheck(c *C, target Target, fresh Target) {
+	var manifest bytes.Buffer
+	for i := 0; i < 8; i++ {
+		data := fmt.Sprintf("object %d\n", i)
+		path := fmt.Sprintf("data/%02d.txt", i)
+		c.Assert(target.Object(path).Create(strings.NewReader(data), int64(len(data))), IsNil)
+		manifest.WriteString(sha256Line(data, path))
+	}
+	m, err := pkg.ReadManifest(&manifest, pkg.ManifestChecksum, "")
+	c.Assert(err, IsNil)
+	summary, err := pkg.ManifestCheck{Target: fresh, Manifest: m, Workers: 4}.Run(func(result pkg.ManifestResult) {})
+	c.Assert(err, IsNil)
+	c.Assert(summary, Equals, pkg.ManifestSummary{Passed: 8})
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *ManifestSuite) TestReadChecksumManifest(c *C) {
+	manifest := fmt.Sprintf(
+		"%x  plain.txt\n%x *binary.bin\n\n%x  ./dotted.txt\n\\%x  back\\\\slash\\nnewline.txt\n%x  two  spaces.txt\r\n",
+		md5.Sum([]byte("a")), md5.Sum([]byte("b")), md5.Sum([]byte("c")), md5.Sum([]byte("d")), md5.Sum([]byte("e")),
+	)
+	m, err := pkg.ReadManifest(strings.NewReader(manifest), pkg.ManifestChecksum, "")
+	c.Assert(err, IsNil)
+	c.Assert(m.Algorithm, Equals, "md5")
+	var paths []string
+	for _, entry := range m.Entries {
+		paths = append(paths, entry.Path)
+	}
+	c.Assert(paths, DeepEquals, []string{"plain.txt", "binary.bin", "dotted.txt", "back\\slash\nnewline.txt", "two  spaces.txt"})
+	c.Assert(m.Entries[2].Line, Equals, 4)
+	sum := md5.Sum([]byte("b"))
+	c.Assert(m.Entries[1].Digest, DeepEquals, sum[:])
+}
+
+func (s *ManifestSuite) TestReadBagItManifest(c *C) {
+	manifest := fmt.Sprintf(
+		"%x data/hello.txt\n%x\t  data/line%%0Abreak%%25.txt\n",
+		sha256.Sum256([]byte("a")), sha256.Sum256([]byte("b")),
+	)
+	m, err := pkg.ReadManifest(strings.NewReader(manifest), pkg.ManifestBagIt, "")
+	c.Assert(err, IsNil)
+	c.Assert(m.Algorithm, Equals, "sha256")
+	c.Assert(m.Entries, HasLen, 2)
+	c.Assert(m.Entries[0].Path, Equals, "data/hello.txt")
+	c.Assert(m.Entries[1].Path, Equals, "data/line\nbreak%.txt")
+}
+
+func (s *ManifestSuite) TestReadManifestErrors(c *C) {
+	_, err := pkg.ReadManifest(strings.NewReader("abcd\n"), pkg.ManifestChecksum, "")
+	c.Assert(err, ErrorMatches, "line 1: expected <DIGEST>  <PATH>.*")
+	_, err = pkg.ReadManifest(strings.NewReader("xyz  file.txt\n"), pkg.ManifestChecksum, "")
+	c.Assert(err, ErrorMatches, "line 1: invalid digest.*")
+	_, err = pkg.ReadManifest(strings.NewReader(helloDigests["md5"]+"  a\n"+helloDigests["sha1"]+"  b\n"), pkg.ManifestChecksum, "")
+	c.Assert(err, ErrorMatches, "line 2: expected 32-digit digest.*")
+	_, err = pkg.ReadManifest(strings.NewReader("abcdef  file.txt\n"), pkg.ManifestChecksum, "")
+	c.Assert(err, ErrorMatches, "unable to infer algorithm from 6-digit digests.*")
+	_, err = pkg.ReadManifest(strings.NewReader("\n\n"), pkg.ManifestChecksum, "")
+	c.Assert(err, ErrorMatches, "no entries found")
+	_, err = pkg.ReadManifest(strings.NewReader(helloDigests["md5"]+"  a\n"), pkg.ManifestChecksum, "sha3")
+	c.Assert(err, ErrorMatches, "unsupported digest algorithm.*")
+}
+
+func (s *ManifestSuite) TestReadManifestChecksDigestLength(c *C) {
+	_, err := pkg.ReadManifest(strings.NewReader(helloDigests["md5"]+"  a\n"), pkg.ManifestChecksum, "sha256")
+	c.Assert(err, ErrorMatches, "line 1: expected 64-digit sha256 digest, got \"[0-9a-f]{32}\"")
+	_, err = pkg.ReadManifest(strings.NewReader(helloDigests["sha256"]+"  a\n"+helloDigests["md5"]+"  b\n"), pkg.ManifestChecksum, "sha256")
+	c.Assert(err, ErrorMatches, "line 2: expected 64-digit sha256 digest.*")
+	_, err = pkg.ReadManifest(strings.NewReader(helloDigests["md5"]+" data/a\n"), pkg.ManifestBagIt, "crc32c")
+	c.Assert(err, ErrorMatches, "line 1: expected 8-digit crc32c digest.*")
+	m, err := pkg.ReadManifest(strings.NewReader(helloDigests["crc32c"]+" data/a\n"), pkg.ManifestBagIt, "crc32c")
+	c.Assert(err, IsNil)
+	c.Assert(m.Algorithm, Equals, "crc32c")
+}
+
+func (s *ManifestSuite) TestReadManifestFile(c *C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "manifest-blake2b.txt")
+	c.Assert(ioutil.WriteFile(path, []byte(helloDigests["blake2b"]+" data/hello.txt\n"), 0644), IsNil)
+	m, err := pkg.ReadManifestFile(path, "")
+	c.Assert(err, IsNil)
+	c.Assert(m.Format, Equals, pkg.ManifestBagIt)
+	c.Assert(m.Algorithm, Equals, "blake2b")
+
+	path = filepath.Join(dir, "checksums.txt")
+	c.Assert(ioutil.WriteFile(path, []byte(helloDigests["sha512"]+"  hello.txt\n"), 0644), IsNil)
+	m, err = pkg.ReadManifestFile(path, "")
+	c.Assert(err, IsNil)
+	c.Assert(m.Format, Equals, pkg.ManifestChecksum)
+	c.Assert(m.Algorithm, Equals, "sha512")
+
+	m, err = pkg.ReadManifestFile(path, "blake2b")
+	c.Assert(err, IsNil)
+	c.Assert(m.Algorithm, Equals, "blake2b")
+}
+
+func (s *ManifestSuite) TestManifestCheck(c *C) {
+	var manifest bytes.Buffer
+	for i := 0; i < 20; i++ {
+		data := fmt.Sprintf("object %d\n", i)
+		path := fmt.Sprintf("data/%02d.txt", i)
+		switch i {
+		case 5:
+			// missing
+		case 7:
+			s.put(c, "bag/"+path, "corrupted")
+		default:
+			s.put(c, "bag/"+path, data)
+		}
+		manifest.WriteString(sha256Line(data, path))
+	}
+	s.put(c, "bag/data/extra.txt", "not in manifest")
+	m, err := pkg.ReadManifest(&manifest, pkg.ManifestChecksum, "")
+	c.Assert(err, IsNil)
+
+	var results []pkg.ManifestResult
+	check := pkg.ManifestCheck{Target: s.target, Prefix: "bag/", Manifest: m, Workers: 3}
+	summary, err := check.Run(func(result pkg.ManifestResult) {
+		results = append(results, result)
+	})
+	c.Assert(err, IsNil)
+	c.Assert(summary, Equals, pkg.ManifestSummary{Passed: 18, Failed: 1, Missing: 1})
+	c.Assert(summary.OK(), Equals, false)
+	c.Assert(summary.String(), Equals, "20 objects: 18 passed, 1 failed, 1 missing, 0 errors")
+
+	c.Assert(results, HasLen, 20)
+	for i, result := range results {
+		c.Check(result.Key, Equals, fmt.Sprintf("bag/data/%02d.txt", i))
+		switch i {
+		case 5:
+			c.Check(result.Status, Equals, pkg.ManifestMissing)
+		case 7:
+			c.Check(result.Status, Equals, pkg.ManifestFail)
+			c.Check(result.Err, ErrorMatches, "(?s)sha256 digest mismatch:.*")
+			sum := sha256.Sum256([]byte("corrupted"))
+			c.Check(result.Actual, DeepEquals, sum[:])
+		default:
+			c.Check(result.Status, Equals, pkg.ManifestPass, Commentf("%v", result))
+		}
+	}
+}
+
+func (s *ManifestSuite) TestManifestCheckPasses(c *C) {
+	s.put(c, "hello.txt", "hello\n")
+	m, err := pkg.ReadManifest(strings.NewReader(helloDigests["md5"]+"  hello.txt\n"), pkg.ManifestChecksum, "")
+	c.Assert(err, IsNil)
+	summary, err := pkg.ManifestCheck{Target: s.target, Manifest: m}.Run(func(result pkg.ManifestResult) {})
+	c.Assert(err, IsNil)
+	c.Assert(summary.OK(), Equals, true)
+	c.Assert(summary.Passed, Equals, 1)
+}
+
+func (s *ManifestSuite) TestManifestCheckUnsupportedAlgorithm(c *C) {
+	m, err := pkg.ReadManifest(strings.NewReader(helloDigests["md5"]+" hello.txt\n"), pkg.ManifestBagIt, "")
+	c.Assert(err, IsNil)
+	m.Algorithm = "sha3"
+	_, err = pkg.ManifestCheck{Target: s.target, Manifest: m}.Run(func(result pkg.ManifestResult) {})
+	c.Assert(err, ErrorMatches, "unsupported digest algorithm.*")
+}
+
+func (s *ManifestSuite) TestManifestCheckDoesNotList(c *C) {
+	s.put(c, "hello.txt", "hello\n")
+	faults, err := ParseFaults("list:error=500")
+	c.Assert(err, IsNil)
+	target := NewFaultTarget(s.target, NewFaultInjector(faults, 1))
+	manifest := helloDigests["md5"] + "  hello.txt\n" + helloDigests["md5"] + "  missing.txt\n"
+	m, err := pkg.ReadManifest(strings.NewReader(manifest), pkg.ManifestChecksum, "")
+	c.Assert(err, IsNil)
+
+	var results []pkg.ManifestResult
+	summary, err := pkg.ManifestCheck{Target: target, Manifest: m}.Run(func(result pkg.ManifestResult) {
+		results = append(results, result)
+	})
+	c.Assert(err, IsNil)
+	c.Assert(summary, Equals, pkg.ManifestSummary{Passed: 1, Missing: 1})
+	c.Assert(results[1].Status, Equals, pkg.ManifestMissing)
+	c.Assert(results[1].Err, IsNil)
+}
+
+func (s *ManifestSuite) TestManifestCheckReportsLookupErrors(c *C) {
+	s.put(c, "hello.txt", "hello\n")
+	faults, err := ParseFaults("head:error=403")
+	c.Assert(err, IsNil)
+	target := NewFaultTarget(s.target, NewFaultInjector(faults, 1))
+	m, err := pkg.ReadManifest(strings.NewReader(helloDigests["md5"]+"  hello.txt\n"), pkg.ManifestChecksum, "")
+	c.Assert(err, IsNil)
+
+	var results []pkg.ManifestResult
+	summary, err := pkg.ManifestCheck{Target: target, Manifest: m}.Run(func(result pkg.ManifestResult) {
+		results = append(results, result)
+	})
+	c.Assert(err, IsNil)
+	c.Assert(summary, Equals, pkg.ManifestSummary{Errors: 1})
+	c.Assert(results[0].Status, Equals, pkg.ManifestError)
+	c.Assert(results[0].Err, NotNil)
+}
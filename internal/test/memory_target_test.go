@@ -0,0 +1,145 @@
+package test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"sort"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/dmolesUC3/cos/internal/keys"
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+type MemoryTargetSuite struct {
+	bucketCount int
+}
+
+var _ = Suite(&MemoryTargetSuite{})
+
+func (s *MemoryTargetSuite) newTarget(rules MemoryRules) *MemoryTarget {
+	s.bucketCount++
+	return NewMemoryTarget(fmt.Sprintf("memory-target-suite-%d", s.bucketCount), rules)
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *MemoryTargetSuite) TestNewTargetFromURL(c *C) {
+	bucketURL, err := url.Parse("mem://bucket?max-key-bytes=16&forbidden-runes=%5C%25&max-object-size=1K&max-objects-per-prefix=3")
+	c.Assert(err, IsNil)
+	target, err := NewTarget(nil, bucketURL, "")
+	c.Assert(err, IsNil)
+	memTarget := target.(*MemoryTarget)
+	c.Assert(memTarget.Bucket, Equals, "bucket")
+	c.Assert(memTarget.Rules, DeepEquals, MemoryRules{
+		MaxKeyBytes:         16,
+		ForbiddenRunes:      "\\%",
+		MaxObjectSize:       1024,
+		MaxObjectsPerPrefix: 3,
+	})
+}
+
+func (s *MemoryTargetSuite) TestSharedStore(c *C) {
+	target := s.newTarget(MemoryRules{})
+	data := []byte("shared")
+	c.Assert(target.Object("key").Create(bytes.NewReader(data), int64(len(data))), IsNil)
+
+	objURL, err := url.Parse(fmt.Sprintf("mem://%v/key", target.Bucket))
+	c.Assert(err, IsNil)
+	obj, err := NewObject(objURL, nil, "")
+	c.Assert(err, IsNil)
+	length, err := obj.ContentLength()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, int64(len(data)))
+}
+
+func (s *MemoryTargetSuite) TestCrvd(c *C) {
+	target := s.newTarget(MemoryRules{})
+	crvd := pkg.NewCrvd(target, "", 12345, pkg.DefaultRandomSeed)
+	c.Assert(crvd.CreateRetrieveVerifyDelete(), IsNil)
+	c.Assert(target.Keys(), HasLen, 0)
+}
+
+func (s *MemoryTargetSuite) TestChecksums(c *C) {
+	target := s.newTarget(MemoryRules{})
+	crvd := pkg.NewCrvd(target, "checksum.bin", 12345, pkg.DefaultRandomSeed)
+	crvd.SendChecksum = true
+	c.Assert(crvd.CreateRetrieveVerifyDelete(), IsNil)
+
+	err := target.Object("wrong.bin").Create(crvd.NewBody(), crvd.ContentLength, WithWrongChecksums())
+	c.Assert(err, ErrorMatches, "MD5 checksum mismatch for mem://.*/wrong.bin: .*")
+
+	md5Digest, sha256Digest := md5.Sum(nil), sha256.Sum256([]byte("not empty"))
+	err = target.Object("empty.bin").Create(bytes.NewReader(nil), 0, WithChecksums(md5Digest[:], sha256Digest[:]))
+	c.Assert(err, ErrorMatches, "SHA-256 checksum mismatch for mem://.*/empty.bin: .*")
+	c.Assert(target.Keys(), HasLen, 0)
+}
+
+func (s *MemoryTargetSuite) TestMissingObject(c *C) {
+	target := s.newTarget(MemoryRules{})
+	_, err := target.Object("missing").ContentLength()
+	c.Assert(err, ErrorMatches, "no such object.*")
+	c.Assert(target.Object("missing").Delete(), ErrorMatches, "no such object.*")
+}
+
+func (s *MemoryTargetSuite) TestMaxKeyBytes(c *C) {
+	target := s.newTarget(MemoryRules{MaxKeyBytes: 4})
+	c.Assert(pkg.NewDefaultCrvd(target, "abcd").CreateRetrieveVerifyDelete(), IsNil)
+	err := pkg.NewDefaultCrvd(target, "abcde").CreateRetrieveVerifyDelete()
+	c.Assert(err, ErrorMatches, ".*exceeds maximum of 4 bytes")
+}
+
+func (s *MemoryTargetSuite) TestMaxObjectSize(c *C) {
+	target := s.newTarget(MemoryRules{MaxObjectSize: 100})
+	c.Assert(pkg.NewCrvd(target, "", 100, pkg.DefaultRandomSeed).CreateRetrieveVerifyDelete(), IsNil)
+	err := pkg.NewCrvd(target, "", 101, pkg.DefaultRandomSeed).CreateRetrieveVerifyDelete()
+	c.Assert(err, ErrorMatches, "object size 101 exceeds maximum of 100 bytes")
+}
+
+func (s *MemoryTargetSuite) TestMaxObjectsPerPrefix(c *C) {
+	target := s.newTarget(MemoryRules{MaxObjectsPerPrefix: 2})
+	for i := 0; i < 2; i++ {
+		c.Assert(pkg.NewDefaultCrvd(target, fmt.Sprintf("prefix/%d", i)).CreateRetrieveVerify(), IsNil)
+	}
+	err := pkg.NewDefaultCrvd(target, "prefix/2").CreateRetrieveVerify()
+	c.Assert(err, ErrorMatches, "prefix \"prefix/\" already contains maximum of 2 objects")
+
+	// overwriting an existing object, or writing to another prefix, is OK
+	c.Assert(pkg.NewDefaultCrvd(target, "prefix/1").CreateRetrieveVerify(), IsNil)
+	c.Assert(pkg.NewDefaultCrvd(target, "other/2").CreateRetrieveVerify(), IsNil)
+}
+
+func (s *MemoryTargetSuite) TestKeysWithForbiddenRunes(c *C) {
+	target := s.newTarget(MemoryRules{ForbiddenRunes: "\\\x00"})
+	keyList := keys.NewKeyList("test", "test keys", []string{
+		"ok",
+		"back\\slash",
+		"also-ok",
+		"nul\x00",
+	})
+	var okOut, badOut bytes.Buffer
+	k := pkg.NewKeys(target, keyList)
+	failures, err := k.CheckAll(&okOut, &badOut, true)
+	c.Assert(err, IsNil)
+
+	var failedKeys []string
+	for _, f := range failures {
+		failedKeys = append(failedKeys, f.Key)
+	}
+	sort.Strings(failedKeys)
+	c.Assert(failedKeys, DeepEquals, []string{"back\\slash", "nul\x00"})
+	c.Assert(okOut.String(), Equals, "ok\nalso-ok\n")
+	c.Assert(badOut.String(), Equals, "back\\slash\nnul\x00\n")
+}
+
+func (s *MemoryTargetSuite) TestList(c *C) {
+	checkListing(c, s.newTarget(DefaultMemoryRules), true)
+}
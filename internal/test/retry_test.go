@@ -0,0 +1,299 @@
+package test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/ncw/swift"
+	. "gopkg.in/check.v1"
+
+	"github.com/dmolesUC3/cos/internal/fakes"
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+type RetrySuite struct {
+	bucketCount int
+	data        []byte
+	target      Target
+	policy      *RetryPolicy
+}
+
+var _ = Suite(&RetrySuite{})
+
+func (s *RetrySuite) SetUpTest(c *C) {
+	s.bucketCount++
+	s.target = NewMemoryTarget(fmt.Sprintf("retry-suite-%d", s.bucketCount), DefaultMemoryRules)
+	s.data = randomBytes(1000)
+	c.Assert(s.target.Object("data.bin").Create(bytes.NewReader(s.data), int64(len(s.data))), IsNil)
+	s.policy = &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 4 * time.Millisecond}
+}
+
+// flakyObject fails the first failures calls to each operation with err
+type flakyObject struct {
+	Object
+	err      error
+	failures int
+
+	mutex sync.Mutex
+	calls map[string]int
+}
+
+func (obj *flakyObject) String() string {
+	return obj.Pretty()
+}
+
+func (obj *flakyObject) fail(op string) error {
+	obj.mutex.Lock()
+	defer obj.mutex.Unlock()
+	if obj.calls == nil {
+		obj.calls = map[string]int{}
+	}
+	obj.calls[op]++
+	if obj.calls[op] <= obj.failures {
+		return obj.err
+	}
+	return nil
+}
+
+func (obj *flakyObject) DownloadRange(startInclusive, endInclusive int64, buffer []byte) (int64, error) {
+	if err := obj.fail("DownloadRange"); err != nil {
+		return 0, err
+	}
+	return obj.Object.DownloadRange(startInclusive, endInclusive, buffer)
+}
+
+func (obj *flakyObject) Create(body io.Reader, length int64, options ...CreateOption) error {
+	// consume the body before failing, as a real upload would
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if err := obj.fail("Create"); err != nil {
+		return err
+	}
+	return obj.Object.Create(bytes.NewReader(data), int64(len(data)), options...)
+}
+
+func (obj *flakyObject) Delete() error {
+	if err := obj.fail("Delete"); err != nil {
+		return err
+	}
+	return obj.Object.Delete()
+}
+
+// timeoutError is a net.Error reporting a timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *RetrySuite) TestDownloadRetried(c *C) {
+	flaky := &flakyObject{Object: s.target.Object("data.bin"), err: io.ErrUnexpectedEOF, failures: 2}
+	obj := NewRetryingObject(flaky, s.policy)
+	digest, err := NewDownloader(100, 4).CalcDigest(obj, "sha256")
+	c.Assert(err, IsNil)
+	expected := sha256.Sum256(s.data)
+	c.Assert(digest, DeepEquals, expected[:])
+	c.Assert(flaky.calls["DownloadRange"], Equals, 10+2)
+}
+
+func (s *RetrySuite) TestAttemptsExhausted(c *C) {
+	flaky := &flakyObject{Object: s.target.Object("data.bin"), err: timeoutError{}, failures: 3}
+	obj := NewRetryingObject(flaky, s.policy)
+	_, err := obj.DownloadRange(0, 99, make([]byte, 100))
+	c.Assert(err, Equals, timeoutError{})
+	c.Assert(flaky.calls["DownloadRange"], Equals, 3)
+}
+
+func (s *RetrySuite) TestNotRetryable(c *C) {
+	notFound := &swift.Error{StatusCode: http.StatusNotFound, Text: "Object Not Found"}
+	flaky := &flakyObject{Object: s.target.Object("data.bin"), err: notFound, failures: 1}
+	err := NewRetryingObject(flaky, s.policy).Delete()
+	c.Assert(err, Equals, notFound)
+	c.Assert(flaky.calls["Delete"], Equals, 1)
+}
+
+func (s *RetrySuite) TestShortRead(c *C) {
+	obj := NewRetryingObject(&truncatingObject{Object: s.target.Object("data.bin"), remaining: 1}, s.policy)
+	buffer := make([]byte, 100)
+	n, err := obj.DownloadRange(0, 99, buffer)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(100))
+	c.Assert(buffer, DeepEquals, s.data[:100])
+}
+
+func (s *RetrySuite) TestCreateRewinds(c *C) {
+	flaky := &flakyObject{Object: s.target.Object("new.bin"), err: awserr.New("SlowDown", "Please reduce your request rate.", nil), failures: 2}
+	obj := NewRetryingObject(flaky, s.policy)
+	c.Assert(obj.Create(bytes.NewReader(s.data), int64(len(s.data))), IsNil)
+	c.Assert(flaky.calls["Create"], Equals, 3)
+
+	var out bytes.Buffer
+	_, err := NewDownloader(100, 1).Download(s.target.Object("new.bin"), &out)
+	c.Assert(err, IsNil)
+	c.Assert(out.Bytes(), DeepEquals, s.data)
+}
+
+func (s *RetrySuite) TestCreateNotSeekable(c *C) {
+	flaky := &flakyObject{Object: s.target.Object("new.bin"), err: io.ErrUnexpectedEOF, failures: 1}
+	obj := NewRetryingObject(flaky, s.policy)
+	err := obj.Create(ioutil.NopCloser(bytes.NewReader(s.data)), int64(len(s.data)))
+	c.Assert(err, Equals, io.ErrUnexpectedEOF)
+	c.Assert(flaky.calls["Create"], Equals, 1)
+}
+
+func (s *RetrySuite) TestCrvdCreateRetried(c *C) {
+	flaky := &flakyObject{Object: s.target.Object("crvd.bin"), err: io.ErrUnexpectedEOF, failures: 2}
+	crvd := pkg.NewCrvd(s.target, "crvd.bin", 100000, 1)
+	crvd.Object = NewRetryingObject(flaky, s.policy)
+	c.Assert(crvd.CreateRetrieveVerify(), IsNil)
+	c.Assert(flaky.calls["Create"], Equals, 3)
+
+	flaky = &flakyObject{Object: s.target.Object("text.bin"), err: io.ErrUnexpectedEOF, failures: 1}
+	crvd = pkg.NewCrvd(s.target, "text.bin", 100000, 1)
+	crvd.Content = &pkg.TextContent{Seed: 1}
+	crvd.Object = NewRetryingObject(flaky, s.policy)
+	c.Assert(crvd.CreateRetrieveVerify(), Equals, io.ErrUnexpectedEOF)
+	c.Assert(flaky.calls["Create"], Equals, 1)
+}
+
+func (s *RetrySuite) TestSwiftClientRetriesReduced(c *C) {
+	authURL, err := url.Parse("http://127.0.0.1:8080/auth/v1.0")
+	c.Assert(err, IsNil)
+
+	target := &SwiftTarget{AuthURL: authURL, Container: "container"}
+	cnx, err := target.Connection()
+	c.Assert(err, IsNil)
+	c.Assert(cnx.Retries, Equals, 3)
+	NewRetryingTarget(NewFaultTarget(target, nil), s.policy)
+	c.Assert(cnx.Retries, Equals, 1)
+
+	target = &SwiftTarget{AuthURL: authURL, Container: "container"}
+	NewRetryingTarget(target, s.policy)
+	cnx, err = target.Connection()
+	c.Assert(err, IsNil)
+	c.Assert(cnx.Retries, Equals, 1)
+}
+
+func (s *RetrySuite) TestRetryingObjectLimitsSwiftRequests(c *C) {
+	server := fakes.NewSwiftServer(swiftTestUser, swiftTestKey)
+	defer server.Close()
+	server.CreateContainer(swiftTestContainer)
+	server.MalformedResponses = true
+	authURL, err := url.Parse(server.AuthURL())
+	c.Assert(err, IsNil)
+	target := &SwiftTarget{UserName: swiftTestUser, APIKey: swiftTestKey, AuthURL: authURL, Container: swiftTestContainer}
+
+	policy := *s.policy
+	policy.Retryable = func(err error) bool { return true }
+	obj := NewRetryingObject(target.Object("data.bin"), &policy)
+	_, err = obj.ContentLength()
+	c.Assert(err, NotNil)
+	// each attempt is a request and the one client retry it cannot disable,
+	// rather than a request and the client's default 3 retries
+	c.Assert(server.ObjectRequests, Equals, policy.MaxAttempts*2)
+}
+
+func (s *RetrySuite) TestRetryingTarget(c *C) {
+	target := NewRetryingTarget(s.target, s.policy)
+	obj := target.Object("data.bin")
+	c.Assert(obj, FitsTypeOf, &RetryingObject{})
+	c.Assert(obj.GetEndpoint(), Equals, target)
+	length, err := obj.ContentLength()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, int64(len(s.data)))
+
+	keys, err := ListAllObjects(target, "", "")
+	c.Assert(err, IsNil)
+	c.Assert(keys, HasLen, 1)
+}
+
+func (s *RetrySuite) TestDelay(c *C) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	expected := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, ms := range expected {
+		c.Check(policy.Delay(i+1), Equals, ms*time.Millisecond, Commentf("retry %d", i+1))
+	}
+
+	policy.Jitter = 0.5
+	for retry := 1; retry <= 6; retry++ {
+		for i := 0; i < 100; i++ {
+			delay := policy.Delay(retry)
+			max := expected[retry-1] * time.Millisecond
+			c.Assert(delay >= max/2 && delay <= max, Equals, true, Commentf("retry %d: %v", retry, delay))
+		}
+	}
+}
+
+func (s *RetrySuite) TestIsRetryable(c *C) {
+	retryable := []error{
+		io.ErrUnexpectedEOF,
+		timeoutError{},
+		&net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}},
+		&ShortReadError{Expected: 100, Actual: 99},
+		swift.TimeoutError,
+		&swift.Error{StatusCode: http.StatusServiceUnavailable, Text: "Service Unavailable"},
+		awserr.New("SlowDown", "Please reduce your request rate.", nil),
+		awserr.New("RequestError", "send request failed", timeoutError{}),
+		awserr.NewRequestFailure(awserr.New("InternalError", "We encountered an internal error.", nil), http.StatusInternalServerError, "req"),
+		&AzureError{StatusCode: http.StatusServiceUnavailable, Code: "ServerBusy"},
+		&GCSError{StatusCode: http.StatusTooManyRequests, Message: "rate limit exceeded"},
+		fmt.Errorf("error downloading: %w", io.ErrUnexpectedEOF),
+	}
+	for _, err := range retryable {
+		c.Check(IsRetryable(err), Equals, true, Commentf("%#v", err))
+	}
+
+	notRetryable := []error{
+		nil,
+		io.EOF,
+		errors.New("injected failure"),
+		&swift.Error{StatusCode: http.StatusNotFound, Text: "Object Not Found"},
+		awserr.New("NoSuchKey", "The specified key does not exist.", nil),
+		awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "req"),
+		&AzureError{StatusCode: http.StatusNotFound, Code: "BlobNotFound"},
+		&GCSError{StatusCode: http.StatusBadRequest, Message: "bad request"},
+	}
+	for _, err := range notRetryable {
+		c.Check(IsRetryable(err), Equals, false, Commentf("%#v", err))
+	}
+}
+
+// ------------------------------------------------------------
+// Helpers
+
+// truncatingObject returns one byte fewer than requested for the first
+// remaining calls to DownloadRange
+type truncatingObject struct {
+	Object
+	remaining int
+}
+
+func (obj *truncatingObject) DownloadRange(startInclusive, endInclusive int64, buffer []byte) (int64, error) {
+	n, err := obj.Object.DownloadRange(startInclusive, endInclusive, buffer)
+	if err == nil && obj.remaining > 0 && n > 0 {
+		obj.remaining--
+		return n - 1, nil
+	}
+	return n, err
+}
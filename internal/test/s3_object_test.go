@@ -0,0 +1,383 @@
+package test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/bytefmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	. "gopkg.in/check.v1"
+
+	"github.com/dmolesUC3/cos/internal/fakes"
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+const s3TestBucket = "s3-test-bucket"
+
+type S3ObjectSuite struct {
+	server   *fakes.S3Server
+	target   *S3Target
+	envSaved map[string]string
+}
+
+var _ = Suite(&S3ObjectSuite{})
+
+func (s *S3ObjectSuite) SetUpSuite(c *C) {
+	s.envSaved = map[string]string{}
+	for k, v := range map[string]string{
+		"AWS_ACCESS_KEY_ID":     "test-access-key",
+		"AWS_SECRET_ACCESS_KEY": "test-secret-key",
+	} {
+		s.envSaved[k] = os.Getenv(k)
+		c.Assert(os.Setenv(k, v), IsNil)
+	}
+}
+
+func (s *S3ObjectSuite) TearDownSuite(c *C) {
+	for k, v := range s.envSaved {
+		_ = os.Setenv(k, v)
+	}
+}
+
+func (s *S3ObjectSuite) SetUpTest(c *C) {
+	s.server = fakes.NewS3Server()
+	s.server.CreateBucket(s3TestBucket)
+	endpointURL, err := url.Parse(s.server.URL())
+	c.Assert(err, IsNil)
+	s.target = NewS3Target("", endpointURL, s3TestBucket)
+}
+
+func (s *S3ObjectSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *S3ObjectSuite) TestCreateDownloadDelete(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+
+	stored, ok := s.server.Object(s3TestBucket, "nested/path/model.txt")
+	c.Assert(ok, Equals, true)
+	c.Assert(stored, DeepEquals, data)
+
+	length, err := obj.ContentLength()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, int64(len(data)))
+
+	buffer := make([]byte, 5)
+	n, err := obj.DownloadRange(9, 13, buffer)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(5))
+	c.Assert(string(buffer), Equals, "very ")
+
+	var out bytes.Buffer
+	n, err = Download(obj, 7, &out)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(len(data)))
+	c.Assert(out.Bytes(), DeepEquals, data)
+
+	c.Assert(obj.Delete(), IsNil)
+	_, ok = s.server.Object(s3TestBucket, "nested/path/model.txt")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *S3ObjectSuite) TestStream(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+	assertStreams(c, obj, data)
+}
+
+func (s *S3ObjectSuite) TestStreamIgnoredRange(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+	s.server.IgnoreOpenRanges = true
+	assertStreamChecksRange(c, obj, data)
+}
+
+func (s *S3ObjectSuite) TestDownloadRangeIgnoredRange(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+	s.server.IgnoreRanges = true
+	assertDownloadRangeChecksRange(c, obj, data)
+}
+
+func (s *S3ObjectSuite) TestNewObject(c *C) {
+	data := []byte("data")
+	c.Assert(s.target.Object("key.bin").Create(bytes.NewReader(data), int64(len(data))), IsNil)
+
+	objURL, err := url.Parse("s3://" + s3TestBucket + "/key.bin")
+	c.Assert(err, IsNil)
+	endpointURL, err := url.Parse(s.server.URL())
+	c.Assert(err, IsNil)
+	obj, err := NewObject(objURL, endpointURL, "")
+	c.Assert(err, IsNil)
+	length, err := obj.ContentLength()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, int64(len(data)))
+}
+
+func (s *S3ObjectSuite) TestMultipartCrvd(c *C) {
+	size := int64(12 * bytefmt.MEGABYTE) // 3 parts at the default part size of 5 MiB
+	crvd := pkg.NewCrvd(s.target, "multipart.bin", size, pkg.DefaultRandomSeed)
+	c.Assert(crvd.CreateRetrieveVerify(), IsNil)
+
+	etag, ok := s.server.ETag(s3TestBucket, "multipart.bin")
+	c.Assert(ok, Equals, true)
+	c.Assert(strings.HasSuffix(etag, "-3\""), Equals, true, Commentf("expected 3-part ETag, got %v", etag))
+
+	info, err := s.target.Object("multipart.bin").Stat()
+	c.Assert(err, IsNil)
+	c.Assert(info.ContentLength, Equals, size)
+	c.Assert(info.ETag, Equals, strings.Trim(etag, "\""))
+	c.Assert(info.LargeObject, Equals, LargeObjectMultipart)
+	c.Assert(info.Parts, Equals, 3)
+}
+
+func (s *S3ObjectSuite) TestCheckMultipartETag(c *C) {
+	data := randomBytes(12 * bytefmt.MEGABYTE)
+	obj := s.target.Object("multipart.bin")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+
+	result, err := pkg.Check{Object: obj, Algorithms: []string{"md5"}, ETag: true}.Verify()
+	c.Assert(err, IsNil)
+	etag, _ := s.server.ETag(s3TestBucket, "multipart.bin")
+	c.Assert("\""+result.ETag+"\"", Equals, etag)
+	c.Assert(result.Parts, Equals, 3)
+	c.Assert(result.PartSize, Equals, int64(5*bytefmt.MEGABYTE))
+
+	result, err = pkg.Check{Object: obj, Algorithms: []string{"md5"}, ETag: true, PartSize: 9 * bytefmt.MEGABYTE / 2}.Verify()
+	c.Assert(err, ErrorMatches, "(?s)ETag mismatch:.*")
+	c.Assert(result.Parts, Equals, 3)
+
+	_, err = pkg.Check{Object: obj, Algorithms: []string{"md5"}, ETag: true, PartSize: 8 * bytefmt.MEGABYTE}.Verify()
+	c.Assert(err, ErrorMatches, "part size .* is inconsistent with 3 parts.*")
+}
+
+func (s *S3ObjectSuite) TestSinglePartCrvd(c *C) {
+	crvd := pkg.NewCrvd(s.target, "single.bin", 1024, pkg.DefaultRandomSeed)
+	c.Assert(crvd.CreateRetrieveVerify(), IsNil)
+
+	etag, ok := s.server.ETag(s3TestBucket, "single.bin")
+	c.Assert(ok, Equals, true)
+	c.Assert(strings.Contains(etag, "-"), Equals, false, Commentf("expected single-part ETag, got %v", etag))
+}
+
+func (s *S3ObjectSuite) TestUploadMethods(c *C) {
+	small, large := int64(1024), int64(12*bytefmt.MEGABYTE)
+	cases := []struct {
+		method   string
+		partSize int64
+		size     int64
+		expected UploadInfo
+	}{
+		{UploadAuto, 0, small, UploadInfo{Method: UploadSingle, Parts: 1}},
+		{UploadAuto, 0, large, UploadInfo{Method: UploadMultipart, Parts: 3, PartSize: int64(5 * bytefmt.MEGABYTE)}},
+		{UploadSingle, 0, large, UploadInfo{Method: UploadSingle, Parts: 1}},
+		{UploadMultipart, 0, small, UploadInfo{Method: UploadMultipart, Parts: 1, PartSize: small}},
+		{UploadMultipart, int64(6 * bytefmt.MEGABYTE), large, UploadInfo{Method: UploadMultipart, Parts: 2, PartSize: int64(6 * bytefmt.MEGABYTE)}},
+	}
+	for i, tc := range cases {
+		s.target.UploadMethod = tc.method
+		s.target.PartSize = tc.partSize
+		s.target.UploadConcurrency = 1
+		key := fmt.Sprintf("upload-%d.bin", i)
+		crvd := pkg.NewCrvd(NewRetryingTarget(s.target, NewRetryPolicy()), key, tc.size, pkg.DefaultRandomSeed)
+		c.Assert(crvd.CreateRetrieveVerify(), IsNil, Commentf("%d: %v", i, tc.method))
+		c.Assert(crvd.Upload, DeepEquals, &tc.expected, Commentf("%d: %v", i, tc.method))
+
+		etag, ok := s.server.ETag(s3TestBucket, key)
+		c.Assert(ok, Equals, true)
+		if tc.expected.Method == UploadSingle {
+			c.Assert(strings.Contains(etag, "-"), Equals, false, Commentf("%d: %v", i, etag))
+		} else {
+			c.Assert(strings.HasSuffix(etag, fmt.Sprintf("-%d\"", tc.expected.Parts)), Equals, true, Commentf("%d: %v", i, etag))
+		}
+	}
+	c.Assert((&UploadInfo{Method: UploadMultipart, Parts: 2, PartSize: int64(6 * bytefmt.MEGABYTE)}).String(), Equals, "multipart upload (2 parts of 6M)")
+}
+
+func (s *S3ObjectSuite) TestUploadPartSizeTooSmall(c *C) {
+	s.target.PartSize = int64(5 * bytefmt.MEGABYTE)
+	err := s.target.Object("huge.bin").Create(bytes.NewReader(nil), int64(100*bytefmt.GIGABYTE))
+	c.Assert(err, ErrorMatches, "part size 5M is too small for 100G: 20480 parts needed, maximum is 10000")
+
+	s.target.UploadMethod = "chunked"
+	err = s.target.Object("small.bin").Create(bytes.NewReader([]byte("data")), 4)
+	c.Assert(err, ErrorMatches, "unknown upload method \"chunked\".*")
+}
+
+func (s *S3ObjectSuite) TestSingleUploadStreamsBody(c *C) {
+	data := randomBytes(int(6 * bytefmt.MEGABYTE))
+	s.target.UploadMethod = UploadSingle
+	obj := s.target.Object("streamed.bin")
+	c.Assert(obj.Create(ioutil.NopCloser(bytes.NewReader(data)), int64(len(data))), IsNil)
+	c.Assert(LastUpload(obj), DeepEquals, &UploadInfo{Method: UploadSingle, Parts: 1})
+	stored, ok := s.server.Object(s3TestBucket, "streamed.bin")
+	c.Assert(ok, Equals, true)
+	c.Assert(bytes.Equal(stored, data), Equals, true)
+}
+
+func (s *S3ObjectSuite) TestOnePartUploadStreamsBody(c *C) {
+	data := randomBytes(int(6 * bytefmt.MEGABYTE))
+	md5Digest := md5.Sum(data)
+	s.target.UploadMethod = UploadMultipart
+	s.target.PartSize = int64(8 * bytefmt.MEGABYTE)
+	obj := s.target.Object("streamed-part.bin")
+	c.Assert(obj.Create(ioutil.NopCloser(bytes.NewReader(data)), int64(len(data)), WithChecksums(md5Digest[:], nil)), IsNil)
+	c.Assert(LastUpload(obj), DeepEquals, &UploadInfo{Method: UploadMultipart, Parts: 1, PartSize: int64(len(data))})
+	stored, ok := s.server.Object(s3TestBucket, "streamed-part.bin")
+	c.Assert(ok, Equals, true)
+	c.Assert(bytes.Equal(stored, data), Equals, true)
+}
+
+func (s *S3ObjectSuite) TestUnseekableChecksumsNotProvided(c *C) {
+	for _, method := range []string{UploadSingle, UploadMultipart} {
+		s.target.UploadMethod = method
+		err := s.target.Object("unseekable.bin").Create(&errorReader{errors.New("body should not be read")}, 1024, WithChecksums(nil, nil))
+		c.Assert(err, ErrorMatches, "unable to send checksums? for .*: .*not provided, and body is not seekable", Commentf(method))
+	}
+}
+
+func (s *S3ObjectSuite) TestSingleUploadTooLarge(c *C) {
+	s.target.UploadMethod = UploadSingle
+	err := s.target.Object("huge.bin").Create(&errorReader{errors.New("body should not be read")}, MaxSingleUploadSize+1)
+	c.Assert(err, ErrorMatches, "5G is too large for a single upload request \\(maximum 5G\\); use multipart upload")
+	c.Assert(ValidateUploadSize(UploadSingle, MaxSingleUploadSize), IsNil)
+	c.Assert(ValidateUploadSize(UploadAuto, MaxSingleUploadSize+1), IsNil)
+}
+
+func (s *S3ObjectSuite) TestSendChecksums(c *C) {
+	small, large := int64(1024), int64(12*bytefmt.MEGABYTE)
+	cases := []struct {
+		method string
+		size   int64
+	}{
+		{UploadAuto, small},
+		{UploadAuto, large},
+		{UploadSingle, large},
+		{UploadMultipart, small},
+	}
+	for i, tc := range cases {
+		s.target.UploadMethod = tc.method
+		key := fmt.Sprintf("checksum-%d.bin", i)
+		crvd := pkg.NewCrvd(s.target, key, tc.size, pkg.DefaultRandomSeed)
+		crvd.SendChecksum = true
+		c.Assert(crvd.CreateRetrieveVerify(), IsNil, Commentf("%d: %v", i, tc.method))
+
+		data, err := ioutil.ReadAll(crvd.NewBody())
+		c.Assert(err, IsNil)
+		key = fmt.Sprintf("wrong-checksum-%d.bin", i)
+		obj := s.target.Object(key)
+		err = obj.Create(bytes.NewReader(data), tc.size, WithWrongChecksums())
+		c.Assert(err, ErrorMatches, "(?s).*BadDigest: The Content-MD5 you specified did not match.*", Commentf("%d: %v", i, tc.method))
+		_, ok := s.server.Object(s3TestBucket, key)
+		c.Assert(ok, Equals, false, Commentf("%d: %v", i, tc.method))
+	}
+}
+
+func (s *S3ObjectSuite) TestSendChecksumSHA256(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	md5Digest := md5.Sum(data)
+	sha256Digest := sha256.Sum256(data)
+	sha256Digest[0] ^= 1
+
+	s.target.UploadMethod = UploadSingle
+	err := s.target.Object("sha256.txt").Create(bytes.NewReader(data), int64(len(data)), WithChecksums(md5Digest[:], sha256Digest[:]))
+	c.Assert(err, ErrorMatches, "(?s)BadDigest: The SHA256 you specified did not match.*")
+	_, ok := s.server.Object(s3TestBucket, "sha256.txt")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *S3ObjectSuite) TestStat(c *C) {
+	s3Svc, err := s.target.S3()
+	c.Assert(err, IsNil)
+	data := []byte("<svg/>")
+	_, err = s3Svc.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s3TestBucket),
+		Key:         aws.String("images/archive.svg"),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("image/svg+xml"),
+		Metadata:    map[string]*string{"Creator": aws.String("dmoles")},
+	})
+	c.Assert(err, IsNil)
+
+	info, err := s.target.Object("images/archive.svg").Stat()
+	c.Assert(err, IsNil)
+	c.Assert(info.URL, Equals, "s3://"+s3TestBucket+"/images/archive.svg")
+	c.Assert(info.ContentLength, Equals, int64(len(data)))
+	c.Assert(info.ETag, Equals, fmt.Sprintf("%x", md5.Sum(data)))
+	c.Assert(info.ContentType, Equals, "image/svg+xml")
+	c.Assert(info.LastModified.IsZero(), Equals, false)
+	c.Assert(info.Metadata, DeepEquals, map[string]string{"creator": "dmoles"})
+	c.Assert(info.LargeObject, Equals, "")
+	c.Assert(info.Parts, Equals, 0)
+}
+
+func (s *S3ObjectSuite) TestContentLengthFallback(c *C) {
+	data := []byte("no content-length on HEAD")
+	obj := s.target.Object("fallback.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+
+	s.server.OmitContentLength = true
+	length, err := obj.ContentLength()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, int64(len(data)))
+}
+
+func (s *S3ObjectSuite) TestSupportsRanges(c *C) {
+	data := []byte("ranges")
+	obj := s.target.Object("ranges.txt").(*S3Object)
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+	c.Assert(obj.SupportsRanges(), Equals, true)
+
+	s.server.OmitAcceptRanges = true
+	c.Assert(obj.SupportsRanges(), Equals, false)
+}
+
+func (s *S3ObjectSuite) TestList(c *C) {
+	s.server.MaxKeys = 2
+	checkListing(c, s.target, true)
+}
+
+func (s *S3ObjectSuite) TestListURLEncodedKeys(c *C) {
+	keys := []string{"control\x01char", "plus+sign", "space key", "percent%25"}
+	for _, key := range keys {
+		c.Assert(s.target.Object(key).Create(bytes.NewReader([]byte("x")), 1), IsNil)
+	}
+	summaries, err := ListAllObjects(s.target, "", "")
+	c.Assert(err, IsNil)
+	var listedKeys []string
+	for _, summary := range summaries {
+		listedKeys = append(listedKeys, summary.Key)
+	}
+	c.Assert(listedKeys, DeepEquals, []string{"control\x01char", "percent%25", "plus+sign", "space key"})
+}
+
+func (s *S3ObjectSuite) TestConcurrentManifestCheck(c *C) {
+	endpointURL, err := url.Parse(s.server.URL())
+	c.Assert(err, IsNil)
+	assertConcurrentManifestCheck(c, s.target, NewS3Target("", endpointURL, s3TestBucket))
+}
+
+func (s *S3ObjectSuite) TestMissingObject(c *C) {
+	_, err := s.target.Object("missing").ContentLength()
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+type StatSuite struct {
+	bucketCount int
+	target      *MemoryTarget
+}
+
+var _ = Suite(&StatSuite{})
+
+func (s *StatSuite) SetUpTest(c *C) {
+	s.bucketCount++
+	s.target = NewMemoryTarget(fmt.Sprintf("stat-suite-%d", s.bucketCount), DefaultMemoryRules)
+	data := []byte("I am the very model of a modern major general")
+	c.Assert(s.target.Object("model.txt").Create(bytes.NewReader(data), int64(len(data))), IsNil)
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *StatSuite) TestMemoryObject(c *C) {
+	info, err := s.target.Object("model.txt").Stat()
+	c.Assert(err, IsNil)
+	c.Assert(info.URL, Equals, "mem://"+s.target.Bucket+"/model.txt")
+	c.Assert(info.ContentLength, Equals, int64(45))
+	c.Assert(info.ETag, Matches, "[0-9a-f]{32}")
+	c.Assert(info.LastModified.IsZero(), Equals, false)
+
+	_, err = s.target.Object("missing.txt").Stat()
+	c.Assert(err, ErrorMatches, "no such object.*")
+}
+
+func (s *StatSuite) TestText(c *C) {
+	var out bytes.Buffer
+	info, err := pkg.Stat{Object: s.target.Object("model.txt")}.Write(&out)
+	c.Assert(err, IsNil)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	c.Assert(lines, HasLen, 4)
+	c.Assert(lines[0], Equals, "URL:            "+info.URL)
+	c.Assert(lines[1], Equals, "Content-Length: 45")
+	c.Assert(lines[2], Equals, "ETag:           "+info.ETag)
+	c.Assert(lines[3], Matches, `Last-Modified:  \d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z`)
+}
+
+func (s *StatSuite) TestJSON(c *C) {
+	var out bytes.Buffer
+	info, err := pkg.Stat{Object: s.target.Object("model.txt"), JSON: true}.Write(&out)
+	c.Assert(err, IsNil)
+
+	var decoded ObjectInfo
+	c.Assert(json.Unmarshal(out.Bytes(), &decoded), IsNil)
+	c.Assert(decoded.URL, Equals, info.URL)
+	c.Assert(decoded.ContentLength, Equals, info.ContentLength)
+	c.Assert(decoded.ETag, Equals, info.ETag)
+	c.Assert(decoded.LastModified.Equal(info.LastModified), Equals, true)
+	c.Assert(strings.Contains(out.String(), `"largeObject"`), Equals, false)
+}
+
+func (s *StatSuite) TestLargeObjectText(c *C) {
+	info := &ObjectInfo{
+		URL:           "s3://bucket/key",
+		ContentLength: 12,
+		LargeObject:   LargeObjectMultipart,
+		Parts:         3,
+		Metadata:      map[string]string{"b": "2", "a": "1"},
+	}
+	c.Assert(info.Pretty(), Equals, strings.Join([]string{
+		"URL:            s3://bucket/key",
+		"Content-Length: 12",
+		"Large-Object:   multipart (3 parts)",
+		"Metadata:",
+		"  a: 1",
+		"  b: 2",
+		"",
+	}, "\n"))
+}
@@ -0,0 +1,401 @@
+package test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/bytefmt"
+	"github.com/ncw/swift"
+	. "gopkg.in/check.v1"
+
+	"github.com/dmolesUC3/cos/internal/fakes"
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+const (
+	swiftTestUser      = "test:tester"
+	swiftTestKey       = "testing"
+	swiftTestContainer = "swift-test-container"
+)
+
+type SwiftObjectSuite struct {
+	server   *fakes.SwiftServer
+	target   *SwiftTarget
+	envSaved map[string]string
+}
+
+var _ = Suite(&SwiftObjectSuite{})
+
+func (s *SwiftObjectSuite) SetUpSuite(c *C) {
+	s.envSaved = map[string]string{}
+	for k, v := range map[string]string{
+		SwiftUserEnvVar: swiftTestUser,
+		SwiftKeyEnvVar:  swiftTestKey,
+	} {
+		s.envSaved[k] = os.Getenv(k)
+		c.Assert(os.Setenv(k, v), IsNil)
+	}
+}
+
+func (s *SwiftObjectSuite) TearDownSuite(c *C) {
+	for k, v := range s.envSaved {
+		_ = os.Setenv(k, v)
+	}
+}
+
+func (s *SwiftObjectSuite) SetUpTest(c *C) {
+	s.server = fakes.NewSwiftServer(swiftTestUser, swiftTestKey)
+	s.server.CreateContainer(swiftTestContainer)
+	s.server.CreateContainer(swiftTestContainer + "_segments")
+	authURL, err := url.Parse(s.server.AuthURL())
+	c.Assert(err, IsNil)
+	s.target, err = NewSwiftEndpoint(authURL, swiftTestContainer)
+	c.Assert(err, IsNil)
+}
+
+func (s *SwiftObjectSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *SwiftObjectSuite) TestCreateDownloadDelete(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+
+	stored, _, ok := s.server.Object(swiftTestContainer, "nested/path/model.txt")
+	c.Assert(ok, Equals, true)
+	c.Assert(stored, DeepEquals, data)
+
+	length, err := obj.ContentLength()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, int64(len(data)))
+
+	buffer := make([]byte, 5)
+	n, err := obj.DownloadRange(9, 13, buffer)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(5))
+	c.Assert(string(buffer), Equals, "very ")
+
+	var out bytes.Buffer
+	n, err = Download(obj, 7, &out)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(len(data)))
+	c.Assert(out.Bytes(), DeepEquals, data)
+
+	c.Assert(obj.Delete(), IsNil)
+	_, _, ok = s.server.Object(swiftTestContainer, "nested/path/model.txt")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *SwiftObjectSuite) TestStream(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+	assertStreams(c, obj, data)
+}
+
+func (s *SwiftObjectSuite) TestStreamIgnoredRange(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+	s.server.IgnoreOpenRanges = true
+	assertStreamChecksRange(c, obj, data)
+}
+
+func (s *SwiftObjectSuite) TestDownloadRangeIgnoredRange(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("nested/path/model.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+	s.server.IgnoreRanges = true
+	assertDownloadRangeChecksRange(c, obj, data)
+}
+
+func (s *SwiftObjectSuite) TestNewObject(c *C) {
+	data := []byte("data")
+	c.Assert(s.target.Object("/key.bin").Create(bytes.NewReader(data), int64(len(data))), IsNil)
+
+	objURL, err := url.Parse("swift://" + swiftTestContainer + "/key.bin")
+	c.Assert(err, IsNil)
+	authURL, err := url.Parse(s.server.AuthURL())
+	c.Assert(err, IsNil)
+	obj, err := NewObject(objURL, authURL, "")
+	c.Assert(err, IsNil)
+	length, err := obj.ContentLength()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, int64(len(data)))
+}
+
+func (s *SwiftObjectSuite) TestStat(c *C) {
+	cnx, err := s.target.Connection()
+	c.Assert(err, IsNil)
+	data := []byte("<svg/>")
+	headers := swift.Headers{"X-Object-Meta-Creator": "dmoles"}
+	_, err = cnx.ObjectPut(swiftTestContainer, "images/archive.svg", bytes.NewReader(data), false, "", "image/svg+xml", headers)
+	c.Assert(err, IsNil)
+
+	info, err := s.target.Object("images/archive.svg").Stat()
+	c.Assert(err, IsNil)
+	c.Assert(info.URL, Equals, "swift://"+swiftTestContainer+"/images/archive.svg")
+	c.Assert(info.ContentLength, Equals, int64(len(data)))
+	c.Assert(info.ETag, Equals, fmt.Sprintf("%x", md5.Sum(data)))
+	c.Assert(info.ContentType, Equals, "image/svg+xml")
+	c.Assert(info.LastModified.IsZero(), Equals, false)
+	c.Assert(info.Metadata, DeepEquals, map[string]string{"creator": "dmoles"})
+	c.Assert(info.LargeObject, Equals, "")
+}
+
+func (s *SwiftObjectSuite) TestSingleObjectCrvd(c *C) {
+	crvd := pkg.NewCrvd(s.target, "single.bin", 1024, pkg.DefaultRandomSeed)
+	c.Assert(crvd.CreateRetrieveVerify(), IsNil)
+
+	_, header, ok := s.server.Object(swiftTestContainer, "single.bin")
+	c.Assert(ok, Equals, true)
+	c.Assert(header.Get("X-Object-Manifest"), Equals, "")
+	c.Assert(s.server.Names(swiftTestContainer+"_segments"), HasLen, 0)
+}
+
+func (s *SwiftObjectSuite) TestDynamicLargeObjectCrvd(c *C) {
+	s.target.LargeObjectThreshold = int64(bytefmt.MEGABYTE)
+
+	size := int64(12 * bytefmt.MEGABYTE) // 3 segments at the default chunk size of 5 MiB
+	crvd := pkg.NewCrvd(s.target, "dlo.bin", size, pkg.DefaultRandomSeed)
+	c.Assert(crvd.CreateRetrieveVerify(), IsNil)
+
+	manifest, header, ok := s.server.Object(swiftTestContainer, "dlo.bin")
+	c.Assert(ok, Equals, true)
+	c.Assert(manifest, HasLen, 0)
+	manifestPrefix := header.Get("X-Object-Manifest")
+	c.Assert(strings.HasPrefix(manifestPrefix, swiftTestContainer+"_segments/"), Equals, true,
+		Commentf("unexpected manifest header: %#v", manifestPrefix))
+	c.Assert(s.server.Names(swiftTestContainer+"_segments"), HasLen, 3)
+
+	length, err := s.target.Object("dlo.bin").ContentLength()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, size)
+
+	info, err := s.target.Object("dlo.bin").Stat()
+	c.Assert(err, IsNil)
+	c.Assert(info.ContentLength, Equals, size)
+	c.Assert(info.LargeObject, Equals, LargeObjectDLO)
+	c.Assert(info.Manifest, Equals, manifestPrefix)
+	c.Assert(info.Parts, Equals, 3)
+}
+
+func (s *SwiftObjectSuite) TestStaticLargeObjectCrvd(c *C) {
+	s.server.CreateContainer("slo-segments")
+	s.target.LargeObjectThreshold = int64(bytefmt.MEGABYTE)
+	s.target.LargeObjectMode = LargeObjectSLO
+	s.target.SegmentSize = int64(2 * bytefmt.MEGABYTE)
+	s.target.SegmentContainer = "slo-segments"
+
+	size := int64(12 * bytefmt.MEGABYTE)
+	crvd := pkg.NewCrvd(s.target, "slo.bin", size, pkg.DefaultRandomSeed)
+	c.Assert(crvd.CreateRetrieveVerify(), IsNil)
+
+	_, header, ok := s.server.Object(swiftTestContainer, "slo.bin")
+	c.Assert(ok, Equals, true)
+	c.Assert(header.Get("X-Static-Large-Object"), Equals, "True")
+	c.Assert(s.server.Names("slo-segments"), HasLen, 6)
+	c.Assert(s.server.Names(swiftTestContainer+"_segments"), HasLen, 0)
+
+	info, err := s.target.Object("slo.bin").Stat()
+	c.Assert(err, IsNil)
+	c.Assert(info.ContentLength, Equals, size)
+	c.Assert(info.LargeObject, Equals, LargeObjectSLO)
+	c.Assert(info.Parts, Equals, 6)
+
+	c.Assert(s.target.Object("slo.bin").Delete(), IsNil)
+	c.Assert(s.server.Names("slo-segments"), HasLen, 0)
+}
+
+func (s *SwiftObjectSuite) TestStaticLargeObjectMaxSegments(c *C) {
+	s.server.MaxManifestSegments = 2
+	s.target.LargeObjectThreshold = int64(bytefmt.MEGABYTE)
+	s.target.LargeObjectMode = LargeObjectSLO
+	s.target.SegmentSize = int64(bytefmt.MEGABYTE)
+
+	crvd := pkg.NewCrvd(s.target, "slo.bin", int64(12*bytefmt.MEGABYTE), pkg.DefaultRandomSeed)
+	c.Assert(crvd.CreateRetrieveVerify(), IsNil)
+	c.Assert(s.server.Names(swiftTestContainer+"_segments"), HasLen, 2)
+}
+
+func (s *SwiftObjectSuite) TestWithSwiftLargeObjects(c *C) {
+	retrying := NewRetryingTarget(s.target, NewRetryPolicy())
+	target, err := WithSwiftLargeObjects(retrying, LargeObjectSLO)
+	c.Assert(err, IsNil)
+	c.Assert(target, FitsTypeOf, &RetryingTarget{})
+	swiftTarget, ok := target.(*RetryingTarget).Target.(*SwiftTarget)
+	c.Assert(ok, Equals, true)
+	c.Assert(swiftTarget.LargeObjectMode, Equals, LargeObjectSLO)
+	c.Assert(s.target.LargeObjectMode, Equals, "")
+
+	crvd := pkg.NewCrvd(target, "slo.bin", int64(64*bytefmt.KILOBYTE), pkg.DefaultRandomSeed)
+	c.Assert(crvd.CreateRetrieveVerify(), IsNil)
+	info, err := target.Object("slo.bin").Stat()
+	c.Assert(err, IsNil)
+	c.Assert(info.LargeObject, Equals, LargeObjectSLO)
+
+	_, err = WithSwiftLargeObjects(s.target, "mlo")
+	c.Assert(err, ErrorMatches, "unknown Swift large object mode \"mlo\".*")
+	_, err = WithSwiftLargeObjects(NewMemoryTarget("bucket", DefaultMemoryRules), LargeObjectDLO)
+	c.Assert(err, ErrorMatches, "not a Swift target: .*")
+}
+
+func (s *SwiftObjectSuite) TestDeleteDynamicLargeObject(c *C) {
+	s.target.LargeObjectThreshold = int64(bytefmt.MEGABYTE)
+	crvd := pkg.NewCrvd(s.target, "dlo.bin", int64(12*bytefmt.MEGABYTE), pkg.DefaultRandomSeed)
+	c.Assert(crvd.CreateRetrieveVerifyDelete(), IsNil)
+
+	_, _, ok := s.server.Object(swiftTestContainer, "dlo.bin")
+	c.Assert(ok, Equals, false)
+	c.Assert(s.server.Names(swiftTestContainer+"_segments"), HasLen, 0)
+	c.Assert(s.server.BulkDeleteRequests, Equals, 0)
+}
+
+func (s *SwiftObjectSuite) TestDeleteBulk(c *C) {
+	s.server.BulkDelete = true
+	s.target.LargeObjectThreshold = int64(bytefmt.MEGABYTE)
+	data := randomBytes(12 * bytefmt.MEGABYTE)
+	obj := s.target.Object("dlo.bin").(*SwiftObject)
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data))), IsNil)
+
+	deletion, err := obj.DeleteWithSegments()
+	c.Assert(err, IsNil)
+	c.Assert(deletion, DeepEquals, &SwiftDeletion{
+		Object:           obj.Pretty(),
+		LargeObject:      LargeObjectDLO,
+		SegmentContainer: swiftTestContainer + "_segments",
+		Segments:         3,
+		BulkDelete:       true,
+	})
+	c.Assert(s.server.BulkDeleteRequests, Equals, 1)
+	_, _, ok := s.server.Object(swiftTestContainer, "dlo.bin")
+	c.Assert(ok, Equals, false)
+	c.Assert(s.server.Names(swiftTestContainer+"_segments"), HasLen, 0)
+}
+
+func (s *SwiftObjectSuite) TestDeleteStaticLargeObject(c *C) {
+	cnx, err := s.target.Connection()
+	c.Assert(err, IsNil)
+	c.Assert(cnx.Authenticate(), IsNil)
+	out, err := cnx.StaticLargeObjectCreateFile(&swift.LargeObjectOpts{
+		Container:  swiftTestContainer,
+		ObjectName: "slo.bin",
+		ChunkSize:  int64(bytefmt.MEGABYTE),
+	})
+	c.Assert(err, IsNil)
+	data := randomBytes(int(2.5 * bytefmt.MEGABYTE))
+	_, err = out.Write(data)
+	c.Assert(err, IsNil)
+	c.Assert(out.Close(), IsNil)
+	c.Assert(s.server.Names(swiftTestContainer+"_segments"), HasLen, 3)
+
+	obj := s.target.Object("slo.bin").(*SwiftObject)
+	info, err := obj.Stat()
+	c.Assert(err, IsNil)
+	c.Assert(info.LargeObject, Equals, LargeObjectSLO)
+	c.Assert(info.ContentLength, Equals, int64(len(data)))
+
+	// delete one segment out from under the manifest
+	segments := s.server.Names(swiftTestContainer + "_segments")
+	c.Assert(cnx.ObjectDelete(swiftTestContainer+"_segments", segments[0]), IsNil)
+
+	deletion, err := obj.DeleteWithSegments()
+	c.Assert(err, IsNil)
+	c.Assert(deletion.LargeObject, Equals, LargeObjectSLO)
+	c.Assert(deletion.Segments, Equals, 2)
+	c.Assert(deletion.NotFound, Equals, 1)
+	c.Assert(deletion.BulkDelete, Equals, false)
+	c.Assert(deletion.String(), Matches, ".*slo.bin \\(slo\\) and 2 segments from .*_segments, individually \\(1 already deleted\\)")
+	_, _, ok := s.server.Object(swiftTestContainer, "slo.bin")
+	c.Assert(ok, Equals, false)
+	c.Assert(s.server.Names(swiftTestContainer+"_segments"), HasLen, 0)
+}
+
+func (s *SwiftObjectSuite) TestSendChecksum(c *C) {
+	data := []byte("I am the very model of a modern major general")
+	obj := s.target.Object("checksum.txt")
+	c.Assert(obj.Create(bytes.NewReader(data), int64(len(data)), WithChecksums(nil, nil)), IsNil)
+	stored, _, ok := s.server.Object(swiftTestContainer, "checksum.txt")
+	c.Assert(ok, Equals, true)
+	c.Assert(stored, DeepEquals, data)
+
+	err := s.target.Object("wrong.txt").Create(bytes.NewReader(data), int64(len(data)), WithWrongChecksums())
+	c.Assert(err, Equals, swift.ObjectCorrupted)
+	_, _, ok = s.server.Object(swiftTestContainer, "wrong.txt")
+	c.Assert(ok, Equals, false)
+
+	err = s.target.Object("unseekable.txt").Create(ioutil.NopCloser(bytes.NewReader(data)), int64(len(data)), WithChecksums(nil, nil))
+	c.Assert(err, ErrorMatches, "unable to send checksum for .*: MD5 digest not provided, and body is not seekable")
+
+	crvd := pkg.NewCrvd(s.target, "crvd.bin", 12345, pkg.DefaultRandomSeed)
+	crvd.SendChecksum = true
+	c.Assert(crvd.CreateRetrieveVerify(), IsNil)
+}
+
+func (s *SwiftObjectSuite) TestSendChecksumLargeObjects(c *C) {
+	s.target.LargeObjectThreshold = int64(bytefmt.MEGABYTE)
+	s.target.SegmentSize = int64(2 * bytefmt.MEGABYTE)
+	size := int64(5 * bytefmt.MEGABYTE)
+	for _, mode := range []string{LargeObjectDLO, LargeObjectSLO} {
+		s.target.LargeObjectMode = mode
+		key := mode + ".bin"
+		crvd := pkg.NewCrvd(s.target, key, size, pkg.DefaultRandomSeed)
+		crvd.SendChecksum = true
+		c.Assert(crvd.CreateRetrieveVerify(), IsNil, Commentf(mode))
+		c.Assert(s.server.Names(swiftTestContainer+"_segments"), HasLen, 3, Commentf(mode))
+
+		info, err := crvd.Object.Stat()
+		c.Assert(err, IsNil)
+		c.Assert(info.ContentLength, Equals, size)
+		c.Assert(info.LargeObject, Equals, mode)
+
+		c.Assert(crvd.Object.Delete(), IsNil)
+		c.Assert(s.server.Names(swiftTestContainer+"_segments"), HasLen, 0, Commentf(mode))
+
+		err = s.target.Object(key).Create(crvd.NewBody(), size, WithWrongChecksums())
+		c.Assert(err, ErrorMatches, "error uploading segment .*: Object Corrupted", Commentf(mode))
+		_, _, ok := s.server.Object(swiftTestContainer, key)
+		c.Assert(ok, Equals, false, Commentf(mode))
+		c.Assert(s.server.Names(swiftTestContainer+"_segments"), HasLen, 0, Commentf(mode))
+	}
+}
+
+func (s *SwiftObjectSuite) TestList(c *C) {
+	s.server.ListingLimit = 2
+	checkListing(c, s.target, true)
+
+	_, err := ListAllObjects(s.target, "", "::")
+	c.Assert(err, ErrorMatches, ".*single-character delimiters.*")
+}
+
+func (s *SwiftObjectSuite) TestBadCredentials(c *C) {
+	s.target.APIKey = "not the key"
+	_, err := s.target.Object("anything").ContentLength()
+	c.Assert(err, NotNil)
+}
+
+func (s *SwiftObjectSuite) TestConcurrentManifestCheck(c *C) {
+	authURL, err := url.Parse(s.server.AuthURL())
+	c.Assert(err, IsNil)
+	fresh, err := NewSwiftEndpoint(authURL, swiftTestContainer)
+	c.Assert(err, IsNil)
+	assertConcurrentManifestCheck(c, s.target, fresh)
+}
+
+func (s *SwiftObjectSuite) TestMissingObject(c *C) {
+	_, err := s.target.Object("missing").ContentLength()
+	c.Assert(err, NotNil)
+}
@@ -1,17 +1,27 @@
 package test
 
 import (
+	"fmt"
 	"strings"
+	"unicode"
 
 	"golang.org/x/text/unicode/rangetable"
 	. "gopkg.in/check.v1"
 
 	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
 
 	"github.com/dmolesUC3/cos/internal/suite"
 )
 
 type UnicodeSuite struct {
+	bucketCount int
+}
+
+func (s *UnicodeSuite) newTarget(forbiddenRunes string) *objects.MemoryTarget {
+	s.bucketCount++
+	rules := objects.MemoryRules{ForbiddenRunes: forbiddenRunes}
+	return objects.NewMemoryTarget(fmt.Sprintf("unicode-suite-%d", s.bucketCount), rules)
 }
 
 var _ = Suite(&UnicodeSuite{})
@@ -28,10 +38,49 @@ func (s *UnicodeSuite) TestNonCharacter(c *C) {
 
 func (s *UnicodeSuite) TestUTF8InvalidSequences(c *C) {
 	const badChar = rune(0xfffd)
-	for i, bb := range suite.UTF8InvalidSequences {
-		bytesStr := logging.FormatByteArray(bb)
-		asString := string(bb)
-		c.Check(strings.ContainsRune(asString, badChar), Equals, true,
-			Commentf("%d: %v: expected %#x (%#v), got %#v", i, bytesStr, badChar, string(badChar), asString))
+	for name, seqs := range suite.UTF8InvalidSequences {
+		for i, asString := range seqs {
+			bytesStr := logging.FormatStringBytes(asString)
+			c.Check(strings.ContainsRune(asString, badChar), Equals, true,
+				Commentf("%v %d: %v: expected %#x (%#v), got %#v", name, i, bytesStr, badChar, string(badChar), asString))
+		}
 	}
 }
+
+func (s *UnicodeSuite) TestRangeTableBinarySearch(c *C) {
+	// printable ASCII and Latin-1
+	rt := &unicode.RangeTable{R16: []unicode.Range16{{Lo: 0x20, Hi: 0x7e, Stride: 1}, {Lo: 0xa0, Hi: 0xff, Stride: 1}}}
+	rangeCase := suite.NewRangeTableCase("test: ", "ascii and latin-1", rt)
+
+	ok, detail := rangeCase.Run(s.newTarget(""))
+	c.Assert(ok, Equals, true, Commentf(detail))
+
+	target := s.newTarget("é%\\")
+	ok, detail = rangeCase.Run(target)
+	c.Assert(ok, Equals, false)
+	c.Assert(detail, Equals, `3 invalid characters: "%\\é"`)
+	c.Assert(target.Keys(), HasLen, 0, Commentf("objects not deleted"))
+}
+
+func (s *UnicodeSuite) TestRangeTableSplitsLongKeys(c *C) {
+	// more runes than fit in a single key
+	rt := &unicode.RangeTable{R16: []unicode.Range16{{Lo: 0x4e00, Hi: 0x5200, Stride: 1}}}
+	rangeCase := suite.NewRangeTableCase("test: ", "CJK", rt)
+	ok, detail := rangeCase.Run(s.newTarget("丂"))
+	c.Assert(ok, Equals, false)
+	c.Assert(detail, Equals, `1 invalid characters: "丂"`)
+}
+
+func (s *UnicodeSuite) TestSequenceBinarySearch(c *C) {
+	seqs := []string{"👍🏻", "👍🏼", "👍🏽", "👍🏾", "👍🏿", "🇺🇸", "🇫🇷"}
+	seqCase := suite.NewBinarySearchSeqCase("test: ", "emoji", seqs)
+
+	ok, detail := seqCase.Run(s.newTarget(""))
+	c.Assert(ok, Equals, true, Commentf(detail))
+
+	// U+1F3FD MEDIUM SKIN TONE, U+1F1EB REGIONAL INDICATOR SYMBOL LETTER F
+	ok, detail = seqCase.Run(s.newTarget("\U0001F3FD\U0001F1EB"))
+	c.Assert(ok, Equals, false)
+	// the message is truncated to fit on one line
+	c.Assert(detail, Matches, `2 invalid sequences: "👍🏽 \[0xf0 .*`)
+}
@@ -0,0 +1,181 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+type VerifyGeneratedSuite struct {
+	bucketCount int
+	target      Target
+}
+
+var _ = Suite(&VerifyGeneratedSuite{})
+
+func (s *VerifyGeneratedSuite) SetUpTest(c *C) {
+	s.bucketCount++
+	s.target = NewMemoryTarget(fmt.Sprintf("verify-generated-suite-%d", s.bucketCount), DefaultMemoryRules)
+}
+
+// create creates an object with the specified content, corrupting the bytes
+// at the specified offsets
+func (s *VerifyGeneratedSuite) create(c *C, key string, content pkg.Content, length int64, corrupt ...int64) Object {
+	data, err := ioutil.ReadAll(content.NewBody(length))
+	c.Assert(err, IsNil)
+	for _, offset := range corrupt {
+		data[offset] ^= 0x10
+	}
+	obj := s.target.Object(key)
+	c.Assert(obj.Create(bytes.NewReader(data), length), IsNil)
+	return obj
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *VerifyGeneratedSuite) TestParseCounter(c *C) {
+	content, err := pkg.ParseContent("counter", 17)
+	c.Assert(err, IsNil)
+	c.Assert(content, DeepEquals, &pkg.CounterContent{Seed: 17})
+	c.Assert(content.Pretty(), Equals, "counter (seed 17)")
+
+	_, err = pkg.ParseContent("counter:1", 17)
+	c.Assert(err, ErrorMatches, ".*counter takes no value")
+}
+
+func (s *VerifyGeneratedSuite) TestCounter(c *C) {
+	content := &pkg.CounterContent{Seed: 1}
+	data, err := ioutil.ReadAll(content.NewBody(10000))
+	c.Assert(err, IsNil)
+	c.Assert(data, HasLen, 10000)
+
+	other, err := ioutil.ReadAll((&pkg.CounterContent{Seed: 2}).NewBody(10000))
+	c.Assert(err, IsNil)
+	c.Assert(other, Not(DeepEquals), data)
+	c.Assert(bytes.Count(data, []byte{0}) < 100, Equals, true, Commentf("too many zeros"))
+}
+
+func (s *VerifyGeneratedSuite) TestReadAtMatchesBody(c *C) {
+	path := filepath.Join(c.MkDir(), "sample.txt")
+	c.Assert(ioutil.WriteFile(path, []byte("sample\n"), 0644), IsNil)
+
+	contents := []pkg.SeekableContent{
+		&pkg.RandomContent{Seed: 3},
+		&pkg.CounterContent{Seed: 3},
+		&pkg.ZerosContent{},
+		&pkg.PatternContent{Pattern: []byte("abc")},
+		&pkg.FileContent{Path: path},
+	}
+	random := rand.New(rand.NewSource(1))
+	for _, content := range contents {
+		expected, err := ioutil.ReadAll(content.NewBody(5000))
+		c.Assert(err, IsNil)
+		for i := 0; i < 50; i++ {
+			offset := random.Int63n(4000)
+			actual := make([]byte, 1+random.Intn(999))
+			n, err := content.ReadAt(actual, offset)
+			c.Assert(err, IsNil, Commentf("%v", content))
+			c.Assert(n, Equals, len(actual), Commentf("%v", content))
+			c.Assert(actual, DeepEquals, expected[offset:offset+int64(n)], Commentf("%v at %d", content, offset))
+		}
+	}
+}
+
+func (s *VerifyGeneratedSuite) TestVerifyAll(c *C) {
+	content := &pkg.CounterContent{Seed: 1}
+	obj := s.create(c, "all.bin", content, 100000)
+	v := pkg.VerifyGenerated{Object: obj, Content: content, Length: 100000, SampleSize: 1024}
+	result, err := v.Verify()
+	c.Assert(err, IsNil)
+	c.Assert(result.Bytes, Equals, int64(100000))
+	c.Assert(result.String(), Equals, "all 97.7K (100000 bytes)")
+}
+
+func (s *VerifyGeneratedSuite) TestVerifySamples(c *C) {
+	content := &pkg.CounterContent{Seed: 1}
+	obj := s.create(c, "samples.bin", content, 100000)
+	v := pkg.VerifyGenerated{Object: obj, Content: content, Samples: 5, SampleSize: 1024, Random: rand.New(rand.NewSource(1))}
+	result, err := v.Verify()
+	c.Assert(err, IsNil)
+	c.Assert(result.Ranges, Equals, 5)
+	// the last range is short: 100000 = 97 * 1024 + 672
+	c.Assert(result.Bytes, Equals, int64(4*1024+672))
+	c.Assert(result.String(), Equals, "5 sample ranges (4.7K of 97.7K)")
+}
+
+func (s *VerifyGeneratedSuite) TestVerifySingleSample(c *C) {
+	content := &pkg.CounterContent{Seed: 1}
+	obj := s.create(c, "sample.bin", content, 100000)
+	v := pkg.VerifyGenerated{Object: obj, Content: content, Samples: 1, SampleSize: 1024}
+	result, err := v.Verify()
+	c.Assert(err, IsNil)
+	c.Assert(result.Ranges, Equals, 1)
+	c.Assert(result.Bytes, Equals, int64(1024))
+	c.Assert(result.String(), Equals, "1 sample range (1K of 97.7K)")
+}
+
+func (s *VerifyGeneratedSuite) TestVerifyFindsFirstCorruptedByte(c *C) {
+	content := &pkg.CounterContent{Seed: 1}
+	expected, err := ioutil.ReadAll(content.NewBody(100000))
+	c.Assert(err, IsNil)
+	obj := s.create(c, "corrupt.bin", content, 100000, 54321, 76543)
+
+	for _, samples := range []int{0, 1000} {
+		v := pkg.VerifyGenerated{Object: obj, Content: content, Samples: samples, SampleSize: 1000}
+		_, err = v.Verify()
+		c.Assert(err, FitsTypeOf, &pkg.CorruptionError{}, Commentf("samples: %d", samples))
+		corruption := err.(*pkg.CorruptionError)
+		c.Assert(corruption.Offset, Equals, int64(54321))
+		c.Assert(corruption.Expected, Equals, expected[54321])
+		c.Assert(corruption.Actual, Equals, expected[54321]^0x10)
+		c.Assert(err, ErrorMatches, "first corrupted byte of mem://.*/corrupt.bin at offset 54321: expected 0x.., got 0x..")
+	}
+}
+
+func (s *VerifyGeneratedSuite) TestVerifyLengthMismatch(c *C) {
+	content := &pkg.ZerosContent{}
+	obj := s.create(c, "short.bin", content, 1000)
+	v := pkg.VerifyGenerated{Object: obj, Content: content, Length: 1001}
+	_, err := v.Verify()
+	c.Assert(err, ErrorMatches, "content-length mismatch for mem://.*/short.bin: expected: 1001, actual: 1000")
+}
+
+func (s *VerifyGeneratedSuite) TestCrvdSamples(c *C) {
+	crvd := pkg.NewCrvd(s.target, "crvd.bin", 100000, 1)
+	crvd.Content = &pkg.CounterContent{Seed: 1}
+	crvd.Samples = 3
+	crvd.SampleSize = 1000
+	c.Assert(crvd.CreateRetrieveVerifyDelete(), IsNil)
+	c.Assert(crvd.Verified, NotNil)
+	c.Assert(crvd.Verified.Ranges, Equals, 3)
+
+	crvd = pkg.NewCrvd(s.target, "crvd.bin", 100000, 1)
+	crvd.Samples = 3
+	c.Assert(crvd.CreateRetrieveVerifyDelete(), IsNil, Commentf("default (random) content"))
+
+	crvd = pkg.NewCrvd(s.target, "crvd.bin", 100000, 1)
+	crvd.Content = &pkg.TextContent{Seed: 1}
+	crvd.Samples = 3
+	c.Assert(crvd.CreateRetrieveVerifyDelete(), ErrorMatches, "verifying sample ranges requires .*, not text \\(seed 1\\)")
+}
+
+func (s *VerifyGeneratedSuite) TestCrvdReportsFirstCorruptedByte(c *C) {
+	faults, err := ParseFaults("put:flipbit")
+	c.Assert(err, IsNil)
+	target := NewFaultTarget(s.target, NewFaultInjector(faults, 1))
+	crvd := pkg.NewCrvd(target, "crvd.bin", 12345, 1)
+	crvd.Content = &pkg.CounterContent{Seed: 1}
+	err = crvd.CreateRetrieveVerify()
+	c.Assert(err, ErrorMatches, "(?s)sha256 digest mismatch:.*\nfirst corrupted byte of .*/crvd.bin at offset [0-9]+: expected 0x.., got 0x..")
+}
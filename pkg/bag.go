@@ -0,0 +1,376 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	. "github.com/dmolesUC3/cos/internal/objects"
+)
+
+const (
+	// BagExtra indicates a file in the payload directory of a bag that is not
+	// listed in any payload manifest
+	BagExtra = "extra"
+
+	bagDeclaration  = "bagit.txt"
+	bagInfo         = "bag-info.txt"
+	bagPayloadDir   = "data/"
+	bagPayloadOxum  = "Payload-Oxum"
+	bagVersion      = "BagIt-Version"
+	bagTagEncoding  = "Tag-File-Character-Encoding"
+	bagUTF8Encoding = "UTF-8"
+)
+
+var bagPayloadManifestRegexp = regexp.MustCompile("^manifest-([a-z0-9]+)\\.txt$")
+var bagTagManifestRegexp = regexp.MustCompile("^tagmanifest-([a-z0-9]+)\\.txt$")
+
+// ------------------------------------------------------------
+// BagSummary type
+
+// BagSummary summarizes the validation of a bag
+type BagSummary struct {
+	// Version is the BagIt version declared in bagit.txt
+	Version string
+	// Files counts the results of verifying the payload and tag files
+	// listed in the manifests
+	Files ManifestSummary
+	// Extra lists the payload files not listed in any payload manifest
+	Extra []string
+	// Problems lists any other ways in which the bag is invalid
+	Problems []string
+}
+
+// Valid returns true if the bag is valid
+func (s *BagSummary) Valid() bool {
+	return s.Files.OK() && len(s.Extra) == 0 && len(s.Problems) == 0
+}
+
+func (s *BagSummary) String() string {
+	validity := "valid"
+	if !s.Valid() {
+		validity = "invalid"
+	}
+	return fmt.Sprintf("bag %v: %v; %d extra, %d other problems", validity, s.Files, len(s.Extra), len(s.Problems))
+}
+
+func (s *BagSummary) problem(format string, args ...interface{}) {
+	s.Problems = append(s.Problems, fmt.Sprintf(format, args...))
+}
+
+// ------------------------------------------------------------
+// BagValidation type
+
+// The BagValidation struct represents the validation of a BagIt bag (see RFC
+// 8493) stored as the objects under a prefix in the target
+type BagValidation struct {
+	Target Target
+	Prefix string
+
+	// Workers is the number of files to verify at once
+	Workers int
+	// Concurrency is the number of ranges of each file to download at once
+	Concurrency int
+	// Stream, if true, streams each file with a single request (see Check)
+	Stream bool
+}
+
+// Validate validates the bag, checking the bag declaration, the
+// Payload-Oxum (if present in bag-info.txt), and that the payload files are
+// exactly those listed in each payload manifest, then streaming each payload
+// and tag file listed in the manifests and verifying its digests. It calls
+// the specified function with the result for each file listed in the
+// manifests, in manifest order, followed by any extra payload files. Validate
+// returns an error only if the target cannot be listed or a tag file cannot
+// be read; other problems are recorded in the summary.
+func (b BagValidation) Validate(fn func(result ManifestResult)) (*BagSummary, error) {
+	logger := logging.DefaultLogger()
+	summary := &BagSummary{}
+
+	sizes := map[string]int64{}
+	err := b.Target.List(b.Prefix, "", func(obj ObjectSummary) error {
+		if !obj.IsPrefix {
+			sizes[strings.TrimPrefix(obj.Key, b.Prefix)] = obj.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sizes) == 0 {
+		return nil, fmt.Errorf("no objects found under %#v", b.Prefix)
+	}
+	logger.Detailf("%d files found in bag\n", len(sizes))
+
+	err = b.checkDeclaration(sizes, summary)
+	if err != nil {
+		return nil, err
+	}
+	err = b.checkPayloadOxum(sizes, summary)
+	if err != nil {
+		return nil, err
+	}
+
+	var payloadManifests, tagManifests []string
+	for path := range sizes {
+		if bagPayloadManifestRegexp.MatchString(path) {
+			payloadManifests = append(payloadManifests, path)
+		} else if bagTagManifestRegexp.MatchString(path) {
+			tagManifests = append(tagManifests, path)
+		}
+	}
+	sort.Strings(payloadManifests)
+	sort.Strings(tagManifests)
+	if len(payloadManifests) == 0 {
+		summary.problem("no payload manifest found")
+	}
+
+	payloadFiles := b.readManifests(payloadManifests, bagPayloadManifestRegexp, true, summary)
+	tagFiles := b.readManifests(tagManifests, bagTagManifestRegexp, false, summary)
+
+	// every payload file must be listed in every payload manifest
+	var payloadPaths []string
+	for path := range sizes {
+		if strings.HasPrefix(path, bagPayloadDir) {
+			payloadPaths = append(payloadPaths, path)
+		}
+	}
+	sort.Strings(payloadPaths)
+	for _, path := range payloadPaths {
+		file := payloadFiles.byPath[path]
+		if file == nil {
+			summary.Extra = append(summary.Extra, path)
+			continue
+		}
+		for i, algorithm := range payloadFiles.algorithms {
+			if _, ok := file.expected[algorithm]; !ok {
+				summary.problem("%v is not listed in %v", path, payloadFiles.manifests[i])
+			}
+		}
+	}
+
+	files := append(payloadFiles.files, tagFiles.files...)
+	verifyInOrder(len(files), b.Workers, func(index int) ManifestResult {
+		file := files[index]
+		key := b.Prefix + file.entry.Path
+		if _, ok := sizes[file.entry.Path]; !ok {
+			return ManifestResult{Entry: file.entry, Key: key, Status: ManifestMissing}
+		}
+		return verifyObject(b.Target.Object(key), file.entry, key, file.algorithm, file.expected, b.Concurrency, b.Stream)
+	}, func(result ManifestResult) {
+		summary.Files.add(result)
+		fn(result)
+	})
+	for _, path := range summary.Extra {
+		fn(ManifestResult{Entry: ManifestEntry{Path: path}, Key: b.Prefix + path, Status: BagExtra})
+	}
+	return summary, nil
+}
+
+// ------------------------------
+// Unexported methods
+
+// checkDeclaration checks that bagit.txt is present and declares the BagIt
+// version and UTF-8 tag file encoding
+func (b BagValidation) checkDeclaration(sizes map[string]int64, summary *BagSummary) error {
+	if _, ok := sizes[bagDeclaration]; !ok {
+		summary.problem("%v not found", bagDeclaration)
+		return nil
+	}
+	tags, err := b.readTags(bagDeclaration)
+	if err != nil {
+		return err
+	}
+	if tags == nil {
+		summary.problem("%v is not a valid tag file", bagDeclaration)
+		return nil
+	}
+	summary.Version = tags.value(bagVersion)
+	if summary.Version == "" {
+		summary.problem("%v does not declare %v", bagDeclaration, bagVersion)
+	}
+	encoding := tags.value(bagTagEncoding)
+	if encoding == "" {
+		summary.problem("%v does not declare %v", bagDeclaration, bagTagEncoding)
+	} else if !strings.EqualFold(encoding, bagUTF8Encoding) {
+		summary.problem("unsupported %v: %#v", bagTagEncoding, encoding)
+	}
+	return nil
+}
+
+// checkPayloadOxum checks the octet count and stream count of the payload
+// files against the Payload-Oxum in bag-info.txt, if present
+func (b BagValidation) checkPayloadOxum(sizes map[string]int64, summary *BagSummary) error {
+	if _, ok := sizes[bagInfo]; !ok {
+		return nil
+	}
+	tags, err := b.readTags(bagInfo)
+	if err != nil {
+		return err
+	}
+	if tags == nil {
+		summary.problem("%v is not a valid tag file", bagInfo)
+		return nil
+	}
+	oxum := tags.value(bagPayloadOxum)
+	if oxum == "" {
+		return nil
+	}
+	var octets, streams int64
+	for path, size := range sizes {
+		if strings.HasPrefix(path, bagPayloadDir) {
+			octets += size
+			streams++
+		}
+	}
+	actual := fmt.Sprintf("%d.%d", octets, streams)
+	parts := strings.Split(oxum, ".")
+	if len(parts) != 2 {
+		summary.problem("invalid %v: %#v", bagPayloadOxum, oxum)
+		return nil
+	}
+	expectedOctets, err1 := strconv.ParseInt(parts[0], 10, 64)
+	expectedStreams, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil {
+		summary.problem("invalid %v: %#v", bagPayloadOxum, oxum)
+	} else if expectedOctets != octets || expectedStreams != streams {
+		summary.problem("%v mismatch: expected %v, actual %v", bagPayloadOxum, oxum, actual)
+	}
+	return nil
+}
+
+// readManifests reads the specified payload or tag manifests, merging their
+// entries by path
+func (b BagValidation) readManifests(manifests []string, nameRegexp *regexp.Regexp, payload bool, summary *BagSummary) *bagFiles {
+	kind := "tag"
+	if payload {
+		kind = "payload"
+	}
+	files := &bagFiles{byPath: map[string]*bagFile{}}
+	for _, name := range manifests {
+		algorithm := nameRegexp.FindStringSubmatch(name)[1]
+		if _, err := NewHash(algorithm); err != nil {
+			summary.problem("%v: %v", name, err)
+			continue
+		}
+		manifest, err := b.readManifest(name, algorithm)
+		if err != nil {
+			summary.problem("%v: %v", name, err)
+			continue
+		}
+		files.manifests = append(files.manifests, name)
+		files.algorithms = append(files.algorithms, algorithm)
+		for _, entry := range manifest.Entries {
+			if strings.HasPrefix(entry.Path, bagPayloadDir) != payload {
+				summary.problem("%v line %d: %v is not a %v file", name, entry.Line, entry.Path, kind)
+				continue
+			}
+			file := files.byPath[entry.Path]
+			if file == nil {
+				file = &bagFile{entry: entry, algorithm: algorithm, expected: map[string][]byte{}}
+				files.byPath[entry.Path] = file
+				files.files = append(files.files, file)
+			}
+			if _, ok := file.expected[algorithm]; ok {
+				summary.problem("%v line %d: %v is listed more than once", name, entry.Line, entry.Path)
+				continue
+			}
+			file.expected[algorithm] = entry.Digest
+		}
+	}
+	return files
+}
+
+// readManifest streams a manifest, so that the manifest, like the payload
+// files, never needs to be stored locally
+func (b BagValidation) readManifest(name string, algorithm string) (*Manifest, error) {
+	reader, writer := io.Pipe()
+	go func() {
+		_, err := NewDownloader(0, b.Concurrency).Download(b.Target.Object(b.Prefix+name), writer)
+		_ = writer.CloseWithError(err)
+	}()
+	manifest, err := ReadManifest(reader, ManifestBagIt, algorithm)
+	_ = reader.Close()
+	return manifest, err
+}
+
+// readTags reads a tag file, returning nil if it cannot be parsed
+func (b BagValidation) readTags(name string) (bagTags, error) {
+	var data bytes.Buffer
+	_, err := NewDownloader(0, b.Concurrency).Download(b.Target.Object(b.Prefix+name), &data)
+	if err != nil {
+		return nil, err
+	}
+	return parseTags(data.String()), nil
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+type bagFile struct {
+	// entry is the entry from the first manifest listing the file
+	entry     ManifestEntry
+	algorithm string
+	expected  map[string][]byte
+}
+
+// bagFiles are the files listed in the payload or tag manifests of a bag
+type bagFiles struct {
+	// manifests and algorithms are the names and algorithms of the manifests read
+	manifests  []string
+	algorithms []string
+
+	files  []*bagFile
+	byPath map[string]*bagFile
+}
+
+type bagTag struct {
+	label string
+	value string
+}
+
+type bagTags []bagTag
+
+// value returns the value of the first tag with the specified label,
+// ignoring case, or the empty string if there is none
+func (tags bagTags) value(label string) string {
+	for _, tag := range tags {
+		if strings.EqualFold(tag.label, label) {
+			return tag.value
+		}
+	}
+	return ""
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// parseTags parses "<LABEL>: <VALUE>" lines, in which values may be continued
+// on following lines indented with whitespace, returning nil if any line is
+// not in that form
+func parseTags(text string) bagTags {
+	tags := bagTags{}
+	for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(tags) == 0 {
+				return nil
+			}
+			tags[len(tags)-1].value += " " + strings.TrimSpace(line)
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return nil
+		}
+		tags = append(tags, bagTag{label: strings.TrimSpace(line[:i]), value: strings.TrimSpace(line[i+1:])})
+	}
+	return tags
+}
@@ -2,31 +2,255 @@ package pkg
 
 import (
 	"bytes"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/dmolesUC3/cos/internal/logging"
 	. "github.com/dmolesUC3/cos/internal/objects"
 	. "github.com/dmolesUC3/cos/internal/streaming"
 )
 
 // The Check struct represents a fixity check operation
 type Check struct {
-	Object    Object
-	Expected  []byte
-	Algorithm string
+	Object      Object
+	Algorithms  []string
+	Expected    map[string][]byte
+	Concurrency int
+	// Stream, if true, downloads the object with a single streaming request
+	// if the backend supports it, using ranged requests only to resume after
+	// an error (see Downloader)
+	Stream bool
+
+	// ETag, if true, verifies the object's S3 ETag by recomputing it from the
+	// object's content
+	ETag bool
+	// PartSize is the part size for recomputing a multipart ETag, or 0 to
+	// detect the part size
+	PartSize int64
+
+	// Checkpoint, if not empty, is the path of a file in which to save the
+	// progress of the digest computation, so that it can be resumed if
+	// interrupted, and from which to resume it
+	Checkpoint string
+	// CheckpointInterval is the interval between checkpoints, or 0 for
+	// DefaultCheckpointInterval
+	CheckpointInterval time.Duration
+
+	// out, if set, is also written the object's content as it is downloaded
+	out io.Writer
+}
+
+// The CheckResult struct represents the result of a fixity check
+type CheckResult struct {
+	Digests map[string][]byte
+
+	// ETag is the recomputed (unquoted) ETag, if ETag verification was requested
+	ETag string
+	// PartSize is the part size of a recomputed multipart ETag
+	PartSize int64
+	// Parts is the number of parts of a recomputed multipart ETag, or 0 for a
+	// single-part ETag
+	Parts int
 }
 
-// VerifyDigest gets the digest, returning an error if the object cannot be retrieved or,
-// when an expected digest is provided, if the calculated digest does not match.
+// VerifyDigest gets the digest for the check's single algorithm, returning
+// an error if the object cannot be retrieved or, when an expected digest is
+// provided, if the calculated digest does not match.
+//
+// Deprecated: use VerifyDigests or Verify, which support multiple algorithms.
 func (c Check) VerifyDigest() ([]byte, error) {
-	actualDigest, err := CalcDigest(c.Object, DefaultRangeSize, c.Algorithm)
+	if len(c.Algorithms) != 1 {
+		return nil, fmt.Errorf("VerifyDigest requires exactly one algorithm, got %d", len(c.Algorithms))
+	}
+	result, err := c.Verify()
+	if result == nil {
+		return nil, err
+	}
+	return result.Digests[c.Algorithms[0]], err
+}
+
+// VerifyDigests gets the digests for each algorithm from a single download,
+// returning an error if the object cannot be retrieved or, when expected
+// digests are provided, if any calculated digest does not match.
+func (c Check) VerifyDigests() (map[string][]byte, error) {
+	result, err := c.Verify()
+	if result == nil {
+		return nil, err
+	}
+	return result.Digests, err
+}
+
+// Verify gets the digests for each algorithm and, if requested, the recomputed
+// ETag, from a single download, returning an error if the object cannot be
+// retrieved or if any expected digest, or the ETag, does not match.
+func (c Check) Verify() (*CheckResult, error) {
+	hashes, err := NewHashes(c.Algorithms)
 	if err != nil {
 		return nil, err
 	}
-	expectedDigest := c.Expected
-	if len(expectedDigest) > 0 {
+	var writers []io.Writer
+	for _, algorithm := range c.Algorithms {
+		writers = append(writers, hashes[algorithm])
+	}
+
+	if c.out != nil {
+		writers = append(writers, c.out)
+	}
+
+	if c.Checkpoint != "" && c.ETag {
+		return nil, fmt.Errorf("ETag verification does not support checkpoints")
+	}
+
+	var etagVerifier *ETagVerifier
+	if c.ETag {
+		info, err := c.Object.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if info.ETag == "" {
+			return nil, fmt.Errorf("no ETag reported for %v", c.Object)
+		}
+		etagVerifier, err = NewETagVerifier(info.ETag, info.ContentLength, c.PartSize)
+		if err != nil {
+			return nil, err
+		}
+		logging.DefaultLogger().Detailf("Recomputing ETag %v with part size(s) %v\n", info.ETag, etagVerifier.PartSizes())
+		writers = append(writers, etagVerifier)
+	}
+
+	downloader := NewDownloader(DefaultRangeSize, c.Concurrency)
+	downloader.Stream = c.Stream
+	if c.Checkpoint != "" {
+		err = c.downloadWithCheckpoint(downloader, hashes, io.MultiWriter(writers...))
+	} else {
+		_, err = downloader.Download(c.Object, io.MultiWriter(writers...))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CheckResult{Digests: map[string][]byte{}}
+	var mismatches []string
+	for _, algorithm := range c.Algorithms {
+		actualDigest := hashes[algorithm].Sum(nil)
+		result.Digests[algorithm] = actualDigest
+		expectedDigest := c.Expected[algorithm]
+		if len(expectedDigest) == 0 {
+			continue
+		}
 		if !bytes.Equal(expectedDigest, actualDigest) {
-			err = fmt.Errorf("digest mismatch:\nexpected:\n%x\nactual: %x", expectedDigest, actualDigest)
+			mismatches = append(mismatches, fmt.Sprintf("%v digest mismatch:\nexpected: %x\nactual: %x", algorithm, expectedDigest, actualDigest))
+		}
+	}
+	if etagVerifier != nil {
+		var etagErr error
+		result.ETag, result.PartSize, etagErr = etagVerifier.Verify()
+		result.Parts = etagVerifier.Parts
+		if etagErr != nil {
+			mismatches = append(mismatches, etagErr.Error())
+		}
+	}
+	if len(mismatches) > 0 {
+		err = fmt.Errorf("%v", strings.Join(mismatches, "\n"))
+	}
+	return result, err
+}
+
+// downloadWithCheckpoint downloads the object to the specified io.Writer,
+// resuming from the checkpoint file if present, and saving checkpoints as
+// the download progresses and if it fails. The checkpoint file is removed
+// once the download is complete.
+func (c Check) downloadWithCheckpoint(downloader *Downloader, hashes map[string]hash.Hash, out io.Writer) error {
+	logger := logging.DefaultLogger()
+	info, err := c.Object.Stat()
+	if err != nil {
+		return err
+	}
+	cp, err := LoadCheckpoint(c.Checkpoint)
+	if err != nil {
+		return err
+	}
+	var offset int64
+	if cp != nil {
+		err = cp.Restore(info, hashes)
+		if err != nil {
+			return fmt.Errorf("unable to resume from checkpoint %v: %v", c.Checkpoint, err)
+		}
+		offset = cp.Offset
+		logger.Detailf("Resuming from checkpoint %v at byte %d of %d\n", c.Checkpoint, offset, info.ContentLength)
+	}
+	// fail now, rather than at the first save, if the hashes can't be saved
+	if _, err = NewCheckpoint(info, offset, hashes); err != nil {
+		return err
+	}
+
+	interval := c.CheckpointInterval
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+	cpWriter := &checkpointWriter{
+		path:      c.Checkpoint,
+		interval:  interval,
+		info:      info,
+		hashes:    hashes,
+		out:       out,
+		offset:    offset,
+		lastSaved: time.Now(),
+	}
+	_, err = downloader.DownloadFrom(c.Object, offset, cpWriter)
+	if err != nil {
+		if saveErr := cpWriter.save(); saveErr != nil {
+			logger.Infof("%v\n", saveErr)
+			return err
+		}
+		return fmt.Errorf("%v (checkpoint saved to %v at byte %d of %d)", err, c.Checkpoint, cpWriter.offset, info.ContentLength)
+	}
+	err = os.Remove(c.Checkpoint)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ParseExpectedDigests parses expected digest values of the form
+// [ALGORITHM:]HEX. The algorithm may be omitted only if there is a single
+// algorithm; otherwise it must be one of the specified algorithms.
+func ParseExpectedDigests(values []string, algorithms []string) (map[string][]byte, error) {
+	expected := map[string][]byte{}
+	for _, value := range values {
+		algorithm, hexDigest := "", value
+		if i := strings.Index(value, ":"); i >= 0 {
+			algorithm, hexDigest = value[:i], value[i+1:]
+		} else if len(algorithms) == 1 {
+			algorithm = algorithms[0]
+		} else {
+			return nil, fmt.Errorf("expected digest %#v must be prefixed with one of: %v", value, strings.Join(algorithms, ", "))
+		}
+		if !contains(algorithms, algorithm) {
+			return nil, fmt.Errorf("expected digest given for %v, which is not among the algorithms: %v", algorithm, strings.Join(algorithms, ", "))
+		}
+		if _, ok := expected[algorithm]; ok {
+			return nil, fmt.Errorf("expected digest for %v given more than once", algorithm)
+		}
+		digest, err := hex.DecodeString(hexDigest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expected %v digest %#v: %v", algorithm, hexDigest, err)
+		}
+		expected[algorithm] = digest
+	}
+	return expected, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
 		}
 	}
-	return actualDigest, err
+	return false
 }
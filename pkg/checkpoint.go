@@ -0,0 +1,217 @@
+package pkg
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	. "github.com/dmolesUC3/cos/internal/objects"
+)
+
+const (
+	// DefaultCheckpointInterval is the default interval between checkpoints
+	DefaultCheckpointInterval = 30 * time.Second
+)
+
+// ------------------------------------------------------------
+// Checkpoint type
+
+// Checkpoint records the progress of a digest computation, so that it can be
+// resumed if interrupted: the intermediate state of each hash (see
+// encoding.BinaryMarshaler), the number of bytes hashed so far, and the
+// object's ETag, length, and last-modified time, to detect whether the object
+// has changed since the checkpoint was written.
+type Checkpoint struct {
+	URL           string            `json:"url"`
+	ETag          string            `json:"etag,omitempty"`
+	ContentLength int64             `json:"contentLength"`
+	LastModified  time.Time         `json:"lastModified"`
+	Offset        int64             `json:"offset"`
+	States        map[string][]byte `json:"states"`
+}
+
+// NewCheckpoint returns a new checkpoint for the object described by the
+// specified ObjectInfo, recording the current state of each hash
+func NewCheckpoint(info *ObjectInfo, offset int64, hashes map[string]hash.Hash) (*Checkpoint, error) {
+	states := map[string][]byte{}
+	for algorithm, h := range hashes {
+		marshaler, ok := h.(encoding.BinaryMarshaler)
+		if !ok {
+			return nil, fmt.Errorf("%v digest computation does not support checkpoints", algorithm)
+		}
+		state, err := marshaler.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		states[algorithm] = state
+	}
+	return &Checkpoint{
+		URL:           info.URL,
+		ETag:          info.ETag,
+		ContentLength: info.ContentLength,
+		LastModified:  info.LastModified,
+		Offset:        offset,
+		States:        states,
+	}, nil
+}
+
+// LoadCheckpoint reads a checkpoint from the specified file, returning nil
+// (and no error) if the file does not exist
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	err = json.Unmarshal(data, &cp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file %v: %v", path, err)
+	}
+	return &cp, nil
+}
+
+// Save writes the checkpoint to the specified file, replacing any previous
+// checkpoint. The checkpoint is first written to a temporary file in the same
+// directory, so that an interrupted save cannot corrupt an earlier checkpoint.
+func (cp *Checkpoint) Save(path string) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Restore checks that the checkpoint is for the same object, unchanged, and
+// the same algorithms, and if so restores the state of each hash
+func (cp *Checkpoint) Restore(info *ObjectInfo, hashes map[string]hash.Hash) error {
+	if cp.URL != info.URL {
+		return fmt.Errorf("checkpoint is for %v, not %v", cp.URL, info.URL)
+	}
+	if cp.ETag != info.ETag || cp.ContentLength != info.ContentLength || !cp.LastModified.Equal(info.LastModified) {
+		return fmt.Errorf(
+			"%v has changed since checkpoint (ETag %v, length %d, last modified %v; now ETag %v, length %d, last modified %v)",
+			info.URL, cp.ETag, cp.ContentLength, cp.LastModified, info.ETag, info.ContentLength, info.LastModified,
+		)
+	}
+	if cp.Offset < 0 || cp.Offset > cp.ContentLength {
+		return fmt.Errorf("invalid checkpoint offset %d for content length %d", cp.Offset, cp.ContentLength)
+	}
+	if !sameKeys(cp.States, hashes) {
+		return fmt.Errorf("checkpoint is for algorithms %v, not %v", stateAlgorithms(cp.States), hashAlgorithms(hashes))
+	}
+	for algorithm, h := range hashes {
+		unmarshaler, ok := h.(encoding.BinaryUnmarshaler)
+		if !ok {
+			return fmt.Errorf("%v digest computation does not support checkpoints", algorithm)
+		}
+		if err := unmarshaler.UnmarshalBinary(cp.States[algorithm]); err != nil {
+			return fmt.Errorf("invalid checkpoint state for %v: %v", algorithm, err)
+		}
+	}
+	return nil
+}
+
+func (cp *Checkpoint) String() string {
+	return fmt.Sprintf(
+		"Checkpoint{ URL: %v, ETag: %v, ContentLength: %d, LastModified: %v, Offset: %d, Algorithms: %v }",
+		cp.URL, cp.ETag, cp.ContentLength, cp.LastModified, cp.Offset, stateAlgorithms(cp.States),
+	)
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+// checkpointWriter writes to the hashes, saving a checkpoint at the
+// specified interval
+type checkpointWriter struct {
+	path     string
+	interval time.Duration
+	info     *ObjectInfo
+	hashes   map[string]hash.Hash
+	out      io.Writer
+
+	offset    int64
+	lastSaved time.Time
+}
+
+func (w *checkpointWriter) Write(p []byte) (n int, err error) {
+	n, err = w.out.Write(p)
+	w.offset += int64(n)
+	if err == nil && time.Since(w.lastSaved) >= w.interval {
+		err = w.save()
+	}
+	return n, err
+}
+
+func (w *checkpointWriter) save() error {
+	cp, err := NewCheckpoint(w.info, w.offset, w.hashes)
+	if err != nil {
+		return err
+	}
+	err = cp.Save(w.path)
+	if err != nil {
+		return fmt.Errorf("error saving checkpoint to %v: %v", w.path, err)
+	}
+	w.lastSaved = time.Now()
+	logging.DefaultLogger().Tracef("checkpoint saved at byte %d of %v\n", w.offset, w.info.URL)
+	return nil
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+func sameKeys(states map[string][]byte, hashes map[string]hash.Hash) bool {
+	if len(states) != len(hashes) {
+		return false
+	}
+	for algorithm := range hashes {
+		if _, ok := states[algorithm]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func stateAlgorithms(states map[string][]byte) string {
+	var algorithms []string
+	for algorithm := range states {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	return strings.Join(algorithms, ", ")
+}
+
+func hashAlgorithms(hashes map[string]hash.Hash) string {
+	var algorithms []string
+	for algorithm := range hashes {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	return strings.Join(algorithms, ", ")
+}
@@ -0,0 +1,465 @@
+package pkg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// ContentRandom is pseudorandom bytes from AES-128 in counter mode, keyed
+	// by the specified seed
+	ContentRandom = "random"
+	// ContentZeros is all zero bytes
+	ContentZeros = "zeros"
+	// ContentPattern is a byte pattern, given in hex, repeated
+	ContentPattern = "pattern"
+	// ContentFile is the contents of a file, repeated
+	ContentFile = "file"
+	// ContentText is pseudorandom English-like text, with the specified seed
+	ContentText = "text"
+	// ContentCounter is pseudorandom bytes generated in counter mode from the
+	// specified seed, so that any range can be regenerated independently
+	ContentCounter = "counter"
+)
+
+// textWords are the words from which ContentText is generated
+var textWords = strings.Fields(`
+	the of and to in is was that for it with as his on be at by had are but
+	from or have an they which one you were all her she there would their we
+	him been has when who will no more if out so up said what its about than
+	into them can only other time new some could these two may first then do
+	any like my now over such our man me even most made after also did many
+	off before must well back through years much where your way down should
+	because each just those people how too little state good very make world
+	still see own men work long here get both between life being under never
+	day same another know while last might us great old year come since
+	against go came right used take three storage object bucket checksum
+`)
+
+// ------------------------------------------------------------
+// Content type
+
+// Content generates the body of an object created by Crvd. Some storage
+// services and gateways compress or deduplicate data, so the same size of
+// object may behave differently depending on its content.
+type Content interface {
+	// NewBody returns a reader for the specified number of bytes of the
+	// content, which are the same each time NewBody is called
+	NewBody(length int64) io.Reader
+	Pretty() string
+}
+
+// ------------------------------------------------------------
+// SeekableContent type
+
+// SeekableContent is Content any range of which can be generated
+// independently, so that an object can be verified a range at a time (see
+// VerifyGenerated). ReadAt fills p with the content starting at the
+// specified offset; content does not end, so ReadAt returns an error only if
+// the content cannot be generated.
+type SeekableContent interface {
+	Content
+	io.ReaderAt
+}
+
+// ParseContent parses a content specification: "random", "zeros",
+// "pattern:<hex>", "file:<path>", "text", or "counter". Random bytes, text,
+// and counter-mode bytes are generated with the specified seed; a file must
+// exist and be non-empty, and is repeated as needed to fill the object.
+func ParseContent(spec string, seed int64) (Content, error) {
+	kind, arg := spec, ""
+	hasArg := false
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, arg, hasArg = spec[:i], spec[i+1:], true
+	}
+	switch kind {
+	case ContentRandom, ContentZeros, ContentText, ContentCounter:
+		if hasArg {
+			return nil, fmt.Errorf("invalid content %#v: %v takes no value", spec, kind)
+		}
+		switch kind {
+		case ContentRandom:
+			return &RandomContent{Seed: seed}, nil
+		case ContentZeros:
+			return &ZerosContent{}, nil
+		case ContentCounter:
+			return &CounterContent{Seed: seed}, nil
+		}
+		return &TextContent{Seed: seed}, nil
+	case ContentPattern:
+		pattern, err := hex.DecodeString(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content %#v: pattern is not valid hex: %v", spec, err)
+		}
+		if len(pattern) == 0 {
+			return nil, fmt.Errorf("invalid content %#v: pattern is empty", spec)
+		}
+		return &PatternContent{Pattern: pattern}, nil
+	case ContentFile:
+		if arg == "" {
+			return nil, fmt.Errorf("invalid content %#v: no file specified", spec)
+		}
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content %#v: %v", spec, err)
+		}
+		if !info.Mode().IsRegular() || info.Size() == 0 {
+			return nil, fmt.Errorf("invalid content %#v: %v is not a non-empty regular file", spec, arg)
+		}
+		return &FileContent{Path: arg}, nil
+	}
+	return nil, fmt.Errorf(
+		"invalid content %#v: expected %#v, %#v, %#v, %#v, %#v, or %#v",
+		spec, ContentRandom, ContentZeros, ContentPattern+":<hex>", ContentFile+":<path>", ContentText, ContentCounter,
+	)
+}
+
+// ------------------------------------------------------------
+// RandomContent type
+
+// RandomContent generates pseudorandom bytes: the AES-128 keystream in counter
+// mode, keyed by the SHA-256 digest of the seed. Most CPUs generate it in
+// hardware several times faster than a 10 GbE link, so that the throughput
+// measured for large objects is that of the storage service rather than of
+// the generator. Any range can be generated independently.
+type RandomContent struct {
+	Seed int64
+}
+
+func (c *RandomContent) NewBody(length int64) io.Reader {
+	return io.LimitReader(&keystreamReader{stream: c.stream(0)}, length)
+}
+
+func (c *RandomContent) ReadAt(p []byte, offset int64) (int, error) {
+	r := keystreamReader{stream: c.stream(offset / aes.BlockSize)}
+	if skip := offset % aes.BlockSize; skip > 0 {
+		var block [aes.BlockSize]byte
+		_, _ = r.Read(block[:skip])
+	}
+	return r.Read(p)
+}
+
+func (c *RandomContent) Pretty() string {
+	return fmt.Sprintf("%v (seed %d)", ContentRandom, c.Seed)
+}
+
+func (c *RandomContent) String() string {
+	return c.Pretty()
+}
+
+// stream returns the keystream starting at the specified block
+func (c *RandomContent) stream(block int64) cipher.Stream {
+	var seed [8]byte
+	binary.BigEndian.PutUint64(seed[:], uint64(c.Seed))
+	key := sha256.Sum256(seed[:])
+	cipherBlock, err := aes.NewCipher(key[:16])
+	if err != nil {
+		// can't happen: key is a valid AES-128 key
+		panic(err)
+	}
+	var iv [aes.BlockSize]byte
+	binary.BigEndian.PutUint64(iv[8:], uint64(block))
+	return cipher.NewCTR(cipherBlock, iv[:])
+}
+
+// ------------------------------------------------------------
+// ZerosContent type
+
+// ZerosContent generates zero bytes
+type ZerosContent struct{}
+
+func (c *ZerosContent) NewBody(length int64) io.Reader {
+	return io.LimitReader(zeroReader{}, length)
+}
+
+func (c *ZerosContent) ReadAt(p []byte, offset int64) (int, error) {
+	return zeroReader{}.Read(p)
+}
+
+func (c *ZerosContent) Pretty() string {
+	return ContentZeros
+}
+
+func (c *ZerosContent) String() string {
+	return c.Pretty()
+}
+
+// ------------------------------------------------------------
+// PatternContent type
+
+// PatternContent repeats a byte pattern
+type PatternContent struct {
+	Pattern []byte
+}
+
+func (c *PatternContent) NewBody(length int64) io.Reader {
+	return io.LimitReader(&patternReader{pattern: c.Pattern}, length)
+}
+
+func (c *PatternContent) ReadAt(p []byte, offset int64) (int, error) {
+	r := patternReader{pattern: c.Pattern, offset: int(offset % int64(len(c.Pattern)))}
+	return r.Read(p)
+}
+
+func (c *PatternContent) Pretty() string {
+	return fmt.Sprintf("%v:%x", ContentPattern, c.Pattern)
+}
+
+func (c *PatternContent) String() string {
+	return c.Pretty()
+}
+
+// ------------------------------------------------------------
+// FileContent type
+
+// FileContent repeats the contents of a file. The file is opened when the
+// content is first read, and kept open, so that it is read consistently even
+// if it is replaced, until Close is called.
+type FileContent struct {
+	Path string
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+func (c *FileContent) NewBody(length int64) io.Reader {
+	return io.LimitReader(&seekableReader{content: c}, length)
+}
+
+// ReadAt reads the repeated file contents starting at the specified offset
+func (c *FileContent) ReadAt(p []byte, offset int64) (n int, err error) {
+	file, size, err := c.open()
+	if err != nil {
+		return 0, err
+	}
+	for n < len(p) {
+		read, err := file.ReadAt(p[n:], (offset+int64(n))%size)
+		n += read
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if read == 0 && err == io.EOF {
+			return n, fmt.Errorf("%v was truncated", c.Path)
+		}
+	}
+	return n, nil
+}
+
+// Close closes the file, if it is open. If the content is read again, the
+// file is reopened.
+func (c *FileContent) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+func (c *FileContent) Pretty() string {
+	return fmt.Sprintf("%v:%v", ContentFile, c.Path)
+}
+
+func (c *FileContent) String() string {
+	return c.Pretty()
+}
+
+// open returns the open file and its size, opening it if necessary
+func (c *FileContent) open() (*os.File, int64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.file == nil {
+		file, err := os.Open(c.Path)
+		if err != nil {
+			return nil, 0, err
+		}
+		info, err := file.Stat()
+		if err == nil && info.Size() == 0 {
+			err = fmt.Errorf("%v is empty", c.Path)
+		}
+		if err != nil {
+			_ = file.Close()
+			return nil, 0, err
+		}
+		c.file, c.size = file, info.Size()
+	}
+	return c.file, c.size, nil
+}
+
+// ------------------------------------------------------------
+// TextContent type
+
+// TextContent generates pseudorandom English-like text: lines of common
+// words, in random order, with the specified seed. Text compresses well, but
+// unlike zeros or a short pattern, it does not repeat.
+type TextContent struct {
+	Seed int64
+}
+
+func (c *TextContent) NewBody(length int64) io.Reader {
+	return io.LimitReader(&textReader{random: rand.New(rand.NewSource(c.Seed))}, length)
+}
+
+func (c *TextContent) Pretty() string {
+	return fmt.Sprintf("%v (seed %d)", ContentText, c.Seed)
+}
+
+func (c *TextContent) String() string {
+	return c.Pretty()
+}
+
+// ------------------------------------------------------------
+// CounterContent type
+
+// CounterContent generates pseudorandom bytes in counter mode: each 8-byte
+// word is the SplitMix64 mix of the seed and the word's index, so that any
+// range of the content can be generated without generating what precedes it.
+type CounterContent struct {
+	Seed int64
+}
+
+func (c *CounterContent) NewBody(length int64) io.Reader {
+	return io.LimitReader(&seekableReader{content: c}, length)
+}
+
+func (c *CounterContent) ReadAt(p []byte, offset int64) (int, error) {
+	seed := uint64(c.Seed)
+	index := uint64(offset / 8)
+	n := 0
+	var word [8]byte
+	if skip := int(offset % 8); skip > 0 {
+		binary.LittleEndian.PutUint64(word[:], counterWord(seed, index))
+		n = copy(p, word[skip:])
+		index++
+	}
+	for ; n+8 <= len(p); n, index = n+8, index+1 {
+		binary.LittleEndian.PutUint64(p[n:], counterWord(seed, index))
+	}
+	if n < len(p) {
+		binary.LittleEndian.PutUint64(word[:], counterWord(seed, index))
+		copy(p[n:], word[:])
+	}
+	return len(p), nil
+}
+
+func (c *CounterContent) Pretty() string {
+	return fmt.Sprintf("%v (seed %d)", ContentCounter, c.Seed)
+}
+
+func (c *CounterContent) String() string {
+	return c.Pretty()
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+// seekableReader reads SeekableContent sequentially
+type seekableReader struct {
+	content SeekableContent
+	offset  int64
+}
+
+func (r *seekableReader) Read(p []byte) (int, error) {
+	n, err := r.content.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	return n, err
+}
+
+// keystreamReader reads the keystream of a cipher.Stream
+type keystreamReader struct {
+	stream cipher.Stream
+}
+
+func (r *keystreamReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	r.stream.XORKeyStream(p, p)
+	return len(p), nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+type patternReader struct {
+	pattern []byte
+	offset  int
+}
+
+// Read copies the pattern once, starting at the current offset, then fills the
+// rest of p by repeatedly doubling what has been copied so far
+func (r *patternReader) Read(p []byte) (int, error) {
+	period := len(r.pattern)
+	n := copy(p, r.pattern[r.offset:])
+	n += copy(p[n:], r.pattern[:r.offset])
+	for n < len(p) {
+		n += copy(p[n:], p[:n])
+	}
+	r.offset = (r.offset + len(p)) % period
+	return len(p), nil
+}
+
+type textReader struct {
+	random  *rand.Rand
+	pending []byte
+	line    []byte
+}
+
+// Read returns text a line at a time, generating each line as needed
+func (r *textReader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if len(r.pending) == 0 {
+			r.pending = r.nextLine()
+		}
+		copied := copy(p[n:], r.pending)
+		n += copied
+		r.pending = r.pending[copied:]
+	}
+	return n, nil
+}
+
+// nextLine returns a capitalized line of 8 to 15 words, ending with a period,
+// reusing the buffer of the previous line
+func (r *textReader) nextLine() []byte {
+	count := 8 + r.random.Intn(8)
+	line := r.line[:0]
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			line = append(line, ' ')
+		}
+		line = append(line, textWords[r.random.Intn(len(textWords))]...)
+	}
+	line[0] -= 'a' - 'A' // words are all lowercase ASCII
+	r.line = append(line, '.', '\n')
+	return r.line
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// counterWord returns the SplitMix64 output for the specified seed and
+// counter
+func counterWord(seed, counter uint64) uint64 {
+	z := seed + (counter+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
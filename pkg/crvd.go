@@ -1,10 +1,10 @@
 package pkg
 
 import (
+	"crypto/md5"
 	"crypto/sha256"
 	"fmt"
 	"io"
-	"math/rand"
 	"time"
 
 	. "github.com/dmolesUC3/cos/internal/objects"
@@ -22,6 +22,28 @@ type Crvd struct {
 	ContentLength int64
 	RandomSeed    int64
 	BodyProvider  func() io.Reader
+
+	// Content generates the body, if BodyProvider is not set; if nil,
+	// RandomContent with RandomSeed is used
+	Content Content
+
+	// SendChecksum causes the MD5 and SHA-256 digests of the body to be
+	// calculated before the upload and sent with it (see WithChecksums), so
+	// that the server rejects a corrupted upload
+	SendChecksum bool
+
+	// Samples, if greater than 0, causes the object to be verified by
+	// comparing that many ranges of SampleSize bytes with the expected
+	// content (see VerifyGenerated), instead of by downloading it in full;
+	// the content must be SeekableContent
+	Samples    int
+	SampleSize int64
+
+	// Upload describes how the object was uploaded, if the object reports it
+	// (see UploadReporter)
+	Upload *UploadInfo
+	// Verified describes the ranges verified, if Samples was set
+	Verified *VerifyGeneratedResult
 }
 
 func NewDefaultCrvd(target Target, key string) *Crvd {
@@ -56,6 +78,13 @@ func (c *Crvd) CreateRetrieveVerify() error {
 
 	logger := logging.DefaultLogger()
 	logger.Tracef("Creating object (%v) at %v\n", logging.FormatBytes(contentLength), obj)
+	if c.Content != nil {
+		logger.Tracef("Content: %v\n", c.Content)
+	}
+	seekable, isSeekable := c.seekableContent()
+	if c.Samples > 0 && !isSeekable {
+		return fmt.Errorf("verifying sample ranges requires content that can be regenerated by range (any but text), not %v", c.content())
+	}
 	expectedDigest, err := c.create()
 	if err != nil {
 		return err
@@ -73,11 +102,31 @@ func (c *Crvd) CreateRetrieveVerify() error {
 		return fmt.Errorf("content-length mismatch: expected: %d, actual: %d", contentLength, actualLength)
 	}
 	logger.Tracef("Uploaded %d bytes\n", contentLength)
+	if c.Samples > 0 {
+		c.Verified, err = c.verifyGenerated(seekable)
+		if err == nil {
+			logger.Tracef("Verified %v of %v\n", c.Verified, obj)
+		}
+		return err
+	}
 	logger.Detailf("Verifying %v (expected digest: %x)\n", obj, expectedDigest)
-	check := Check{Object: obj, Expected: expectedDigest, Algorithm: "sha256"}
-	actualDigest, err := check.VerifyDigest()
+	check := Check{
+		Object:     obj,
+		Algorithms: []string{"sha256"},
+		Expected:   map[string][]byte{"sha256": expectedDigest},
+	}
+	// compare generated content with the download as it is hashed, so that
+	// if the digest does not match, the first corrupted byte is known
+	var generated *generatedWriter
+	if isSeekable {
+		generated = &generatedWriter{object: obj, content: seekable, record: true}
+		check.out = generated
+	}
+	actualDigests, err := check.VerifyDigests()
 	if err == nil {
-		logger.Tracef("Verified %v (%d bytes, SHA-256 digest %x)\n", obj, contentLength, actualDigest)
+		logger.Tracef("Verified %v (%d bytes, SHA-256 digest %x)\n", obj, contentLength, actualDigests["sha256"])
+	} else if generated != nil && generated.err != nil {
+		err = fmt.Errorf("%v\n%v", err, generated.err)
 	}
 	return err
 }
@@ -86,25 +135,131 @@ func (c *Crvd) NewBody() io.Reader {
 	if c.BodyProvider != nil {
 		return c.BodyProvider()
 	}
-	random := rand.New(rand.NewSource(c.RandomSeed))
-	return io.LimitReader(random, c.ContentLength)
+	return c.content().NewBody(c.ContentLength)
+}
+
+func (c *Crvd) content() Content {
+	if c.Content != nil {
+		return c.Content
+	}
+	return &RandomContent{Seed: c.RandomSeed}
+}
+
+// seekableContent returns the content, if the body is generated from
+// SeekableContent
+func (c *Crvd) seekableContent() (SeekableContent, bool) {
+	if c.BodyProvider != nil {
+		return nil, false
+	}
+	seekable, ok := c.content().(SeekableContent)
+	return seekable, ok
+}
+
+// verifyGenerated verifies the object against the expected content, in full
+// or, if Samples is set, in sample ranges
+func (c *Crvd) verifyGenerated(content SeekableContent) (*VerifyGeneratedResult, error) {
+	v := VerifyGenerated{
+		Object:     c.Object,
+		Content:    content,
+		Length:     c.ContentLength,
+		Samples:    c.Samples,
+		SampleSize: c.SampleSize,
+	}
+	return v.Verify()
 }
 
 func (c *Crvd) create() ([] byte, error) {
 	obj := c.Object
 	logger := logging.DefaultLogger()
 
-	digest := sha256.New()
-	tr := io.TeeReader(c.NewBody(), digest)
+	var options []CreateOption
+	if c.SendChecksum {
+		md5Digest, sha256Digest, err := c.bodyDigests()
+		if err != nil {
+			return nil, err
+		}
+		logger.Tracef("Sending checksums with upload: MD5 %x, SHA-256 %x\n", md5Digest, sha256Digest)
+		options = append(options, WithChecksums(md5Digest, sha256Digest))
+	}
 
+	digest := sha256.New()
 	contentLength := c.ContentLength
-	in := logging.NewProgressReader(tr, contentLength)
-	in.LogTo(logger, 2 * time.Second)
+	progress := logging.NewProgressWriter(digest, contentLength)
+	progress.LogTo(logger, 2 * time.Second)
+
+	// generated content can be rewound, so that the upload can be retried
+	// (see RetryingObject); other bodies are read once
+	var in io.Reader
+	seekable, isSeekable := c.seekableContent()
+	if isSeekable {
+		in = &rewindableBody{section: io.NewSectionReader(seekable, 0, contentLength), out: progress}
+	} else {
+		in = io.TeeReader(c.NewBody(), progress)
+	}
 
-	err := obj.Create(in, contentLength)
+	err := obj.Create(in, contentLength, options...)
 	if err != nil {
 		return nil, err
 	}
-	logger.Detailf("%v to %v\n", logging.FormatBytes(in.TotalBytes()), obj)
+	logger.Detailf("%v to %v\n", logging.FormatBytes(progress.TotalBytes()), obj)
+	if body, ok := in.(*rewindableBody); ok {
+		// in case the upload skipped any of the body
+		if err = body.finish(); err != nil {
+			return nil, err
+		}
+	}
+	c.Upload = LastUpload(obj)
 	return digest.Sum(nil), err
 }
+
+// bodyDigests calculates the MD5 and SHA-256 digests of a new body
+func (c *Crvd) bodyDigests() (md5Digest, sha256Digest []byte, err error) {
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	if _, err = io.Copy(io.MultiWriter(md5Hash, sha256Hash), c.NewBody()); err != nil {
+		return nil, nil, err
+	}
+	return md5Hash.Sum(nil), sha256Hash.Sum(nil), nil
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+// rewindableBody reads a section of SeekableContent, writing each byte to out
+// the first time it is read, so that reading again after seeking back (as
+// when an upload is retried) does not write any byte twice
+type rewindableBody struct {
+	section *io.SectionReader
+	out     io.Writer
+	// written is the number of bytes from the start of the section written to out
+	written int64
+}
+
+func (b *rewindableBody) Read(p []byte) (int, error) {
+	start, err := b.section.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	n, err := b.section.Read(p)
+	if end := start + int64(n); start <= b.written && end > b.written {
+		if _, writeErr := b.out.Write(p[b.written-start : n]); writeErr != nil {
+			return n, writeErr
+		}
+		b.written = end
+	}
+	return n, err
+}
+
+func (b *rewindableBody) Seek(offset int64, whence int) (int64, error) {
+	return b.section.Seek(offset, whence)
+}
+
+// finish writes any bytes not yet written to out
+func (b *rewindableBody) finish() error {
+	remaining := b.section.Size() - b.written
+	if remaining <= 0 {
+		return nil
+	}
+	_, err := io.Copy(b.out, io.NewSectionReader(b.section, b.written, remaining))
+	b.written += remaining
+	return err
+}
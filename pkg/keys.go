@@ -70,14 +70,20 @@ func (k *Keys) Check(key string) (err error) {
 	return crvd.CreateRetrieveVerifyDelete()
 }
 
+// FormatKey formats a key for output: as-is if raw is true, or otherwise as
+// a quoted Go string literal, so that keys containing whitespace, control
+// characters or invalid UTF-8 display unambiguously
+func FormatKey(key string, raw bool) string {
+	if raw {
+		return key
+	}
+	return fmt.Sprintf("%#v", key)
+}
+
 func writeKey(w io.Writer, key string, raw bool) (err error) {
 	if w == nil {
 		return
 	}
-	if raw {
-		_, err = fmt.Fprintln(w, key)
-	} else {
-		_, err = fmt.Fprintf(w, "%#v\n", key)
-	}
+	_, err = fmt.Fprintln(w, FormatKey(key, raw))
 	return
 }
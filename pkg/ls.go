@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+)
+
+const (
+	lsTimeFormat = "2006-01-02 15:04:05"
+	lsLongFormat = "%-19v %12v  %-34v  %v\n"
+)
+
+// The Ls struct represents a listing operation
+type Ls struct {
+	Target    Target
+	Prefix    string
+	Delimiter string
+	Long      bool
+	Quoted    bool
+}
+
+// List writes the keys (and, if Long is true, the last-modified time, size
+// and ETag) of the objects and common prefixes under the prefix to the
+// specified io.Writer, returning the number of entries written.
+func (l Ls) List(out io.Writer) (count int, err error) {
+	err = l.Target.List(l.Prefix, l.Delimiter, func(summary ObjectSummary) error {
+		_, err := io.WriteString(out, l.format(summary))
+		if err == nil {
+			count++
+		}
+		return err
+	})
+	return count, err
+}
+
+func (l Ls) format(summary ObjectSummary) string {
+	key := FormatKey(summary.Key, !l.Quoted)
+	if !l.Long {
+		return key + "\n"
+	}
+	if summary.IsPrefix {
+		return fmt.Sprintf(lsLongFormat, "", "PRE", "", key)
+	}
+	lastModified := ""
+	if !summary.LastModified.IsZero() {
+		lastModified = summary.LastModified.UTC().Format(lsTimeFormat)
+	}
+	return fmt.Sprintf(lsLongFormat, lastModified, summary.Size, summary.ETag, key)
+}
@@ -0,0 +1,195 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	. "github.com/dmolesUC3/cos/internal/objects"
+)
+
+const (
+	// ManifestChecksum indicates a manifest in the format written by sha256sum,
+	// md5sum, etc.: one "<HEX>  <PATH>" (or "<HEX> *<PATH>") line per file
+	ManifestChecksum = "checksum"
+	// ManifestBagIt indicates a BagIt payload or tag manifest: one
+	// "<HEX> <PATH>" line per file, with paths percent-encoded
+	ManifestBagIt = "bagit"
+)
+
+var bagItManifestRegexp = regexp.MustCompile("^(?:tag)?manifest-([a-z0-9]+)\\.txt$")
+
+// manifestAlgorithmsByLength are the algorithms assumed for manifests whose
+// algorithm is neither specified nor given by the file name, by hex digest length
+var manifestAlgorithmsByLength = map[int]string{
+	8:   "crc32c",
+	32:  "md5",
+	40:  "sha1",
+	64:  "sha256",
+	128: "sha512",
+}
+
+// ------------------------------------------------------------
+// ManifestEntry type
+
+// ManifestEntry is a single digest and path from a manifest
+type ManifestEntry struct {
+	Path   string
+	Digest []byte
+	// Line is the line number of the entry in the manifest (starting with 1)
+	Line int
+}
+
+// ------------------------------------------------------------
+// Manifest type
+
+// Manifest is a list of files and their digests
+type Manifest struct {
+	Algorithm string
+	Format    string
+	Entries   []ManifestEntry
+}
+
+// ReadManifestFile reads a manifest from the specified file. Files named
+// manifest-<ALGORITHM>.txt or tagmanifest-<ALGORITHM>.txt are read as BagIt
+// manifests with the named algorithm; any other file is read as
+// sha256sum-style checksum manifest. If algorithm is not empty, it overrides
+// the algorithm given by the file name, if any; otherwise, if the name does
+// not give the algorithm, it is inferred from the length of the digests.
+func ReadManifestFile(path string, algorithm string) (*Manifest, error) {
+	format := ManifestChecksum
+	if m := bagItManifestRegexp.FindStringSubmatch(filepath.Base(path)); m != nil {
+		format = ManifestBagIt
+		if algorithm == "" {
+			algorithm = m[1]
+		}
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logging.DefaultLogger().Infof("error closing file %v: %v", path, err.Error())
+		}
+	}()
+	manifest, err := ReadManifest(file, format, algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest %v: %v", path, err)
+	}
+	return manifest, nil
+}
+
+// ReadManifest reads a manifest in the specified format (ManifestChecksum or
+// ManifestBagIt). If algorithm is empty, it is inferred from the length of the
+// digests; otherwise, each digest must be of the length that algorithm
+// produces.
+func ReadManifest(r io.Reader, format string, algorithm string) (*Manifest, error) {
+	var parseLine func(line string) (hexDigest, path string, err error)
+	switch format {
+	case ManifestChecksum:
+		parseLine = parseChecksumLine
+	case ManifestBagIt:
+		parseLine = parseBagItLine
+	default:
+		return nil, fmt.Errorf("unsupported manifest format: %#v", format)
+	}
+
+	manifest := &Manifest{Algorithm: algorithm, Format: format}
+	digestLen := 0
+	if algorithm != "" {
+		h, err := NewHash(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		digestLen = 2 * h.Size()
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, bufio.MaxScanTokenSize), 1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		hexDigest, path, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		digest, err := hex.DecodeString(hexDigest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid digest %#v: %v", lineNum, hexDigest, err)
+		}
+		if digestLen == 0 {
+			digestLen = len(hexDigest)
+		} else if len(hexDigest) != digestLen {
+			if algorithm != "" {
+				return nil, fmt.Errorf("line %d: expected %d-digit %v digest, got %#v", lineNum, digestLen, algorithm, hexDigest)
+			}
+			return nil, fmt.Errorf("line %d: expected %d-digit digest, got %#v", lineNum, digestLen, hexDigest)
+		}
+		manifest.Entries = append(manifest.Entries, ManifestEntry{Path: path, Digest: digest, Line: lineNum})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(manifest.Entries) == 0 {
+		return nil, fmt.Errorf("no entries found")
+	}
+	if manifest.Algorithm == "" {
+		manifest.Algorithm = manifestAlgorithmsByLength[digestLen]
+		if manifest.Algorithm == "" {
+			return nil, fmt.Errorf("unable to infer algorithm from %d-digit digests; try specifying the algorithm", digestLen)
+		}
+	}
+	return manifest, nil
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// parseChecksumLine parses a line as written by sha256sum etc.: the digest,
+// a space, a space or asterisk (indicating text or binary mode), and the
+// path. A line starting with a backslash has a path with backslashes and
+// newlines escaped as "\\" and "\n".
+func parseChecksumLine(line string) (hexDigest, path string, err error) {
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+	i := strings.Index(line, " ")
+	if i < 0 || len(line) < i+3 || (line[i+1] != ' ' && line[i+1] != '*') {
+		return "", "", fmt.Errorf("expected <DIGEST>  <PATH>, got %#v", line)
+	}
+	hexDigest, path = line[:i], line[i+2:]
+	if escaped {
+		path = strings.NewReplacer("\\\\", "\\", "\\n", "\n", "\\r", "\r").Replace(path)
+	}
+	return hexDigest, strings.TrimPrefix(path, "./"), nil
+}
+
+// parseBagItLine parses a BagIt manifest line: the digest, one or more
+// whitespace characters, and the path, in which CR, LF, and % are
+// percent-encoded (RFC 8493, section 2.1.3).
+func parseBagItLine(line string) (hexDigest, path string, err error) {
+	i := strings.IndexAny(line, " \t")
+	if i < 0 {
+		return "", "", fmt.Errorf("expected <DIGEST> <PATH>, got %#v", line)
+	}
+	hexDigest = line[:i]
+	path = strings.TrimLeft(line[i:], " \t")
+	if path == "" {
+		return "", "", fmt.Errorf("expected <DIGEST> <PATH>, got %#v", line)
+	}
+	path, err = url.PathUnescape(path)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid path %#v: %v", line[i:], err)
+	}
+	return hexDigest, path, nil
+}
@@ -0,0 +1,216 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	. "github.com/dmolesUC3/cos/internal/objects"
+)
+
+const (
+	// DefaultManifestWorkers is the default number of objects a ManifestCheck
+	// verifies at once
+	DefaultManifestWorkers = 4
+
+	// ManifestPass indicates an object whose digest matches the manifest
+	ManifestPass = "pass"
+	// ManifestFail indicates an object whose digest does not match the manifest
+	ManifestFail = "fail"
+	// ManifestMissing indicates an object listed in the manifest but not found
+	ManifestMissing = "missing"
+	// ManifestError indicates an object that could not be retrieved
+	ManifestError = "error"
+)
+
+// ------------------------------------------------------------
+// ManifestResult type
+
+// ManifestResult is the result of verifying a single manifest entry
+type ManifestResult struct {
+	Entry  ManifestEntry
+	Key    string
+	Status string
+	// Actual is the calculated digest, if the object could be retrieved
+	Actual []byte
+	Err    error
+}
+
+func (r ManifestResult) String() string {
+	return fmt.Sprintf("ManifestResult{ Key: %#v, Status: %v, Actual: %x, Err: %v }", r.Key, r.Status, r.Actual, r.Err)
+}
+
+// ------------------------------------------------------------
+// ManifestSummary type
+
+// ManifestSummary counts the results of a ManifestCheck by status
+type ManifestSummary struct {
+	Passed  int
+	Failed  int
+	Missing int
+	Errors  int
+}
+
+// OK returns true if every object in the manifest passed
+func (s ManifestSummary) OK() bool {
+	return s.Failed == 0 && s.Missing == 0 && s.Errors == 0
+}
+
+// Total returns the total number of objects checked
+func (s ManifestSummary) Total() int {
+	return s.Passed + s.Failed + s.Missing + s.Errors
+}
+
+func (s ManifestSummary) String() string {
+	return fmt.Sprintf(
+		"%d objects: %d passed, %d failed, %d missing, %d errors",
+		s.Total(), s.Passed, s.Failed, s.Missing, s.Errors,
+	)
+}
+
+func (s *ManifestSummary) add(result ManifestResult) {
+	switch result.Status {
+	case ManifestPass:
+		s.Passed++
+	case ManifestFail:
+		s.Failed++
+	case ManifestMissing:
+		s.Missing++
+	default:
+		s.Errors++
+	}
+}
+
+// ------------------------------------------------------------
+// ManifestCheck type
+
+// The ManifestCheck struct represents a fixity check of all the objects
+// listed in a manifest, with paths relative to a prefix in the target
+type ManifestCheck struct {
+	Target   Target
+	Prefix   string
+	Manifest *Manifest
+
+	// Workers is the number of objects to verify at once
+	Workers int
+	// Concurrency is the number of ranges of each object to download at once
+	Concurrency int
+	// Stream, if true, streams each object with a single request (see Check)
+	Stream bool
+}
+
+// Run verifies each object in the manifest, calling the specified function
+// with the result for each object, in manifest order. Objects that do not
+// exist are reported as missing without being downloaded. Run returns an
+// error only if the manifest algorithm is unsupported; failures of
+// individual objects are reported in the results and counted in the summary.
+func (m ManifestCheck) Run(fn func(result ManifestResult)) (ManifestSummary, error) {
+	summary := ManifestSummary{}
+	if _, err := NewHash(m.Manifest.Algorithm); err != nil {
+		return summary, err
+	}
+
+	entries := m.Manifest.Entries
+	verifyInOrder(len(entries), m.Workers, func(index int) ManifestResult {
+		return m.verify(entries[index])
+	}, func(result ManifestResult) {
+		summary.add(result)
+		fn(result)
+	})
+	return summary, nil
+}
+
+func (m ManifestCheck) verify(entry ManifestEntry) ManifestResult {
+	key := m.Prefix + entry.Path
+	obj := m.Target.Object(key)
+	if _, err := obj.ContentLength(); err != nil {
+		if IsNotFound(err) {
+			logging.DefaultLogger().Detailf("%v not found: %v\n", obj.Pretty(), err)
+			return ManifestResult{Entry: entry, Key: key, Status: ManifestMissing}
+		}
+		return ManifestResult{Entry: entry, Key: key, Status: ManifestError, Err: err}
+	}
+	expected := map[string][]byte{m.Manifest.Algorithm: entry.Digest}
+	return verifyObject(obj, entry, key, m.Manifest.Algorithm, expected, m.Concurrency, m.Stream)
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// verifyObject verifies the object against the expected digests, returning a
+// result with the actual digest for the specified algorithm
+func verifyObject(obj Object, entry ManifestEntry, key string, algorithm string, expected map[string][]byte, concurrency int, stream bool) ManifestResult {
+	result := ManifestResult{Entry: entry, Key: key}
+	var algorithms []string
+	for alg := range expected {
+		algorithms = append(algorithms, alg)
+	}
+	sort.Strings(algorithms)
+	check := Check{
+		Object:      obj,
+		Algorithms:  algorithms,
+		Expected:    expected,
+		Concurrency: concurrency,
+		Stream:      stream,
+	}
+	checkResult, err := check.Verify()
+	result.Err = err
+	if checkResult == nil {
+		result.Status = ManifestError
+		return result
+	}
+	result.Actual = checkResult.Digests[algorithm]
+	if err != nil {
+		result.Status = ManifestFail
+	} else {
+		result.Status = ManifestPass
+	}
+	return result
+}
+
+// verifyInOrder calls verify for each index from 0 to count-1, with up to
+// the specified number of workers (or DefaultManifestWorkers) at once, and
+// calls report with each result in index order, as they become available
+func verifyInOrder(count int, workers int, verify func(index int) ManifestResult, report func(result ManifestResult)) {
+	if workers <= 0 {
+		workers = DefaultManifestWorkers
+	}
+	jobs := make(chan int)
+	results := make(chan indexedManifestResult)
+	go func() {
+		defer close(jobs)
+		for index := 0; index < count; index++ {
+			jobs <- index
+		}
+	}()
+	for i := 0; i < workers; i++ {
+		go func() {
+			for index := range jobs {
+				results <- indexedManifestResult{index: index, result: verify(index)}
+			}
+		}()
+	}
+
+	pending := map[int]ManifestResult{}
+	for next := 0; next < count; {
+		r := <-results
+		pending[r.index] = r.result
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			report(result)
+			next++
+		}
+	}
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+type indexedManifestResult struct {
+	index  int
+	result ManifestResult
+}
@@ -0,0 +1,31 @@
+package pkg
+
+import (
+	"encoding/json"
+	"io"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+)
+
+// The Stat struct represents an object properties lookup
+type Stat struct {
+	Object Object
+	JSON   bool
+}
+
+// Write writes the object's properties to the specified io.Writer, as
+// "Name: value" lines or, if JSON is true, as an indented JSON object.
+func (s Stat) Write(out io.Writer) (*ObjectInfo, error) {
+	info, err := s.Object.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if s.JSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return info, encoder.Encode(info)
+	}
+	_, err = io.WriteString(out, info.Pretty())
+	return info, err
+}
@@ -0,0 +1,238 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	. "github.com/dmolesUC3/cos/internal/objects"
+	. "github.com/dmolesUC3/cos/internal/streaming"
+)
+
+// ------------------------------------------------------------
+// VerifyGenerated type
+
+// VerifyGenerated verifies an object against the content expected from a
+// SeekableContent generator, either in full or in a number of sample ranges,
+// reporting the offset of the first corrupted byte found
+type VerifyGenerated struct {
+	Object  Object
+	Content SeekableContent
+	// Length is the expected length of the object; if 0, the object's
+	// actual length is used
+	Length int64
+	// Samples is the number of ranges to verify; if 0, the whole object is
+	// verified. The first range is always included, the last range is
+	// included if there is more than one sample, and the rest are chosen at
+	// random.
+	Samples int
+	// SampleSize is the size of each sample range; if 0, DefaultRangeSize is
+	// used
+	SampleSize int64
+	// Concurrency is the number of ranges downloaded at once when verifying
+	// the whole object; if 0, DefaultDownloadConcurrency is used
+	Concurrency int
+	// Random chooses the sample ranges; if nil, a source seeded with the
+	// current time is used
+	Random *rand.Rand
+}
+
+// VerifyGeneratedResult describes what was verified
+type VerifyGeneratedResult struct {
+	// Length is the length of the object
+	Length int64
+	// Ranges is the number of ranges verified
+	Ranges int
+	// Bytes is the number of bytes verified
+	Bytes int64
+}
+
+func (r *VerifyGeneratedResult) Pretty() string {
+	if r.Bytes == r.Length {
+		return fmt.Sprintf("all %v (%d bytes)", logging.FormatBytes(r.Length), r.Length)
+	}
+	noun := "ranges"
+	if r.Ranges == 1 {
+		noun = "range"
+	}
+	return fmt.Sprintf(
+		"%d sample %v (%v of %v)",
+		r.Ranges, noun, logging.FormatBytes(r.Bytes), logging.FormatBytes(r.Length),
+	)
+}
+
+func (r *VerifyGeneratedResult) String() string {
+	return r.Pretty()
+}
+
+// Verify verifies the object, returning a *CorruptionError if any byte
+// verified does not match the expected content
+func (v *VerifyGenerated) Verify() (*VerifyGeneratedResult, error) {
+	length, err := v.Object.ContentLength()
+	if err != nil {
+		return nil, err
+	}
+	if v.Length > 0 && length != v.Length {
+		return nil, fmt.Errorf("content-length mismatch for %v: expected: %d, actual: %d", v.Object, v.Length, length)
+	}
+	result := &VerifyGeneratedResult{Length: length}
+	if v.Samples <= 0 {
+		downloader := NewDownloader(v.sampleSize(), v.concurrency())
+		out := &generatedWriter{object: v.Object, content: v.Content}
+		result.Bytes, err = downloader.Download(v.Object, out)
+		result.Ranges = out.writes
+		return result, err
+	}
+
+	logger := logging.DefaultLogger()
+	buffer := make([]byte, v.sampleSize())
+	expected := make([]byte, v.sampleSize())
+	for _, start := range v.sampleOffsets(length) {
+		end := start + v.sampleSize() - 1
+		if end >= length {
+			end = length - 1
+		}
+		actual := buffer[:end+1-start]
+		logger.Tracef("Verifying bytes %d-%d of %v\n", start, end, v.Object)
+		n, err := v.Object.DownloadRange(start, end, actual)
+		if err == nil && n != int64(len(actual)) {
+			err = &ShortReadError{Expected: int64(len(actual)), Actual: n}
+		}
+		if err != nil {
+			return result, fmt.Errorf("error downloading bytes %d-%d of %v: %v", start, end, v.Object, err)
+		}
+		if err = verifyGenerated(v.Object, v.Content, start, actual, expected[:len(actual)]); err != nil {
+			return result, err
+		}
+		result.Ranges++
+		result.Bytes += int64(len(actual))
+	}
+	return result, nil
+}
+
+// ------------------------------
+// Unexported methods
+
+func (v *VerifyGenerated) sampleSize() int64 {
+	if v.SampleSize > 0 {
+		return v.SampleSize
+	}
+	return DefaultRangeSize
+}
+
+func (v *VerifyGenerated) concurrency() int {
+	if v.Concurrency > 0 {
+		return v.Concurrency
+	}
+	return DefaultDownloadConcurrency
+}
+
+// sampleOffsets returns the start offsets of the sample ranges, in order:
+// the first range, the last range unless there is only one sample, and the
+// rest chosen at random, aligned to the sample size so that they do not
+// overlap. If the object has no more ranges than the number of samples,
+// every range is returned.
+func (v *VerifyGenerated) sampleOffsets(length int64) []int64 {
+	size := v.sampleSize()
+	ranges := (length + size - 1) / size
+	if int64(v.Samples) >= ranges {
+		offsets := make([]int64, ranges)
+		for i := range offsets {
+			offsets[i] = int64(i) * size
+		}
+		return offsets
+	}
+	random := v.Random
+	if random == nil {
+		random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	chosen := map[int64]bool{0: true}
+	if v.Samples > 1 {
+		chosen[ranges-1] = true
+	}
+	for len(chosen) < v.Samples {
+		chosen[random.Int63n(ranges)] = true
+	}
+	var offsets []int64
+	for index := range chosen {
+		offsets = append(offsets, index*size)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets
+}
+
+// ------------------------------------------------------------
+// CorruptionError type
+
+// CorruptionError reports the first byte of an object found not to match the
+// expected content
+type CorruptionError struct {
+	Object   string
+	Offset   int64
+	Expected byte
+	Actual   byte
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf(
+		"first corrupted byte of %v at offset %d: expected 0x%02x, got 0x%02x",
+		e.Object, e.Offset, e.Expected, e.Actual,
+	)
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+// generatedWriter compares the bytes written to it, in order from the start
+// of the object, with the expected content. Write fails at the first
+// corrupted byte, unless record is set, in which case the error is kept in
+// err and later bytes are accepted without comparison.
+type generatedWriter struct {
+	object   Object
+	content  SeekableContent
+	offset   int64
+	writes   int
+	expected []byte
+	record   bool
+	err      error
+}
+
+func (w *generatedWriter) Write(p []byte) (int, error) {
+	if w.err == nil {
+		if cap(w.expected) < len(p) {
+			w.expected = make([]byte, len(p))
+		}
+		if err := verifyGenerated(w.object, w.content, w.offset, p, w.expected[:len(p)]); err != nil {
+			if !w.record {
+				return 0, err
+			}
+			w.err = err
+		}
+	}
+	w.offset += int64(len(p))
+	w.writes++
+	return len(p), nil
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// verifyGenerated compares the actual bytes at the specified offset with the
+// expected content, generated into the specified buffer
+func verifyGenerated(obj Object, content SeekableContent, offset int64, actual, expected []byte) error {
+	if _, err := content.ReadAt(expected, offset); err != nil {
+		return fmt.Errorf("unable to generate expected content at offset %d: %v", offset, err)
+	}
+	if bytes.Equal(actual, expected) {
+		return nil
+	}
+	for i := range actual {
+		if actual[i] != expected[i] {
+			return &CorruptionError{Object: obj.Pretty(), Offset: offset + int64(i), Expected: expected[i], Actual: actual[i]}
+		}
+	}
+	return nil
+}